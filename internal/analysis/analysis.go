@@ -0,0 +1,257 @@
+// Package analysis scores feedbacks with a lexicon-based sentiment model and
+// extracts their most frequent keywords and bigrams. Everything runs offline
+// from the embedded lexicons, no external service is ever called
+package analysis
+
+import (
+	"bufio"
+	"embed"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Positive = "positive"
+	Neutral  = "neutral"
+	Negative = "negative"
+	// negationWindow is the number of words following a negation whose score is inverted
+	negationWindow = 3
+)
+
+var (
+	//go:embed lexicons/*
+	embeddedLexicons embed.FS
+	// Languages lists the languages having both a sentiment lexicon and a stop-word list
+	Languages = []string{"en", "fr"}
+
+	sentimentLexicons = make(map[string]map[string]int)
+	stopWords         = make(map[string]map[string]bool)
+	negations         = map[string]bool{
+		"not": true, "no": true, "never": true, "nothing": true, "don't": true, "didn't": true,
+		"doesn't": true, "isn't": true, "wasn't": true, "can't": true, "won't": true,
+		"pas": true, "jamais": true, "rien": true, "ne": true, "n'": true,
+	}
+	// elisions are the French prefixes stripped from words (l'équipe, n'était...)
+	elisions = []string{"l'", "d'", "j'", "n'", "qu'", "c'", "s'", "m'", "t'"}
+)
+
+// LineSentiment is the sentiment of one feedback
+type LineSentiment struct {
+	Text     string `json:"text"`
+	Language string `json:"language"`
+	Score    int    `json:"score"`
+	Label    string `json:"label"`
+}
+
+// Term is a keyword or a bigram with its number of occurrences
+type Term struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// Report sums up the analysis of a set of feedbacks
+type Report struct {
+	Lines    []LineSentiment `json:"lines"`
+	Positive int             `json:"positive"`
+	Neutral  int             `json:"neutral"`
+	Negative int             `json:"negative"`
+	// AverageScore is the mean score of the feedbacks
+	AverageScore float64 `json:"average_score"`
+	Keywords     []Term  `json:"keywords"`
+	Bigrams      []Term  `json:"bigrams"`
+}
+
+func init() {
+	for _, lang := range Languages {
+		sentimentLexicons[lang] = make(map[string]int)
+		for _, line := range readLexicon(lang + ".sentiment.txt") {
+			word, score, found := strings.Cut(line, "\t")
+			value, err := strconv.Atoi(strings.TrimSpace(score))
+			if !found || err != nil {
+				log.Error().Msgf("invalid line in %s sentiment lexicon: %q", lang, line)
+				continue
+			}
+			sentimentLexicons[lang][strings.ToLower(strings.TrimSpace(word))] = value
+		}
+
+		stopWords[lang] = make(map[string]bool)
+		for _, word := range readLexicon(lang + ".stopwords.txt") {
+			stopWords[lang][strings.ToLower(word)] = true
+		}
+	}
+}
+
+func readLexicon(name string) (lines []string) {
+	file, err := embeddedLexicons.Open("lexicons/" + name)
+	if err != nil {
+		log.Error().Msgf("couldn't open lexicon %s: %s", name, err.Error())
+		return nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+// Tokenize lowercases the text and splits it into words, keeping apostrophes
+// inside words (don't) and splitting French elisions (n'était gives n' était)
+func Tokenize(text string) (tokens []string) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\'' && r != '’'
+	})
+	for _, word := range words {
+		word = strings.Trim(strings.ReplaceAll(word, "’", "'"), "'")
+		if word == "" {
+			continue
+		}
+		for _, elision := range elisions {
+			if strings.HasPrefix(word, elision) && len(word) > len(elision) {
+				tokens = append(tokens, elision)
+				word = strings.TrimPrefix(word, elision)
+				break
+			}
+		}
+		tokens = append(tokens, word)
+	}
+	return
+}
+
+// DetectLanguage picks the language whose stop words appear the most, English
+// being the default
+func DetectLanguage(tokens []string) string {
+	best, bestCount := Languages[0], 0
+	for _, lang := range Languages {
+		count := 0
+		for _, token := range tokens {
+			if stopWords[lang][token] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = lang, count
+		}
+	}
+	return best
+}
+
+// Score computes the sentiment of one feedback. Words following a negation
+// have their score inverted
+func Score(text string) LineSentiment {
+	tokens := Tokenize(text)
+	sentiment := LineSentiment{Text: text, Language: DetectLanguage(tokens)}
+
+	negated := 0
+	for _, token := range tokens {
+		if negations[token] {
+			negated = negationWindow
+			continue
+		}
+		score := sentimentLexicons[sentiment.Language][token]
+		if negated > 0 {
+			score = -score
+			negated--
+		}
+		sentiment.Score += score
+	}
+
+	switch {
+	case sentiment.Score > 0:
+		sentiment.Label = Positive
+	case sentiment.Score < 0:
+		sentiment.Label = Negative
+	default:
+		sentiment.Label = Neutral
+	}
+	return sentiment
+}
+
+// Analyze scores every feedback and extracts the maxTerms most frequent
+// keywords and bigrams, stop words excluded
+func Analyze(texts []string, maxTerms int) (report Report) {
+	keywords := make(map[string]int)
+	bigrams := make(map[string]int)
+
+	total := 0
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		sentiment := Score(text)
+		report.Lines = append(report.Lines, sentiment)
+		total += sentiment.Score
+		switch sentiment.Label {
+		case Positive:
+			report.Positive++
+		case Negative:
+			report.Negative++
+		default:
+			report.Neutral++
+		}
+
+		// bigrams are made of consecutive meaningful words only
+		previous := ""
+		for _, token := range Tokenize(text) {
+			if !isKeyword(token) {
+				previous = ""
+				continue
+			}
+			keywords[token]++
+			if previous != "" {
+				bigrams[previous+" "+token]++
+			}
+			previous = token
+		}
+	}
+
+	if len(report.Lines) > 0 {
+		report.AverageScore = float64(total) / float64(len(report.Lines))
+	}
+	report.Keywords = topTerms(keywords, maxTerms, 1)
+	report.Bigrams = topTerms(bigrams, maxTerms, 2)
+	return
+}
+
+func isKeyword(token string) bool {
+	if len([]rune(token)) < 3 || negations[token] {
+		return false
+	}
+	if _, err := strconv.Atoi(token); err == nil {
+		return false
+	}
+	for _, lang := range Languages {
+		if stopWords[lang][token] {
+			return false
+		}
+	}
+	return true
+}
+
+// topTerms sorts terms by decreasing count, then alphabetically, and drops
+// the ones seen less than minCount times
+func topTerms(counts map[string]int, max, minCount int) (terms []Term) {
+	for term, count := range counts {
+		if count >= minCount {
+			terms = append(terms, Term{Term: term, Count: count})
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > max {
+		terms = terms[:max]
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected []string
+	}{
+		{"Great session, thanks!", []string{"great", "session", "thanks"}},
+		{"I don't like it", []string{"i", "don't", "like", "it"}},
+		{"L'équipe n’était pas prête", []string{"l'", "équipe", "n'", "était", "pas", "prête"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			if tokens := Tokenize(tc.text); !reflect.DeepEqual(tokens, tc.expected) {
+				t.Errorf("Got %v but expected %v", tokens, tc.expected)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		text             string
+		expectedLanguage string
+		expectedLabel    string
+	}{
+		{"Great session, very useful", "en", Positive},
+		{"This was a waste of time", "en", Negative},
+		{"It was not useful at all", "en", Negative},
+		{"We talked about the roadmap", "en", Neutral},
+		{"C'était vraiment génial et très utile", "fr", Positive},
+		{"La réunion était trop longue et ennuyeuse", "fr", Negative},
+		{"Ce n'était pas bien du tout", "fr", Negative},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			sentiment := Score(tc.text)
+			if sentiment.Language != tc.expectedLanguage {
+				t.Errorf("Got language %s but expected %s", sentiment.Language, tc.expectedLanguage)
+			}
+			if sentiment.Label != tc.expectedLabel {
+				t.Errorf("Got %s (%d) but expected %s", sentiment.Label, sentiment.Score, tc.expectedLabel)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	report := Analyze([]string{
+		"Great demo of the new release pipeline",
+		"The release pipeline is still too slow",
+		"",
+		"Loved the demo",
+	}, 3)
+
+	if report.Positive != 2 || report.Negative != 1 || report.Neutral != 0 {
+		t.Errorf("Got %d positive, %d negative and %d neutral but expected 2, 1 and 0", report.Positive, report.Negative, report.Neutral)
+	}
+
+	expectedKeywords := []Term{{"demo", 2}, {"pipeline", 2}, {"release", 2}}
+	if !reflect.DeepEqual(report.Keywords, expectedKeywords) {
+		t.Errorf("Got keywords %v but expected %v", report.Keywords, expectedKeywords)
+	}
+
+	expectedBigrams := []Term{{"release pipeline", 2}}
+	if !reflect.DeepEqual(report.Bigrams, expectedBigrams) {
+		t.Errorf("Got bigrams %v but expected %v", report.Bigrams, expectedBigrams)
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 var (
@@ -16,6 +18,79 @@ type Config struct {
 	VoteStep      float64 `toml:"vote_step"`
 	QrCodeSize    int     `toml:"qr_code_size"`
 	CleanOverTime int     `toml:"clean_over_time"`
+	// LowSample is the number of votes under which results are flagged as a low sample
+	LowSample int `toml:"low_sample_threshold"`
+	// AnonymityThreshold is the number of votes under which min, max, distributions
+	// and feedback-to-vote association are not displayed
+	AnonymityThreshold int `toml:"anonymity_threshold"`
+	// AnonymousFeedback shuffles feedbacks and drops their vote value on every ROTI
+	AnonymousFeedback bool `toml:"anonymous_feedback"`
+	// FeedbackPrompts are the default prompts of structured feedbacks, separated by "|"
+	FeedbackPrompts string `toml:"feedback_prompts"`
+	// MaxFeedbackLength is the maximum number of characters of a feedback
+	MaxFeedbackLength int `toml:"max_feedback_length"`
+	// WordListsDir holds the word lists (one <lang>.txt file per language) of the moderation filter
+	WordListsDir string `toml:"wordlists_dir"`
+	// HoldForReview holds every feedback until the owner of the ROTI approves it
+	HoldForReview bool `toml:"hold_for_review"`
+	// EmbedFrameAncestors are the sources allowed to embed the widget of a ROTI,
+	// written as in a frame-ancestors directive ("*", "'self' https://wiki.example.com"...)
+	EmbedFrameAncestors string `toml:"embed_frame_ancestors"`
+	// BadgeLowScore and BadgeHighScore color the badges: red under the low
+	// score, green from the high score and yellow in between
+	BadgeLowScore  float64 `toml:"badge_low_score"`
+	BadgeHighScore float64 `toml:"badge_high_score"`
+	// AdminToken gives access to the admin pages, which are disabled when it's empty
+	AdminToken string `toml:"admin_token"`
+	// WebhooksAllowPrivate lets the webhooks of ROTIs call private and loopback
+	// addresses. Global webhooks, set by admins, always can
+	WebhooksAllowPrivate bool `toml:"webhooks_allow_private"`
+	// SlackSigningSecret checks that slash commands and button clicks come from
+	// Slack. The Slack endpoints are disabled when it's empty
+	SlackSigningSecret string `toml:"slack_signing_secret"`
+	// ChatWebhookURL is the incoming webhook of a chat channel, where the
+	// summary of ROTIs is posted when they close
+	ChatWebhookURL string `toml:"chat_webhook_url"`
+	// ChatPlatform tells how to format the summaries: "slack", "mattermost" or "teams"
+	ChatPlatform string `toml:"chat_platform"`
+	// SMTPHost is the server sending the emails, which are disabled when it's empty
+	SMTPHost     string `toml:"smtp_host"`
+	SMTPPort     int    `toml:"smtp_port"`
+	SMTPUsername string `toml:"smtp_username"`
+	SMTPPassword string `toml:"smtp_password"`
+	// SMTPFrom is the sender of the emails
+	SMTPFrom string `toml:"smtp_from"`
+	// SMTPSecurity is "starttls", requiring the server to upgrade the connection,
+	// or "none" for servers on a trusted network
+	SMTPSecurity string `toml:"smtp_security"`
+	// DigestRecipients get the weekly digest of the public ROTIs, separated by ","
+	DigestRecipients string `toml:"digest_recipients"`
+	// CalendarFeed is the path or the http(s) URL of an iCalendar feed of
+	// meetings to create ROTIs for, disabled when empty
+	CalendarFeed string `toml:"calendar_feed"`
+	// CalendarPollInterval is the number of minutes between two reads of the feed
+	CalendarPollInterval int `toml:"calendar_poll_interval"`
+	// CalendarFilter only keeps the meetings whose summary or organizer
+	// contains it, ignoring case
+	CalendarFilter string `toml:"calendar_filter"`
+	// CalendarVotingWindow is the number of minutes ROTIs stay open after
+	// the end of their meeting
+	CalendarVotingWindow int `toml:"calendar_voting_window"`
+	// OIDCIssuer is the OpenID Connect provider users log in with to create
+	// ROTIs, logins are disabled when empty
+	OIDCIssuer       string `toml:"oidc_issuer"`
+	OIDCClientID     string `toml:"oidc_client_id"`
+	OIDCClientSecret string `toml:"oidc_client_secret"`
+	// OIDCScopes are requested along with the openid one, separated by ","
+	OIDCScopes string `toml:"oidc_scopes"`
+	// OIDCAllowedDomains restricts logins to the email domains, separated by ","
+	OIDCAllowedDomains string `toml:"oidc_allowed_domains"`
+	// OIDCGroupsClaim is the claim of the ID token listing the groups of users
+	OIDCGroupsClaim string `toml:"oidc_groups_claim"`
+	// OIDCAllowedGroups restricts logins to the members of the groups, separated by ","
+	OIDCAllowedGroups string `toml:"oidc_allowed_groups"`
+	// OIDCAdminGroups give access to the admin pages, separated by ","
+	OIDCAdminGroups string `toml:"oidc_admin_groups"`
 }
 
 func NewConfig(config Config) *Config {
@@ -33,3 +108,106 @@ func (c *Config) GetURL() string {
 func (c *Config) GetQrCodeSize() int {
 	return c.QrCodeSize
 }
+
+func (c *Config) GetLowSampleThreshold() int {
+	return c.LowSample
+}
+
+func (c *Config) GetAnonymityThreshold() int {
+	return c.AnonymityThreshold
+}
+
+func (c *Config) GetEmbedFrameAncestors() string {
+	return c.EmbedFrameAncestors
+}
+
+// GetBadgeThresholds returns the scores from which badges turn yellow, then green
+func (c *Config) GetBadgeThresholds() (low, high float64) {
+	return c.BadgeLowScore, c.BadgeHighScore
+}
+
+func (c *Config) GetAdminToken() string {
+	return c.AdminToken
+}
+
+func (c *Config) GetSlackSigningSecret() string {
+	return c.SlackSigningSecret
+}
+
+// GetChatWebhook returns the incoming webhook where summaries are posted, and
+// the platform it belongs to
+func (c *Config) GetChatWebhook() (url, platform string) {
+	return c.ChatWebhookURL, c.ChatPlatform
+}
+
+// GetSMTPAddr returns the host:port of the SMTP server, or "" when emails
+// are disabled
+func (c *Config) GetSMTPAddr() string {
+	if c.SMTPHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.SMTPHost, c.SMTPPort)
+}
+
+// GetDigestRecipients splits the recipients of the weekly digest
+func (c *Config) GetDigestRecipients() []string {
+	return splitList(c.DigestRecipients)
+}
+
+// LoginEnabled tells whether creating ROTIs requires logging in with OpenID Connect
+func (c *Config) LoginEnabled() bool {
+	return c.OIDCIssuer != ""
+}
+
+// GetOIDCScopes returns the scopes requested to the OpenID Connect provider,
+// openid first
+func (c *Config) GetOIDCScopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range splitList(c.OIDCScopes) {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// GetOIDCRestrictions returns the email domains and the groups logins are
+// restricted to, and the groups of admins
+func (c *Config) GetOIDCRestrictions() (domains, groups, adminGroups []string) {
+	for _, domain := range splitList(c.OIDCAllowedDomains) {
+		domains = append(domains, strings.ToLower(strings.TrimPrefix(domain, "@")))
+	}
+	return domains, splitList(c.OIDCAllowedGroups), splitList(c.OIDCAdminGroups)
+}
+
+// splitList splits values separated by ",", leaving out empty ones
+func splitList(list string) (values []string) {
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+// GetCalendarFeed returns the iCalendar feed of meetings, "" when disabled,
+// and the delay between two reads
+func (c *Config) GetCalendarFeed() (feed string, interval time.Duration) {
+	return c.CalendarFeed, time.Duration(c.CalendarPollInterval) * time.Minute
+}
+
+// GetCalendarVotingWindow returns how long ROTIs of the calendar stay open
+// after their meeting ends
+func (c *Config) GetCalendarVotingWindow() time.Duration {
+	return time.Duration(c.CalendarVotingWindow) * time.Minute
+}
+
+// GetFeedbackPrompts splits the default prompts of structured feedbacks
+func (c *Config) GetFeedbackPrompts() (prompts []string) {
+	for _, prompt := range strings.Split(c.FeedbackPrompts, "|") {
+		if prompt = strings.TrimSpace(prompt); prompt != "" {
+			prompts = append(prompts, prompt)
+		}
+	}
+	return
+}
@@ -19,6 +19,40 @@ const (
 	voteStepEnvVar    = "VOTE_STEP"
 	qrCodeSizeEnvVar  = "QR_CODE_SIZE"
 	cleanOverTime     = "CLEAN_OVER_TIME"
+	lowSampleEnvVar   = "LOW_SAMPLE_THRESHOLD"
+	anonymityEnvVar   = "ANONYMITY_THRESHOLD"
+	anonymousEnvVar   = "ANONYMOUS_FEEDBACK"
+	promptsEnvVar     = "FEEDBACK_PROMPTS"
+	maxFeedbackEnvVar = "MAX_FEEDBACK_LENGTH"
+	wordListsEnvVar   = "WORDLISTS_DIR"
+	holdEnvVar        = "HOLD_FOR_REVIEW"
+	embedEnvVar       = "EMBED_FRAME_ANCESTORS"
+	badgeLowEnvVar    = "BADGE_LOW_SCORE"
+	badgeHighEnvVar   = "BADGE_HIGH_SCORE"
+	adminTokenEnvVar  = "ADMIN_TOKEN"
+	privateHooksVar   = "WEBHOOKS_ALLOW_PRIVATE"
+	slackSecretEnvVar = "SLACK_SIGNING_SECRET"
+	chatWebhookEnvVar = "CHAT_WEBHOOK_URL"
+	chatPlatformVar   = "CHAT_PLATFORM"
+	smtpHostEnvVar    = "SMTP_HOST"
+	smtpPortEnvVar    = "SMTP_PORT"
+	smtpUserEnvVar    = "SMTP_USERNAME"
+	smtpPassEnvVar    = "SMTP_PASSWORD"
+	smtpFromEnvVar    = "SMTP_FROM"
+	smtpSecurityVar   = "SMTP_SECURITY"
+	digestEnvVar      = "DIGEST_RECIPIENTS"
+	calendarEnvVar    = "CALENDAR_FEED"
+	calendarPollVar   = "CALENDAR_POLL_INTERVAL"
+	calendarFilterVar = "CALENDAR_FILTER"
+	calendarWindowVar = "CALENDAR_VOTING_WINDOW"
+	oidcIssuerEnvVar  = "OIDC_ISSUER"
+	oidcClientEnvVar  = "OIDC_CLIENT_ID"
+	oidcSecretEnvVar  = "OIDC_CLIENT_SECRET"
+	oidcScopesEnvVar  = "OIDC_SCOPES"
+	oidcDomainsEnvVar = "OIDC_ALLOWED_DOMAINS"
+	oidcClaimEnvVar   = "OIDC_GROUPS_CLAIM"
+	oidcGroupsEnvVar  = "OIDC_ALLOWED_GROUPS"
+	oidcAdminsEnvVar  = "OIDC_ADMIN_GROUPS"
 )
 
 func parse(path string) (Config, error) {
@@ -76,6 +110,66 @@ func (c *Config) SetDefaults() {
 	if c.CleanOverTime == 0 {
 		c.CleanOverTime = 30
 	}
+
+	if c.LowSample == 0 {
+		c.LowSample = 5
+	}
+
+	if c.AnonymityThreshold == 0 {
+		c.AnonymityThreshold = 3
+	}
+
+	if c.FeedbackPrompts == "" {
+		c.FeedbackPrompts = "What went well|What to improve|Ideas"
+	}
+
+	if c.MaxFeedbackLength == 0 {
+		c.MaxFeedbackLength = 500
+	}
+
+	if c.EmbedFrameAncestors == "" {
+		c.EmbedFrameAncestors = "*"
+	}
+
+	if c.BadgeLowScore == 0.0 {
+		c.BadgeLowScore = 2.5
+	}
+
+	if c.BadgeHighScore == 0.0 {
+		c.BadgeHighScore = 4
+	}
+
+	if c.ChatPlatform == "" {
+		c.ChatPlatform = "slack"
+	}
+
+	if c.SMTPPort == 0 {
+		c.SMTPPort = 587
+	}
+
+	if c.SMTPFrom == "" {
+		c.SMTPFrom = "groroti@localhost"
+	}
+
+	if c.SMTPSecurity == "" {
+		c.SMTPSecurity = "starttls"
+	}
+
+	if c.CalendarPollInterval == 0 {
+		c.CalendarPollInterval = 15
+	}
+
+	if c.CalendarVotingWindow == 0 {
+		c.CalendarVotingWindow = 60
+	}
+
+	if c.OIDCScopes == "" {
+		c.OIDCScopes = "openid,email,profile"
+	}
+
+	if c.OIDCGroupsClaim == "" {
+		c.OIDCGroupsClaim = "groups"
+	}
 }
 
 func (c *Config) SetConfigFromEnv() (err error) {
@@ -119,5 +213,230 @@ func (c *Config) SetConfigFromEnv() (err error) {
 		c.CleanOverTime = cot
 	}
 
+	lowSampleFromEnv := os.Getenv(lowSampleEnvVar)
+	if lowSampleFromEnv != "" {
+		threshold, err := strconv.Atoi(lowSampleFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, lowSampleFromEnv)
+			return err
+		}
+		c.LowSample = threshold
+	}
+
+	anonymityFromEnv := os.Getenv(anonymityEnvVar)
+	if anonymityFromEnv != "" {
+		threshold, err := strconv.Atoi(anonymityFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, anonymityFromEnv)
+			return err
+		}
+		c.AnonymityThreshold = threshold
+	}
+
+	anonFeedbackFromEnv := os.Getenv(anonymousEnvVar)
+	if anonFeedbackFromEnv != "" {
+		anonymous, err := strconv.ParseBool(anonFeedbackFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, anonFeedbackFromEnv)
+			return err
+		}
+		c.AnonymousFeedback = anonymous
+	}
+
+	promptsFromEnv := os.Getenv(promptsEnvVar)
+	if promptsFromEnv != "" {
+		c.FeedbackPrompts = promptsFromEnv
+	}
+
+	maxFeedbackFromEnv := os.Getenv(maxFeedbackEnvVar)
+	if maxFeedbackFromEnv != "" {
+		length, err := strconv.Atoi(maxFeedbackFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, maxFeedbackFromEnv)
+			return err
+		}
+		c.MaxFeedbackLength = length
+	}
+
+	wordListsFromEnv := os.Getenv(wordListsEnvVar)
+	if wordListsFromEnv != "" {
+		c.WordListsDir = wordListsFromEnv
+	}
+
+	holdFromEnv := os.Getenv(holdEnvVar)
+	if holdFromEnv != "" {
+		hold, err := strconv.ParseBool(holdFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, holdFromEnv)
+			return err
+		}
+		c.HoldForReview = hold
+	}
+
+	embedFromEnv := os.Getenv(embedEnvVar)
+	if embedFromEnv != "" {
+		c.EmbedFrameAncestors = embedFromEnv
+	}
+
+	badgeLowFromEnv := os.Getenv(badgeLowEnvVar)
+	if badgeLowFromEnv != "" {
+		score, err := strconv.ParseFloat(badgeLowFromEnv, 64)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, badgeLowFromEnv)
+			return err
+		}
+		c.BadgeLowScore = score
+	}
+
+	badgeHighFromEnv := os.Getenv(badgeHighEnvVar)
+	if badgeHighFromEnv != "" {
+		score, err := strconv.ParseFloat(badgeHighFromEnv, 64)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, badgeHighFromEnv)
+			return err
+		}
+		c.BadgeHighScore = score
+	}
+
+	adminTokenFromEnv := os.Getenv(adminTokenEnvVar)
+	if adminTokenFromEnv != "" {
+		c.AdminToken = adminTokenFromEnv
+	}
+
+	privateHooksFromEnv := os.Getenv(privateHooksVar)
+	if privateHooksFromEnv != "" {
+		allow, err := strconv.ParseBool(privateHooksFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, privateHooksFromEnv)
+			return err
+		}
+		c.WebhooksAllowPrivate = allow
+	}
+
+	slackSecretFromEnv := os.Getenv(slackSecretEnvVar)
+	if slackSecretFromEnv != "" {
+		c.SlackSigningSecret = slackSecretFromEnv
+	}
+
+	chatWebhookFromEnv := os.Getenv(chatWebhookEnvVar)
+	if chatWebhookFromEnv != "" {
+		c.ChatWebhookURL = chatWebhookFromEnv
+	}
+
+	chatPlatformFromEnv := os.Getenv(chatPlatformVar)
+	if chatPlatformFromEnv != "" {
+		c.ChatPlatform = chatPlatformFromEnv
+	}
+
+	smtpHostFromEnv := os.Getenv(smtpHostEnvVar)
+	if smtpHostFromEnv != "" {
+		c.SMTPHost = smtpHostFromEnv
+	}
+
+	smtpPortFromEnv := os.Getenv(smtpPortEnvVar)
+	if smtpPortFromEnv != "" {
+		port, err := strconv.Atoi(smtpPortFromEnv)
+		if err != nil {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, smtpPortFromEnv)
+			return err
+		}
+		c.SMTPPort = port
+	}
+
+	smtpUserFromEnv := os.Getenv(smtpUserEnvVar)
+	if smtpUserFromEnv != "" {
+		c.SMTPUsername = smtpUserFromEnv
+	}
+
+	smtpPassFromEnv := os.Getenv(smtpPassEnvVar)
+	if smtpPassFromEnv != "" {
+		c.SMTPPassword = smtpPassFromEnv
+	}
+
+	smtpFromFromEnv := os.Getenv(smtpFromEnvVar)
+	if smtpFromFromEnv != "" {
+		c.SMTPFrom = smtpFromFromEnv
+	}
+
+	smtpSecurityFromEnv := os.Getenv(smtpSecurityVar)
+	if smtpSecurityFromEnv != "" {
+		c.SMTPSecurity = smtpSecurityFromEnv
+	}
+
+	digestFromEnv := os.Getenv(digestEnvVar)
+	if digestFromEnv != "" {
+		c.DigestRecipients = digestFromEnv
+	}
+
+	calendarFromEnv := os.Getenv(calendarEnvVar)
+	if calendarFromEnv != "" {
+		c.CalendarFeed = calendarFromEnv
+	}
+
+	calendarPollFromEnv := os.Getenv(calendarPollVar)
+	if calendarPollFromEnv != "" {
+		interval, err := strconv.Atoi(calendarPollFromEnv)
+		if err != nil || interval <= 0 {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, calendarPollFromEnv)
+			return err
+		}
+		c.CalendarPollInterval = interval
+	}
+
+	calendarFilterFromEnv := os.Getenv(calendarFilterVar)
+	if calendarFilterFromEnv != "" {
+		c.CalendarFilter = calendarFilterFromEnv
+	}
+
+	calendarWindowFromEnv := os.Getenv(calendarWindowVar)
+	if calendarWindowFromEnv != "" {
+		window, err := strconv.Atoi(calendarWindowFromEnv)
+		if err != nil || window <= 0 {
+			err = fmt.Errorf("%w %s", ErrInvalidVar, calendarWindowFromEnv)
+			return err
+		}
+		c.CalendarVotingWindow = window
+	}
+
+	oidcIssuerFromEnv := os.Getenv(oidcIssuerEnvVar)
+	if oidcIssuerFromEnv != "" {
+		c.OIDCIssuer = oidcIssuerFromEnv
+	}
+
+	oidcClientFromEnv := os.Getenv(oidcClientEnvVar)
+	if oidcClientFromEnv != "" {
+		c.OIDCClientID = oidcClientFromEnv
+	}
+
+	oidcSecretFromEnv := os.Getenv(oidcSecretEnvVar)
+	if oidcSecretFromEnv != "" {
+		c.OIDCClientSecret = oidcSecretFromEnv
+	}
+
+	oidcScopesFromEnv := os.Getenv(oidcScopesEnvVar)
+	if oidcScopesFromEnv != "" {
+		c.OIDCScopes = oidcScopesFromEnv
+	}
+
+	oidcDomainsFromEnv := os.Getenv(oidcDomainsEnvVar)
+	if oidcDomainsFromEnv != "" {
+		c.OIDCAllowedDomains = oidcDomainsFromEnv
+	}
+
+	oidcClaimFromEnv := os.Getenv(oidcClaimEnvVar)
+	if oidcClaimFromEnv != "" {
+		c.OIDCGroupsClaim = oidcClaimFromEnv
+	}
+
+	oidcGroupsFromEnv := os.Getenv(oidcGroupsEnvVar)
+	if oidcGroupsFromEnv != "" {
+		c.OIDCAllowedGroups = oidcGroupsFromEnv
+	}
+
+	oidcAdminsFromEnv := os.Getenv(oidcAdminsEnvVar)
+	if oidcAdminsFromEnv != "" {
+		c.OIDCAdminGroups = oidcAdminsFromEnv
+	}
+
 	return nil
 }
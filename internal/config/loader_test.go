@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -78,6 +80,42 @@ func TestSetDefaults(t *testing.T) {
 	if c.QrCodeSize != 384 {
 		t.Errorf("Expected %d, got %d", 384, c.QrCodeSize)
 	}
+	if c.LowSample != 5 {
+		t.Errorf("Expected %d, got %d", 5, c.LowSample)
+	}
+	if c.AnonymityThreshold != 3 {
+		t.Errorf("Expected %d, got %d", 3, c.AnonymityThreshold)
+	}
+	if c.MaxFeedbackLength != 500 {
+		t.Errorf("Expected %d, got %d", 500, c.MaxFeedbackLength)
+	}
+	if c.EmbedFrameAncestors != "*" {
+		t.Errorf("Expected %s, got %s", "*", c.EmbedFrameAncestors)
+	}
+	if low, high := c.GetBadgeThresholds(); low != 2.5 || high != 4 {
+		t.Errorf("Expected badge thresholds %f and %f, got %f and %f", 2.5, 4.0, low, high)
+	}
+	if c.GetAdminToken() != "" || c.WebhooksAllowPrivate {
+		t.Errorf("Expected admin pages and private webhooks to be disabled, got %q and %t", c.GetAdminToken(), c.WebhooksAllowPrivate)
+	}
+	if url, platform := c.GetChatWebhook(); url != "" || platform != "slack" {
+		t.Errorf("Expected no chat webhook and the %s platform, got %q and %s", "slack", url, platform)
+	}
+	if c.GetSMTPAddr() != "" || c.SMTPPort != 587 || c.SMTPSecurity != "starttls" || len(c.GetDigestRecipients()) != 0 {
+		t.Errorf("Expected emails to be disabled on port %d with STARTTLS, got %q, %d, %s and %v",
+			587, c.GetSMTPAddr(), c.SMTPPort, c.SMTPSecurity, c.GetDigestRecipients())
+	}
+	if feed, interval := c.GetCalendarFeed(); feed != "" || interval != 15*time.Minute || c.GetCalendarVotingWindow() != time.Hour {
+		t.Errorf("Expected no calendar feed, read every %s with a voting window of %s, got %q, %s and %s",
+			15*time.Minute, time.Hour, feed, interval, c.GetCalendarVotingWindow())
+	}
+	if c.LoginEnabled() || strings.Join(c.GetOIDCScopes(), " ") != "openid email profile" || c.OIDCGroupsClaim != "groups" {
+		t.Errorf("Expected logins to be disabled, requesting the %s scopes and reading the %s claim, got %t, %v and %s",
+			"openid email profile", "groups", c.LoginEnabled(), c.GetOIDCScopes(), c.OIDCGroupsClaim)
+	}
+	if len(c.GetFeedbackPrompts()) != 3 {
+		t.Errorf("Expected %d default prompts, got %v", 3, c.GetFeedbackPrompts())
+	}
 }
 
 func TestSetConfigFromEnv(t *testing.T) {
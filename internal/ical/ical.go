@@ -0,0 +1,443 @@
+// Package ical reads the meetings of iCalendar feeds (RFC 5545), expanding
+// recurring ones, and writes calendars of a few events
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// feeds name their time zones, which may not be installed on the host
+	_ "time/tzdata"
+)
+
+var (
+	ErrNotACalendar    = errors.New("not an iCalendar feed")
+	ErrInvalidProperty = errors.New("invalid iCalendar property")
+	ErrInvalidDate     = errors.New("invalid iCalendar date")
+	ErrInvalidDuration = errors.New("invalid iCalendar duration")
+	ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	utcLayout      = "20060102T150405Z"
+	// maxLineOctets is the length lines are folded at, line break excluded
+	maxLineOctets = 75
+	// maxPeriods bounds the expansion of recurrence rules without end
+	maxPeriods = 10000
+)
+
+// Event is a meeting, or one occurrence of a recurring meeting
+type Event struct {
+	UID string
+	// RecurrenceID is the start of the occurrence as set by the recurrence
+	// rule, before any rescheduling. Zero for single events
+	RecurrenceID   time.Time
+	Summary        string
+	Description    string
+	Location       string
+	URL            string
+	OrganizerName  string
+	OrganizerEmail string
+	Start          time.Time
+	End            time.Time
+	// AllDay events last whole days, from midnight in the local time zone
+	AllDay bool
+}
+
+// IsRecurring tells whether the event is an occurrence of a recurring meeting
+func (e Event) IsRecurring() bool {
+	return !e.RecurrenceID.IsZero()
+}
+
+// Calendar holds the events of a feed
+type Calendar struct {
+	events []vevent
+	// Warnings lists the events that couldn't be read in full, the rest of
+	// the feed is still usable
+	Warnings []error
+}
+
+// vevent is an event as written in the feed, with its recurrence rule
+type vevent struct {
+	Event
+	duration  time.Duration
+	rule      *rule
+	exDates   []time.Time
+	cancelled bool
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads an iCalendar feed
+func Parse(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotACalendar
+	}
+
+	calendar := &Calendar{}
+	var current *vevent
+	var props []property
+	// depth counts the components nested in the current event, like alarms
+	depth := 0
+	for number, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w on line %d", err, number+1)
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT") && current == nil:
+			current = &vevent{}
+			props = nil
+		case current == nil:
+		case prop.name == "BEGIN":
+			depth++
+		case prop.name == "END" && depth > 0:
+			depth--
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if err := current.read(props); err != nil {
+				calendar.Warnings = append(calendar.Warnings, fmt.Errorf("event %q: %w", current.UID, err))
+			} else {
+				calendar.events = append(calendar.events, *current)
+			}
+			current = nil
+		case depth == 0:
+			props = append(props, prop)
+		}
+	}
+	return calendar, nil
+}
+
+// unfold joins the lines folded by the feed
+func unfold(r io.Reader) (lines []string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty splits a line into its name, parameters and value, taking
+// quoted parameter values into account
+func parseProperty(line string) (prop property, err error) {
+	prop.params = make(map[string]string)
+	quoted := false
+	start := 0
+	var name string
+	for i, char := range line {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case quoted:
+		case char == ';' || char == ':':
+			part := line[start:i]
+			if name == "" {
+				name = part
+			} else if key, value, found := strings.Cut(part, "="); found {
+				prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+			}
+			start = i + 1
+			if char == ':' {
+				if name == "" {
+					return prop, ErrInvalidProperty
+				}
+				prop.name = strings.ToUpper(name)
+				prop.value = line[i+1:]
+				return prop, nil
+			}
+		}
+	}
+	return prop, ErrInvalidProperty
+}
+
+// read fills the event from its properties
+func (event *vevent) read(props []property) (err error) {
+	var start, end property
+	var duration string
+	for _, prop := range props {
+		switch prop.name {
+		case "UID":
+			event.UID = prop.value
+		case "SUMMARY":
+			event.Summary = unescape(prop.value)
+		case "DESCRIPTION":
+			event.Description = unescape(prop.value)
+		case "LOCATION":
+			event.Location = unescape(prop.value)
+		case "URL":
+			event.URL = prop.value
+		case "ORGANIZER":
+			event.OrganizerName = prop.params["CN"]
+			if address, found := cutPrefixFold(prop.value, "mailto:"); found {
+				event.OrganizerEmail = address
+			}
+		case "STATUS":
+			event.cancelled = strings.EqualFold(prop.value, "CANCELLED")
+		case "DTSTART":
+			start = prop
+		case "DTEND":
+			end = prop
+		case "DURATION":
+			duration = prop.value
+		case "RECURRENCE-ID":
+			if event.RecurrenceID, _, err = parseDate(prop); err != nil {
+				return err
+			}
+		case "RRULE":
+			if event.rule, err = parseRule(prop.value); err != nil {
+				return err
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				date, _, err := parseDate(property{params: prop.params, value: value})
+				if err != nil {
+					return err
+				}
+				event.exDates = append(event.exDates, date)
+			}
+		}
+	}
+
+	if start.name == "" {
+		return fmt.Errorf("%w: missing DTSTART", ErrInvalidDate)
+	}
+	if event.Start, event.AllDay, err = parseDate(start); err != nil {
+		return err
+	}
+	switch {
+	case end.name != "":
+		if event.End, _, err = parseDate(end); err != nil {
+			return err
+		}
+	case duration != "":
+		length, err := parseDuration(duration)
+		if err != nil {
+			return err
+		}
+		event.End = event.Start.Add(length)
+	case event.AllDay:
+		event.End = event.Start.AddDate(0, 0, 1)
+	default:
+		event.End = event.Start
+	}
+	event.duration = event.End.Sub(event.Start)
+	return nil
+}
+
+// parseDate reads a date or a date-time, in UTC, in the time zone of its
+// TZID parameter or in the local time zone
+func parseDate(prop property) (date time.Time, allDay bool, err error) {
+	location := time.Local
+	if tzid := prop.params["TZID"]; tzid != "" {
+		// unknown zones, like the Windows names of some clients, are read as UTC
+		if location, err = time.LoadLocation(strings.TrimPrefix(tzid, "/")); err != nil {
+			location = time.UTC
+		}
+	}
+	value := strings.TrimSpace(prop.value)
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		date, err = time.Parse(utcLayout, value)
+	case len(value) == len(dateLayout):
+		allDay = true
+		date, err = time.ParseInLocation(dateLayout, value, location)
+	default:
+		date, err = time.ParseInLocation(dateTimeLayout, value, location)
+	}
+	if err != nil {
+		return date, allDay, fmt.Errorf("%w %q", ErrInvalidDate, value)
+	}
+	return date, allDay, nil
+}
+
+// parseDuration reads durations like P1D, PT1H30M or P2W
+func parseDuration(value string) (duration time.Duration, err error) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+	}
+	value = strings.TrimLeft(value, "+-")
+	if !strings.HasPrefix(value, "P") || len(value) < 3 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidDuration, value)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	number := ""
+	for i := 1; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case char == 'T':
+		case char >= '0' && char <= '9':
+			number += string(char)
+		default:
+			unit, found := units[char]
+			count, err := strconv.Atoi(number)
+			if !found || err != nil {
+				return 0, fmt.Errorf("%w %q", ErrInvalidDuration, value)
+			}
+			duration += time.Duration(count) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("%w %q", ErrInvalidDuration, value)
+	}
+	return sign * duration, nil
+}
+
+func unescape(value string) string {
+	var text strings.Builder
+	escaped := false
+	for _, char := range value {
+		switch {
+		case escaped && (char == 'n' || char == 'N'):
+			text.WriteRune('\n')
+		case escaped:
+			text.WriteRune(char)
+		case char == '\\':
+			escaped = true
+			continue
+		default:
+			text.WriteRune(char)
+		}
+		escaped = false
+	}
+	return text.String()
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+func cutPrefixFold(value, prefix string) (string, bool) {
+	if len(value) >= len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+		return value[len(prefix):], true
+	}
+	return value, false
+}
+
+// Occurrences returns the events, and the occurrences of recurring events,
+// taking place at some point between from and to, by start date. Cancelled
+// ones are left out
+func (c *Calendar) Occurrences(from, to time.Time) (events []Event) {
+	// rescheduled or cancelled occurrences of recurring events, by UID and
+	// original start
+	overrides := make(map[string]map[int64]bool)
+	for _, event := range c.events {
+		if event.IsRecurring() {
+			if overrides[event.UID] == nil {
+				overrides[event.UID] = make(map[int64]bool)
+			}
+			overrides[event.UID][event.RecurrenceID.Unix()] = true
+			if !event.cancelled && event.Start.Before(to) && event.End.After(from) {
+				events = append(events, event.Event)
+			}
+		}
+	}
+
+	for _, event := range c.events {
+		if event.IsRecurring() || event.cancelled {
+			continue
+		}
+		if event.rule == nil {
+			if event.Start.Before(to) && event.End.After(from) {
+				events = append(events, event.Event)
+			}
+			continue
+		}
+		for _, start := range event.rule.expand(event.Start, from.Add(-event.duration), to) {
+			if overrides[event.UID][start.Unix()] || event.excluded(start) {
+				continue
+			}
+			occurrence := event.Event
+			occurrence.RecurrenceID = start
+			occurrence.Start = start
+			occurrence.End = start.Add(event.duration)
+			events = append(events, occurrence)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return
+}
+
+func (event vevent) excluded(start time.Time) bool {
+	for _, date := range event.exDates {
+		if date.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes a calendar of the events, in UTC
+func Write(w io.Writer, prodID string, events ...Event) error {
+	var buffer bytes.Buffer
+	writeLine := func(name, value string) {
+		line := name + ":" + value
+		// fold lines without splitting UTF-8 characters
+		for len(line) > maxLineOctets {
+			cut := maxLineOctets
+			for cut > 0 && line[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			buffer.WriteString(line[:cut] + "\r\n")
+			line = " " + line[cut:]
+		}
+		buffer.WriteString(line + "\r\n")
+	}
+
+	writeLine("BEGIN", "VCALENDAR")
+	writeLine("VERSION", "2.0")
+	writeLine("PRODID", prodID)
+	writeLine("CALSCALE", "GREGORIAN")
+	writeLine("METHOD", "PUBLISH")
+	stamp := time.Now().UTC().Format(utcLayout)
+	for _, event := range events {
+		writeLine("BEGIN", "VEVENT")
+		writeLine("UID", event.UID)
+		writeLine("DTSTAMP", stamp)
+		writeLine("DTSTART", event.Start.UTC().Format(utcLayout))
+		writeLine("DTEND", event.End.UTC().Format(utcLayout))
+		writeLine("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			writeLine("DESCRIPTION", escape(event.Description))
+		}
+		if event.Location != "" {
+			writeLine("LOCATION", escape(event.Location))
+		}
+		if event.URL != "" {
+			writeLine("URL", event.URL)
+		}
+		writeLine("END", "VEVENT")
+	}
+	writeLine("END", "VCALENDAR")
+
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
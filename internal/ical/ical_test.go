@@ -0,0 +1,208 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, content string) *Calendar {
+	t.Helper()
+	calendar, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calendar
+}
+
+func TestParse(t *testing.T) {
+	file, err := os.Open("testdata/meetings.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	calendar, err := Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendar.Warnings) != 1 || !errors.Is(calendar.Warnings[0], ErrUnsupportedRule) {
+		t.Errorf("Expected a warning about the unsupported rule, got %v", calendar.Warnings)
+	}
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	events := calendar.Occurrences(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	expected := []struct {
+		uid      string
+		summary  string
+		start    time.Time
+		end      time.Time
+		recurrer time.Time
+	}{
+		{"retro-weekly@team", "Sprint retro", time.Date(2024, 3, 4, 10, 0, 0, 0, paris), time.Date(2024, 3, 4, 11, 0, 0, 0, paris), time.Date(2024, 3, 4, 10, 0, 0, 0, paris)},
+		{"kickoff@team", "Project kickoff", time.Date(2024, 3, 5, 13, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Time{}},
+		{"offsite@team", "Offsite", time.Date(2024, 3, 6, 0, 0, 0, 0, time.Local), time.Date(2024, 3, 7, 0, 0, 0, 0, time.Local), time.Time{}},
+		// the 7th is excluded, the 11th moved to the 12th
+		{"retro-weekly@team", "Sprint retro (moved)", time.Date(2024, 3, 12, 14, 0, 0, 0, paris), time.Date(2024, 3, 12, 15, 0, 0, 0, paris), time.Date(2024, 3, 11, 10, 0, 0, 0, paris)},
+		// the 14th is cancelled
+		{"retro-weekly@team", "Sprint retro", time.Date(2024, 3, 18, 10, 0, 0, 0, paris), time.Date(2024, 3, 18, 11, 0, 0, 0, paris), time.Date(2024, 3, 18, 10, 0, 0, 0, paris)},
+		{"retro-weekly@team", "Sprint retro", time.Date(2024, 3, 21, 10, 0, 0, 0, paris), time.Date(2024, 3, 21, 11, 0, 0, 0, paris), time.Date(2024, 3, 21, 10, 0, 0, 0, paris)},
+		{"retro-weekly@team", "Sprint retro", time.Date(2024, 3, 25, 10, 0, 0, 0, paris), time.Date(2024, 3, 25, 11, 0, 0, 0, paris), time.Date(2024, 3, 25, 10, 0, 0, 0, paris)},
+		{"retro-weekly@team", "Sprint retro", time.Date(2024, 3, 28, 10, 0, 0, 0, paris), time.Date(2024, 3, 28, 11, 0, 0, 0, paris), time.Date(2024, 3, 28, 10, 0, 0, 0, paris)},
+	}
+	if len(events) != len(expected) {
+		for _, event := range events {
+			t.Logf("%s %s %s", event.UID, event.Summary, event.Start)
+		}
+		t.Fatalf("Expected %d occurrences, got %d", len(expected), len(events))
+	}
+	for i, want := range expected {
+		event := events[i]
+		if event.UID != want.uid || event.Summary != want.summary || !event.Start.Equal(want.start) || !event.End.Equal(want.end) ||
+			!event.RecurrenceID.Equal(want.recurrer) {
+			t.Errorf("Expected occurrence %d to be %s %q from %s to %s (%s), got %s %q from %s to %s (%s)", i,
+				want.uid, want.summary, want.start, want.end, want.recurrer,
+				event.UID, event.Summary, event.Start, event.End, event.RecurrenceID)
+		}
+	}
+
+	retro := events[0]
+	if retro.Description != "Bring your post-its, and your ideas.\nSee the board on the wiki." {
+		t.Errorf("Expected the unfolded and unescaped description, got %q", retro.Description)
+	}
+	if retro.OrganizerName != "Doe, Jane" || retro.OrganizerEmail != "jane.doe@example.com" || !retro.IsRecurring() {
+		t.Errorf("Expected a recurring event organized by Jane, got %q <%s>, %t", retro.OrganizerName, retro.OrganizerEmail, retro.IsRecurring())
+	}
+	if kickoff := events[1]; kickoff.OrganizerName != "" || kickoff.OrganizerEmail != "john@example.com" || kickoff.IsRecurring() {
+		t.Errorf("Expected a single event organized by john@example.com, got %q <%s>, %t", kickoff.OrganizerName, kickoff.OrganizerEmail, kickoff.IsRecurring())
+	}
+	if !events[2].AllDay || events[0].AllDay {
+		t.Errorf("Expected only the offsite to last all day")
+	}
+
+	// occurrences still running at the start of the window are included
+	events = calendar.Occurrences(time.Date(2024, 3, 18, 9, 30, 0, 0, time.UTC), time.Date(2024, 3, 18, 9, 45, 0, 0, time.UTC))
+	if len(events) != 1 || events[0].Summary != "Sprint retro" {
+		t.Errorf("Expected the retro running at 9:30 UTC, got %v", events)
+	}
+}
+
+func TestParseInvalidFeeds(t *testing.T) {
+	if _, err := Parse(strings.NewReader("<html></html>")); !errors.Is(err, ErrNotACalendar) {
+		t.Errorf("Expected %v, got %v", ErrNotACalendar, err)
+	}
+	if _, err := Parse(strings.NewReader("BEGIN:VCALENDAR\r\nnot a property\r\nEND:VCALENDAR\r\n")); !errors.Is(err, ErrInvalidProperty) {
+		t.Errorf("Expected %v, got %v", ErrInvalidProperty, err)
+	}
+
+	calendar := mustParse(t, "\ufeffBEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a\nDTSTART:2024-03-01\nEND:VEVENT\nBEGIN:VEVENT\nUID:b\nEND:VEVENT\nEND:VCALENDAR\n")
+	if len(calendar.Warnings) != 2 || !errors.Is(calendar.Warnings[0], ErrInvalidDate) || !errors.Is(calendar.Warnings[1], ErrInvalidDate) {
+		t.Errorf("Expected warnings about the invalid and the missing start, got %v", calendar.Warnings)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P2W":     14 * 24 * time.Hour,
+		"P1DT2H":  26 * time.Hour,
+		"-PT15M":  -15 * time.Minute,
+		"+PT45S":  45 * time.Second,
+	}
+	for value, expected := range testCases {
+		if duration, err := parseDuration(value); err != nil || duration != expected {
+			t.Errorf("Got %s (%v) for %s but expected %s", duration, err, value, expected)
+		}
+	}
+	for _, value := range []string{"", "P", "1H", "PT1X", "PT1H30"} {
+		if _, err := parseDuration(value); !errors.Is(err, ErrInvalidDuration) {
+			t.Errorf("Expected %v for %q, got %v", ErrInvalidDuration, value, err)
+		}
+	}
+}
+
+func TestRecurrenceRules(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	testCases := []struct {
+		name     string
+		rule     string
+		dtstart  time.Time
+		expected []string
+	}{
+		{"daily count", "FREQ=DAILY;COUNT=3", time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			[]string{"2024-03-01 09:00", "2024-03-02 09:00", "2024-03-03 09:00"}},
+		{"workdays", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=4", time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC),
+			[]string{"2024-03-07 09:00", "2024-03-08 09:00", "2024-03-11 09:00", "2024-03-12 09:00"}},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;UNTIL=20240401", time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC),
+			[]string{"2024-03-05 09:00", "2024-03-19 09:00"}},
+		{"same hour after daylight saving time", "FREQ=WEEKLY;COUNT=2", time.Date(2024, 3, 25, 10, 0, 0, 0, paris),
+			[]string{"2024-03-25 10:00", "2024-04-01 10:00"}},
+		{"first monday", "FREQ=MONTHLY;BYDAY=1MO;COUNT=3", time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+			[]string{"2024-01-01 14:00", "2024-02-05 14:00", "2024-03-04 14:00"}},
+		{"last friday", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=2", time.Date(2024, 1, 26, 16, 0, 0, 0, time.UTC),
+			[]string{"2024-01-26 16:00", "2024-02-23 16:00"}},
+		{"31st", "FREQ=MONTHLY;COUNT=3", time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+			[]string{"2024-01-31 08:00", "2024-03-31 08:00", "2024-05-31 08:00"}},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=2", time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+			[]string{"2024-01-31 08:00", "2024-02-29 08:00"}},
+		{"leap day", "FREQ=YEARLY;COUNT=2", time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC),
+			[]string{"2024-02-29 08:00", "2028-02-29 08:00"}},
+	}
+	for _, testCase := range testCases {
+		r, err := parseRule(testCase.rule)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+		var starts []string
+		for _, start := range r.expand(testCase.dtstart, testCase.dtstart.Add(-time.Second), testCase.dtstart.AddDate(10, 0, 0)) {
+			starts = append(starts, start.Format("2006-01-02 15:04"))
+		}
+		if strings.Join(starts, ",") != strings.Join(testCase.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", testCase.name, testCase.expected, starts)
+		}
+	}
+
+	for _, value := range []string{"FREQ=HOURLY", "FREQ=MONTHLY;BYSETPOS=1", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=DAILY;INTERVAL=0", "FREQ=WEEKLY;BYDAY=XX"} {
+		if _, err := parseRule(value); !errors.Is(err, ErrUnsupportedRule) {
+			t.Errorf("Expected %v for %s, got %v", ErrUnsupportedRule, value, err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	event := Event{
+		UID:         "roti-12345@groroti",
+		Summary:     "ROTI: Sprint retro; week 10",
+		Description: "Vote on https://groroti.example.com/roti/12345\nQR code: https://groroti.example.com/qr/12345.png — scan it, it's quicker",
+		URL:         "https://groroti.example.com/roti/12345",
+		Start:       time.Date(2024, 3, 4, 11, 0, 0, 0, time.FixedZone("CET", 3600)),
+		End:         time.Date(2024, 3, 4, 11, 0, 0, 0, time.FixedZone("CET", 3600)).Add(time.Hour),
+	}
+	var buffer bytes.Buffer
+	if err := Write(&buffer, "-//Deezer//GroROTI//EN", event); err != nil {
+		t.Fatal(err)
+	}
+	content := buffer.String()
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("Expected lines of %d octets at most, got %q", maxLineOctets, line)
+		}
+	}
+	if !strings.Contains(content, "DTSTART:20240304T100000Z\r\n") || !strings.Contains(content, "SUMMARY:ROTI: Sprint retro\\; week 10\r\n") {
+		t.Errorf("Expected the start in UTC and an escaped summary, got %s", content)
+	}
+
+	calendar := mustParse(t, content)
+	events := calendar.Occurrences(event.Start, event.End)
+	if len(events) != 1 {
+		t.Fatalf("Expected to read back the event, got %v", events)
+	}
+	if read := events[0]; read.UID != event.UID || read.Summary != event.Summary || read.Description != event.Description ||
+		read.URL != event.URL || !read.Start.Equal(event.Start) || !read.End.Equal(event.End) {
+		t.Errorf("Expected to read back %+v, got %+v", event, read)
+	}
+}
@@ -0,0 +1,260 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// rule is a recurrence rule (RRULE) of the daily, weekly, monthly or yearly
+// kind, the ones meetings use
+type rule struct {
+	frequency string
+	interval  int
+	count     int
+	// until is kept as written, its time zone being the one of the event
+	until      string
+	byDay      []weekdayNum
+	byMonthDay []int
+	weekStart  time.Weekday
+}
+
+// weekdayNum is a day of the week, ordinal picking one of them in the month:
+// 1 for the first one, -1 for the last one, 0 for all of them
+type weekdayNum struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+func parseRule(value string) (*rule, error) {
+	r := &rule{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.frequency = strings.ToUpper(val)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(val)
+			if err == nil && r.interval < 1 {
+				err = ErrUnsupportedRule
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			r.until = val
+		case "WKST":
+			var found bool
+			if r.weekStart, found = weekdays[strings.ToUpper(val)]; !found {
+				err = ErrUnsupportedRule
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				var weekday weekdayNum
+				if weekday, err = parseWeekdayNum(day); err != nil {
+					break
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				var number int
+				if number, err = strconv.Atoi(day); err != nil || number == 0 || number > 31 || number < -31 {
+					err = ErrUnsupportedRule
+					break
+				}
+				r.byMonthDay = append(r.byMonthDay, number)
+			}
+		default:
+			err = ErrUnsupportedRule
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedRule, value)
+		}
+	}
+
+	supported := true
+	switch r.frequency {
+	case "DAILY", "WEEKLY":
+		supported = len(r.byMonthDay) == 0
+		for _, day := range r.byDay {
+			supported = supported && day.ordinal == 0
+		}
+	case "MONTHLY":
+		supported = len(r.byDay) == 0 || len(r.byMonthDay) == 0
+	case "YEARLY":
+		supported = len(r.byDay) == 0 && len(r.byMonthDay) == 0
+	default:
+		supported = false
+	}
+	if !supported {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedRule, value)
+	}
+	return r, nil
+}
+
+// parseWeekdayNum reads days like MO, 1MO or -1FR
+func parseWeekdayNum(value string) (day weekdayNum, err error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return day, ErrUnsupportedRule
+	}
+	weekday, found := weekdays[value[len(value)-2:]]
+	if !found {
+		return day, ErrUnsupportedRule
+	}
+	day.weekday = weekday
+	if ordinal := value[:len(value)-2]; ordinal != "" {
+		if day.ordinal, err = strconv.Atoi(ordinal); err != nil || day.ordinal == 0 || day.ordinal > 5 || day.ordinal < -5 {
+			return day, ErrUnsupportedRule
+		}
+	}
+	return day, nil
+}
+
+// expand returns the starts of the occurrences of an event beginning at
+// dtstart, that are after after and before before
+func (r *rule) expand(dtstart, after, before time.Time) (starts []time.Time) {
+	until := r.untilIn(dtstart.Location())
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, start := range r.period(dtstart, period) {
+			if start.Before(dtstart) {
+				continue
+			}
+			if (!until.IsZero() && start.After(until)) || !start.Before(before) {
+				return
+			}
+			count++
+			if r.count > 0 && count > r.count {
+				return
+			}
+			if start.After(after) {
+				starts = append(starts, start)
+			}
+		}
+	}
+	return
+}
+
+// untilIn reads the end of the rule, dates ending at midnight of the next day
+func (r *rule) untilIn(location *time.Location) time.Time {
+	if r.until == "" {
+		return time.Time{}
+	}
+	until, allDay, err := parseDate(property{value: r.until})
+	if err != nil {
+		// an unreadable end is taken as no end at all
+		return time.Time{}
+	}
+	if !strings.HasSuffix(r.until, "Z") {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, location)
+	}
+	if allDay {
+		until = until.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return until
+}
+
+// period returns the occurrences of the nth period (day, week, month or
+// year) of the rule, sorted. Keeping the wall clock time of dtstart keeps
+// meetings at the same hour across daylight saving time changes
+func (r *rule) period(dtstart time.Time, n int) (starts []time.Time) {
+	year, month, day := dtstart.Date()
+	hour, minute, second := dtstart.Clock()
+	location := dtstart.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, location)
+	}
+	step := n * r.interval
+
+	switch r.frequency {
+	case "DAILY":
+		start := at(year, month, day+step)
+		if r.matchesWeekday(start.Weekday()) {
+			starts = append(starts, start)
+		}
+	case "WEEKLY":
+		days := []time.Weekday{dtstart.Weekday()}
+		if len(r.byDay) > 0 {
+			days = nil
+			for _, byDay := range r.byDay {
+				days = append(days, byDay.weekday)
+			}
+		}
+		firstDay := day - r.sinceWeekStart(dtstart.Weekday()) + 7*step
+		for _, weekday := range days {
+			starts = append(starts, at(year, month, firstDay+r.sinceWeekStart(weekday)))
+		}
+	case "MONTHLY":
+		first := at(year, month+time.Month(step), 1)
+		length := at(first.Year(), first.Month()+1, 0).Day()
+		var days []int
+		switch {
+		case len(r.byDay) > 0:
+			for _, byDay := range r.byDay {
+				var matching []int
+				for d := 1; d <= length; d++ {
+					if first.AddDate(0, 0, d-1).Weekday() == byDay.weekday {
+						matching = append(matching, d)
+					}
+				}
+				switch {
+				case byDay.ordinal == 0:
+					days = append(days, matching...)
+				case byDay.ordinal > 0 && byDay.ordinal <= len(matching):
+					days = append(days, matching[byDay.ordinal-1])
+				case byDay.ordinal < 0 && -byDay.ordinal <= len(matching):
+					days = append(days, matching[len(matching)+byDay.ordinal])
+				}
+			}
+		case len(r.byMonthDay) > 0:
+			for _, d := range r.byMonthDay {
+				if d < 0 {
+					d = length + d + 1
+				}
+				days = append(days, d)
+			}
+		default:
+			days = []int{day}
+		}
+		sort.Ints(days)
+		for i, d := range days {
+			// months too short for a day don't have an occurrence on it
+			if d >= 1 && d <= length && (i == 0 || days[i-1] != d) {
+				starts = append(starts, at(first.Year(), first.Month(), d))
+			}
+		}
+	case "YEARLY":
+		// February 29th only comes back on leap years
+		if start := at(year+step, month, day); start.Month() == month {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return
+}
+
+func (r *rule) matchesWeekday(weekday time.Weekday) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, byDay := range r.byDay {
+		if byDay.weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// sinceWeekStart counts the days from the start of the week to weekday
+func (r *rule) sinceWeekStart(weekday time.Weekday) int {
+	return (int(weekday) - int(r.weekStart) + 7) % 7
+}
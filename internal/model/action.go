@@ -0,0 +1,111 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrEmptyAction            = errors.New("an action item needs a text")
+	ErrNoActionMatchingThisID = errors.New("no action item of this ROTI matching this ID")
+	ErrInvalidActionStatus    = errors.New("invalid action item status")
+)
+
+// ActionStatus tells if an action item still has to be done
+type ActionStatus string
+
+const (
+	ActionOpen ActionStatus = "open"
+	ActionDone ActionStatus = "done"
+)
+
+// ActionItem is something the team agreed to do after a ROTI
+type ActionItem struct {
+	ID        string       `json:"id"`
+	ROTIID    ROTIID       `json:"roti"`
+	Text      string       `json:"text"`
+	Status    ActionStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func CheckActionStatus(status string) (ActionStatus, error) {
+	switch ActionStatus(status) {
+	case ActionOpen, ActionDone:
+		return ActionStatus(status), nil
+	}
+	return "", ErrInvalidActionStatus
+}
+
+// AddAction creates an open action item linked to this ROTI
+func (currentROTI *ROTIEntity) AddAction(text string) (action ActionItem, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ActionItem{}, ErrEmptyAction
+	}
+
+	action = ActionItem{ID: uuid.NewString(), ROTIID: currentROTI.id, Text: text, Status: ActionOpen, CreatedAt: time.Now()}
+	_, err = sqliteDatabase.Exec("INSERT INTO action(id, roti, series, text, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		action.ID, int(currentROTI.id), currentROTI.series, action.Text, action.Status, action.CreatedAt)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	log.Info().Msgf("action item %s added to ROTI %d", action.ID, int(currentROTI.id))
+	return action, nil
+}
+
+// ListActions returns the action items created on this ROTI
+func (currentROTI *ROTIEntity) ListActions() []ActionItem {
+	return queryActions("SELECT id, roti, text, status, created_at FROM action WHERE roti = ? ORDER BY created_at", int(currentROTI.id))
+}
+
+// ListCarriedOverActions returns the action items still open from the previous
+// sessions of the recurring meeting of this ROTI
+func (currentROTI *ROTIEntity) ListCarriedOverActions() []ActionItem {
+	if currentROTI.series == "" {
+		return nil
+	}
+	return queryActions(`SELECT action.id, action.roti, action.text, action.status, action.created_at FROM action
+		JOIN roti ON roti.rotiid = action.roti
+		WHERE action.series = ? AND action.roti != ? AND action.status = 'open'
+		AND roti.id < (SELECT id FROM roti WHERE rotiid = ?)
+		ORDER BY action.created_at`, currentROTI.series, int(currentROTI.id), int(currentROTI.id))
+}
+
+func queryActions(query string, args ...any) (actions []ActionItem) {
+	row, err := sqliteDatabase.Query(query, args...)
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var action ActionItem
+		var createdAt sql.NullTime
+		if err := row.Scan(&action.ID, &action.ROTIID, &action.Text, &action.Status, &createdAt); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		action.CreatedAt = createdAt.Time
+		actions = append(actions, action)
+	}
+	return
+}
+
+// SetActionStatus opens or closes an action item of this ROTI, or one carried
+// over from a previous session of the same recurring meeting
+func (currentROTI *ROTIEntity) SetActionStatus(actionID string, status ActionStatus) error {
+	result, err := sqliteDatabase.Exec("UPDATE action SET status = ? WHERE id = ? AND (roti = ? OR (series != '' AND series = ?))",
+		status, actionID, int(currentROTI.id), currentROTI.series)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNoActionMatchingThisID
+	}
+	log.Info().Msgf("action item %s of ROTI %d set to %s", actionID, int(currentROTI.id), status)
+	return nil
+}
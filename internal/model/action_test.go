@@ -0,0 +1,102 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestActionsCarryOver(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	first, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "weekly", Feedback: true}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.AddAction("  "); err != ErrEmptyAction {
+		t.Errorf("Got %v but expected %v", err, ErrEmptyAction)
+	}
+	open, err := first.AddAction("shorter demos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := first.AddAction("book a bigger room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.SetActionStatus(done.ID, ActionDone); err != nil {
+		t.Fatal(err)
+	}
+
+	series := first.StartSeries()
+	if series == "" || first.StartSeries() != series {
+		t.Fatalf("Got series %q, expected a stable identifier", series)
+	}
+
+	second, err := GetROTI(CreateROTIWithOptions(first.NextSessionOptions(), 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.GetDescription() != "weekly" || second.GetSeries() != series {
+		t.Errorf("Got description %q and series %q for the next session", second.GetDescription(), second.GetSeries())
+	}
+	if _, err := second.AddAction("rotate facilitators"); err != nil {
+		t.Fatal(err)
+	}
+
+	carried := second.ListCarriedOverActions()
+	if len(carried) != 1 || carried[0].ID != open.ID {
+		t.Errorf("Got %v but expected only the open action of the first session", carried)
+	}
+	if carried := first.ListCarriedOverActions(); len(carried) != 0 {
+		t.Errorf("Got %v but actions of later sessions shouldn't carry over", carried)
+	}
+
+	// the action is closed from the next session
+	if err := second.SetActionStatus(open.ID, ActionDone); err != nil {
+		t.Fatal(err)
+	}
+	if carried := second.ListCarriedOverActions(); len(carried) != 0 {
+		t.Errorf("Got %v but done actions shouldn't carry over", carried)
+	}
+
+	other, err := GetROTI(CreateROTI("other", false, true, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SetActionStatus(open.ID, ActionOpen); err != ErrNoActionMatchingThisID {
+		t.Errorf("Got %v but expected %v", err, ErrNoActionMatchingThisID)
+	}
+}
+
+func TestReplyToFeedback(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	roti, err := GetROTI(CreateROTI("replies", false, true, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteID, err := roti.CastBallot(Ballot{Value: 2, Feedback: "too long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := roti.ReplyToFeedback(feedbackIDOf(t, voteID), " We'll timebox it "); err != nil {
+		t.Fatal(err)
+	}
+	for _, feedbackID := range []FeedbackID{"unknown", FeedbackID(voteID)} {
+		if err := roti.ReplyToFeedback(feedbackID, "hello"); err != ErrNoVoteMatchingThisID {
+			t.Errorf("Got %v but expected %v", err, ErrNoVoteMatchingThisID)
+		}
+	}
+
+	if reply := roti.ListSupportedFeedbacks(true)[0].Reply; reply != "We'll timebox it" {
+		t.Errorf("Got reply %q", reply)
+	}
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CalendarEvent links a meeting of the calendar feed to the ROTI created for it
+type CalendarEvent struct {
+	UID string
+	// Occurrence is the original start of an occurrence of a recurring
+	// meeting, zero for single meetings
+	Occurrence time.Time
+	ROTI       ROTIID
+	StartsAt   time.Time
+	EndsAt     time.Time
+	CreatedAt  time.Time
+}
+
+// occurrenceKey identifies occurrences by their Unix time, 0 for single meetings
+func occurrenceKey(occurrence time.Time) int64 {
+	if occurrence.IsZero() {
+		return 0
+	}
+	return occurrence.Unix()
+}
+
+// AddCalendarEvent records the ROTI created for a meeting
+func AddCalendarEvent(event CalendarEvent) {
+	_, err := sqliteDatabase.Exec("INSERT INTO calendar_event(uid, occurrence, roti, starts_at, ends_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		event.UID, occurrenceKey(event.Occurrence), int(event.ROTI), event.StartsAt, event.EndsAt, time.Now())
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// RescheduleCalendarEvent saves the new dates of a meeting
+func RescheduleCalendarEvent(event CalendarEvent) {
+	_, err := sqliteDatabase.Exec("UPDATE calendar_event SET starts_at = ?, ends_at = ? WHERE uid = ? AND occurrence = ?",
+		event.StartsAt, event.EndsAt, event.UID, occurrenceKey(event.Occurrence))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// GetCalendarEvent returns the meeting of the feed, if a ROTI was created for it
+func GetCalendarEvent(uid string, occurrence time.Time) (CalendarEvent, bool) {
+	return queryCalendarEvent("uid = ? AND occurrence = ?", uid, occurrenceKey(occurrence))
+}
+
+// GetCalendarEvent returns the meeting the ROTI was created for, if any
+func (currentROTI *ROTIEntity) GetCalendarEvent() (CalendarEvent, bool) {
+	return queryCalendarEvent("roti = ?", int(currentROTI.id))
+}
+
+// GetCalendarSeries returns the series of the ROTIs created for the previous
+// occurrences of a recurring meeting, empty if there's none
+func GetCalendarSeries(uid string) (series string) {
+	err := sqliteDatabase.QueryRow(`SELECT roti.series FROM calendar_event JOIN roti ON roti.rotiid = calendar_event.roti
+		WHERE calendar_event.uid = ? AND roti.series IS NOT NULL AND roti.series != '' ORDER BY calendar_event.occurrence DESC LIMIT 1`, uid).
+		Scan(&series)
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatal().Msgf(err.Error())
+	}
+	return
+}
+
+func queryCalendarEvent(condition string, args ...any) (event CalendarEvent, found bool) {
+	var occurrence int64
+	var rotiID int
+	var startsAt, endsAt, createdAt sql.NullTime
+	err := sqliteDatabase.QueryRow("SELECT uid, occurrence, roti, starts_at, ends_at, created_at FROM calendar_event WHERE "+condition, args...).
+		Scan(&event.UID, &occurrence, &rotiID, &startsAt, &endsAt, &createdAt)
+	if err == sql.ErrNoRows {
+		return event, false
+	} else if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if occurrence != 0 {
+		event.Occurrence = time.Unix(occurrence, 0)
+	}
+	event.ROTI = ROTIID(rotiID)
+	event.StartsAt = startsAt.Time
+	event.EndsAt = endsAt.Time
+	event.CreatedAt = createdAt.Time
+	return event, true
+}
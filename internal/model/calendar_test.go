@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarEvents(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	start := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	if _, found := GetCalendarEvent("retro@team", start); found {
+		t.Fatal("Expected no meeting before a ROTI is created for it")
+	}
+
+	first, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "retro"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddCalendarEvent(CalendarEvent{UID: "retro@team", Occurrence: start, ROTI: first.GetID(), StartsAt: start, EndsAt: start.Add(time.Hour)})
+	if series := GetCalendarSeries("retro@team"); series != "" {
+		t.Errorf("Expected no series before it's started, got %s", series)
+	}
+	series := first.StartSeries()
+
+	// the same instant in another time zone is the same occurrence
+	event, found := GetCalendarEvent("retro@team", start.In(time.FixedZone("CET", 3600)))
+	if !found || event.ROTI != first.GetID() || !event.Occurrence.Equal(start) || !event.EndsAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Expected the meeting of ROTI %d, got %+v (%t)", first.GetID().Int(), event, found)
+	}
+	if _, found := GetCalendarEvent("retro@team", start.AddDate(0, 0, 7)); found {
+		t.Error("Expected the next occurrence to be unknown")
+	}
+	if got := GetCalendarSeries("retro@team"); got != series {
+		t.Errorf("Expected series %s, got %s", series, got)
+	}
+
+	event.StartsAt = start.Add(2 * time.Hour)
+	event.EndsAt = start.Add(3 * time.Hour)
+	RescheduleCalendarEvent(event)
+	if rescheduled, _ := first.GetCalendarEvent(); !rescheduled.StartsAt.Equal(event.StartsAt) || !rescheduled.EndsAt.Equal(event.EndsAt) {
+		t.Errorf("Expected the meeting to be moved to %s, got %+v", event.StartsAt, rescheduled)
+	}
+
+	single, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "kickoff"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddCalendarEvent(CalendarEvent{UID: "kickoff@team", ROTI: single.GetID(), StartsAt: start, EndsAt: start.Add(time.Hour)})
+	if event, found := GetCalendarEvent("kickoff@team", time.Time{}); !found || !event.Occurrence.IsZero() || event.ROTI != single.GetID() {
+		t.Errorf("Expected the single meeting of ROTI %d, got %+v (%t)", single.GetID().Int(), event, found)
+	}
+	if _, found := (&ROTIEntity{id: 1}).GetCalendarEvent(); found {
+		t.Error("Expected no meeting for an unknown ROTI")
+	}
+}
+
+func TestCloseAt(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	currentROTI, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "scheduled"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	currentROTI.CloseAt(later)
+	if currentROTI, _ = GetROTI(currentROTI.GetID()); !currentROTI.GetClosesAt().Equal(later) || currentROTI.IsClosed() {
+		t.Errorf("Expected the ROTI to close at %s, got %s", later, currentROTI.GetClosesAt())
+	}
+
+	currentROTI.Close()
+	closedAt := currentROTI.GetClosesAt()
+	currentROTI.CloseAt(later)
+	if currentROTI, _ = GetROTI(currentROTI.GetID()); !currentROTI.GetClosesAt().Equal(closedAt) {
+		t.Errorf("Expected a closed ROTI to stay closed at %s, got %s", closedAt, currentROTI.GetClosesAt())
+	}
+}
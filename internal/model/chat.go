@@ -0,0 +1,25 @@
+package model
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// RegisterChatVoter remembers that a participant voted on this ROTI from a
+// chat, where there's no cookie to tell. voter must not identify the
+// participant, nor link their votes on different ROTIs. It returns false when
+// the voter already voted
+func (currentROTI *ROTIEntity) RegisterChatVoter(voter string) bool {
+	result, err := sqliteDatabase.Exec("INSERT OR IGNORE INTO chat_voter(roti, voter) VALUES (?, ?)", int(currentROTI.id), voter)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	inserted, _ := result.RowsAffected()
+	return inserted == 1
+}
+
+// ForgetChatVoter lets a participant whose vote was refused vote again
+func (currentROTI *ROTIEntity) ForgetChatVoter(voter string) {
+	if _, err := sqliteDatabase.Exec("DELETE FROM chat_voter WHERE roti = ? AND voter = ?", int(currentROTI.id), voter); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestRegisterChatVoter(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	first, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "first"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GetROTI(CreateROTIWithOptions(ROTIOptions{Description: "second"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !first.RegisterChatVoter("voter") {
+		t.Error("Expected the first vote to be registered")
+	}
+	if first.RegisterChatVoter("voter") {
+		t.Error("Expected the second vote on the same ROTI to be refused")
+	}
+	if !second.RegisterChatVoter("voter") {
+		t.Error("Expected the vote on another ROTI to be registered")
+	}
+
+	first.ForgetChatVoter("voter")
+	if !first.RegisterChatVoter("voter") {
+		t.Error("Expected a forgotten voter to be able to vote again")
+	}
+	if columnExists(sqliteDatabase, "chat_voter", "created_at") {
+		t.Error("Expected chat voters not to be dated")
+	}
+}
@@ -3,8 +3,10 @@ package model
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -57,14 +59,37 @@ func initTables(db *sql.DB) {
 		"description" TEXT,
 		"hide" INTEGER,
 		"feedback" INTEGER DEFAULT 0,
-        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		"blind" INTEGER DEFAULT 0,
+		"revealed" INTEGER DEFAULT 0,
+		"closes_at" TIMESTAMP,
+		"opens_at" TIMESTAMP,
+		"owner_token" TEXT,
+		"min_votes" INTEGER DEFAULT 0,
+		"anonymous_feedback" INTEGER DEFAULT 0,
+		"prompts" TEXT,
+		"low_threshold" REAL,
+		"low_question" TEXT,
+		"high_threshold" REAL,
+		"high_question" TEXT,
+		"review" INTEGER DEFAULT 0,
+		"series" TEXT,
+		"email" TEXT,
+		"results_emailed" INTEGER DEFAULT 0,
+		"close_notified" INTEGER DEFAULT 0,
+		"creator" TEXT
 	  );`
 
 	createVoteTable := `CREATE TABLE vote (
 		"id" TEXT NOT NULL PRIMARY KEY,		
 		"value" INTEGER,
 		"roti" INTEGER,
-		"feedback" TEXT
+		"feedback" TEXT,
+		"followup" TEXT,
+		"status" TEXT DEFAULT 'visible',
+		"reply" TEXT,
+		"created_at" TIMESTAMP,
+		"feedback_id" TEXT
 	  );`
 
 	rotiStatement, err := db.Prepare(createROTITable)
@@ -86,6 +111,130 @@ func initTables(db *sql.DB) {
 		log.Fatal().Msg(err.Error())
 	}
 	log.Info().Msg("'vote' table created")
+
+	createMissingTables(db)
+}
+
+// extraTables are created on new databases as well as on old ones missing them
+var extraTables = []struct {
+	name      string
+	statement string
+}{
+	{"answer", `CREATE TABLE answer (
+		"vote" TEXT NOT NULL,
+		"roti" INTEGER,
+		"prompt" INTEGER,
+		"text" TEXT
+	  );`},
+	{"upvote", `CREATE TABLE upvote (
+		"vote" TEXT NOT NULL,
+		"roti" INTEGER,
+		"created_at" TIMESTAMP
+	  );`},
+	{"action", `CREATE TABLE action (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"roti" INTEGER,
+		"series" TEXT,
+		"text" TEXT,
+		"status" TEXT DEFAULT 'open',
+		"created_at" TIMESTAMP
+	  );`},
+	{"webhook", `CREATE TABLE webhook (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"roti" INTEGER,
+		"url" TEXT,
+		"secret" TEXT,
+		"events" TEXT,
+		"votes" INTEGER DEFAULT 0,
+		"created_at" TIMESTAMP
+	  );`},
+	{"delivery", `CREATE TABLE delivery (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"webhook" TEXT,
+		"event" TEXT,
+		"payload" TEXT,
+		"status" TEXT DEFAULT 'pending',
+		"attempts" INTEGER DEFAULT 0,
+		"next_attempt" TIMESTAMP,
+		"last_status" INTEGER,
+		"last_error" TEXT,
+		"created_at" TIMESTAMP,
+		"updated_at" TIMESTAMP
+	  );`},
+	// chat voters are neither dated nor kept in the order of the votes, which
+	// would tell what each of them voted
+	{"chat_voter", `CREATE TABLE chat_voter (
+		"roti" INTEGER,
+		"voter" TEXT,
+		PRIMARY KEY ("roti", "voter")
+	  ) WITHOUT ROWID;`},
+	{"email_recipient", `CREATE TABLE email_recipient (
+		"email" TEXT NOT NULL PRIMARY KEY,
+		"token" TEXT NOT NULL UNIQUE,
+		"unsubscribed" INTEGER DEFAULT 0,
+		"digest_sent_at" TIMESTAMP,
+		"created_at" TIMESTAMP,
+		"confirmed" INTEGER DEFAULT 0,
+		"confirmation_sent_at" TIMESTAMP
+	  );`},
+	{"email", `CREATE TABLE email (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"recipient" TEXT,
+		"subject" TEXT,
+		"message" BLOB,
+		"status" TEXT DEFAULT 'pending',
+		"attempts" INTEGER DEFAULT 0,
+		"next_attempt" TIMESTAMP,
+		"last_error" TEXT,
+		"created_at" TIMESTAMP,
+		"updated_at" TIMESTAMP
+	  );`},
+	{"calendar_event", `CREATE TABLE calendar_event (
+		"uid" TEXT NOT NULL,
+		"occurrence" INTEGER NOT NULL,
+		"roti" INTEGER,
+		"starts_at" TIMESTAMP,
+		"ends_at" TIMESTAMP,
+		"created_at" TIMESTAMP,
+		PRIMARY KEY ("uid", "occurrence")
+	  );`},
+	{"login_state", `CREATE TABLE login_state (
+		"state" TEXT NOT NULL PRIMARY KEY,
+		"verifier" TEXT,
+		"nonce" TEXT,
+		"next" TEXT,
+		"created_at" TIMESTAMP
+	  );`},
+	{"login_session", `CREATE TABLE login_session (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"subject" TEXT,
+		"email" TEXT,
+		"name" TEXT,
+		"admin" INTEGER DEFAULT 0,
+		"expires_at" TIMESTAMP,
+		"created_at" TIMESTAMP
+	  );`},
+}
+
+func createMissingTables(db *sql.DB) {
+	for _, table := range extraTables {
+		if tableExists(db, table.name) {
+			continue
+		}
+		if _, err := db.Exec(table.statement); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		log.Info().Msgf("'%s' table created", table.name)
+	}
+}
+
+func tableExists(db *sql.DB, tableName string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Scan(&count)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	return count > 0
 }
 
 // addMissingColumns allows to update old databases missing columns (new features)
@@ -132,6 +281,65 @@ func addMissingColumns(db *sql.DB) {
 		log.Info().Msg("'created_at' column added to 'roti' table")
 	}
 
+	addColumnIfMissing(db, "roti", "blind", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "revealed", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "closes_at", "TIMESTAMP")
+	addColumnIfMissing(db, "roti", "owner_token", "TEXT")
+	addColumnIfMissing(db, "roti", "min_votes", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "anonymous_feedback", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "prompts", "TEXT")
+	addColumnIfMissing(db, "roti", "low_threshold", "REAL")
+	addColumnIfMissing(db, "roti", "low_question", "TEXT")
+	addColumnIfMissing(db, "roti", "high_threshold", "REAL")
+	addColumnIfMissing(db, "roti", "high_question", "TEXT")
+	addColumnIfMissing(db, "vote", "followup", "TEXT")
+	addColumnIfMissing(db, "vote", "status", "TEXT DEFAULT 'visible'")
+	addColumnIfMissing(db, "roti", "review", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "series", "TEXT")
+	addColumnIfMissing(db, "vote", "reply", "TEXT")
+	addColumnIfMissing(db, "vote", "created_at", "TIMESTAMP")
+	// feedbacks are published under their own ID, which can't be joined to
+	// the vote IDs of the raw exports
+	if !columnExists(db, "vote", "feedback_id") {
+		addColumnIfMissing(db, "vote", "feedback_id", "TEXT")
+		if _, err := db.Exec("UPDATE vote SET feedback_id = lower(hex(randomblob(16))) WHERE feedback_id IS NULL"); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+	addColumnIfMissing(db, "roti", "email", "TEXT")
+	addColumnIfMissing(db, "roti", "results_emailed", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "roti", "creator", "TEXT")
+	addColumnIfMissing(db, "roti", "opens_at", "TIMESTAMP")
+	// the ROTIs closed before notifications were recorded aren't told again
+	if !columnExists(db, "roti", "close_notified") {
+		addColumnIfMissing(db, "roti", "close_notified", "INTEGER DEFAULT 0")
+		markClosedROTIsNotified(db, time.Now())
+	}
+
+	if tableExists(db, "email_recipient") {
+		addColumnIfMissing(db, "email_recipient", "confirmed", "INTEGER DEFAULT 0")
+		addColumnIfMissing(db, "email_recipient", "confirmation_sent_at", "TIMESTAMP")
+	}
+
+	// chat voters used to be dated, the table is created again without dates
+	if tableExists(db, "chat_voter") && columnExists(db, "chat_voter", "created_at") {
+		if _, err := db.Exec("ALTER TABLE chat_voter RENAME TO chat_voter_old"); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+
+	createMissingTables(db)
+
+	if tableExists(db, "chat_voter_old") {
+		if _, err := db.Exec("INSERT OR IGNORE INTO chat_voter(roti, voter) SELECT roti, voter FROM chat_voter_old"); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		if _, err := db.Exec("DROP TABLE chat_voter_old"); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		log.Info().Msg("'created_at' column removed from 'chat_voter' table")
+	}
+
 	// look for rows that don't have a value for created_at
 	dbStatement := `UPDATE roti SET created_at = CURRENT_DATE WHERE created_at IS NULL;`
 	_, err := db.Exec(dbStatement)
@@ -140,6 +348,46 @@ func addMissingColumns(db *sql.DB) {
 	}
 }
 
+// addColumnIfMissing adds a column to an existing table, unless it's already there
+// markClosedROTIsNotified records that the ROTIs closed by now were notified.
+// Dates are compared once read, the driver storing them as text
+func markClosedROTIsNotified(db *sql.DB, now time.Time) {
+	rows, err := db.Query("SELECT rotiid, closes_at FROM roti WHERE closes_at IS NOT NULL")
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	var closed []int
+	for rows.Next() {
+		var rotiID int
+		var closesAt sql.NullTime
+		if err := rows.Scan(&rotiID, &closesAt); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		if closesAt.Valid && !closesAt.Time.After(now) {
+			closed = append(closed, rotiID)
+		}
+	}
+	rows.Close()
+	for _, rotiID := range closed {
+		if _, err := db.Exec("UPDATE roti SET close_notified = 1 WHERE rotiid = ?", rotiID); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+}
+
+func addColumnIfMissing(db *sql.DB, tableName, columnName, definition string) {
+	if columnExists(db, tableName, columnName) {
+		return
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s;`, tableName, columnName, definition))
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	log.Info().Msgf("'%s' column added to '%s' table", columnName, tableName)
+}
+
 func columnExists(db *sql.DB, tableName, columnName string) bool {
 	query := `
 		SELECT sql
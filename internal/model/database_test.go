@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -59,3 +60,61 @@ func TestInitTables(t *testing.T) {
 	}
 
 }
+
+func TestRemoveChatVoterDates(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// chat voters of old databases were dated
+	initTables(db)
+	for _, statement := range []string{
+		"DROP TABLE chat_voter",
+		`CREATE TABLE chat_voter ("roti" INTEGER, "voter" TEXT, "created_at" TIMESTAMP, PRIMARY KEY ("roti", "voter"))`,
+		"INSERT INTO chat_voter(roti, voter, created_at) VALUES (1, 'voter', CURRENT_TIMESTAMP)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addMissingColumns(db)
+	if columnExists(db, "chat_voter", "created_at") || tableExists(db, "chat_voter_old") {
+		t.Error("Expected the dates of chat voters to be removed")
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM chat_voter WHERE roti = 1 AND voter = 'voter'").Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected the chat voter to be kept, got %d and %v", count, err)
+	}
+}
+
+func TestMarkClosedROTIsNotified(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// old databases didn't record the notifications of closings
+	initTables(db)
+	if _, err := db.Exec("ALTER TABLE roti DROP COLUMN close_notified"); err != nil {
+		t.Fatal(err)
+	}
+	insert := "INSERT INTO roti(rotiid, description, hide, closes_at) VALUES (?, '', 0, ?)"
+	if _, err := db.Exec(insert, 1, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(insert, 2, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	addMissingColumns(db)
+	for rotiID, expected := range map[int]bool{1: true, 2: false} {
+		var notified bool
+		if err := db.QueryRow("SELECT close_notified FROM roti WHERE rotiid = ?", rotiID).Scan(&notified); err != nil || notified != expected {
+			t.Errorf("Expected ROTI %d to be notified %t, got %t (%v)", rotiID, expected, notified, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidEmail                 = errors.New("invalid email address")
+	ErrNoRecipientMatchingThisToken = errors.New("no email recipient matching this token")
+)
+
+// CheckEmail returns the address of an email, without the name it may come with
+func CheckEmail(value string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(value))
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// GetEmail returns the address receiving the results of the ROTI, empty if none
+func (currentROTI *ROTIEntity) GetEmail() string {
+	return currentROTI.email
+}
+
+// ListROTIsAwaitingResults returns the ROTIs having an email address their
+// results weren't sent to yet, closed or not
+func ListROTIsAwaitingResults() []ROTIID {
+	return queryROTIIDs("SELECT rotiid FROM roti WHERE email IS NOT NULL AND email != '' AND results_emailed = 0 ORDER BY id")
+}
+
+// MarkResultsEmailed records that the results of the ROTI were sent, or
+// won't be
+func (currentROTI *ROTIEntity) MarkResultsEmailed() {
+	if _, err := sqliteDatabase.Exec("UPDATE roti SET results_emailed = 1 WHERE rotiid = ?", int(currentROTI.id)); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// EmailRecipient is an address GroROTI sends emails to, along with the token
+// of its unsubscribe links
+type EmailRecipient struct {
+	Email        string
+	Token        string
+	Unsubscribed bool
+	// Confirmed is set once the recipient followed the confirmation link,
+	// results emails being only sent to confirmed addresses
+	Confirmed bool
+	// ConfirmationSentAt is when the last confirmation link was sent, zero if never
+	ConfirmationSentAt time.Time
+	// DigestSentAt is when the last weekly digest was sent, zero if never
+	DigestSentAt time.Time
+	CreatedAt    time.Time
+}
+
+// GetEmailRecipient returns the recipient of an address, created on the first
+// email sent to it
+func GetEmailRecipient(email string) EmailRecipient {
+	_, err := sqliteDatabase.Exec("INSERT OR IGNORE INTO email_recipient(email, token, created_at) VALUES (?, ?, ?)",
+		email, uuid.NewString(), time.Now())
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	recipient, _ := queryEmailRecipient("email = ?", email)
+	return recipient
+}
+
+// GetEmailRecipientByToken returns the recipient of the token of an unsubscribe link
+func GetEmailRecipientByToken(token string) (EmailRecipient, error) {
+	return queryEmailRecipient("token = ?", token)
+}
+
+// Unsubscribe stops the emails to the recipient of the token
+func Unsubscribe(token string) (EmailRecipient, error) {
+	recipient, err := GetEmailRecipientByToken(token)
+	if err != nil {
+		return recipient, err
+	}
+	if _, err := sqliteDatabase.Exec("UPDATE email_recipient SET unsubscribed = 1 WHERE token = ?", token); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	recipient.Unsubscribed = true
+	log.Info().Msgf("%s unsubscribed from emails", recipient.Email)
+	return recipient, nil
+}
+
+// ConfirmEmailRecipient records that the recipient of the token wants the
+// results emails, even if it unsubscribed before
+func ConfirmEmailRecipient(token string) (EmailRecipient, error) {
+	recipient, err := GetEmailRecipientByToken(token)
+	if err != nil {
+		return recipient, err
+	}
+	if _, err := sqliteDatabase.Exec("UPDATE email_recipient SET confirmed = 1, unsubscribed = 0 WHERE token = ?", token); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	recipient.Confirmed, recipient.Unsubscribed = true, false
+	log.Info().Msgf("%s confirmed to get emails", recipient.Email)
+	return recipient, nil
+}
+
+// RecordConfirmationRequest saves when the confirmation link was sent to the recipient
+func RecordConfirmationRequest(email string, at time.Time) {
+	if _, err := sqliteDatabase.Exec("UPDATE email_recipient SET confirmation_sent_at = ? WHERE email = ?", at, email); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// RecordDigest saves when the last digest was sent to the recipient
+func RecordDigest(email string, at time.Time) {
+	if _, err := sqliteDatabase.Exec("UPDATE email_recipient SET digest_sent_at = ? WHERE email = ?", at, email); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+func queryEmailRecipient(condition string, value string) (recipient EmailRecipient, err error) {
+	var digestSentAt, confirmationSentAt, createdAt sql.NullTime
+	var confirmed sql.NullBool
+	err = sqliteDatabase.QueryRow("SELECT email, token, unsubscribed, confirmed, confirmation_sent_at, digest_sent_at, created_at FROM email_recipient WHERE "+condition, value).
+		Scan(&recipient.Email, &recipient.Token, &recipient.Unsubscribed, &confirmed, &confirmationSentAt, &digestSentAt, &createdAt)
+	if err == sql.ErrNoRows {
+		return recipient, ErrNoRecipientMatchingThisToken
+	} else if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	recipient.Confirmed = confirmed.Bool
+	recipient.ConfirmationSentAt = confirmationSentAt.Time
+	recipient.DigestSentAt = digestSentAt.Time
+	recipient.CreatedAt = createdAt.Time
+	return recipient, nil
+}
+
+// Email is a message in the queue of the SMTP server
+type Email struct {
+	ID        string
+	Recipient string
+	Subject   string
+	// Message is the whole message, headers included
+	Message     []byte
+	Status      DeliveryStatus
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// QueueEmail adds a message to the queue, to be sent right away
+func QueueEmail(recipient, subject string, message []byte) Email {
+	now := time.Now()
+	email := Email{ID: uuid.NewString(), Recipient: recipient, Subject: subject, Message: message, Status: DeliveryPending,
+		NextAttempt: now, CreatedAt: now, UpdatedAt: now}
+	_, err := sqliteDatabase.Exec(`INSERT INTO email(id, recipient, subject, message, status, attempts, next_attempt, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		email.ID, email.Recipient, email.Subject, email.Message, email.Status, email.NextAttempt, email.CreatedAt, email.UpdatedAt)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	return email
+}
+
+// RecordEmailAttempt saves the outcome of an attempt to send an email, next
+// being when to try again if it's still pending
+func RecordEmailAttempt(emailID string, status DeliveryStatus, lastError string, next time.Time) {
+	_, err := sqliteDatabase.Exec(`UPDATE email SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt = ?, updated_at = ?
+		WHERE id = ?`,
+		status, lastError, next, time.Now(), emailID)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// ListDueEmails returns the pending emails whose next attempt is due, oldest first
+func ListDueEmails(now time.Time) (emails []Email) {
+	for _, email := range queryEmails("SELECT id, recipient, subject, message, status, attempts, next_attempt, last_error, created_at, updated_at FROM email WHERE status = 'pending' ORDER BY created_at") {
+		if !email.NextAttempt.After(now) {
+			emails = append(emails, email)
+		}
+	}
+	return
+}
+
+// ListEmails returns the emails sent, or to be sent, to an address, oldest first
+func ListEmails(recipient string) []Email {
+	return queryEmails("SELECT id, recipient, subject, message, status, attempts, next_attempt, last_error, created_at, updated_at FROM email WHERE recipient = ? ORDER BY created_at", recipient)
+}
+
+func queryEmails(query string, args ...any) (emails []Email) {
+	row, err := sqliteDatabase.Query(query, args...)
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var email Email
+		var lastError sql.NullString
+		var nextAttempt, createdAt, updatedAt sql.NullTime
+		if err := row.Scan(&email.ID, &email.Recipient, &email.Subject, &email.Message, &email.Status, &email.Attempts, &nextAttempt,
+			&lastError, &createdAt, &updatedAt); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		email.LastError = lastError.String
+		email.NextAttempt = nextAttempt.Time
+		email.CreatedAt = createdAt.Time
+		email.UpdatedAt = updatedAt.Time
+		emails = append(emails, email)
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckEmail(t *testing.T) {
+	testCases := []struct {
+		value       string
+		expected    string
+		expectedErr error
+	}{
+		{"facilitator@example.com", "facilitator@example.com", nil},
+		{" Jo <Jo@Example.com> ", "jo@example.com", nil},
+		{"not an email", "", ErrInvalidEmail},
+		{"", "", ErrInvalidEmail},
+	}
+	for _, tc := range testCases {
+		if email, err := CheckEmail(tc.value); email != tc.expected || err != tc.expectedErr {
+			t.Errorf("Got %q and %v for %q but expected %q and %v", email, err, tc.value, tc.expected, tc.expectedErr)
+		}
+	}
+}
+
+func TestResultsEmails(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	withEmail := CreateROTIWithOptions(ROTIOptions{Description: "weekly", Email: "facilitator@example.com"}, 30)
+	CreateROTIWithOptions(ROTIOptions{Description: "no email"}, 30)
+	if awaiting := ListROTIsAwaitingResults(); !slices.Equal(awaiting, []ROTIID{withEmail}) {
+		t.Fatalf("Got %v but expected only ROTI %d", awaiting, withEmail.Int())
+	}
+
+	currentROTI, err := GetROTI(withEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currentROTI.GetEmail() != "facilitator@example.com" || currentROTI.NextSessionOptions().Email != "facilitator@example.com" {
+		t.Errorf("Got email %q", currentROTI.GetEmail())
+	}
+	currentROTI.MarkResultsEmailed()
+	if awaiting := ListROTIsAwaitingResults(); len(awaiting) != 0 {
+		t.Errorf("Got %v but expected no ROTI awaiting its results", awaiting)
+	}
+}
+
+func TestEmailRecipients(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	recipient := GetEmailRecipient("facilitator@example.com")
+	if recipient.Token == "" || recipient.Unsubscribed || recipient.Confirmed || !recipient.DigestSentAt.IsZero() {
+		t.Fatalf("Got %+v", recipient)
+	}
+	if again := GetEmailRecipient("facilitator@example.com"); again.Token != recipient.Token {
+		t.Errorf("Got token %s then %s, expected it to be kept", recipient.Token, again.Token)
+	}
+
+	sentAt := time.Now().Add(-time.Hour)
+	RecordDigest(recipient.Email, sentAt)
+	if recipient = GetEmailRecipient(recipient.Email); !recipient.DigestSentAt.Equal(sentAt) {
+		t.Errorf("Got digest sent at %s but expected %s", recipient.DigestSentAt, sentAt)
+	}
+
+	if _, err := Unsubscribe("unknown"); err != ErrNoRecipientMatchingThisToken {
+		t.Errorf("Got %v but expected %v", err, ErrNoRecipientMatchingThisToken)
+	}
+	if _, err := Unsubscribe(recipient.Token); err != nil {
+		t.Fatal(err)
+	}
+	if !GetEmailRecipient(recipient.Email).Unsubscribed {
+		t.Error("Expected the recipient to be unsubscribed")
+	}
+
+	RecordConfirmationRequest(recipient.Email, sentAt)
+	if recipient = GetEmailRecipient(recipient.Email); !recipient.ConfirmationSentAt.Equal(sentAt) {
+		t.Errorf("Got confirmation sent at %s but expected %s", recipient.ConfirmationSentAt, sentAt)
+	}
+	if _, err := ConfirmEmailRecipient("unknown"); err != ErrNoRecipientMatchingThisToken {
+		t.Errorf("Got %v but expected %v", err, ErrNoRecipientMatchingThisToken)
+	}
+	if _, err := ConfirmEmailRecipient(recipient.Token); err != nil {
+		t.Fatal(err)
+	}
+	if recipient = GetEmailRecipient(recipient.Email); !recipient.Confirmed || recipient.Unsubscribed {
+		t.Errorf("Got %+v, expected the recipient to be confirmed and subscribed again", recipient)
+	}
+}
+
+func TestEmailQueue(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	email := QueueEmail("facilitator@example.com", "Results", []byte("Subject: Results\r\n\r\nHello"))
+	now := time.Now()
+	due := ListDueEmails(now)
+	if len(due) != 1 || due[0].ID != email.ID || string(due[0].Message) != string(email.Message) {
+		t.Fatalf("Got %+v", due)
+	}
+
+	RecordEmailAttempt(email.ID, DeliveryPending, "421 try again later", now.Add(time.Minute))
+	if due := ListDueEmails(now); len(due) != 0 {
+		t.Errorf("Got %+v but expected the email to wait for its retry", due)
+	}
+	RecordEmailAttempt(email.ID, DeliveryDelivered, "", time.Time{})
+	emails := ListEmails("facilitator@example.com")
+	if len(emails) != 1 || emails[0].Status != DeliveryDelivered || emails[0].Attempts != 2 || emails[0].LastError != "" {
+		t.Errorf("Got %+v", emails)
+	}
+	if due := ListDueEmails(now.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("Got %+v but expected no email left to send", due)
+	}
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoVoteMatchingThisID  = errors.New("no vote of this ROTI matching this ID")
+	ErrInvalidFeedbackStatus = errors.New("invalid feedback status")
+)
+
+// FeedbackID identifies the feedbacks of a vote on the results page. It's
+// distinct from the vote ID, published along with the vote value in the raw
+// exports, so that anonymous feedbacks can't be tied to their vote
+type FeedbackID string
+
+func (id FeedbackID) String() string {
+	return string(id)
+}
+
+// FeedbackStatus tells if the feedbacks of a vote are published
+type FeedbackStatus string
+
+const (
+	FeedbackVisible FeedbackStatus = "visible"
+	// FeedbackHeld feedbacks wait for the owner of the ROTI to review them
+	FeedbackHeld FeedbackStatus = "held"
+	// FeedbackHidden feedbacks were hidden by the owner of the ROTI. They are
+	// kept in the database and still appear in the CSV export
+	FeedbackHidden FeedbackStatus = "hidden"
+)
+
+// publishedFeedback is the SQL condition matching votes whose feedbacks can be shown
+const publishedFeedback = "(vote.status IS NULL OR vote.status = 'visible')"
+
+// FeedbackItem gathers every text sent along with a vote, for moderation purposes
+type FeedbackItem struct {
+	ID     FeedbackID
+	Value  float64
+	Text   string
+	Status FeedbackStatus
+	// Reply is the public answer of the owner of the ROTI
+	Reply string
+}
+
+func CheckFeedbackStatus(status string) (FeedbackStatus, error) {
+	switch FeedbackStatus(status) {
+	case FeedbackVisible, FeedbackHeld, FeedbackHidden:
+		return FeedbackStatus(status), nil
+	}
+	return "", ErrInvalidFeedbackStatus
+}
+
+// NeedsReview tells if new feedbacks are held until the owner approves them
+func (currentROTI *ROTIEntity) NeedsReview() bool {
+	return currentROTI.review
+}
+
+// ListFeedbackItems returns all the votes that came with some text, whatever
+// their status. Feedback, answers and follow-up are joined in Text
+func (currentROTI *ROTIEntity) ListFeedbackItems() (items []FeedbackItem) {
+	row, err := sqliteDatabase.Query(`SELECT vote.feedback_id, vote.value, vote.feedback, vote.followup, vote.status, vote.reply,
+		(SELECT GROUP_CONCAT(answer.text, ' | ') FROM answer WHERE answer.vote = vote.id)
+		FROM vote WHERE vote.roti = ? ORDER BY vote.rowid`, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var item FeedbackItem
+		var feedback, followUp, status, reply, answers sql.NullString
+		if err := row.Scan(&item.ID, &item.Value, &feedback, &followUp, &status, &reply, &answers); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+
+		var texts []string
+		for _, text := range []sql.NullString{feedback, answers, followUp} {
+			if text.String != "" {
+				texts = append(texts, text.String)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		item.Text = strings.Join(texts, " | ")
+		item.Reply = reply.String
+
+		item.Status = FeedbackStatus(status.String)
+		if item.Status == "" {
+			item.Status = FeedbackVisible
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+// SetFeedbackStatus publishes, holds or hides the feedbacks of a vote of this ROTI
+func (currentROTI *ROTIEntity) SetFeedbackStatus(feedbackID FeedbackID, status FeedbackStatus) error {
+	result, err := sqliteDatabase.Exec("UPDATE vote SET status = ? WHERE feedback_id = ? AND roti = ?", status, feedbackID, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNoVoteMatchingThisID
+	}
+	log.Info().Msgf("feedback %s of ROTI %d set to %s", feedbackID, int(currentROTI.id), status)
+	return nil
+}
+
+// ReplyToFeedback attaches a public reply of the owner to a feedback of this
+// ROTI. An empty reply removes it
+func (currentROTI *ROTIEntity) ReplyToFeedback(feedbackID FeedbackID, reply string) error {
+	result, err := sqliteDatabase.Exec("UPDATE vote SET reply = ? WHERE feedback_id = ? AND roti = ?", strings.TrimSpace(reply), feedbackID, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNoVoteMatchingThisID
+	}
+	log.Info().Msgf("reply to feedback %s of ROTI %d updated", feedbackID, int(currentROTI.id))
+	return nil
+}
+
+// ListFeedbackTexts returns the raw texts of the published feedbacks, answers
+// to the prompts and follow-ups included, without the value of their vote
+func (currentROTI *ROTIEntity) ListFeedbackTexts() (texts []string) {
+	row, err := sqliteDatabase.Query(`SELECT vote.feedback FROM vote WHERE vote.roti = ? AND `+publishedFeedback+`
+		UNION ALL SELECT vote.followup FROM vote WHERE vote.roti = ? AND `+publishedFeedback+`
+		UNION ALL SELECT answer.text FROM answer JOIN vote ON vote.id = answer.vote WHERE answer.roti = ? AND `+publishedFeedback,
+		int(currentROTI.id), int(currentROTI.id), int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var text sql.NullString
+		if err := row.Scan(&text); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		if text.String != "" {
+			texts = append(texts, text.String)
+		}
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetFeedbackStatus(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTIWithOptions(ROTIOptions{Description: "moderation", Feedback: true}, 30)
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rude, err := roti.CastBallot(Ballot{Value: 1, Feedback: "rude"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roti.CastBallot(Ballot{Value: 4, Feedback: "held", Status: FeedbackHeld}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roti.CastBallot(Ballot{Value: 5, Feedback: "nice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := roti.SetFeedbackStatus(feedbackIDOf(t, rude), FeedbackHidden); err != nil {
+		t.Fatal(err)
+	}
+	// feedbacks are moderated by their own ID, not by the ID of their vote
+	for _, feedbackID := range []FeedbackID{"unknown", FeedbackID(rude)} {
+		if err := roti.SetFeedbackStatus(feedbackID, FeedbackHidden); err != ErrNoVoteMatchingThisID {
+			t.Errorf("Got %v but expected %v", err, ErrNoVoteMatchingThisID)
+		}
+	}
+
+	if feedbacks := roti.ListFeedbacks(); !reflect.DeepEqual(feedbacks, []string{"(5.0) nice"}) {
+		t.Errorf("Got feedbacks %v but only the published one was expected", feedbacks)
+	}
+
+	if texts := roti.ListFeedbackTexts(); !reflect.DeepEqual(texts, []string{"nice"}) {
+		t.Errorf("Got texts %v but only the published one was expected", texts)
+	}
+
+	items := roti.ListFeedbackItems()
+	var statuses []FeedbackStatus
+	for _, item := range items {
+		statuses = append(statuses, item.Status)
+	}
+	expected := []FeedbackStatus{FeedbackHidden, FeedbackHeld, FeedbackVisible}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Got statuses %v but expected %v", statuses, expected)
+	}
+}
+
+func TestCheckFeedbackStatus(t *testing.T) {
+	if _, err := CheckFeedbackStatus("hidden"); err != nil {
+		t.Errorf("Got %v for a valid status", err)
+	}
+	if _, err := CheckFeedbackStatus("deleted"); err != ErrInvalidFeedbackStatus {
+		t.Errorf("Got %v but expected %v", err, ErrInvalidFeedbackStatus)
+	}
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoLoginMatchingThisState    = errors.New("no login matching this state")
+	ErrNoSessionMatchingThisCookie = errors.New("no session matching this cookie")
+)
+
+// LoginState is what GroROTI remembers of a user sent to the OpenID Connect
+// provider, until they come back
+type LoginState struct {
+	State string
+	// Verifier is the PKCE code verifier of the login
+	Verifier string
+	Nonce    string
+	// Next is the page to send the user back to once logged in
+	Next      string
+	CreatedAt time.Time
+}
+
+// SaveLoginState remembers a login until the user comes back from the provider
+func SaveLoginState(login LoginState) {
+	_, err := sqliteDatabase.Exec("INSERT INTO login_state(state, verifier, nonce, next, created_at) VALUES (?, ?, ?, ?, ?)",
+		login.State, login.Verifier, login.Nonce, login.Next, time.Now())
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+// TakeLoginState returns the login of the state and forgets it, so it can't
+// be used twice. Logins older than maxAge are refused
+func TakeLoginState(state string, maxAge time.Duration) (login LoginState, err error) {
+	var createdAt sql.NullTime
+	err = sqliteDatabase.QueryRow("SELECT state, verifier, nonce, next, created_at FROM login_state WHERE state = ?", state).
+		Scan(&login.State, &login.Verifier, &login.Nonce, &login.Next, &createdAt)
+	if err == sql.ErrNoRows {
+		return login, ErrNoLoginMatchingThisState
+	} else if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	login.CreatedAt = createdAt.Time
+
+	// abandoned logins go away along with this one
+	_, err = sqliteDatabase.Exec("DELETE FROM login_state WHERE state = ? OR created_at < ?", state, time.Now().Add(-maxAge))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if time.Since(login.CreatedAt) > maxAge {
+		return login, ErrNoLoginMatchingThisState
+	}
+	return login, nil
+}
+
+// User is a user logged in with OpenID Connect
+type User struct {
+	// Subject identifies the user at the provider
+	Subject string
+	Email   string
+	Name    string
+	// Admin users can access the admin pages
+	Admin bool
+}
+
+// sessionID is what's stored of the cookie of a session, so the database
+// doesn't hold usable cookies
+func sessionID(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession logs a user in for the duration and returns the value of
+// the cookie of the session
+func CreateSession(user User, duration time.Duration) string {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	cookie := base64.RawURLEncoding.EncodeToString(random)
+
+	now := time.Now()
+	// expired sessions go away when new ones start
+	if _, err := sqliteDatabase.Exec("DELETE FROM login_session WHERE expires_at < ?", now); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	_, err := sqliteDatabase.Exec("INSERT INTO login_session(id, subject, email, name, admin, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sessionID(cookie), user.Subject, user.Email, user.Name, user.Admin, now.Add(duration), now)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	log.Info().Msgf("%s logged in", user.Email)
+	return cookie
+}
+
+// GetSession returns the user logged in with the cookie
+func GetSession(cookie string) (user User, err error) {
+	var expiresAt sql.NullTime
+	err = sqliteDatabase.QueryRow("SELECT subject, email, name, admin, expires_at FROM login_session WHERE id = ?", sessionID(cookie)).
+		Scan(&user.Subject, &user.Email, &user.Name, &user.Admin, &expiresAt)
+	if err == sql.ErrNoRows {
+		return user, ErrNoSessionMatchingThisCookie
+	} else if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if !expiresAt.Time.After(time.Now()) {
+		return User{}, ErrNoSessionMatchingThisCookie
+	}
+	return user, nil
+}
+
+// DeleteSession logs the user of the cookie out
+func DeleteSession(cookie string) {
+	if _, err := sqliteDatabase.Exec("DELETE FROM login_session WHERE id = ?", sessionID(cookie)); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoginStates(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	SaveLoginState(LoginState{State: "state", Verifier: "verifier", Nonce: "nonce", Next: "/mine"})
+	login, err := TakeLoginState("state", 10*time.Minute)
+	if err != nil || login.Verifier != "verifier" || login.Nonce != "nonce" || login.Next != "/mine" {
+		t.Fatalf("Expected the saved login, got %+v and %v", login, err)
+	}
+	if _, err := TakeLoginState("state", 10*time.Minute); err != ErrNoLoginMatchingThisState {
+		t.Errorf("Expected %v when using a state twice, got %v", ErrNoLoginMatchingThisState, err)
+	}
+
+	SaveLoginState(LoginState{State: "old", Verifier: "verifier", Nonce: "nonce", Next: "/"})
+	if _, err := TakeLoginState("old", -time.Second); err != ErrNoLoginMatchingThisState {
+		t.Errorf("Expected %v for an expired login, got %v", ErrNoLoginMatchingThisState, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	jane := User{Subject: "jane", Email: "jane@example.com", Name: "Jane", Admin: true}
+	cookie := CreateSession(jane, time.Hour)
+	if user, err := GetSession(cookie); err != nil || user != jane {
+		t.Fatalf("Expected Jane to be logged in, got %+v and %v", user, err)
+	}
+	if _, err := GetSession("forged"); err != ErrNoSessionMatchingThisCookie {
+		t.Errorf("Expected %v for an unknown cookie, got %v", ErrNoSessionMatchingThisCookie, err)
+	}
+	DeleteSession(cookie)
+	if _, err := GetSession(cookie); err != ErrNoSessionMatchingThisCookie {
+		t.Errorf("Expected %v once logged out, got %v", ErrNoSessionMatchingThisCookie, err)
+	}
+
+	expired := CreateSession(jane, -time.Second)
+	if _, err := GetSession(expired); err != ErrNoSessionMatchingThisCookie {
+		t.Errorf("Expected %v for an expired session, got %v", ErrNoSessionMatchingThisCookie, err)
+	}
+}
+
+func TestListCreatorROTIs(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	first := CreateROTIWithOptions(ROTIOptions{Description: "first", Creator: "jane"}, 30)
+	hidden := CreateROTIWithOptions(ROTIOptions{Description: "hidden", Hide: true, Creator: "jane"}, 30)
+	CreateROTIWithOptions(ROTIOptions{Description: "someone else's", Creator: "john"}, 30)
+	CreateROTIWithOptions(ROTIOptions{Description: "anonymous"}, 30)
+
+	if rotis := ListCreatorROTIs("jane"); !slices.Equal(rotis, []ROTIID{hidden, first}) {
+		t.Errorf("Expected ROTIs %d and %d, got %v", hidden.Int(), first.Int(), rotis)
+	}
+	if rotis := ListCreatorROTIs(""); rotis != nil {
+		t.Errorf("Expected no ROTIs without a creator, got %v", rotis)
+	}
+
+	currentROTI, err := GetROTI(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currentROTI.GetCreator() != "jane" || currentROTI.NextSessionOptions().Creator != "jane" {
+		t.Errorf("Expected the ROTI and its next session to be created by jane, got %q and %q",
+			currentROTI.GetCreator(), currentROTI.NextSessionOptions().Creator)
+	}
+}
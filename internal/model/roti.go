@@ -1,19 +1,26 @@
 package model
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
 var (
 	ErrInvalidROTIID = errors.New("invalid ROTI ID")
+	ErrROTIClosed    = errors.New("this ROTI is closed")
+	ErrROTINotOpen   = errors.New("this ROTI doesn't accept votes yet")
 )
 
 type ROTIEntity struct {
@@ -21,6 +28,62 @@ type ROTIEntity struct {
 	description string
 	hide        bool
 	feedback    bool
+	blind       bool
+	revealed    bool
+	closesAt    time.Time
+	opensAt     time.Time
+	ownerToken  string
+	minVotes    int
+	anonymous   bool
+	// prompts of structured feedbacks, separated by new lines
+	prompts  string
+	lowRule  FollowUpRule
+	highRule FollowUpRule
+	review   bool
+	// series links the sessions of a recurring meeting
+	series string
+	// email receives the results once the ROTI is closed
+	email string
+	// creator is the subject of the user who created the ROTI, when logins
+	// are enabled
+	creator   string
+	createdAt time.Time
+}
+
+// FollowUpRule asks an extra question to participants whose vote is under
+// (low rule) or over (high rule) the threshold. Rules without a question are disabled
+type FollowUpRule struct {
+	Threshold float64
+	Question  string
+}
+
+// ROTIOptions holds everything that can be chosen when creating a ROTI
+type ROTIOptions struct {
+	Description string
+	Hide        bool
+	Feedback    bool
+	// Blind ROTIs only display their number of votes until results are revealed
+	// by their owner or the ROTI is closed
+	Blind      bool
+	OwnerToken string
+	// MinVotes overrides the global anonymity threshold when not 0
+	MinVotes int
+	// AnonymousFeedback shuffles feedbacks and drops their vote value
+	AnonymousFeedback bool
+	// Prompts turn the feedback textbox into one textbox per prompt
+	Prompts []string
+	// LowRule applies to votes lower or equal to its threshold, HighRule to
+	// votes greater or equal to its threshold
+	LowRule  FollowUpRule
+	HighRule FollowUpRule
+	// HoldForReview keeps feedbacks hidden until the owner approves them
+	HoldForReview bool
+	// Series links the ROTI to the previous sessions of a recurring meeting
+	Series string
+	// Email receives the results once the ROTI is closed
+	Email string
+	// Creator is the subject of the user creating the ROTI, when logins are enabled
+	Creator string
 }
 
 type ROTIID int
@@ -57,37 +120,77 @@ func NewROTIEntity(id ROTIID, description string, hide, feedback bool) (roti ROT
 func GetROTI(rotiid ROTIID) (roti ROTIEntity, err error) {
 	var description string
 	var hide, feedback bool
-
-	row, err := sqliteDatabase.Query("SELECT description,hide,feedback FROM roti WHERE rotiid =" + strconv.Itoa(int(rotiid)))
+	var blind, revealed sql.NullBool
+	var closesAt, opensAt sql.NullTime
+	var ownerToken sql.NullString
+	var minVotes sql.NullInt64
+	var anonymous sql.NullBool
+	var prompts sql.NullString
+	var lowThreshold, highThreshold sql.NullFloat64
+	var lowQuestion, highQuestion sql.NullString
+	var review sql.NullBool
+	var series sql.NullString
+	var email sql.NullString
+	var creator sql.NullString
+	var createdAt sql.NullTime
+
+	row, err := sqliteDatabase.Query("SELECT description,hide,feedback,blind,revealed,closes_at,owner_token,min_votes,anonymous_feedback,prompts,low_threshold,low_question,high_threshold,high_question,review,series,email,creator,created_at,opens_at FROM roti WHERE rotiid =" + strconv.Itoa(int(rotiid)))
 	if err != nil {
 		log.Fatal().Msgf(err.Error())
 	}
 	defer row.Close()
 
 	row.Next()
-	err = row.Scan(&description, &hide, &feedback)
+	err = row.Scan(&description, &hide, &feedback, &blind, &revealed, &closesAt, &ownerToken, &minVotes, &anonymous, &prompts, &lowThreshold, &lowQuestion, &highThreshold, &highQuestion, &review, &series, &email, &creator, &createdAt, &opensAt)
 	if err != nil {
 		return ROTIEntity{}, err
 	}
-	return NewROTIEntity(rotiid, description, hide, feedback), nil
+	roti = NewROTIEntity(rotiid, description, hide, feedback)
+	roti.blind = blind.Bool
+	roti.revealed = revealed.Bool
+	roti.closesAt = closesAt.Time
+	roti.opensAt = opensAt.Time
+	roti.ownerToken = ownerToken.String
+	roti.minVotes = int(minVotes.Int64)
+	roti.anonymous = anonymous.Bool
+	roti.prompts = prompts.String
+	roti.lowRule = FollowUpRule{Threshold: lowThreshold.Float64, Question: lowQuestion.String}
+	roti.highRule = FollowUpRule{Threshold: highThreshold.Float64, Question: highQuestion.String}
+	roti.review = review.Bool
+	roti.series = series.String
+	roti.email = email.String
+	roti.creator = creator.String
+	roti.createdAt = createdAt.Time
+	return roti, nil
 }
 
 func insertROTI(db *sql.DB, roti ROTIEntity) {
 	id := int(roti.GetID())
-	log.Info().Msgf("inserting ROTI record %d (%s) hidden:%t feedback:%t", id, roti.description, roti.hide, roti.feedback)
-	insertROTISQL := `INSERT INTO ROTI(rotiid, description, hide, feedback) VALUES (?, ?, ?, ?)`
+	log.Info().Msgf("inserting ROTI record %d (%s) hidden:%t feedback:%t blind:%t", id, roti.description, roti.hide, roti.feedback, roti.blind)
+	insertROTISQL := `INSERT INTO ROTI(rotiid, description, hide, feedback, blind, owner_token, min_votes, anonymous_feedback, prompts,
+		low_threshold, low_question, high_threshold, high_question, review, series, email, creator) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	statement, err := db.Prepare(insertROTISQL)
 
 	if err != nil {
 		log.Fatal().Msgf(err.Error())
 	}
-	_, err = statement.Exec(id, roti.description, roti.hide, roti.feedback)
+	_, err = statement.Exec(id, roti.description, roti.hide, roti.feedback, roti.blind, roti.ownerToken, roti.minVotes, roti.anonymous, roti.prompts,
+		roti.lowRule.Threshold, roti.lowRule.Question, roti.highRule.Threshold, roti.highRule.Question, roti.review, roti.series, roti.email, roti.creator)
 	if err != nil {
 		log.Fatal().Msgf(err.Error())
 	}
 }
 
+// NewOwnerToken generates the secret allowing the creator of a ROTI to manage it
+func NewOwnerToken() string {
+	return uuid.NewString()
+}
+
 func CreateROTI(description string, hide, feedback bool, clean int) (rotiID ROTIID) {
+	return CreateROTIWithOptions(ROTIOptions{Description: description, Hide: hide, Feedback: feedback}, clean)
+}
+
+func CreateROTIWithOptions(options ROTIOptions, clean int) (rotiID ROTIID) {
 	// before doing anything, run a check to see if we can clean some old ROTIs
 	log.Info().Msgf("searching for opportunistic cleaning on the ROTI database")
 	cleanOldROTIs(sqliteDatabase, clean)
@@ -110,7 +213,19 @@ func CreateROTI(description string, hide, feedback bool, clean int) (rotiID ROTI
 		panic(ErrNoFreeIDs)
 	}
 
-	insertROTI(sqliteDatabase, NewROTIEntity(rotiID, description, hide, feedback))
+	newROTI := NewROTIEntity(rotiID, options.Description, options.Hide, options.Feedback)
+	newROTI.blind = options.Blind
+	newROTI.ownerToken = options.OwnerToken
+	newROTI.minVotes = options.MinVotes
+	newROTI.anonymous = options.AnonymousFeedback
+	newROTI.prompts = joinPrompts(options.Prompts)
+	newROTI.lowRule = options.LowRule
+	newROTI.highRule = options.HighRule
+	newROTI.review = options.HoldForReview
+	newROTI.series = options.Series
+	newROTI.email = options.Email
+	newROTI.creator = options.Creator
+	insertROTI(sqliteDatabase, newROTI)
 
 	return
 }
@@ -161,6 +276,41 @@ func cleanOldROTIs(db *sql.DB, clean int) {
 			continue
 		}
 		log.Info().Msgf("votes deleted for ROTI ID %d/%d", rotiID.rotiid, rotiID.id)
+
+		_, err = db.Exec("DELETE FROM answer WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting answers for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM upvote WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting upvotes for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM action WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting actions for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM delivery WHERE webhook IN (SELECT id FROM webhook WHERE roti = ?)", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting webhook deliveries for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM webhook WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting webhooks for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM chat_voter WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting chat voters for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
+
+		_, err = db.Exec("DELETE FROM calendar_event WHERE roti = ?", rotiID.rotiid)
+		if err != nil {
+			log.Error().Msgf("error deleting calendar events for ROTI ID %d/%d: %s", rotiID.rotiid, rotiID.id, err.Error())
+		}
 	}
 
 	// Delete old ROTIs
@@ -170,6 +320,12 @@ func cleanOldROTIs(db *sql.DB, clean int) {
 		return
 	}
 
+	// emails quote the results of ROTIs, they go away along with them
+	_, err = db.Exec("DELETE FROM email WHERE created_at < ?", cleanOverTime)
+	if err != nil {
+		log.Error().Msgf("error cleaning old emails: %s", err.Error())
+	}
+
 	log.Info().Msgf("old ROTIs cleaned up successfully")
 }
 
@@ -192,6 +348,51 @@ func ListROTIs() (rotis []ShortROTIInfo) {
 	return
 }
 
+// sqliteTimeLayout is the format of the timestamps set by CURRENT_TIMESTAMP
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// ListROTIsCreatedBetween returns the visible ROTIs created from the first day
+// to the last one included, oldest first
+func ListROTIsCreatedBetween(from, to time.Time) (rotiIDs []ROTIID) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	return queryROTIIDs("SELECT rotiid FROM roti WHERE hide = FALSE AND created_at >= ? AND created_at < ? ORDER BY created_at, id",
+		start.Format(sqliteTimeLayout), end.Format(sqliteTimeLayout))
+}
+
+// ListCreatorROTIs returns the ROTIs created by a user, hidden ones included,
+// newest first
+func ListCreatorROTIs(creator string) (rotiIDs []ROTIID) {
+	if creator == "" {
+		return nil
+	}
+	return queryROTIIDs("SELECT rotiid FROM roti WHERE creator = ? ORDER BY id DESC", creator)
+}
+
+// ListSeriesROTIs returns the sessions of a recurring meeting, oldest first
+func ListSeriesROTIs(series string) (rotiIDs []ROTIID) {
+	if series == "" {
+		return nil
+	}
+	return queryROTIIDs("SELECT rotiid FROM roti WHERE series = ? ORDER BY id", series)
+}
+
+func queryROTIIDs(query string, args ...any) (rotiIDs []ROTIID) {
+	rows, err := sqliteDatabase.Query(query, args...)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rotiid int
+		if err := rows.Scan(&rotiid); err != nil {
+			log.Fatal().Msgf(err.Error())
+		}
+		rotiIDs = append(rotiIDs, ROTIID(rotiid))
+	}
+	return
+}
+
 func CountROTIs() int {
 	var count int
 	err := sqliteDatabase.QueryRow("SELECT COUNT(*) FROM roti").Scan(&count)
@@ -225,6 +426,11 @@ func (currentROTI *ROTIEntity) GetDescription() string {
 	return currentROTI.description
 }
 
+// GetCreatedAt returns the creation date of the ROTI, in UTC
+func (currentROTI *ROTIEntity) GetCreatedAt() time.Time {
+	return currentROTI.createdAt
+}
+
 func (currentROTI *ROTIEntity) IsHidden() bool {
 	return currentROTI.hide
 }
@@ -233,13 +439,257 @@ func (currentROTI *ROTIEntity) HasFeedback() bool {
 	return currentROTI.feedback
 }
 
+func (currentROTI *ROTIEntity) IsBlind() bool {
+	return currentROTI.blind
+}
+
+func (currentROTI *ROTIEntity) IsRevealed() bool {
+	return currentROTI.revealed
+}
+
+// IsClosed tells if the closing date of the ROTI has passed
+func (currentROTI *ROTIEntity) IsClosed() bool {
+	return !currentROTI.closesAt.IsZero() && !currentROTI.closesAt.After(time.Now())
+}
+
+// NotOpenYet tells if the ROTI has an opening date that hasn't come yet
+func (currentROTI *ROTIEntity) NotOpenYet() bool {
+	return currentROTI.opensAt.After(time.Now())
+}
+
+// ResultsVisible is false for blind ROTIs that are neither revealed nor closed
+func (currentROTI *ROTIEntity) ResultsVisible() bool {
+	return !currentROTI.blind || currentROTI.revealed || currentROTI.IsClosed()
+}
+
+// IsOwnedBy checks the given token against the one generated at creation.
+// ROTIs created before owner tokens existed can't be managed by anyone
+func (currentROTI *ROTIEntity) IsOwnedBy(token string) bool {
+	return currentROTI.ownerToken != "" && subtle.ConstantTimeCompare([]byte(currentROTI.ownerToken), []byte(token)) == 1
+}
+
+// GetPresenterToken returns the token of the presenter mode, only allowing to
+// show and reveal the results. It's derived from the owner token, which can't
+// be found back from it, so links to the presenter mode can be shared
+func (currentROTI *ROTIEntity) GetPresenterToken() string {
+	if currentROTI.ownerToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("presenter:" + currentROTI.ownerToken))
+	return hex.EncodeToString(sum[:16])
+}
+
+// IsPresentedBy checks the given token against the presenter token
+func (currentROTI *ROTIEntity) IsPresentedBy(token string) bool {
+	presenterToken := currentROTI.GetPresenterToken()
+	return presenterToken != "" && subtle.ConstantTimeCompare([]byte(presenterToken), []byte(token)) == 1
+}
+
+// GetMinVotes returns the anonymity threshold of this ROTI, 0 meaning the
+// global one applies
+func (currentROTI *ROTIEntity) GetMinVotes() int {
+	return currentROTI.minVotes
+}
+
+// GetPrompts returns the prompts of structured feedbacks, nil for free text feedbacks
+func (currentROTI *ROTIEntity) GetPrompts() (prompts []string) {
+	if currentROTI.prompts == "" {
+		return nil
+	}
+	return strings.Split(currentROTI.prompts, "\n")
+}
+
+func joinPrompts(prompts []string) string {
+	var cleaned []string
+	for _, prompt := range prompts {
+		prompt = strings.Join(strings.Fields(prompt), " ")
+		if prompt != "" {
+			cleaned = append(cleaned, prompt)
+		}
+	}
+	return strings.Join(cleaned, "\n")
+}
+
+func (currentROTI *ROTIEntity) GetLowRule() FollowUpRule {
+	return currentROTI.lowRule
+}
+
+func (currentROTI *ROTIEntity) GetHighRule() FollowUpRule {
+	return currentROTI.highRule
+}
+
+// FollowUpQuestion returns the follow-up question matching the vote, if any.
+// The low rule wins when both rules match
+func (currentROTI *ROTIEntity) FollowUpQuestion(vote float64) (question string, ok bool) {
+	if currentROTI.lowRule.Question != "" && vote <= currentROTI.lowRule.Threshold {
+		return currentROTI.lowRule.Question, true
+	}
+	if currentROTI.highRule.Question != "" && vote >= currentROTI.highRule.Threshold {
+		return currentROTI.highRule.Question, true
+	}
+	return "", false
+}
+
+func (currentROTI *ROTIEntity) HasAnonymousFeedback() bool {
+	return currentROTI.anonymous
+}
+
+func (currentROTI *ROTIEntity) GetOwnerToken() string {
+	return currentROTI.ownerToken
+}
+
+// GetCreator returns the subject of the user who created the ROTI, empty if
+// it was created without logging in
+func (currentROTI *ROTIEntity) GetCreator() string {
+	return currentROTI.creator
+}
+
+// GetSeries returns the identifier shared by the sessions of a recurring
+// meeting, empty if the ROTI isn't part of one
+func (currentROTI *ROTIEntity) GetSeries() string {
+	return currentROTI.series
+}
+
+// StartSeries makes this ROTI the first session of a recurring meeting, if it
+// isn't part of one yet, and returns the identifier of its series
+func (currentROTI *ROTIEntity) StartSeries() string {
+	if currentROTI.series != "" {
+		return currentROTI.series
+	}
+	series := uuid.NewString()
+	_, err := sqliteDatabase.Exec("UPDATE roti SET series = ? WHERE rotiid = ?", series, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	// actions created before the series started carry over as well
+	_, err = sqliteDatabase.Exec("UPDATE action SET series = ? WHERE roti = ?", series, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	currentROTI.series = series
+	return series
+}
+
+// NextSessionOptions returns the options of this ROTI, to create the next
+// session of its recurring meeting. The series must have been started first
+func (currentROTI *ROTIEntity) NextSessionOptions() ROTIOptions {
+	return ROTIOptions{
+		Description:       currentROTI.description,
+		Hide:              currentROTI.hide,
+		Feedback:          currentROTI.feedback,
+		Blind:             currentROTI.blind,
+		MinVotes:          currentROTI.minVotes,
+		AnonymousFeedback: currentROTI.anonymous,
+		Prompts:           currentROTI.GetPrompts(),
+		LowRule:           currentROTI.lowRule,
+		HighRule:          currentROTI.highRule,
+		HoldForReview:     currentROTI.review,
+		Series:            currentROTI.series,
+		Email:             currentROTI.email,
+		Creator:           currentROTI.creator,
+	}
+}
+
+// Reveal makes the results of a blind ROTI visible to everyone
+func (currentROTI *ROTIEntity) Reveal() {
+	_, err := sqliteDatabase.Exec("UPDATE roti SET revealed = TRUE WHERE rotiid = ?", int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	currentROTI.revealed = true
+}
+
+// CloseAt schedules the end of the votes, unless the ROTI is already closed
+func (currentROTI *ROTIEntity) CloseAt(at time.Time) {
+	if currentROTI.IsClosed() {
+		return
+	}
+	_, err := sqliteDatabase.Exec("UPDATE roti SET closes_at = ? WHERE rotiid = ?", at, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	currentROTI.closesAt = at
+}
+
+// GetClosesAt returns when the ROTI stops accepting votes, zero if it isn't
+// scheduled
+func (currentROTI *ROTIEntity) GetClosesAt() time.Time {
+	return currentROTI.closesAt
+}
+
+// OpenAt schedules the start of the votes, which are refused before
+func (currentROTI *ROTIEntity) OpenAt(at time.Time) {
+	_, err := sqliteDatabase.Exec("UPDATE roti SET opens_at = ? WHERE rotiid = ?", at, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	currentROTI.opensAt = at
+}
+
+// GetOpensAt returns when the ROTI starts accepting votes, zero if it always did
+func (currentROTI *ROTIEntity) GetOpensAt() time.Time {
+	return currentROTI.opensAt
+}
+
+// Close stops the ROTI from accepting new votes
+func (currentROTI *ROTIEntity) Close() {
+	if currentROTI.IsClosed() {
+		return
+	}
+	now := time.Now()
+	_, err := sqliteDatabase.Exec("UPDATE roti SET closes_at = ? WHERE rotiid = ?", now, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	currentROTI.closesAt = now
+}
+
+// ListROTIsClosing returns the ROTIs with a closing date whose closing wasn't
+// notified yet, closed or not
+func ListROTIsClosing() []ROTIID {
+	return queryROTIIDs("SELECT rotiid FROM roti WHERE closes_at IS NOT NULL AND close_notified = 0 ORDER BY id")
+}
+
+// ClaimCloseNotification records that the closing of the ROTI is notified. It
+// tells if the caller is the one to notify it, which happens once
+func (currentROTI *ROTIEntity) ClaimCloseNotification() bool {
+	result, err := sqliteDatabase.Exec("UPDATE roti SET close_notified = 1 WHERE rotiid = ? AND close_notified = 0", int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	return claimed == 1
+}
+
 func (currentROTI *ROTIEntity) AddVoteToROTI(value float64, feedback string) (err error) {
-	currentVote, err := NewVoteEntity(value)
+	_, err = currentROTI.CastBallot(Ballot{Value: value, Feedback: feedback})
+	return
+}
+
+// CastBallot records a vote and everything that comes with it
+func (currentROTI *ROTIEntity) CastBallot(ballot Ballot) (voteID VoteID, err error) {
+	if currentROTI.IsClosed() {
+		return "", ErrROTIClosed
+	}
+	if currentROTI.NotOpenYet() {
+		return "", ErrROTINotOpen
+	}
+	if _, ok := currentROTI.FollowUpQuestion(ballot.Value); !ok && ballot.FollowUp != "" {
+		return "", ErrUnexpectedFollowUp
+	}
+	currentVote, err := NewVoteEntity(ballot.Value)
 	if err != nil {
-		return fmt.Errorf("%w: %s", ErrInvalidVoteID, err)
+		return "", fmt.Errorf("%w: %s", ErrInvalidVoteID, err)
+	}
+	if ballot.Status == "" {
+		ballot.Status = FeedbackVisible
 	}
-	insertVote(sqliteDatabase, currentVote, currentROTI.id, feedback)
-	return nil
+	insertVote(sqliteDatabase, currentVote, currentROTI.id, ballot)
+	insertAnswers(sqliteDatabase, currentVote, currentROTI.id, ballot.Answers)
+	return currentVote.ID(), nil
 }
 
 func (currentROTI *ROTIEntity) CountVotes() int {
@@ -311,7 +761,7 @@ func (currentROTI *ROTIEntity) VotesAverage() float64 {
 func (currentROTI *ROTIEntity) ListFeedbacks() (feedbacks []string) {
 	var feedback string
 	var value float32
-	row, err := sqliteDatabase.Query("SELECT value, feedback FROM vote WHERE roti =" + strconv.Itoa(int(currentROTI.id)))
+	row, err := sqliteDatabase.Query("SELECT value, feedback FROM vote WHERE roti =" + strconv.Itoa(int(currentROTI.id)) + " AND " + publishedFeedback)
 	if err != nil {
 		log.Fatal().Msgf("couldn't connect to database")
 	}
@@ -326,3 +776,112 @@ func (currentROTI *ROTIEntity) ListFeedbacks() (feedbacks []string) {
 	}
 	return
 }
+
+// ListAnonymousFeedbacks returns the feedbacks without the value of their vote,
+// in a random order, so that they can't be associated with a vote
+func (currentROTI *ROTIEntity) ListAnonymousFeedbacks() (feedbacks []string) {
+	row, err := sqliteDatabase.Query("SELECT feedback FROM vote WHERE roti =" + strconv.Itoa(int(currentROTI.id)) + " AND " + publishedFeedback)
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var feedback sql.NullString
+		if err := row.Scan(&feedback); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+		}
+		if feedback.String != "" {
+			feedbacks = append(feedbacks, feedback.String)
+		}
+	}
+	rand.Shuffle(len(feedbacks), func(i, j int) {
+		feedbacks[i], feedbacks[j] = feedbacks[j], feedbacks[i]
+	})
+	return
+}
+
+// ListAnswers returns the answers to structured feedbacks, one list per prompt.
+// Like ListFeedbacks, answers are prefixed with their vote value unless anonymous
+// is set, in which case they are shuffled
+func (currentROTI *ROTIEntity) ListAnswers(anonymous bool) (answers [][]string) {
+	answers = make([][]string, len(currentROTI.GetPrompts()))
+
+	row, err := sqliteDatabase.Query("SELECT answer.prompt, answer.text, vote.value FROM answer JOIN vote ON vote.id = answer.vote WHERE answer.roti = ? AND "+publishedFeedback+" ORDER BY vote.rowid", int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var prompt int
+		var text string
+		var value float32
+		if err := row.Scan(&prompt, &text, &value); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		if prompt < 0 || prompt >= len(answers) {
+			continue
+		}
+		if !anonymous {
+			text = fmt.Sprintf("(%.1f) %s", value, text)
+		}
+		answers[prompt] = append(answers[prompt], text)
+	}
+
+	if anonymous {
+		for _, list := range answers {
+			rand.Shuffle(len(list), func(i, j int) {
+				list[i], list[j] = list[j], list[i]
+			})
+		}
+	}
+	return
+}
+
+// ListFollowUps returns the answers to the follow-up questions, grouped by
+// question in the order of the rules (low, then high). Answers are anonymized
+// the same way as ListAnswers
+func (currentROTI *ROTIEntity) ListFollowUps(anonymous bool) (questions []string, answers [][]string) {
+	for _, rule := range []FollowUpRule{currentROTI.lowRule, currentROTI.highRule} {
+		if rule.Question != "" {
+			questions = append(questions, rule.Question)
+		}
+	}
+	answers = make([][]string, len(questions))
+
+	row, err := sqliteDatabase.Query("SELECT value, followup FROM vote WHERE roti = ? AND followup != '' AND "+publishedFeedback, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var value float64
+		var followUp string
+		if err := row.Scan(&value, &followUp); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		question, ok := currentROTI.FollowUpQuestion(value)
+		if !ok {
+			continue
+		}
+		if !anonymous {
+			followUp = fmt.Sprintf("(%.1f) %s", value, followUp)
+		}
+		for i := range questions {
+			if questions[i] == question {
+				answers[i] = append(answers[i], followUp)
+				break
+			}
+		}
+	}
+
+	if anonymous {
+		for _, list := range answers {
+			rand.Shuffle(len(list), func(i, j int) {
+				list[i], list[j] = list[j], list[i]
+			})
+		}
+	}
+	return
+}
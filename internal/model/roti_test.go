@@ -3,7 +3,10 @@ package model
 import (
 	"os"
 	"reflect"
+	"slices"
+	"sort"
 	"testing"
+	"time"
 )
 
 func removeData() error {
@@ -72,6 +75,58 @@ func TestListROTIs(t *testing.T) {
 	}
 }
 
+func TestListROTIsCreatedBetween(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	old := CreateROTI("old", false, false, 30)
+	recent := CreateROTI("recent", false, false, 30)
+	CreateROTI("hidden", true, false, 30)
+	if _, err := sqliteDatabase.Exec("UPDATE roti SET created_at = '2024-03-01 18:30:00' WHERE rotiid = ?", int(old)); err != nil {
+		t.Fatal(err)
+	}
+
+	roti, _ := GetROTI(old)
+	if expected := time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC); !roti.GetCreatedAt().Equal(expected) {
+		t.Errorf("Got creation date %s but expected %s", roti.GetCreatedAt(), expected)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if rotiIDs := ListROTIsCreatedBetween(day, day); !reflect.DeepEqual(rotiIDs, []ROTIID{old}) {
+		t.Errorf("Got %v but expected only %d", rotiIDs, old)
+	}
+	today := time.Now().UTC()
+	if rotiIDs := ListROTIsCreatedBetween(day, today); !reflect.DeepEqual(rotiIDs, []ROTIID{old, recent}) {
+		t.Errorf("Got %v but expected %d and %d", rotiIDs, old, recent)
+	}
+	if rotiIDs := ListROTIsCreatedBetween(day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)); len(rotiIDs) != 0 {
+		t.Errorf("Got %v but expected no ROTI", rotiIDs)
+	}
+}
+
+func TestListSeriesROTIs(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	first, _ := GetROTI(CreateROTI("weekly", false, false, 30))
+	CreateROTI("other", false, false, 30)
+	series := first.StartSeries()
+	second := CreateROTIWithOptions(first.NextSessionOptions(), 30)
+
+	if rotiIDs := ListSeriesROTIs(series); !reflect.DeepEqual(rotiIDs, []ROTIID{first.GetID(), second}) {
+		t.Errorf("Got %v but expected %d and %d", rotiIDs, first.GetID(), second)
+	}
+	if rotiIDs := ListSeriesROTIs(""); rotiIDs != nil {
+		t.Errorf("Got %v for an empty series", rotiIDs)
+	}
+}
+
 func TestGetMinVote(t *testing.T) {
 	roti, err := initVoteTest([]float64{5, 6}, []string{"test", "test"})
 	if err != nil {
@@ -143,3 +198,127 @@ func TestListFeedbacks(t *testing.T) {
 		}
 	}
 }
+
+func TestBlindROTI(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	token := NewOwnerToken()
+	rotiid := CreateROTIWithOptions(ROTIOptions{Description: "blind", Blind: true, OwnerToken: token}, 30)
+
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !roti.IsBlind() || roti.ResultsVisible() {
+		t.Fatalf("Expected a blind ROTI with hidden results")
+	}
+	if !roti.IsOwnedBy(token) || roti.IsOwnedBy("") || roti.IsOwnedBy("wrong") {
+		t.Errorf("Owner token check doesn't match the token given at creation")
+	}
+	presenterToken := roti.GetPresenterToken()
+	if presenterToken == "" || presenterToken == token || !roti.IsPresentedBy(presenterToken) || roti.IsPresentedBy(token) || roti.IsOwnedBy(presenterToken) {
+		t.Errorf("Expected a presenter token %q different from the owner token, only allowing to present", presenterToken)
+	}
+
+	roti.Reveal()
+	roti, _ = GetROTI(rotiid)
+	if !roti.IsRevealed() || !roti.ResultsVisible() {
+		t.Errorf("Expected results to be visible once revealed")
+	}
+}
+
+func TestCloseROTI(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTIWithOptions(ROTIOptions{Description: "closing", Blind: true}, 30)
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roti.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	roti.Close()
+	roti, _ = GetROTI(rotiid)
+	if !roti.IsClosed() || !roti.ResultsVisible() {
+		t.Errorf("Expected a closed ROTI with visible results")
+	}
+	if err := roti.AddVoteToROTI(4, ""); err != ErrROTIClosed {
+		t.Errorf("Got %v but expected %v", err, ErrROTIClosed)
+	}
+	if roti.CountVotes() != 1 {
+		t.Errorf("Got %d vote(s) but expected 1", roti.CountVotes())
+	}
+}
+
+func TestClaimCloseNotification(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTI("deadline", false, false, 30)
+	roti, _ := GetROTI(rotiid)
+	if slices.Contains(ListROTIsClosing(), rotiid) {
+		t.Error("Expected ROTIs without closing date not to be listed")
+	}
+	roti.CloseAt(time.Now().Add(-time.Minute))
+	if !slices.Contains(ListROTIsClosing(), rotiid) {
+		t.Error("Expected the closed ROTI to be listed")
+	}
+	if !roti.ClaimCloseNotification() || roti.ClaimCloseNotification() {
+		t.Error("Expected the closing to be notified once")
+	}
+	if slices.Contains(ListROTIsClosing(), rotiid) {
+		t.Error("Expected the notified ROTI not to be listed anymore")
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTI("opening", false, false, 30)
+	roti, _ := GetROTI(rotiid)
+	roti.OpenAt(time.Now().Add(time.Hour))
+	roti, _ = GetROTI(rotiid)
+	if !roti.NotOpenYet() {
+		t.Errorf("Expected the ROTI not to be open before %s", roti.GetOpensAt())
+	}
+	if err := roti.AddVoteToROTI(4, ""); err != ErrROTINotOpen {
+		t.Errorf("Got %v but expected %v", err, ErrROTINotOpen)
+	}
+
+	roti.OpenAt(time.Now().Add(-time.Minute))
+	if err := roti.AddVoteToROTI(4, ""); err != nil || roti.CountVotes() != 1 {
+		t.Errorf("Expected the vote to be counted once open, got %v and %d vote(s)", err, roti.CountVotes())
+	}
+}
+
+func TestListAnonymousFeedbacks(t *testing.T) {
+	roti, err := initVoteTest([]float64{4.5, 3.0, 2.0}, []string{"Good Roti", "Okay Roti", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testedFeedbacks := roti.ListAnonymousFeedbacks()
+	sort.Strings(testedFeedbacks)
+
+	expectedFeedbacks := []string{"Good Roti", "Okay Roti"}
+	if !reflect.DeepEqual(testedFeedbacks, expectedFeedbacks) {
+		t.Errorf("Got feedback = %v but expected list is %v", testedFeedbacks, expectedFeedbacks)
+	}
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tCritical95 holds the two-sided 95% critical values of the Student t
+// distribution, indexed by degrees of freedom (index 0 is unused)
+var tCritical95 = []float64{0,
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// VotesStats gathers the descriptive statistics of a set of votes
+type VotesStats struct {
+	Count  int
+	Mean   float64
+	StdDev float64
+	// CILow and CIHigh bound the 95% confidence interval of the mean.
+	// They are only meaningful when HasCI is true (at least 2 votes)
+	CILow  float64
+	CIHigh float64
+	HasCI  bool
+}
+
+// ComputeStats returns the mean, sample standard deviation and t-based 95%
+// confidence interval of the mean for the given votes. The interval is
+// clamped to the valid vote range
+func ComputeStats(values []float64) (stats VotesStats) {
+	stats.Count = len(values)
+	if stats.Count == 0 {
+		return
+	}
+
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	stats.Mean = sum / float64(stats.Count)
+
+	if stats.Count < 2 {
+		return
+	}
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - stats.Mean) * (value - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(squares / float64(stats.Count-1))
+
+	margin := tCriticalValue(stats.Count-1) * stats.StdDev / math.Sqrt(float64(stats.Count))
+	stats.CILow = math.Max(minVoteValue, roundTo2Decimals(stats.Mean-margin))
+	stats.CIHigh = math.Min(maxVoteValue, roundTo2Decimals(stats.Mean+margin))
+	stats.HasCI = true
+
+	return
+}
+
+// tCriticalValue falls back on the normal approximation past 30 degrees of freedom
+func tCriticalValue(df int) float64 {
+	if df < len(tCritical95) {
+		return tCritical95[df]
+	}
+	return 1.96
+}
+
+func roundTo2Decimals(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func (currentROTI *ROTIEntity) ListVoteValues() (values []float64) {
+	row, err := sqliteDatabase.Query("SELECT value FROM vote WHERE roti =" + strconv.Itoa(int(currentROTI.id)))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var value float64
+		if err := row.Scan(&value); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// GetVotesStats computes the statistics of all the votes of this ROTI
+func (currentROTI *ROTIEntity) GetVotesStats() VotesStats {
+	return ComputeStats(currentROTI.ListVoteValues())
+}
+
+// VotesDistribution counts the votes of this ROTI for each vote value
+func (currentROTI *ROTIEntity) VotesDistribution() (distribution map[float64]int) {
+	distribution = make(map[float64]int)
+	row, err := sqliteDatabase.Query("SELECT value, COUNT(*) FROM vote WHERE roti =" + strconv.Itoa(int(currentROTI.id)) + " GROUP BY value")
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var value float64
+		var count int
+		if err := row.Scan(&value, &count); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		distribution[value] = count
+	}
+	return
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	testCases := []struct {
+		name           string
+		values         []float64
+		expectedMean   float64
+		expectedHasCI  bool
+		expectedCILow  float64
+		expectedCIHigh float64
+	}{
+		{"no vote", []float64{}, 0, false, 0, 0},
+		{"one vote", []float64{4}, 4, false, 0, 0},
+		{"identical votes", []float64{3, 3, 3}, 3, true, 3, 3},
+		{"three votes", []float64{3, 4, 4}, 11.0 / 3, true, 2.23, 5},
+		{"clamped low", []float64{1, 1.5}, 1.25, true, 1, 4.43},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := ComputeStats(tc.values)
+
+			if stats.Count != len(tc.values) {
+				t.Errorf("Got count = %d but expected %d", stats.Count, len(tc.values))
+			}
+			if stats.Mean != tc.expectedMean {
+				t.Errorf("Got mean = %v but expected %v", stats.Mean, tc.expectedMean)
+			}
+			if stats.HasCI != tc.expectedHasCI {
+				t.Fatalf("Got HasCI = %t but expected %t", stats.HasCI, tc.expectedHasCI)
+			}
+			if stats.CILow != tc.expectedCILow || stats.CIHigh != tc.expectedCIHigh {
+				t.Errorf("Got CI = [%v, %v] but expected [%v, %v]", stats.CILow, stats.CIHigh, tc.expectedCILow, tc.expectedCIHigh)
+			}
+		})
+	}
+}
+
+func TestGetVotesStats(t *testing.T) {
+	roti, err := initVoteTest([]float64{2, 4}, []string{"", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := roti.GetVotesStats()
+
+	if stats.Count != 2 || stats.Mean != 3 {
+		t.Errorf("Got count = %d and mean = %v but expected 2 and 3", stats.Count, stats.Mean)
+	}
+}
+
+func TestVotesDistribution(t *testing.T) {
+	roti, err := initVoteTest([]float64{2, 4, 4, 4.5}, []string{"", "", "", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distribution := roti.VotesDistribution()
+
+	expected := map[float64]int{2: 1, 4: 2, 4.5: 1}
+	if !reflect.DeepEqual(distribution, expected) {
+		t.Errorf("Got distribution = %v but expected %v", distribution, expected)
+	}
+}
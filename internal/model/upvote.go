@@ -0,0 +1,79 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SupportedFeedback is a published feedback along with the number of
+// participants that "+1"ed it
+type SupportedFeedback struct {
+	ID      FeedbackID
+	Text    string
+	Upvotes int
+	// Reply is the public answer of the owner of the ROTI
+	Reply string
+}
+
+// Upvote adds the support of a participant to a feedback of this ROTI. Only
+// published feedbacks can be upvoted
+func (currentROTI *ROTIEntity) Upvote(feedbackID FeedbackID) error {
+	if currentROTI.IsClosed() {
+		return ErrROTIClosed
+	}
+
+	var voteID VoteID
+	err := sqliteDatabase.QueryRow("SELECT vote.id FROM vote WHERE vote.feedback_id = ? AND vote.roti = ? AND vote.feedback != '' AND "+publishedFeedback,
+		feedbackID, int(currentROTI.id)).Scan(&voteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoVoteMatchingThisID
+	} else if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+
+	if _, err := sqliteDatabase.Exec("INSERT INTO upvote(vote, roti, created_at) VALUES (?, ?, ?)", voteID, int(currentROTI.id), time.Now()); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	log.Info().Msgf("feedback %s of ROTI %d upvoted", feedbackID, int(currentROTI.id))
+	return nil
+}
+
+// ListSupportedFeedbacks returns the published feedbacks with their number of
+// upvotes. Like ListFeedbacks, they are prefixed with their vote value unless
+// anonymous is set, in which case they are shuffled
+func (currentROTI *ROTIEntity) ListSupportedFeedbacks(anonymous bool) (feedbacks []SupportedFeedback) {
+	row, err := sqliteDatabase.Query(`SELECT vote.feedback_id, vote.value, vote.feedback, vote.reply,
+		(SELECT COUNT(*) FROM upvote WHERE upvote.vote = vote.id)
+		FROM vote WHERE vote.roti = ? AND vote.feedback != '' AND `+publishedFeedback+` ORDER BY vote.rowid`, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var feedback SupportedFeedback
+		var value float32
+		var text, reply sql.NullString
+		if err := row.Scan(&feedback.ID, &value, &text, &reply, &feedback.Upvotes); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		feedback.Text = text.String
+		feedback.Reply = reply.String
+		if !anonymous {
+			feedback.Text = fmt.Sprintf("(%.1f) %s", value, feedback.Text)
+		}
+		feedbacks = append(feedbacks, feedback)
+	}
+
+	if anonymous {
+		rand.Shuffle(len(feedbacks), func(i, j int) {
+			feedbacks[i], feedbacks[j] = feedbacks[j], feedbacks[i]
+		})
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+// feedbackIDOf returns the ID the feedbacks of the vote are published under
+func feedbackIDOf(t *testing.T, voteID VoteID) (feedbackID FeedbackID) {
+	t.Helper()
+	if err := sqliteDatabase.QueryRow("SELECT feedback_id FROM vote WHERE id = ?", voteID).Scan(&feedbackID); err != nil {
+		t.Fatal(err)
+	}
+	return feedbackID
+}
+
+func TestUpvote(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTIWithOptions(ROTIOptions{Description: "upvotes", Feedback: true}, 30)
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow, err := roti.CastBallot(Ballot{Value: 2, Feedback: "too slow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roti.CastBallot(Ballot{Value: 4, Feedback: "nice demo"}); err != nil {
+		t.Fatal(err)
+	}
+	silent, err := roti.CastBallot(Ballot{Value: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := roti.CastBallot(Ballot{Value: 1, Feedback: "held", Status: FeedbackHeld})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := roti.Upvote(feedbackIDOf(t, slow)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// feedbacks are upvoted by their own ID, not by the ID of their vote
+	for _, feedbackID := range []FeedbackID{feedbackIDOf(t, silent), feedbackIDOf(t, held), FeedbackID(slow), "unknown"} {
+		if err := roti.Upvote(feedbackID); err != ErrNoVoteMatchingThisID {
+			t.Errorf("Got %v when upvoting %s but expected %v", err, feedbackID, ErrNoVoteMatchingThisID)
+		}
+	}
+
+	var texts []string
+	var upvotes []int
+	for _, feedback := range roti.ListSupportedFeedbacks(false) {
+		texts = append(texts, feedback.Text)
+		upvotes = append(upvotes, feedback.Upvotes)
+	}
+	if !reflect.DeepEqual(texts, []string{"(2.0) too slow", "(4.0) nice demo"}) || !reflect.DeepEqual(upvotes, []int{2, 0}) {
+		t.Errorf("Got feedbacks %v with upvotes %v", texts, upvotes)
+	}
+
+	for _, feedback := range roti.ListSupportedFeedbacks(true) {
+		if feedback.Text != "too slow" && feedback.Text != "nice demo" {
+			t.Errorf("Got %s but expected anonymous feedbacks", feedback.Text)
+		}
+		if feedback.ID == "" || feedback.ID == FeedbackID(slow) {
+			t.Errorf("Got ID %q but expected an ID of its own", feedback.ID)
+		}
+	}
+
+	roti.Close()
+	if err := roti.Upvote(feedbackIDOf(t, slow)); err != ErrROTIClosed {
+		t.Errorf("Got %v but expected %v", err, ErrROTIClosed)
+	}
+}
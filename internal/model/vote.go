@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -14,6 +15,14 @@ import (
 var (
 	ErrInvalidVoteID = errors.New("invalid vote ID")
 	ErrInvalidVote   = errors.New("invalid vote value")
+	// ErrUnexpectedFollowUp is returned when a follow-up answer comes with a vote
+	// that no follow-up rule applies to
+	ErrUnexpectedFollowUp = errors.New("no follow-up question applies to this vote")
+)
+
+const (
+	minVoteValue = 1.0
+	maxVoteValue = 5.0
 )
 
 type VoteEntity struct {
@@ -23,6 +32,27 @@ type VoteEntity struct {
 
 type VoteID string
 
+// Ballot holds everything a participant submits with a vote
+type Ballot struct {
+	Value    float64
+	Feedback string
+	// Answers to the prompts of structured feedbacks, in the order of the prompts
+	Answers []string
+	// FollowUp answers the follow-up question matching the vote, if any
+	FollowUp string
+	// Status tells if the feedbacks of the vote can be published, defaults to visible
+	Status FeedbackStatus
+}
+
+// RawVote is one vote as stored, for raw data exports. CreatedAt is zero for
+// votes cast before timestamps were recorded
+type RawVote struct {
+	ID        VoteID
+	Value     float64
+	Feedback  string
+	CreatedAt time.Time
+}
+
 func (id VoteID) String() string {
 	return string(id)
 }
@@ -47,29 +77,68 @@ func NewVoteEntity(value float64) (vote VoteEntity, err error) {
 	return
 }
 
-func insertVote(db *sql.DB, vote VoteEntity, rotiid ROTIID, feedback string) {
+func insertVote(db *sql.DB, vote VoteEntity, rotiid ROTIID, ballot Ballot) {
 	log.Info().Msgf("Inserting Vote record %s for ROTI %d", vote.id, int(rotiid))
-	insertVoteSQL := `INSERT INTO vote(id, value, roti, feedback) VALUES (?, ?, ?, ?)`
+	insertVoteSQL := `INSERT INTO vote(id, value, roti, feedback, followup, status, created_at, feedback_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 	statement, err := db.Prepare(insertVoteSQL)
 
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
-	_, err = statement.Exec(vote.id, vote.value, rotiid, feedback)
+	_, err = statement.Exec(vote.id, vote.value, rotiid, ballot.Feedback, ballot.FollowUp, ballot.Status, time.Now(), uuid.NewString())
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
 }
 
+func insertAnswers(db *sql.DB, vote VoteEntity, rotiid ROTIID, answers []string) {
+	for prompt, answer := range answers {
+		if answer == "" {
+			continue
+		}
+		_, err := db.Exec(`INSERT INTO answer(vote, roti, prompt, text) VALUES (?, ?, ?, ?)`, vote.id, rotiid, prompt, answer)
+		if err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+}
+
 func CheckVote(voteString string) (vote float64, err error) {
 	vote, err = strconv.ParseFloat(voteString, 64)
 	if err != nil {
 		return 0, ErrInvalidVote
 	} else {
-		if vote < 1 || vote > 5 {
+		if vote < minVoteValue || vote > maxVoteValue {
 			return 0, ErrInvalidVote
 		} else {
 			return vote, nil
 		}
 	}
 }
+
+// ListRawVotes returns every vote of this ROTI in the order they were cast.
+// Feedbacks that aren't published are left empty, as well as all of them when
+// withFeedback is false
+func (currentROTI *ROTIEntity) ListRawVotes(withFeedback bool) (votes []RawVote) {
+	row, err := sqliteDatabase.Query(`SELECT vote.id, vote.value, CASE WHEN `+publishedFeedback+` THEN vote.feedback END, vote.created_at
+		FROM vote WHERE vote.roti = ? ORDER BY vote.rowid`, int(currentROTI.id))
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var vote RawVote
+		var feedback sql.NullString
+		var createdAt sql.NullTime
+		if err := row.Scan(&vote.ID, &vote.Value, &feedback, &createdAt); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		if withFeedback {
+			vote.Feedback = feedback.String
+		}
+		vote.CreatedAt = createdAt.Time
+		votes = append(votes, vote)
+	}
+	return
+}
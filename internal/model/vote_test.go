@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -81,3 +82,115 @@ func TestCheckVote(t *testing.T) {
 		})
 	}
 }
+
+func TestCastBallot(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTIWithOptions(ROTIOptions{Description: "retro", Feedback: true, Prompts: []string{"Keep", " ", "Stop  doing"}}, 30)
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(roti.GetPrompts(), []string{"Keep", "Stop doing"}) {
+		t.Fatalf("Got prompts %v but expected [Keep Stop doing]", roti.GetPrompts())
+	}
+
+	if _, err := roti.CastBallot(Ballot{Value: 4, Feedback: "free", Answers: []string{"pairing", ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roti.CastBallot(Ballot{Value: 2, Answers: []string{"", "long meetings"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{{"(4.0) pairing"}, {"(2.0) long meetings"}}
+	if answers := roti.ListAnswers(false); !reflect.DeepEqual(answers, expected) {
+		t.Errorf("Got answers %v but expected %v", answers, expected)
+	}
+
+	expected = [][]string{{"pairing"}, {"long meetings"}}
+	if answers := roti.ListAnswers(true); !reflect.DeepEqual(answers, expected) {
+		t.Errorf("Got anonymous answers %v but expected %v", answers, expected)
+	}
+}
+
+func TestFollowUps(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiid := CreateROTIWithOptions(ROTIOptions{
+		Description: "follow-ups",
+		LowRule:     FollowUpRule{Threshold: 2, Question: "What would have made this a 4?"},
+		HighRule:    FollowUpRule{Threshold: 4, Question: "What should we keep?"},
+	}, 30)
+	roti, err := GetROTI(rotiid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		vote        float64
+		followUp    string
+		expectedErr error
+	}{
+		{1.5, "shorter", nil},                  // Low rule applies
+		{2, "", nil},                           // No answer is always fine
+		{3, "anything", ErrUnexpectedFollowUp}, // No rule applies
+		{4.5, "the demo", nil},                 // High rule applies
+	}
+
+	for _, tc := range testCases {
+		if _, err := roti.CastBallot(Ballot{Value: tc.vote, FollowUp: tc.followUp}); err != tc.expectedErr {
+			t.Errorf("Vote %v with follow-up %q: got error %v but expected %v", tc.vote, tc.followUp, err, tc.expectedErr)
+		}
+	}
+
+	questions, answers := roti.ListFollowUps(false)
+	expectedQuestions := []string{"What would have made this a 4?", "What should we keep?"}
+	expectedAnswers := [][]string{{"(1.5) shorter"}, {"(4.5) the demo"}}
+	if !reflect.DeepEqual(questions, expectedQuestions) || !reflect.DeepEqual(answers, expectedAnswers) {
+		t.Errorf("Got %v / %v but expected %v / %v", questions, answers, expectedQuestions, expectedAnswers)
+	}
+}
+
+func TestListRawVotes(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	roti, err := GetROTI(CreateROTI("raw", false, true, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := roti.CastBallot(Ballot{Value: 4, Feedback: "nice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roti.CastBallot(Ballot{Value: 1, Feedback: "rude", Status: FeedbackHeld}); err != nil {
+		t.Fatal(err)
+	}
+
+	votes := roti.ListRawVotes(true)
+	if len(votes) != 2 {
+		t.Fatalf("Got %d votes but expected 2", len(votes))
+	}
+	if votes[0].ID != first || votes[0].Value != 4 || votes[0].Feedback != "nice" || votes[0].CreatedAt.IsZero() {
+		t.Errorf("Got %+v for the first vote", votes[0])
+	}
+	if votes[1].Feedback != "" {
+		t.Errorf("Got feedback %q but held feedbacks shouldn't be exported", votes[1].Feedback)
+	}
+
+	if votes := roti.ListRawVotes(false); votes[0].Feedback != "" {
+		t.Errorf("Got feedback %q but feedbacks weren't requested", votes[0].Feedback)
+	}
+}
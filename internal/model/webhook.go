@@ -0,0 +1,274 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidWebhookURL       = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidWebhookEvent     = errors.New("unknown webhook event")
+	ErrNoWebhookEvent          = errors.New("a webhook needs at least one event")
+	ErrInvalidWebhookVotes     = errors.New("the number of votes of a webhook must be positive")
+	ErrNoWebhookMatchingThisID = errors.New("no webhook matching this ID")
+)
+
+// WebhookEvent is something happening to a ROTI that webhooks can subscribe to
+type WebhookEvent string
+
+const (
+	EventROTICreated  WebhookEvent = "roti.created"
+	EventVoteAdded    WebhookEvent = "vote.added"
+	EventVotesReached WebhookEvent = "roti.votes_reached"
+	EventROTIClosed   WebhookEvent = "roti.closed"
+)
+
+// WebhookEvents lists every event, in the order they happen
+var WebhookEvents = []WebhookEvent{EventROTICreated, EventVoteAdded, EventVotesReached, EventROTIClosed}
+
+func CheckWebhookEvent(event string) (WebhookEvent, error) {
+	if slices.Contains(WebhookEvents, WebhookEvent(event)) {
+		return WebhookEvent(event), nil
+	}
+	return "", ErrInvalidWebhookEvent
+}
+
+// GlobalWebhooks is the ROTI ID of the webhooks receiving the events of every ROTI
+const GlobalWebhooks ROTIID = 0
+
+// Webhook is an URL receiving events of a ROTI, or of every ROTI
+type Webhook struct {
+	ID     string `json:"id"`
+	ROTIID ROTIID `json:"roti"`
+	URL    string `json:"url"`
+	// Secret signs the payloads sent to the URL
+	Secret string         `json:"-"`
+	Events []WebhookEvent `json:"events"`
+	// Votes is the number of votes triggering the roti.votes_reached event
+	Votes     int       `json:"votes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribes tells if the webhook receives the event
+func (hook Webhook) Subscribes(event WebhookEvent) bool {
+	return slices.Contains(hook.Events, event)
+}
+
+// newWebhookSecret returns a random secret of 32 bytes, written in hexadecimal
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal().Msgf("couldn't generate webhook secret: %s", err.Error())
+	}
+	return hex.EncodeToString(secret)
+}
+
+// AddWebhook saves a webhook after checking it, generating its secret when
+// none is given
+func AddWebhook(hook Webhook) (Webhook, error) {
+	parsed, err := url.Parse(strings.TrimSpace(hook.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Webhook{}, ErrInvalidWebhookURL
+	}
+	if len(hook.Events) == 0 {
+		return Webhook{}, ErrNoWebhookEvent
+	}
+	for _, event := range hook.Events {
+		if _, err := CheckWebhookEvent(string(event)); err != nil {
+			return Webhook{}, err
+		}
+	}
+	if hook.Subscribes(EventVotesReached) && hook.Votes <= 0 {
+		return Webhook{}, ErrInvalidWebhookVotes
+	}
+
+	hook.ID = uuid.NewString()
+	hook.URL = parsed.String()
+	hook.Secret = strings.TrimSpace(hook.Secret)
+	if hook.Secret == "" {
+		hook.Secret = newWebhookSecret()
+	}
+	hook.CreatedAt = time.Now()
+
+	var events []string
+	for _, event := range hook.Events {
+		events = append(events, string(event))
+	}
+	_, err = sqliteDatabase.Exec("INSERT INTO webhook(id, roti, url, secret, events, votes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		hook.ID, int(hook.ROTIID), hook.URL, hook.Secret, strings.Join(events, ","), hook.Votes, hook.CreatedAt)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	log.Info().Msgf("webhook %s added to ROTI %d", hook.ID, int(hook.ROTIID))
+	return hook, nil
+}
+
+// ListWebhooks returns the webhooks of a ROTI, or the global ones for GlobalWebhooks
+func ListWebhooks(rotiID ROTIID) []Webhook {
+	return queryWebhooks("SELECT id, roti, url, secret, events, votes, created_at FROM webhook WHERE roti = ? ORDER BY created_at", int(rotiID))
+}
+
+// ListSubscribedWebhooks returns the webhooks, global or of the ROTI, receiving the event
+func ListSubscribedWebhooks(rotiID ROTIID, event WebhookEvent) (hooks []Webhook) {
+	for _, hook := range queryWebhooks("SELECT id, roti, url, secret, events, votes, created_at FROM webhook WHERE roti IN (?, ?) ORDER BY created_at",
+		int(GlobalWebhooks), int(rotiID)) {
+		if hook.Subscribes(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return
+}
+
+func queryWebhooks(query string, args ...any) (hooks []Webhook) {
+	row, err := sqliteDatabase.Query(query, args...)
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var hook Webhook
+		var events string
+		var createdAt sql.NullTime
+		if err := row.Scan(&hook.ID, &hook.ROTIID, &hook.URL, &hook.Secret, &events, &hook.Votes, &createdAt); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		for _, event := range strings.Split(events, ",") {
+			hook.Events = append(hook.Events, WebhookEvent(event))
+		}
+		hook.CreatedAt = createdAt.Time
+		hooks = append(hooks, hook)
+	}
+	return
+}
+
+// DeleteWebhook removes a webhook of a ROTI, or a global one for
+// GlobalWebhooks, along with its deliveries
+func DeleteWebhook(rotiID ROTIID, webhookID string) error {
+	result, err := sqliteDatabase.Exec("DELETE FROM webhook WHERE id = ? AND roti = ?", webhookID, int(rotiID))
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNoWebhookMatchingThisID
+	}
+	if _, err := sqliteDatabase.Exec("DELETE FROM delivery WHERE webhook = ?", webhookID); err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	log.Info().Msgf("webhook %s of ROTI %d deleted", webhookID, int(rotiID))
+	return nil
+}
+
+// DeliveryStatus tells where a delivery stands in the retry queue
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed deliveries gave up after too many attempts
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is an event sent, or to be sent, to a webhook
+type Delivery struct {
+	ID          string
+	Webhook     Webhook
+	Event       WebhookEvent
+	Payload     []byte
+	Status      DeliveryStatus
+	Attempts    int
+	NextAttempt time.Time
+	// LastStatus is the HTTP status of the last attempt, 0 when it didn't get an answer
+	LastStatus int
+	LastError  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// QueueDelivery adds the payload of an event to the queue of a webhook, to be
+// sent right away
+func QueueDelivery(hook Webhook, event WebhookEvent, payload []byte) Delivery {
+	now := time.Now()
+	delivery := Delivery{ID: uuid.NewString(), Webhook: hook, Event: event, Payload: payload, Status: DeliveryPending,
+		NextAttempt: now, CreatedAt: now, UpdatedAt: now}
+	_, err := sqliteDatabase.Exec(`INSERT INTO delivery(id, webhook, event, payload, status, attempts, next_attempt, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		delivery.ID, hook.ID, delivery.Event, string(payload), delivery.Status, delivery.NextAttempt, delivery.CreatedAt, delivery.UpdatedAt)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+	return delivery
+}
+
+// RecordAttempt saves the outcome of an attempt to send a delivery, next being
+// when to try again if it's still pending
+func RecordAttempt(deliveryID string, status DeliveryStatus, httpStatus int, lastError string, next time.Time) {
+	_, err := sqliteDatabase.Exec(`UPDATE delivery SET status = ?, attempts = attempts + 1, last_status = ?, last_error = ?,
+		next_attempt = ?, updated_at = ? WHERE id = ?`,
+		status, httpStatus, lastError, next, time.Now(), deliveryID)
+	if err != nil {
+		log.Fatal().Msgf(err.Error())
+	}
+}
+
+const deliveryColumns = `delivery.id, delivery.event, delivery.payload, delivery.status, delivery.attempts, delivery.next_attempt,
+	delivery.last_status, delivery.last_error, delivery.created_at, delivery.updated_at,
+	webhook.id, webhook.roti, webhook.url, webhook.secret`
+
+// ListDueDeliveries returns the pending deliveries whose next attempt is due,
+// oldest first
+func ListDueDeliveries(now time.Time) (deliveries []Delivery) {
+	for _, delivery := range queryDeliveries("SELECT " + deliveryColumns + ` FROM delivery
+		JOIN webhook ON webhook.id = delivery.webhook
+		WHERE delivery.status = 'pending' ORDER BY delivery.created_at`) {
+		if !delivery.NextAttempt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return
+}
+
+// ListRecentDeliveries returns the last deliveries, whatever their webhook
+func ListRecentDeliveries(limit int) []Delivery {
+	return queryDeliveries("SELECT "+deliveryColumns+` FROM delivery
+		JOIN webhook ON webhook.id = delivery.webhook
+		ORDER BY delivery.created_at DESC LIMIT ?`, limit)
+}
+
+func queryDeliveries(query string, args ...any) (deliveries []Delivery) {
+	row, err := sqliteDatabase.Query(query, args...)
+	if err != nil {
+		log.Fatal().Msgf("couldn't connect to database")
+	}
+	defer row.Close()
+	for row.Next() {
+		var delivery Delivery
+		var payload string
+		var lastStatus sql.NullInt64
+		var lastError sql.NullString
+		var nextAttempt, createdAt, updatedAt sql.NullTime
+		if err := row.Scan(&delivery.ID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts, &nextAttempt,
+			&lastStatus, &lastError, &createdAt, &updatedAt,
+			&delivery.Webhook.ID, &delivery.Webhook.ROTIID, &delivery.Webhook.URL, &delivery.Webhook.Secret); err != nil {
+			log.Error().Msgf("couldn't scan values : %s", err.Error())
+			continue
+		}
+		delivery.Payload = []byte(payload)
+		delivery.LastStatus = int(lastStatus.Int64)
+		delivery.LastError = lastError.String
+		delivery.NextAttempt = nextAttempt.Time
+		delivery.CreatedAt = createdAt.Time
+		delivery.UpdatedAt = updatedAt.Time
+		deliveries = append(deliveries, delivery)
+	}
+	return
+}
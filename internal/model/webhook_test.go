@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	if err := removeData(); err != nil {
+		t.Fatal(err)
+	}
+	InitDatabase()
+	defer removeData()
+
+	rotiID := CreateROTIWithOptions(ROTIOptions{Description: "weekly"}, 30)
+	otherID := CreateROTIWithOptions(ROTIOptions{Description: "other"}, 30)
+
+	invalid := []struct {
+		hook        Webhook
+		expectedErr error
+	}{
+		{Webhook{URL: "ftp://example.com", Events: []WebhookEvent{EventVoteAdded}}, ErrInvalidWebhookURL},
+		{Webhook{URL: "/hooks", Events: []WebhookEvent{EventVoteAdded}}, ErrInvalidWebhookURL},
+		{Webhook{URL: "https://example.com"}, ErrNoWebhookEvent},
+		{Webhook{URL: "https://example.com", Events: []WebhookEvent{"roti.deleted"}}, ErrInvalidWebhookEvent},
+		{Webhook{URL: "https://example.com", Events: []WebhookEvent{EventVotesReached}}, ErrInvalidWebhookVotes},
+	}
+	for _, tc := range invalid {
+		if _, err := AddWebhook(tc.hook); err != tc.expectedErr {
+			t.Errorf("Got %v but expected %v for %+v", err, tc.expectedErr, tc.hook)
+		}
+	}
+
+	global, err := AddWebhook(Webhook{URL: "https://example.com/all", Events: []WebhookEvent{EventROTICreated, EventROTIClosed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(global.Secret) != 64 {
+		t.Errorf("Got secret %q, expected 32 random bytes", global.Secret)
+	}
+	own, err := AddWebhook(Webhook{ROTIID: rotiID, URL: "https://example.com/weekly", Secret: "s3cret",
+		Events: []WebhookEvent{EventVoteAdded, EventROTIClosed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hooks := ListWebhooks(rotiID); len(hooks) != 1 || hooks[0].Secret != "s3cret" || !hooks[0].Subscribes(EventVoteAdded) {
+		t.Errorf("Got %+v but expected the webhook of the ROTI", hooks)
+	}
+	if hooks := ListSubscribedWebhooks(rotiID, EventROTIClosed); len(hooks) != 2 {
+		t.Errorf("Got %d webhooks but expected the global one and the one of the ROTI", len(hooks))
+	}
+	if hooks := ListSubscribedWebhooks(otherID, EventVoteAdded); len(hooks) != 0 {
+		t.Errorf("Got %+v but no webhook of the other ROTI subscribes to votes", hooks)
+	}
+
+	// a failed attempt waits for its retry
+	delivery := QueueDelivery(own, EventVoteAdded, []byte(`{"event":"vote.added"}`))
+	QueueDelivery(global, EventROTIClosed, []byte(`{"event":"roti.closed"}`))
+	now := time.Now()
+	if due := ListDueDeliveries(now); len(due) != 2 || due[0].ID != delivery.ID || due[0].Webhook.URL != own.URL || string(due[0].Payload) != `{"event":"vote.added"}` {
+		t.Fatalf("Got %+v but expected both deliveries, oldest first", due)
+	}
+	RecordAttempt(delivery.ID, DeliveryPending, 500, "unexpected status 500", now.Add(time.Minute))
+	if due := ListDueDeliveries(now); len(due) != 1 || due[0].ID == delivery.ID {
+		t.Errorf("Got %+v but the failed delivery isn't due yet", due)
+	}
+	if due := ListDueDeliveries(now.Add(2 * time.Minute)); len(due) != 2 {
+		t.Errorf("Got %d due deliveries but expected 2", len(due))
+	}
+
+	recent := ListRecentDeliveries(10)
+	if len(recent) != 2 || recent[1].Attempts != 1 || recent[1].LastStatus != 500 || recent[1].Status != DeliveryPending {
+		t.Errorf("Got %+v", recent)
+	}
+
+	if err := DeleteWebhook(otherID, own.ID); err != ErrNoWebhookMatchingThisID {
+		t.Errorf("Got %v but expected %v", err, ErrNoWebhookMatchingThisID)
+	}
+	if err := DeleteWebhook(rotiID, own.ID); err != nil {
+		t.Fatal(err)
+	}
+	if recent := ListRecentDeliveries(10); len(recent) != 1 {
+		t.Errorf("Got %d deliveries but those of the deleted webhook should be gone", len(recent))
+	}
+}
@@ -0,0 +1,148 @@
+package moderation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrFeedbackTooLong = errors.New("feedback is too long")
+)
+
+// Filter flags feedbacks that shouldn't be published without a review.
+// Implementations must be safe for concurrent use
+type Filter interface {
+	// Flag returns true and a reason when the text needs a review
+	Flag(text string) (flagged bool, reason string)
+}
+
+// Moderator applies the moderation rules to every feedback
+type Moderator struct {
+	// MaxLength is the maximum number of characters of a feedback, 0 for no limit
+	MaxLength int
+	Filters   []Filter
+}
+
+// CheckLength rejects feedbacks longer than MaxLength characters
+func (m *Moderator) CheckLength(text string) error {
+	if m.MaxLength > 0 && utf8.RuneCountInString(text) > m.MaxLength {
+		return fmt.Errorf("%w: more than %d characters", ErrFeedbackTooLong, m.MaxLength)
+	}
+	return nil
+}
+
+// Flag runs all the filters and stops at the first one flagging the text
+func (m *Moderator) Flag(text string) (bool, string) {
+	for _, filter := range m.Filters {
+		if flagged, reason := filter.Flag(text); flagged {
+			return true, reason
+		}
+	}
+	return false, ""
+}
+
+// WordListFilter flags texts containing one of the words or phrases of its lists
+type WordListFilter struct {
+	// words maps each forbidden word or phrase, its words separated by single
+	// spaces, to the language of the list it comes from
+	words map[string]string
+	// maxWords is the number of words of the longest phrase
+	maxWords int
+}
+
+// NewWordListFilter builds a filter from in-memory lists, indexed by language
+func NewWordListFilter(lists map[string][]string) *WordListFilter {
+	filter := &WordListFilter{words: make(map[string]string)}
+	for lang, words := range lists {
+		for _, word := range words {
+			// phrases are split like the texts, so that they match whatever
+			// separates their words
+			tokens := tokenize(word)
+			if len(tokens) == 0 {
+				continue
+			}
+			filter.words[strings.Join(tokens, " ")] = lang
+			filter.maxWords = max(filter.maxWords, len(tokens))
+		}
+	}
+	return filter
+}
+
+// LoadWordLists reads one list per language from dir. Files are named after
+// the language (en.txt, fr.txt...) and hold one word or phrase per line, lines
+// starting with # being comments
+func LoadWordLists(dir string) (*WordListFilter, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string][]string)
+	for _, path := range files {
+		lang := strings.TrimSuffix(filepath.Base(path), ".txt")
+		words, err := readWordList(path)
+		if err != nil {
+			return nil, err
+		}
+		lists[lang] = words
+		log.Info().Msgf("%d words loaded in the '%s' moderation word list", len(words), lang)
+	}
+	return NewWordListFilter(lists), nil
+}
+
+func readWordList(path string) (words []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// Flag looks up every sequence of words of the text, up to the length of the
+// longest phrase of the lists
+func (f *WordListFilter) Flag(text string) (bool, string) {
+	tokens := tokenize(text)
+	for start := range tokens {
+		for end := start + 1; end <= len(tokens) && end-start <= f.maxWords; end++ {
+			if lang, ok := f.words[strings.Join(tokens[start:end], " ")]; ok {
+				return true, fmt.Sprintf("contains a word of the '%s' list", lang)
+			}
+		}
+	}
+	return false, ""
+}
+
+// tokenize splits the text in normalized words
+func tokenize(text string) []string {
+	tokens := strings.FieldsFunc(text, isSeparator)
+	for i, token := range tokens {
+		tokens[i] = normalize(token)
+	}
+	return tokens
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+}
+
+func normalize(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
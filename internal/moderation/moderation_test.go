@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckLength(t *testing.T) {
+	moderator := Moderator{MaxLength: 5}
+
+	if err := moderator.CheckLength("héllo"); err != nil {
+		t.Errorf("Got %v but 5 characters should be accepted", err)
+	}
+	if err := moderator.CheckLength("hello!"); !errors.Is(err, ErrFeedbackTooLong) {
+		t.Errorf("Got %v but expected %v", err, ErrFeedbackTooLong)
+	}
+	if err := (&Moderator{}).CheckLength("no limit"); err != nil {
+		t.Errorf("Got %v but there is no limit", err)
+	}
+}
+
+func TestLoadWordLists(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "en.txt"), []byte("# comment\nidiot\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fr.txt"), []byte("Crétin\nva te faire\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := LoadWordLists(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator := Moderator{Filters: []Filter{filter}}
+
+	testCases := []struct {
+		text     string
+		expected bool
+	}{
+		{"Great session", false},
+		{"The speaker is an IDIOT!", true},
+		{"quel crétin", true},
+		{"idiotic is not in the list", false},
+		{"# comment", false},
+		// phrases match whatever separates their words
+		{"Va, te  faire voir", true},
+		{"Va te faire!", true},
+		{"te faire", false},
+		{"va faire te", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			if flagged, _ := moderator.Flag(tc.text); flagged != tc.expected {
+				t.Errorf("Got flagged = %t but expected %t", flagged, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// algorithms are the signature algorithms accepted for ID tokens: "none"
+// and the HMAC ones, keyed with the client secret, aren't
+var algorithms = map[string]struct {
+	hash    crypto.Hash
+	newHash func() hash.Hash
+}{
+	"RS256": {crypto.SHA256, sha256.New},
+	"RS384": {crypto.SHA384, sha512.New384},
+	"RS512": {crypto.SHA512, sha512.New},
+	"ES256": {crypto.SHA256, sha256.New},
+	"ES384": {crypto.SHA384, sha512.New384},
+	"ES512": {crypto.SHA512, sha512.New},
+}
+
+// jsonWebKey is a public key of the JWKS document of the provider
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// elliptic curve keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// verifySignature checks the signature of a compact JWS with the keys of the
+// provider and returns its payload
+func (p *Provider) verifySignature(token string, now time.Time) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidIDToken)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+	algorithm, found := algorithms[header.Algorithm]
+	if !found {
+		return nil, fmt.Errorf("%w: %q signatures aren't accepted", ErrInvalidIDToken, header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	key, err := p.signingKey(header.KeyID, now)
+	if err != nil {
+		return nil, err
+	}
+	digest := algorithm.newHash()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	hashed := digest.Sum(nil)
+
+	valid := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		valid = strings.HasPrefix(header.Algorithm, "RS") && rsa.VerifyPKCS1v15(key, algorithm.hash, hashed, signature) == nil
+	case *ecdsa.PublicKey:
+		// the signature is r and s, each as long as the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if strings.HasPrefix(header.Algorithm, "ES") && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(key, hashed, r, s)
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+	return payload, nil
+}
+
+func decodeSegment(segment string, value any) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, value)
+}
+
+// signingKey returns the key of the provider with the ID, reading the keys
+// again when it's unknown: providers rotate them
+func (p *Provider) signingKey(keyID string, now time.Time) (any, error) {
+	p.keysMutex.Lock()
+	defer p.keysMutex.Unlock()
+
+	if key, found := p.findKey(keyID); found {
+		return key, nil
+	}
+	if p.keys != nil && now.Sub(p.keysReadAt) < keysRefreshDelay {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(p.JWKSURI, &document); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, err.Error())
+	}
+	p.keys = make(map[string]any)
+	p.keysReadAt = now
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			p.keys[jwk.KeyID] = key
+		}
+	}
+
+	if key, found := p.findKey(keyID); found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+}
+
+// findKey looks for a key by ID, tokens without key ID being signed with the
+// only key of the provider
+func (p *Provider) findKey(keyID string) (any, bool) {
+	if keyID == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, found := p.keys[keyID]
+	return key, found
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, found := curves[jwk.Curve]
+		if !found {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point not on curve %s", jwk.Curve)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+}
@@ -0,0 +1,250 @@
+// Package oidc logs users in with an OpenID Connect provider, following the
+// authorization code flow with PKCE, and checks the ID tokens it issues
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery      = errors.New("OpenID Connect discovery failed")
+	ErrTokenExchange  = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrUnknownKey     = errors.New("unknown signing key")
+)
+
+const (
+	// maxResponseSize bounds the documents read from the provider
+	maxResponseSize = 1 << 20
+	// clockSkew is tolerated between the provider and GroROTI
+	clockSkew = 2 * time.Minute
+	// keysRefreshDelay is the least time between two reads of the keys of
+	// the provider, when tokens are signed with unknown keys
+	keysRefreshDelay = time.Minute
+)
+
+// Config describes the client GroROTI is to the provider
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider is an OpenID Connect provider, as described by its discovery document
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	client *http.Client
+	// keys are the signing keys of the provider, by key ID
+	keys       map[string]any
+	keysReadAt time.Time
+	keysMutex  sync.Mutex
+}
+
+// Discover reads the discovery document of the issuer
+func Discover(client *http.Client, issuer string) (*Provider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	provider := &Provider{client: client}
+	if err := provider.getJSON(issuer+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDiscovery, err.Error())
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer %q doesn't match %q", ErrDiscovery, provider.Issuer, issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	return provider, nil
+}
+
+func (p *Provider) getJSON(url string, value any) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(value)
+}
+
+// RandomString returns a random URL safe string, for states, nonces and
+// code verifiers
+func RandomString() string {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random)
+}
+
+// CodeChallenge derives the PKCE challenge sent to the provider from the
+// verifier kept by GroROTI (S256 method)
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the page of the provider users log in on
+func (p *Provider) AuthCodeURL(config Config, state, nonce, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.ClientID},
+		"redirect_uri":          {config.RedirectURL},
+		"scope":                 {strings.Join(config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades the authorization code the user came back with for an ID token
+func (p *Provider) Exchange(config Config, code, verifier string) (idToken string, err error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	// public clients only prove who they are with PKCE
+	if config.ClientSecret == "" {
+		form.Set("client_id", config.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrTokenExchange, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrTokenExchange, err.Error())
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("%w: %s answered %s", ErrTokenExchange, p.TokenEndpoint, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", ErrTokenExchange, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: no ID token", ErrTokenExchange)
+	}
+	return token.IDToken, nil
+}
+
+// Claims are the claims of an ID token
+type Claims struct {
+	Subject string
+	Email   string
+	// EmailVerified is true only when the provider says the email was verified
+	EmailVerified bool
+	Name          string
+	raw           map[string]json.RawMessage
+}
+
+// Strings returns a claim holding a list of strings, like groups, or a
+// single string
+func (c Claims) Strings(name string) []string {
+	var values []string
+	if err := json.Unmarshal(c.raw[name], &values); err == nil {
+		return values
+	}
+	var value string
+	if err := json.Unmarshal(c.raw[name], &value); err == nil && value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
+// Verify checks the signature of the ID token and that it was issued for
+// this client and this login, then returns its claims
+func (p *Provider) Verify(config Config, idToken, nonce string, now time.Time) (claims Claims, err error) {
+	payload, err := p.verifySignature(idToken, now)
+	if err != nil {
+		return claims, err
+	}
+
+	var token struct {
+		Issuer        string          `json:"iss"`
+		Subject       string          `json:"sub"`
+		Audience      json.RawMessage `json:"aud"`
+		AuthorizedBy  string          `json:"azp"`
+		Expiry        json.Number     `json:"exp"`
+		IssuedAt      json.Number     `json:"iat"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return claims, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+	if err := json.Unmarshal(payload, &claims.raw); err != nil {
+		return claims, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	if strings.TrimSuffix(token.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return claims, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, token.Issuer)
+	}
+	var audience []string
+	if err := json.Unmarshal(token.Audience, &audience); err != nil {
+		audience = []string{strings.Trim(string(token.Audience), `"`)}
+	}
+	if !slices.Contains(audience, config.ClientID) || (len(audience) > 1 && token.AuthorizedBy != config.ClientID) {
+		return claims, fmt.Errorf("%w: issued for %v", ErrInvalidIDToken, audience)
+	}
+	expiry, err := token.Expiry.Int64()
+	if err != nil || now.After(time.Unix(expiry, 0).Add(clockSkew)) {
+		return claims, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if issuedAt, err := token.IssuedAt.Int64(); err != nil || time.Unix(issuedAt, 0).After(now.Add(clockSkew)) {
+		return claims, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+	if token.Nonce != nonce {
+		return claims, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if token.Subject == "" {
+		return claims, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	claims.Subject = token.Subject
+	claims.Email = strings.ToLower(token.Email)
+	// a missing claim doesn't vouch for the email, and some providers send
+	// "true" as a string
+	claims.EmailVerified = string(token.EmailVerified) == "true" || string(token.EmailVerified) == `"true"`
+	claims.Name = token.Name
+	return claims, nil
+}
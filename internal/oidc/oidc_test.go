@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/oidc/oidctest"
+)
+
+var noRedirect = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+// authorize goes through the login page of the provider and returns the
+// query the user comes back with
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	resp, err := noRedirect.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected the provider to redirect, got %s", resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query()
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	for _, secret := range []string{"", "s3cr3t:&"} {
+		stand := oidctest.NewProvider("groroti", secret)
+		defer stand.Close()
+		stand.SetClaims(map[string]any{"sub": "jane", "email": "Jane@Example.com", "email_verified": true, "name": "Jane", "groups": []string{"team", "admins"}})
+
+		provider, err := Discover(http.DefaultClient, stand.Issuer()+"/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := Config{ClientID: "groroti", ClientSecret: secret, RedirectURL: "https://groroti.example.com/auth/callback",
+			Scopes: []string{"openid", "email"}}
+		state, nonce, verifier := RandomString(), RandomString(), RandomString()
+		authURL := provider.AuthCodeURL(config, state, nonce, verifier)
+		if !strings.Contains(authURL, "code_challenge="+CodeChallenge(verifier)) || !strings.Contains(authURL, "scope=openid+email") {
+			t.Errorf("Expected the PKCE challenge and the scopes in %s", authURL)
+		}
+
+		query := authorize(t, authURL)
+		if query.Get("state") != state {
+			t.Errorf("Expected state %s, got %s", state, query.Get("state"))
+		}
+		// the code only works with the verifier of the challenge, and only once
+		if _, err := provider.Exchange(config, query.Get("code"), RandomString()); !errors.Is(err, ErrTokenExchange) {
+			t.Errorf("Expected %v with another verifier, got %v", ErrTokenExchange, err)
+		}
+		query = authorize(t, authURL)
+		idToken, err := provider.Exchange(config, query.Get("code"), verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.Exchange(config, query.Get("code"), verifier); !errors.Is(err, ErrTokenExchange) {
+			t.Errorf("Expected %v when using the code twice, got %v", ErrTokenExchange, err)
+		}
+
+		claims, err := provider.Verify(config, idToken, nonce, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "jane" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.Name != "Jane" ||
+			!slices.Equal(claims.Strings("groups"), []string{"team", "admins"}) {
+			t.Errorf("Unexpected claims %+v, groups %v", claims, claims.Strings("groups"))
+		}
+		if _, err := provider.Verify(config, idToken, RandomString(), time.Now()); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("Expected %v with another nonce, got %v", ErrInvalidIDToken, err)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	stand := oidctest.NewProvider("groroti", "")
+	defer stand.Close()
+	if _, err := Discover(http.DefaultClient, stand.URL+"/other"); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("Expected %v for an unknown issuer, got %v", ErrDiscovery, err)
+	}
+	stand.Close()
+	if _, err := Discover(http.DefaultClient, stand.Issuer()); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("Expected %v when the provider is down, got %v", ErrDiscovery, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	stand := oidctest.NewProvider("groroti", "")
+	defer stand.Close()
+	provider, err := Discover(http.DefaultClient, stand.Issuer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{ClientID: "groroti"}
+	now := time.Now()
+
+	valid := stand.IDToken("nonce", map[string]any{"sub": "jane", "email_verified": "false", "groups": "team"})
+	claims, err := provider.Verify(config, valid, "nonce", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified || !slices.Equal(claims.Strings("groups"), []string{"team"}) || claims.Strings("missing") != nil {
+		t.Errorf("Expected an unverified email and a single group, got %+v and %v", claims, claims.Strings("groups"))
+	}
+	for verified, expected := range map[any]bool{true: true, "true": true, false: false, "": false, nil: false} {
+		claims := map[string]any{"sub": "jane", "email_verified": verified}
+		if verified == nil {
+			delete(claims, "email_verified")
+		}
+		verifiedClaims, err := provider.Verify(config, stand.IDToken("nonce", claims), "nonce", now)
+		if err != nil || verifiedClaims.EmailVerified != expected {
+			t.Errorf("Expected email_verified %#v to verify the email %t, got %t (%v)", verified, expected, verifiedClaims.EmailVerified, err)
+		}
+	}
+
+	parts := strings.Split(valid, ".")
+	header, _ := json.Marshal(map[string]string{"alg": "none"})
+	testCases := map[string]string{
+		"expired":         stand.IDToken("nonce", map[string]any{"sub": "jane", "exp": now.Add(-time.Hour).Unix()}),
+		"future":          stand.IDToken("nonce", map[string]any{"sub": "jane", "iat": now.Add(time.Hour).Unix()}),
+		"other audience":  stand.IDToken("nonce", map[string]any{"sub": "jane", "aud": "other"}),
+		"many audiences":  stand.IDToken("nonce", map[string]any{"sub": "jane", "aud": []string{"groroti", "other"}, "azp": "other"}),
+		"other issuer":    stand.IDToken("nonce", map[string]any{"sub": "jane", "iss": "https://evil.example.com"}),
+		"no subject":      stand.IDToken("nonce", nil),
+		"tampered":        parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2],
+		"unsigned":        base64.RawURLEncoding.EncodeToString(header) + "." + parts[1] + ".",
+		"not a JWT":       "token",
+		"bad signature":   parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")),
+		"invalid payload": parts[0] + ".!." + parts[2],
+	}
+	for name, token := range testCases {
+		if _, err := provider.Verify(config, token, "nonce", now); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidIDToken, err)
+		}
+	}
+	if _, err := provider.Verify(config, stand.IDToken("nonce", map[string]any{"sub": "jane", "aud": []string{"groroti", "other"}, "azp": "groroti"}),
+		"nonce", now); err != nil {
+		t.Errorf("Expected tokens for many audiences authorized by the client to be valid, got %v", err)
+	}
+
+	// new keys are read from the provider, at most once a minute
+	stand.RotateKey()
+	rotated := stand.IDToken("nonce", map[string]any{"sub": "jane"})
+	if _, err := provider.Verify(config, rotated, "nonce", now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected %v right after reading the keys, got %v", ErrUnknownKey, err)
+	}
+	if _, err := provider.Verify(config, rotated, "nonce", now.Add(keysRefreshDelay)); err != nil {
+		t.Errorf("Expected the new key to be read, got %v", err)
+	}
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &Provider{Issuer: "https://id.example.com", keys: map[string]any{"ec": &key.PublicKey}, keysReadAt: time.Now()}
+	now := time.Now()
+
+	sign := func(payload map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec"})
+		body, _ := json.Marshal(payload)
+		input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+		hashed := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	token := sign(map[string]any{"iss": "https://id.example.com", "aud": "groroti", "sub": "jo", "exp": now.Add(time.Hour).Unix(), "iat": now.Unix()})
+	if claims, err := provider.Verify(Config{ClientID: "groroti"}, token, "", now); err != nil || claims.Subject != "jo" {
+		t.Errorf("Expected the ES256 token of jo to be valid, got %+v and %v", claims, err)
+	}
+}
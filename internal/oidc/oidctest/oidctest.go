@@ -0,0 +1,220 @@
+// Package oidctest runs a stand-in OpenID Connect provider for tests. It
+// logs users in without asking anything, as the user described by the
+// claims set beforehand, and checks the PKCE verifiers of the code flow
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// grant is an authorization code waiting to be exchanged
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      map[string]any
+}
+
+// Provider is the stand-in provider, its issuer being the URL of its server
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mutex  sync.Mutex
+	claims map[string]any
+	key    *rsa.PrivateKey
+	keyID  int
+	codes  map[string]grant
+}
+
+// NewProvider starts a provider knowing a single client. Clients without
+// secret are public ones
+func NewProvider(clientID, clientSecret string) *Provider {
+	provider := &Provider{ClientID: clientID, ClientSecret: clientSecret, codes: make(map[string]grant)}
+	provider.RotateKey()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("GET /authorize", provider.authorize)
+	mux.HandleFunc("POST /token", provider.token)
+	mux.HandleFunc("GET /jwks", provider.jwks)
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+// Issuer returns the identifier of the provider
+func (p *Provider) Issuer() string {
+	return p.URL
+}
+
+// SetClaims sets the claims of the ID tokens issued to the next users
+// logging in, on top of the ones identifying the provider and the client
+func (p *Provider) SetClaims(claims map[string]any) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.claims = claims
+}
+
+// RotateKey signs the next ID tokens with a new key
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.key = key
+	p.keyID++
+}
+
+// IDToken returns an ID token issued to the client for the nonce, with the
+// claims given on top of the standard ones
+func (p *Provider) IDToken(nonce string, claims map[string]any) string {
+	now := time.Now()
+	payload := map[string]any{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+	for name, value := range claims {
+		payload[name] = value
+	}
+	return p.Sign(payload)
+}
+
+// Sign signs the payload as a JWT with the current key (RS256)
+func (p *Provider) Sign(payload map[string]any) string {
+	p.mutex.Lock()
+	key, keyID := p.key, p.keyID
+	p.mutex.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": strconv.Itoa(keyID)})
+	body, _ := json.Marshal(payload)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	hashed := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		panic(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// authorize logs the user in right away and sends them back to the client
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID || query.Get("redirect_uri") == "" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mutex.Lock()
+	p.codes[code] = grant{clientID: query.Get("client_id"), redirectURI: query.Get("redirect_uri"),
+		challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: p.claims}
+	p.mutex.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges codes, once, for the client that asked for them and
+// knows the PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostForm.Get("client_id")
+	} else {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if clientID != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mutex.Lock()
+	code, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mutex.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || r.PostForm.Get("grant_type") != "authorization_code" || code.clientID != clientID ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.IDToken(code.nonce, code.claims),
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	key, keyID := p.key, p.keyID
+	p.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": strconv.Itoa(keyID),
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+}
+
+func randomString() string {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,380 @@
+// Package pdf writes simple PDF documents in pure Go: text in an embedded
+// TrueType font, filled rectangles, lines and images. Coordinates are in points, from
+// the top left corner of the page
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/goki/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Page sizes in points
+const (
+	A4Width      = 595.28
+	A4Height     = 841.89
+	A6Width      = 297.64
+	A6Height     = 419.53
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+var ErrNoPage = errors.New("the document has no page")
+
+// Font is a TrueType font embedded in the documents using it. It can be
+// shared between documents
+type Font struct {
+	data []byte
+	font *truetype.Font
+	upem int32
+}
+
+// ParseFont parses the content of a .ttf file
+func ParseFont(data []byte) (*Font, error) {
+	parsed, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Font{data: data, font: parsed, upem: parsed.FUnitsPerEm()}, nil
+}
+
+// glyphWidth returns the advance of a glyph in thousandths of em
+func (f *Font) glyphWidth(index truetype.Index) float64 {
+	advance := f.font.HMetric(fixed.Int26_6(f.upem), index).AdvanceWidth
+	return float64(advance) * 1000 / float64(f.upem)
+}
+
+// Width returns the width of the text in points
+func (f *Font) Width(text string, size float64) (width float64) {
+	for _, r := range text {
+		width += f.glyphWidth(f.font.Index(r))
+	}
+	return width * size / 1000
+}
+
+// Printable removes the runes that can't be printed with the font, such as
+// emojis and control characters. New lines are kept
+func (f *Font) Printable(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || (unicode.IsPrint(r) && f.font.Index(r) != 0) {
+			return r
+		}
+		return -1
+	}, text)
+}
+
+// Wrap splits the text in lines no wider than maxWidth, on spaces when
+// possible. New lines of the text are kept
+func (f *Font) Wrap(text string, size, maxWidth float64) (lines []string) {
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if f.Width(candidate, size) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// words wider than a line are cut
+			line = ""
+			for _, r := range word {
+				if line != "" && f.Width(line+string(r), size) > maxWidth {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+// Document is a PDF document whose pages all have the same size
+type Document struct {
+	Title  string
+	Width  float64
+	Height float64
+	Pages  []*Page
+	font   *Font
+	// glyphs used by the text of the document, with the rune they represent
+	glyphs map[truetype.Index]rune
+	// images drawn in the document, each one being embedded once
+	images  []image.Image
+	imageID map[image.Image]int
+}
+
+// New returns an empty document using the given font
+func New(font *Font, width, height float64) *Document {
+	return &Document{Width: width, Height: height, font: font, glyphs: make(map[truetype.Index]rune), imageID: make(map[image.Image]int)}
+}
+
+// Page is a page of a document, drawn in the order of the calls
+type Page struct {
+	document *Document
+	content  bytes.Buffer
+}
+
+// AddPage appends an empty page to the document
+func (document *Document) AddPage() *Page {
+	page := &Page{document: document}
+	document.Pages = append(document.Pages, page)
+	return page
+}
+
+func colorComponents(col color.Color) (float64, float64, float64) {
+	r, g, b, _ := col.RGBA()
+	return float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff
+}
+
+// Text draws a single line of text, y being its baseline
+func (page *Page) Text(x, y, size float64, col color.Color, text string) {
+	var encoded strings.Builder
+	for _, r := range page.document.font.Printable(text) {
+		if r == '\n' {
+			continue
+		}
+		index := page.document.font.font.Index(r)
+		page.document.glyphs[index] = r
+		fmt.Fprintf(&encoded, "%04X", uint16(index))
+	}
+	red, green, blue := colorComponents(col)
+	fmt.Fprintf(&page.content, "BT %.3f %.3f %.3f rg /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n",
+		red, green, blue, size, x, page.document.Height-y, encoded.String())
+}
+
+// Rect fills a rectangle whose top left corner is (x, y)
+func (page *Page) Rect(x, y, width, height float64, col color.Color) {
+	red, green, blue := colorComponents(col)
+	fmt.Fprintf(&page.content, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+		red, green, blue, x, page.document.Height-y-height, width, height)
+}
+
+// Line draws a line from (x0, y0) to (x1, y1)
+func (page *Page) Line(x0, y0, x1, y1, width float64, col color.Color) {
+	red, green, blue := colorComponents(col)
+	fmt.Fprintf(&page.content, "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l S\n",
+		red, green, blue, width, x0, page.document.Height-y0, x1, page.document.Height-y1)
+}
+
+// Image draws an image stretched to the rectangle whose top left corner is (x, y)
+func (page *Page) Image(x, y, width, height float64, img image.Image) {
+	id, ok := page.document.imageID[img]
+	if !ok {
+		id = len(page.document.images)
+		page.document.imageID[img] = id
+		page.document.images = append(page.document.images, img)
+	}
+	fmt.Fprintf(&page.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+		width, height, x, page.document.Height-y-height, id)
+}
+
+// imageSamples splits an image into its RGB samples and its alpha channel,
+// which is nil for opaque images
+func imageSamples(img image.Image) (rgb, alpha []byte) {
+	bounds := img.Bounds()
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, col.R, col.G, col.B)
+			alpha = append(alpha, col.A)
+			opaque = opaque && col.A == 0xff
+		}
+	}
+	if opaque {
+		alpha = nil
+	}
+	return
+}
+
+// writer numbers the objects of the file and remembers their offsets for the
+// cross-reference table
+type writer struct {
+	buffer  bytes.Buffer
+	offsets []int
+}
+
+func (w *writer) object(id int, content string) {
+	for len(w.offsets) < id {
+		w.offsets = append(w.offsets, 0)
+	}
+	w.offsets[id-1] = w.buffer.Len()
+	fmt.Fprintf(&w.buffer, "%d 0 obj\n%s\nendobj\n", id, content)
+}
+
+func (w *writer) stream(id int, dictionary string, data []byte) error {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	w.object(id, fmt.Sprintf("<< %s /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", dictionary, compressed.Len(), compressed.String()))
+	return nil
+}
+
+// textString encodes a text as a UTF-16 PDF string
+func textString(text string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&sb, "%04X", unit)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// Write writes the document as a PDF file
+func (document *Document) Write(out io.Writer) error {
+	if len(document.Pages) == 0 {
+		return ErrNoPage
+	}
+
+	const (
+		catalogID = iota + 1
+		pagesID
+		fontID
+		cidFontID
+		descriptorID
+		fontFileID
+		toUnicodeID
+		infoID
+		firstPageID
+	)
+
+	var w writer
+	w.buffer.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	w.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	var kids []string
+	for i := range document.Pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPageID+2*i))
+	}
+	w.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(document.Pages)))
+
+	font := document.font
+	w.object(fontID, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /Luciole /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		cidFontID, toUnicodeID))
+
+	indexes := make([]truetype.Index, 0, len(document.glyphs))
+	for index := range document.glyphs {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var widths strings.Builder
+	for _, index := range indexes {
+		fmt.Fprintf(&widths, "%d [%.0f] ", index, font.glyphWidth(index))
+	}
+	w.object(cidFontID, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Luciole /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 500 /W [%s] >>", descriptorID, widths.String()))
+
+	bounds := font.font.Bounds(fixed.Int26_6(font.upem))
+	toThousandths := func(value fixed.Int26_6) int {
+		return int(value) * 1000 / int(font.upem)
+	}
+	w.object(descriptorID, fmt.Sprintf("<< /Type /FontDescriptor /FontName /Luciole /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 "+
+		"/Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		toThousandths(bounds.Min.X), toThousandths(bounds.Min.Y), toThousandths(bounds.Max.X), toThousandths(bounds.Max.Y),
+		toThousandths(bounds.Max.Y), toThousandths(bounds.Min.Y), toThousandths(bounds.Max.Y), fontFileID))
+
+	if err := w.stream(fontFileID, fmt.Sprintf("/Length1 %d", len(font.data)), font.data); err != nil {
+		return err
+	}
+	if err := w.stream(toUnicodeID, "", document.toUnicode(indexes)); err != nil {
+		return err
+	}
+
+	w.object(infoID, fmt.Sprintf("<< /Title %s /Producer %s /CreationDate (D:%s) >>",
+		textString(document.Title), textString("GroROTI"), time.Now().UTC().Format("20060102150405Z")))
+
+	// images come after the pages, followed by the alpha channels of those having one
+	firstImageID := firstPageID + 2*len(document.Pages)
+	var xObjects strings.Builder
+	for i := range document.images {
+		fmt.Fprintf(&xObjects, "/Im%d %d 0 R ", i, firstImageID+i)
+	}
+
+	for i, page := range document.Pages {
+		pageID := firstPageID + 2*i
+		w.object(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 %d 0 R >> /XObject << %s>> >> /Contents %d 0 R >>",
+			pagesID, document.Width, document.Height, fontID, xObjects.String(), pageID+1))
+		if err := w.stream(pageID+1, "", page.content.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	maskID := firstImageID + len(document.images)
+	for i, img := range document.images {
+		bounds := img.Bounds()
+		size := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", bounds.Dx(), bounds.Dy())
+		rgb, alpha := imageSamples(img)
+		mask := ""
+		if alpha != nil {
+			mask = fmt.Sprintf(" /SMask %d 0 R", maskID)
+			if err := w.stream(maskID, size+" /ColorSpace /DeviceGray", alpha); err != nil {
+				return err
+			}
+			maskID++
+		}
+		if err := w.stream(firstImageID+i, size+" /ColorSpace /DeviceRGB"+mask, rgb); err != nil {
+			return err
+		}
+	}
+
+	xref := w.buffer.Len()
+	fmt.Fprintf(&w.buffer, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.buffer, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, catalogID, infoID, xref)
+
+	_, err := w.buffer.WriteTo(out)
+	return err
+}
+
+// toUnicode maps the glyphs back to their runes, so that the text of the
+// document can be searched and copied
+func (document *Document) toUnicode(indexes []truetype.Index) []byte {
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// bfchar blocks can't hold more than 100 entries
+	for start := 0; start < len(indexes); start += 100 {
+		end := min(start+100, len(indexes))
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", end-start)
+		for _, index := range indexes[start:end] {
+			var code strings.Builder
+			for _, unit := range utf16.Encode([]rune{document.glyphs[index]}) {
+				fmt.Fprintf(&code, "%04X", unit)
+			}
+			fmt.Fprintf(&cmap, "<%04X> <%s>\n", uint16(index), code.String())
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return cmap.Bytes()
+}
@@ -0,0 +1,136 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/staticEmbed"
+)
+
+func loadFont(t *testing.T) *Font {
+	data, err := fs.ReadFile(staticEmbed.EmbeddedStatic, "static/Luciole-Regular.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := ParseFont(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+func TestWrap(t *testing.T) {
+	font := loadFont(t)
+	if width := font.Width("aaaa", 10); width <= 0 {
+		t.Fatalf("Got width %v", width)
+	}
+
+	testCases := []struct {
+		text     string
+		maxWidth string
+		expected []string
+	}{
+		{"aaaa aaaa", "aaaa aaaa", []string{"aaaa aaaa"}},
+		{"aa aa aa aa aa", "aa aa aa", []string{"aa aa aa", "aa aa"}},
+		{"aaaaaaaaaaaaaaaa", "aaaaaaaaaa", []string{"aaaaaaaaaa", "aaaaaa"}},
+		{"first\n\nthird", "first third", []string{"first", "", "third"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			if lines := font.Wrap(tc.text, 10, font.Width(tc.maxWidth, 10)); !reflect.DeepEqual(lines, tc.expected) {
+				t.Errorf("Got %q but expected %q", lines, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	font := loadFont(t)
+	if text := font.Printable("Réunion 👍\tok\n€"); text != "Réunion ok\n€" {
+		t.Errorf("Got %q", text)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	font := loadFont(t)
+
+	document := New(font, A4Width, A4Height)
+	if err := document.Write(io.Discard); err != ErrNoPage {
+		t.Errorf("Got %v but expected %v", err, ErrNoPage)
+	}
+
+	document.Title = "ROTI 12345"
+	page := document.AddPage()
+	page.Text(50, 50, 12, color.Black, "Réunion")
+	page.Rect(50, 60, 100, 20, color.RGBA{200, 100, 0, 255})
+	opaque := image.NewGray(image.Rect(0, 0, 4, 2))
+	translucent := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	translucent.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 128})
+	page.Image(50, 100, 40, 20, opaque)
+	second := document.AddPage()
+	second.Line(50, 50, 100, 50, 1, color.Black)
+	// images drawn several times are embedded once
+	second.Image(50, 100, 40, 20, opaque)
+	second.Image(50, 150, 20, 20, translucent)
+
+	var buffer bytes.Buffer
+	if err := document.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	content := buffer.Bytes()
+	if !bytes.HasPrefix(content, []byte("%PDF-1.7")) || !bytes.HasSuffix(content, []byte("%%EOF\n")) {
+		t.Fatalf("Not a PDF file")
+	}
+
+	// every object must be where the cross-reference table says
+	xref := regexp.MustCompile(`xref\n0 (\d+)\n`).FindSubmatchIndex(content)
+	if xref == nil {
+		t.Fatal("No cross-reference table")
+	}
+	count, _ := strconv.Atoi(string(content[xref[2]:xref[3]]))
+	entries := strings.Split(string(content[xref[1]:]), "\n")
+	for id := 1; id < count; id++ {
+		offset, err := strconv.Atoi(entries[id][:10])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(content[offset:], []byte(fmt.Sprintf("%d 0 obj", id))) {
+			t.Errorf("Object %d not found at offset %d", id, offset)
+		}
+	}
+	if !bytes.Contains(content, []byte("/Count 2")) {
+		t.Errorf("Expected 2 pages")
+	}
+	if images := bytes.Count(content, []byte("/Subtype /Image")); images != 3 {
+		t.Errorf("Got %d images and masks, expected 3", images)
+	}
+	if !bytes.Contains(content, []byte("/XObject << /Im0 13 0 R /Im1 14 0 R >>")) || !bytes.Contains(content, []byte("/SMask 15 0 R")) {
+		t.Errorf("Images aren't referenced as expected")
+	}
+
+	// the first page stream holds the text as glyph indexes
+	stream := regexp.MustCompile(`(?s)9 0 obj\n.*?stream\n`).FindIndex(content)
+	if stream == nil {
+		t.Fatal("Page content not found")
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(content[stream[1]:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageContent, _ := io.ReadAll(reader)
+	expected := fmt.Sprintf("<%04X", uint16(font.font.Index('R')))
+	if !bytes.Contains(pageContent, []byte(expected)) || !bytes.Contains(pageContent, []byte(" re f")) {
+		t.Errorf("Unexpected page content %s", pageContent)
+	}
+}
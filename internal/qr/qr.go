@@ -0,0 +1,324 @@
+// Package qr generates QR codes as PNG or SVG images on demand, and keeps the
+// most recently used ones in memory
+package qr
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/image/draw"
+)
+
+// Limits of the options
+const (
+	MinSize      = 64
+	MaxSize      = 2048
+	MaxQuietZone = 16
+	// logoRatio is the width of the logo relative to the width of the code
+	logoRatio = 0.2
+)
+
+var (
+	ErrInvalidSize      = fmt.Errorf("size must be between %d and %d pixels", MinSize, MaxSize)
+	ErrInvalidLevel     = errors.New("error correction level must be L, M, Q or H")
+	ErrInvalidColor     = errors.New("colors must be written as RRGGBB")
+	ErrInvalidQuietZone = fmt.Errorf("quiet zone must be between 0 and %d modules", MaxQuietZone)
+	ErrUnknownFormat    = errors.New("unknown image format")
+)
+
+// Level is the error correction level, from L (7% of the code can be
+// recovered) to H (30%)
+type Level byte
+
+const (
+	LevelLow      Level = 'L'
+	LevelMedium   Level = 'M'
+	LevelQuartile Level = 'Q'
+	LevelHigh     Level = 'H'
+)
+
+var recoveryLevels = map[Level]qrcode.RecoveryLevel{
+	LevelLow:      qrcode.Low,
+	LevelMedium:   qrcode.Medium,
+	LevelQuartile: qrcode.High,
+	LevelHigh:     qrcode.Highest,
+}
+
+// ParseLevel reads a level written as L, M, Q or H
+func ParseLevel(value string) (Level, error) {
+	level := Level(strings.ToUpper(value + " ")[0])
+	if _, ok := recoveryLevels[level]; !ok || len(value) != 1 {
+		return 0, ErrInvalidLevel
+	}
+	return level, nil
+}
+
+// ParseColor reads a color written as RRGGBB, with or without a leading #
+func ParseColor(value string) (color.RGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) != 6 {
+		return color.RGBA{}, ErrInvalidColor
+	}
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidColor
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}, nil
+}
+
+// Format is the format of the generated images
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+var contentTypes = map[Format]string{PNG: "image/png", SVG: "image/svg+xml"}
+
+// Options change the look of a QR code
+type Options struct {
+	// Size is the width and height of the image, in pixels
+	Size       int
+	Level      Level
+	Foreground color.RGBA
+	Background color.RGBA
+	// QuietZone is the blank margin around the code, in modules
+	QuietZone int
+	// Logo is drawn in the middle of the code. Codes with a logo use the
+	// highest error correction level, so that the modules it hides can be recovered
+	Logo bool
+}
+
+// DefaultOptions returns black on white codes of the given size
+func DefaultOptions(size int) Options {
+	return Options{
+		Size:       size,
+		Level:      LevelMedium,
+		Foreground: color.RGBA{0, 0, 0, 255},
+		Background: color.RGBA{255, 255, 255, 255},
+		QuietZone:  4,
+	}
+}
+
+func (options Options) Validate() error {
+	if options.Size < MinSize || options.Size > MaxSize {
+		return ErrInvalidSize
+	}
+	if _, ok := recoveryLevels[options.Level]; !ok {
+		return ErrInvalidLevel
+	}
+	if options.QuietZone < 0 || options.QuietZone > MaxQuietZone {
+		return ErrInvalidQuietZone
+	}
+	return nil
+}
+
+// Image is a generated QR code
+type Image struct {
+	Data        []byte
+	ContentType string
+	// ETag changes with the content of the image
+	ETag string
+}
+
+type key struct {
+	content string
+	options Options
+	format  Format
+}
+
+type entry struct {
+	key   key
+	image Image
+}
+
+// Service generates QR codes, keeping the last ones in a LRU cache
+type Service struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[key]*list.Element
+	// recent holds the entries, most recently used first
+	recent  *list.List
+	logo    image.Image
+	logoPNG []byte
+}
+
+// NewService returns a service caching up to capacity images. logo is the
+// PNG image drawn in the middle of the codes asking for it
+func NewService(capacity int, logo []byte) (*Service, error) {
+	decoded, err := png.Decode(bytes.NewReader(logo))
+	if err != nil {
+		return nil, err
+	}
+	return &Service{capacity: capacity, entries: make(map[key]*list.Element), recent: list.New(), logo: decoded, logoPNG: logo}, nil
+}
+
+// Len returns the number of cached images
+func (s *Service) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recent.Len()
+}
+
+// Get returns the QR code of the content, from the cache when it has already
+// been generated
+func (s *Service) Get(content string, options Options, format Format) (Image, error) {
+	if err := options.Validate(); err != nil {
+		return Image{}, err
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return Image{}, ErrUnknownFormat
+	}
+	k := key{content: content, options: options, format: format}
+
+	s.mu.Lock()
+	if element, ok := s.entries[k]; ok {
+		s.recent.MoveToFront(element)
+		s.mu.Unlock()
+		return element.Value.(*entry).image, nil
+	}
+	s.mu.Unlock()
+
+	// codes are generated without holding the lock
+	img, err := s.generate(k)
+	if err != nil {
+		return Image{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[k]; ok {
+		s.recent.MoveToFront(element)
+		return element.Value.(*entry).image, nil
+	}
+	s.entries[k] = s.recent.PushFront(&entry{key: k, image: img})
+	for s.recent.Len() > s.capacity {
+		oldest := s.recent.Back()
+		s.recent.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+	}
+	return img, nil
+}
+
+func (s *Service) generate(k key) (Image, error) {
+	level := recoveryLevels[k.options.Level]
+	if k.options.Logo {
+		level = qrcode.Highest
+	}
+	code, err := qrcode.New(k.content, level)
+	if err != nil {
+		return Image{}, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	var data []byte
+	if k.format == SVG {
+		data = s.drawSVG(bitmap, k.content, k.options)
+	} else if data, err = s.drawPNG(bitmap, k.options); err != nil {
+		return Image{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return Image{Data: data, ContentType: contentTypes[k.format], ETag: `"` + hex.EncodeToString(sum[:16]) + `"`}, nil
+}
+
+// drawPNG scales the modules to whole pixels and centers the code in the image
+func (s *Service) drawPNG(bitmap [][]bool, options Options) ([]byte, error) {
+	modules := len(bitmap) + 2*options.QuietZone
+	module := max(options.Size/modules, 1)
+	offset := (options.Size-module*modules)/2 + options.QuietZone*module
+
+	img := image.NewRGBA(image.Rect(0, 0, options.Size, options.Size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{options.Background}, image.Point{}, draw.Src)
+	foreground := &image.Uniform{options.Foreground}
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				rect := image.Rect(offset+x*module, offset+y*module, offset+(x+1)*module, offset+(y+1)*module)
+				draw.Draw(img, rect, foreground, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if options.Logo {
+		codeWidth := len(bitmap) * module
+		bounds := s.logo.Bounds()
+		width := int(float64(codeWidth) * logoRatio)
+		height := width * bounds.Dy() / bounds.Dx()
+		x, y := (options.Size-width)/2, (options.Size-height)/2
+		// the logo stands on a margin of the background color
+		draw.Draw(img, image.Rect(x-module, y-module, x+width+module, y+height+module), &image.Uniform{options.Background}, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(img, image.Rect(x, y, x+width, y+height), s.logo, bounds, draw.Over, nil)
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func hexColor(col color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B)
+}
+
+// drawSVG draws the dark modules as a single path, in a view box measured in modules
+func (s *Service) drawSVG(bitmap [][]bool, content string, options Options) []byte {
+	quiet := options.QuietZone
+	modules := len(bitmap) + 2*quiet
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			end := x
+			for end < len(row) && row[end] {
+				end++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", x+quiet, y+quiet, end-x, end-x)
+			x = end
+		}
+	}
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges" role="img">`+"\n",
+		options.Size, options.Size, modules, modules)
+	fmt.Fprintf(&svg, "<title>%s</title>\n", html.EscapeString(content))
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(options.Background))
+	fmt.Fprintf(&svg, `<path fill="%s" d="%s"/>`+"\n", hexColor(options.Foreground), path.String())
+
+	if options.Logo {
+		bounds := s.logo.Bounds()
+		width := float64(len(bitmap)) * logoRatio
+		height := width * float64(bounds.Dy()) / float64(bounds.Dx())
+		x, y := (float64(modules)-width)/2, (float64(modules)-height)/2
+		fmt.Fprintf(&svg, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			number(x-1), number(y-1), number(width+2), number(height+2), hexColor(options.Background))
+		fmt.Fprintf(&svg, `<image x="%s" y="%s" width="%s" height="%s" href="data:image/png;base64,%s"/>`+"\n",
+			number(x), number(y), number(width), number(height), base64.StdEncoding.EncodeToString(s.logoPNG))
+	}
+
+	svg.WriteString("</svg>\n")
+	return svg.Bytes()
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,209 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of testdata/")
+
+// testLogo returns a red PNG, twice as wide as high
+func testLogo(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func newTestService(t *testing.T, capacity int) *Service {
+	service, err := NewService(capacity, testLogo(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestParse(t *testing.T) {
+	if level, err := ParseLevel("q"); err != nil || level != LevelQuartile {
+		t.Errorf("Got %c, %v for q", level, err)
+	}
+	for _, value := range []string{"", "X", "LM"} {
+		if _, err := ParseLevel(value); !errors.Is(err, ErrInvalidLevel) {
+			t.Errorf("Got %v for %q", err, value)
+		}
+	}
+
+	if col, err := ParseColor("#1a2B3c"); err != nil || col != (color.RGBA{0x1a, 0x2b, 0x3c, 255}) {
+		t.Errorf("Got %v, %v for #1a2B3c", col, err)
+	}
+	for _, value := range []string{"", "fff", "12345g", "1234567"} {
+		if _, err := ParseColor(value); !errors.Is(err, ErrInvalidColor) {
+			t.Errorf("Got %v for %q", err, value)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		change      func(*Options)
+		expectedErr error
+	}{
+		{"default", func(o *Options) {}, nil},
+		{"too small", func(o *Options) { o.Size = MinSize - 1 }, ErrInvalidSize},
+		{"too big", func(o *Options) { o.Size = MaxSize + 1 }, ErrInvalidSize},
+		{"no level", func(o *Options) { o.Level = 0 }, ErrInvalidLevel},
+		{"negative quiet zone", func(o *Options) { o.QuietZone = -1 }, ErrInvalidQuietZone},
+		{"wide quiet zone", func(o *Options) { o.QuietZone = MaxQuietZone + 1 }, ErrInvalidQuietZone},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := DefaultOptions(200)
+			tc.change(&options)
+			if err := options.Validate(); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Got error %v but expected %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	service := newTestService(t, 10)
+	options := DefaultOptions(300)
+	options.Foreground = color.RGBA{0, 0, 255, 255}
+	options.Background = color.RGBA{255, 255, 0, 255}
+
+	for _, logo := range []bool{false, true} {
+		options.Logo = logo
+		code, err := service.Get("http://localhost:3000/roti/12345", options, PNG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.ContentType != "image/png" {
+			t.Errorf("Got content type %s", code.ContentType)
+		}
+		img, err := png.Decode(bytes.NewReader(code.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 300 || bounds.Dy() != 300 {
+			t.Errorf("Got a %dx%d image", bounds.Dx(), bounds.Dy())
+		}
+		// the corner is in the quiet zone, the finder pattern starts after it
+		if col := color.RGBAModel.Convert(img.At(1, 1)); col != options.Background {
+			t.Errorf("Got %v in the quiet zone", col)
+		}
+		if col := color.RGBAModel.Convert(img.At(50, 50)); col != options.Foreground {
+			t.Errorf("Got %v in the finder pattern", col)
+		}
+		if center := color.RGBAModel.Convert(img.At(150, 150)); (center == color.RGBA{255, 0, 0, 255}) != logo {
+			t.Errorf("Got %v in the center with logo %t", center, logo)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	service := newTestService(t, 10)
+	code, err := service.Get("http://localhost:3000/roti/12345", DefaultOptions(200), SVG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkWellFormed(t, code.Data)
+
+	path := filepath.Join("testdata", "qr.svg")
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, code.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(code.Data, expected) {
+		t.Error("qr.svg doesn't match the golden file, run the tests with -update if the change is expected")
+	}
+
+	options := DefaultOptions(200)
+	options.Logo = true
+	if code, err = service.Get("http://localhost:3000/roti/12345", options, SVG); err != nil {
+		t.Fatal(err)
+	}
+	checkWellFormed(t, code.Data)
+	if !strings.Contains(string(code.Data), `href="data:image/png;base64,`) {
+		t.Error("The logo is missing")
+	}
+}
+
+// checkWellFormed fails if the content isn't valid XML
+func checkWellFormed(t *testing.T, content []byte) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("SVG is not well-formed: %s", err)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	service := newTestService(t, 2)
+	get := func(content string, options Options) Image {
+		code, err := service.Get(content, options, PNG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	first := get("a", DefaultOptions(100))
+	if again := get("a", DefaultOptions(100)); &again.Data[0] != &first.Data[0] {
+		t.Error("The cached image wasn't reused")
+	}
+	if other := get("a", DefaultOptions(120)); other.ETag == first.ETag {
+		t.Error("Images of different sizes have the same ETag")
+	}
+	if service.Len() != 2 {
+		t.Errorf("Got %d cached images", service.Len())
+	}
+
+	// a is the least recently used one, so it's evicted first
+	get("b", DefaultOptions(100))
+	if service.Len() != 2 {
+		t.Errorf("Got %d cached images", service.Len())
+	}
+	if again := get("a", DefaultOptions(100)); &again.Data[0] == &first.Data[0] {
+		t.Error("The least recently used image wasn't evicted")
+	} else if again.ETag != first.ETag {
+		t.Error("The ETag changed for the same image")
+	}
+
+	if _, err := service.Get("a", DefaultOptions(10), PNG); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("Got error %v", err)
+	}
+	if _, err := service.Get("a", DefaultOptions(100), "gif"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Got error %v", err)
+	}
+}
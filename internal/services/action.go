@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+// actionsExport is the JSON export of the action items of a ROTI
+type actionsExport struct {
+	ID          int                `json:"id"`
+	Description string             `json:"description"`
+	Actions     []model.ActionItem `json:"actions"`
+	CarriedOver []model.ActionItem `json:"carried_over"`
+}
+
+// getOwnedROTI returns the ROTI of the URL if the user created it, and
+// answers the request otherwise
+func getOwnedROTI(w http.ResponseWriter, r *http.Request, action string) (currentROTI model.ROTIEntity, ok bool) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return currentROTI, false
+	}
+
+	currentROTI, err = model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return currentROTI, false
+	}
+
+	if !isROTIOwner(r, currentROTI) {
+		log.Warn().Msgf("%s of ROTI %d refused: %s", action, rotiID, ErrNotROTIOwner)
+		http.Error(w, ErrNotROTIOwner.Error(), http.StatusForbidden)
+		return currentROTI, false
+	}
+	return currentROTI, true
+}
+
+func replyFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "reply to feedback")
+	if !ok {
+		return
+	}
+
+	err := currentROTI.ReplyToFeedback(model.FeedbackID(r.PathValue("feedbackid")), r.FormValue("reply"))
+	if errors.Is(err, model.ErrNoVoteMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
+
+func addActionHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "new action item")
+	if !ok {
+		return
+	}
+
+	if _, err := currentROTI.AddAction(r.FormValue("text")); err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
+
+func updateActionHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "update of action item")
+	if !ok {
+		return
+	}
+
+	status, err := model.CheckActionStatus(r.FormValue("status"))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	err = currentROTI.SetActionStatus(r.PathValue("actionid"), status)
+	if errors.Is(err, model.ErrNoActionMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
+
+// nextSessionHandler creates the next session of a recurring meeting, with the
+// same options. Open actions of previous sessions are shown on its page
+func nextSessionHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "next session")
+	if !ok {
+		return
+	}
+
+	user, ok := requireLogin(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()))
+	if !ok {
+		return
+	}
+
+	currentROTI.StartSeries()
+	options := currentROTI.NextSessionOptions()
+	options.OwnerToken = model.NewOwnerToken()
+	if user.Subject != "" {
+		options.Creator = user.Subject
+	}
+
+	rotiID := model.CreateROTIWithOptions(options, currentConfig.CleanOverTime)
+	setOwnerCookie(w, rotiID.Int(), options.OwnerToken)
+	if options.Email != "" {
+		requestEmailConfirmation(options.Email, time.Now())
+	}
+	if nextROTI, err := model.GetROTI(rotiID); err == nil {
+		emitWebhookEvent(nextROTI, model.EventROTICreated)
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID.Int()), http.StatusSeeOther)
+}
+
+// exportActionsAsMarkdown renders the action items as a Markdown checklist
+func exportActionsAsMarkdown(export actionsExport) string {
+	var md strings.Builder
+	title := fmt.Sprintf("ROTI %d", export.ID)
+	if export.Description != "" {
+		title += " - " + export.Description
+	}
+	fmt.Fprintf(&md, "# Action items of %s\n", title)
+
+	writeList := func(actions []model.ActionItem, withOrigin bool) {
+		if len(actions) == 0 {
+			md.WriteString("\nNo action item.\n")
+			return
+		}
+		md.WriteString("\n")
+		for _, action := range actions {
+			check := " "
+			if action.Status == model.ActionDone {
+				check = "x"
+			}
+			fmt.Fprintf(&md, "- [%s] %s", check, strings.ReplaceAll(action.Text, "\n", " "))
+			if withOrigin {
+				fmt.Fprintf(&md, " (ROTI %d)", action.ROTIID.Int())
+			}
+			md.WriteString("\n")
+		}
+	}
+
+	writeList(export.Actions, false)
+	if len(export.CarriedOver) > 0 {
+		md.WriteString("\n## Open actions from previous sessions\n")
+		writeList(export.CarriedOver, true)
+	}
+	return md.String()
+}
+
+func downloadActionsHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	export := actionsExport{
+		ID:          rotiID,
+		Description: currentROTI.GetDescription(),
+		Actions:     currentROTI.ListActions(),
+		CarriedOver: currentROTI.ListCarriedOverActions(),
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "md", "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d_actions.md", rotiID))
+		fmt.Fprint(w, exportActionsAsMarkdown(export))
+	default:
+		if export.Actions == nil {
+			export.Actions = []model.ActionItem{}
+		}
+		if export.CarriedOver == nil {
+			export.CarriedOver = []model.ActionItem{}
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d_actions.json", rotiID))
+		writeJSON(w, http.StatusOK, export)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/deezer/groroti/internal/analysis"
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+type confidenceInterval struct {
+	Level float64 `json:"level"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
+
+// feedbackAnalysis is the sentiment summary and the keywords of the feedbacks.
+// The sentiment of each feedback is left out, as it would tell the order of the votes
+type feedbackAnalysis struct {
+	Positive     int             `json:"positive"`
+	Neutral      int             `json:"neutral"`
+	Negative     int             `json:"negative"`
+	AverageScore float64         `json:"average_score"`
+	Keywords     []analysis.Term `json:"keywords"`
+	Bigrams      []analysis.Term `json:"bigrams"`
+}
+
+// apiResults is the JSON representation of the results of a ROTI
+type apiResults struct {
+	ID          int                 `json:"id"`
+	Description string              `json:"description"`
+	NumVotes    int                 `json:"num_votes"`
+	Avg         float64             `json:"average"`
+	Min         *float64            `json:"min,omitempty"`
+	Max         *float64            `json:"max,omitempty"`
+	CI          *confidenceInterval `json:"confidence_interval,omitempty"`
+	LowSample   bool                `json:"low_sample"`
+	// DetailsHidden is set when there are less votes than the anonymity threshold
+	DetailsHidden bool                `json:"details_hidden"`
+	Distribution  []distributionBar   `json:"distribution,omitempty"`
+	Feedbacks     []string            `json:"feedbacks"`
+	Support       []supportedFeedback `json:"feedback_support,omitempty"`
+	Groups        []feedbackGroup     `json:"feedback_by_prompt,omitempty"`
+	FollowUps     []feedbackGroup     `json:"follow_ups,omitempty"`
+	Analysis      *feedbackAnalysis   `json:"analysis,omitempty"`
+	Actions       []model.ActionItem  `json:"actions,omitempty"`
+	CarriedOver   []model.ActionItem  `json:"carried_over_actions,omitempty"`
+}
+
+func newAPIResults(roti existingROTI) apiResults {
+	results := apiResults{
+		ID:            roti.Id,
+		Description:   roti.Description,
+		NumVotes:      roti.NumVotes,
+		Avg:           roti.Avg,
+		LowSample:     roti.LowSample,
+		DetailsHidden: roti.DetailsHidden,
+		Distribution:  roti.Distribution,
+		Feedbacks:     roti.Feedbacks,
+		Support:       roti.Supported,
+		Groups:        roti.Groups,
+		FollowUps:     roti.FollowUps,
+		Actions:       roti.Actions,
+		CarriedOver:   roti.CarriedOver,
+	}
+	if !roti.DetailsHidden {
+		results.Min, results.Max = &roti.Min, &roti.Max
+	}
+	if roti.HasCI {
+		results.CI = &confidenceInterval{Level: 0.95, Low: roti.CILow, High: roti.CIHigh}
+	}
+	if roti.Analysis != nil {
+		results.Analysis = &feedbackAnalysis{
+			Positive:     roti.Analysis.Positive,
+			Neutral:      roti.Analysis.Neutral,
+			Negative:     roti.Analysis.Negative,
+			AverageScore: roti.Analysis.AverageScore,
+			Keywords:     roti.Analysis.Keywords,
+			Bigrams:      roti.Analysis.Bigrams,
+		}
+	}
+	if results.Feedbacks == nil {
+		results.Feedbacks = []string{}
+	}
+	return results
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Msgf("couldn't encode JSON response: %s", err.Error())
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func apiROTIHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, model.ErrNoROTIMatchingThisID)
+		return
+	}
+
+	results := collectResults(rotiID, currentROTI)
+	if results.ResultsHidden {
+		writeJSONError(w, http.StatusForbidden, ErrResultsHidden)
+		return
+	}
+	if r.URL.Query().Get("sort") == "support" {
+		sortBySupport(results.Supported)
+	}
+
+	writeJSON(w, http.StatusOK, newAPIResults(results))
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deezer/groroti/internal/ical"
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrCalendarFeed = errors.New("calendar feed unavailable")
+
+const (
+	// calendarLookahead is how long before their meeting ROTIs are created
+	calendarLookahead = 24 * time.Hour
+	calendarTimeout   = 30 * time.Second
+	// calendarMaxSize bounds the size of the feeds read
+	calendarMaxSize = 10 << 20
+	calendarProdID  = "-//Deezer//GroROTI//EN"
+)
+
+var calendarClient = &http.Client{Timeout: calendarTimeout}
+
+// readCalendarFeed reads a feed from an http(s) URL or from a file
+func readCalendarFeed(feed string) (*ical.Calendar, error) {
+	var body io.Reader
+	if strings.HasPrefix(feed, "http://") || strings.HasPrefix(feed, "https://") {
+		resp, err := calendarClient.Get(feed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCalendarFeed, err.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("%w: answered %s", ErrCalendarFeed, resp.Status)
+		}
+		body = resp.Body
+	} else {
+		file, err := os.Open(feed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCalendarFeed, err.Error())
+		}
+		defer file.Close()
+		body = file
+	}
+	return ical.Parse(io.LimitReader(body, calendarMaxSize))
+}
+
+// matchesCalendarFilter tells whether the summary or the organizer of the
+// meeting contains the filter, ignoring case
+func matchesCalendarFilter(event ical.Event, filter string) bool {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return true
+	}
+	for _, value := range []string{event.Summary, event.OrganizerName, event.OrganizerEmail} {
+		if strings.Contains(strings.ToLower(value), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncCalendar creates the ROTIs of the meetings of the feed starting within
+// calendarLookahead, or whose votes are still open, and follows the ones
+// that were rescheduled. It returns the number of ROTIs created
+func syncCalendar(now time.Time) (created int, err error) {
+	feed, _ := currentConfig.GetCalendarFeed()
+	calendar, err := readCalendarFeed(feed)
+	if err != nil {
+		return 0, err
+	}
+	for _, warning := range calendar.Warnings {
+		log.Warn().Msgf("calendar feed: %s", warning.Error())
+	}
+
+	window := currentConfig.GetCalendarVotingWindow()
+	for _, event := range calendar.Occurrences(now.Add(-window), now.Add(calendarLookahead)) {
+		// all day events are days off or reminders rather than meetings
+		if event.AllDay || !matchesCalendarFilter(event, currentConfig.CalendarFilter) {
+			continue
+		}
+
+		if known, found := model.GetCalendarEvent(event.UID, event.RecurrenceID); found {
+			if !known.StartsAt.Equal(event.Start) || !known.EndsAt.Equal(event.End) {
+				rescheduleCalendarROTI(known, event, window)
+			}
+			continue
+		}
+
+		options := model.ROTIOptions{Description: event.Summary, OwnerToken: model.NewOwnerToken()}
+		if event.IsRecurring() {
+			options.Series = model.GetCalendarSeries(event.UID)
+		}
+		rotiID := model.CreateROTIWithOptions(options, currentConfig.CleanOverTime)
+		currentROTI, err := model.GetROTI(rotiID)
+		if err != nil {
+			log.Error().Msgf("ROTI %d created from the calendar can't be found: %s", rotiID.Int(), err.Error())
+			continue
+		}
+		// the first occurrence of a recurring meeting starts its series
+		if event.IsRecurring() && options.Series == "" {
+			currentROTI.StartSeries()
+		}
+		// votes open when the meeting ends, not when the ROTI is created
+		currentROTI.OpenAt(event.End)
+		currentROTI.CloseAt(event.End.Add(window))
+		model.AddCalendarEvent(model.CalendarEvent{UID: event.UID, Occurrence: event.RecurrenceID, ROTI: rotiID,
+			StartsAt: event.Start, EndsAt: event.End})
+		emitWebhookEvent(currentROTI, model.EventROTICreated)
+		log.Info().Msgf("ROTI %d created from the calendar for %q on %s", rotiID.Int(), event.Summary, event.Start.Format(time.RFC3339))
+		created++
+	}
+	return created, nil
+}
+
+// rescheduleCalendarROTI moves the votes along with the meeting, unless the
+// ROTI is already closed
+func rescheduleCalendarROTI(known model.CalendarEvent, event ical.Event, window time.Duration) {
+	known.StartsAt = event.Start
+	known.EndsAt = event.End
+	model.RescheduleCalendarEvent(known)
+	if currentROTI, err := model.GetROTI(known.ROTI); err == nil && !currentROTI.IsClosed() {
+		currentROTI.OpenAt(event.End)
+		currentROTI.CloseAt(event.End.Add(window))
+	}
+	log.Info().Msgf("ROTI %d rescheduled with its meeting on %s", known.ROTI.Int(), event.Start.Format(time.RFC3339))
+}
+
+// startCalendarWorker reads the calendar feed on a regular basis. The feed
+// and its interval are read on each loop, the configuration being loaded
+// after the worker starts
+func startCalendarWorker() {
+	go func() {
+		for {
+			feed, interval := currentConfig.GetCalendarFeed()
+			if feed != "" {
+				if created, err := syncCalendar(time.Now()); err != nil {
+					log.Error().Msgf("couldn't read the calendar feed: %s", err.Error())
+				} else if created > 0 {
+					log.Info().Msgf("%d ROTIs created from the calendar feed", created)
+				}
+			}
+			if interval <= 0 {
+				interval = time.Minute
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// rotiCalendarEvent returns the voting window of the ROTI: from the end of its
+// meeting, or its creation, to its closing
+func rotiCalendarEvent(currentROTI model.ROTIEntity) ical.Event {
+	rotiID := currentROTI.GetID().Int()
+	voteURL := fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), rotiID)
+	qrURL := fmt.Sprintf("%s/qr/%d.png", currentConfig.GetURL(), rotiID)
+
+	summary := fmt.Sprintf("ROTI %d", rotiID)
+	if description := currentROTI.GetDescription(); description != "" {
+		summary = "ROTI: " + description
+	}
+	host := "groroti"
+	if frontend, err := url.Parse(currentConfig.GetURL()); err == nil && frontend.Hostname() != "" {
+		host = frontend.Hostname()
+	}
+
+	start := currentROTI.GetCreatedAt()
+	if meeting, found := currentROTI.GetCalendarEvent(); found {
+		start = meeting.EndsAt
+	}
+	end := currentROTI.GetClosesAt()
+	if !end.After(start) {
+		end = start.Add(currentConfig.GetCalendarVotingWindow())
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("roti-%d@%s", rotiID, host),
+		Summary:     summary,
+		Description: fmt.Sprintf("Vote on the ROTI: %s\nOr scan the QR code: %s", voteURL, qrURL),
+		URL:         voteURL,
+		Start:       start,
+		End:         end,
+	}
+}
+
+// icsHandler serves the voting window of a ROTI as an iCalendar file, to
+// remind participants to vote
+func icsHandler(w http.ResponseWriter, r *http.Request) {
+	strID, found := strings.CutSuffix(r.PathValue("name"), ".ics")
+	rotiID, err := strconv.Atoi(strID)
+	if !found || err != nil || rotiID < 10000 || rotiID > 99999 {
+		http.Error(w, model.ErrInvalidROTIID.Error(), http.StatusNotFound)
+		return
+	}
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		http.Error(w, model.ErrNoROTIMatchingThisID.Error(), http.StatusNotFound)
+		return
+	}
+
+	var calendar bytes.Buffer
+	if err := ical.Write(&calendar, calendarProdID, rotiCalendarEvent(currentROTI)); err != nil {
+		log.Error().Msgf("couldn't write calendar of ROTI %d: %s", rotiID, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d.ics", rotiID))
+	if _, err := w.Write(calendar.Bytes()); err != nil {
+		log.Error().Msgf("couldn't write calendar of ROTI %d: %s", rotiID, err.Error())
+	}
+}
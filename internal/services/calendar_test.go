@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/ical"
+	"github.com/deezer/groroti/internal/model"
+)
+
+// writeFeed writes an iCalendar feed of the events, each one given as its
+// properties
+func writeFeed(t *testing.T, path string, events ...[]string) {
+	t.Helper()
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Test//Meetings//EN"}
+	for _, event := range events {
+		lines = append(lines, "BEGIN:VEVENT")
+		lines = append(lines, event...)
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func icsTime(date time.Time) string {
+	return date.UTC().Format("20060102T150405Z")
+}
+
+func TestSyncCalendar(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	// the database is kept between runs, meetings are unique to this one
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	feed := filepath.Join(t.TempDir(), "meetings.ics")
+	defer func(feed, filter string, window int) {
+		currentConfig.CalendarFeed, currentConfig.CalendarFilter, currentConfig.CalendarVotingWindow = feed, filter, window
+	}(currentConfig.CalendarFeed, currentConfig.CalendarFilter, currentConfig.CalendarVotingWindow)
+	currentConfig.CalendarFeed = feed
+	currentConfig.CalendarFilter = "RETRO"
+	currentConfig.CalendarVotingWindow = 60
+
+	now := time.Now().Truncate(time.Minute)
+	retroStart := now.Add(-47 * time.Hour)
+	kickoffStart := now.Add(2 * time.Hour)
+	retro := []string{"UID:retro-" + run, "SUMMARY:Sprint retro " + run, "DTSTART:" + icsTime(retroStart),
+		"DTEND:" + icsTime(retroStart.Add(30*time.Minute)), "RRULE:FREQ=DAILY"}
+	kickoff := []string{"UID:kickoff-" + run, "SUMMARY:Kickoff " + run, `ORGANIZER;CN="Retro Master":mailto:master@example.com`,
+		"DTSTART:" + icsTime(kickoffStart), "DTEND:" + icsTime(kickoffStart.Add(time.Hour))}
+	lunch := []string{"UID:lunch-" + run, "SUMMARY:Lunch " + run, "DTSTART:" + icsTime(now.Add(3*time.Hour)), "DURATION:PT1H"}
+	offsite := []string{"UID:offsite-" + run, "SUMMARY:Retro offsite " + run, "DTSTART;VALUE=DATE:" + now.Add(4*time.Hour).Format("20060102")}
+	writeFeed(t, feed, retro, kickoff, lunch, offsite)
+
+	// the retro of today and the kickoff, organized by the Retro Master, match the filter
+	if created, err := syncCalendar(now); err != nil || created != 2 {
+		t.Fatalf("Expected 2 ROTIs to be created, got %d (%v)", created, err)
+	}
+	if created, err := syncCalendar(now); err != nil || created != 0 {
+		t.Errorf("Expected the meetings to get a single ROTI, got %d more (%v)", created, err)
+	}
+	for _, uid := range []string{"lunch-" + run, "offsite-" + run} {
+		if _, found := model.GetCalendarEvent(uid, time.Time{}); found {
+			t.Errorf("Expected no ROTI for %s", uid)
+		}
+	}
+
+	firstOccurrence := retroStart.AddDate(0, 0, 2)
+	firstRetro, found := model.GetCalendarEvent("retro-"+run, firstOccurrence)
+	if !found {
+		t.Fatal("Expected a ROTI for the retro of today")
+	}
+	firstROTI, err := model.GetROTI(firstRetro.ROTI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstROTI.GetDescription() != "Sprint retro "+run || firstROTI.GetSeries() == "" ||
+		!firstROTI.GetClosesAt().Equal(firstOccurrence.Add(90*time.Minute)) {
+		t.Errorf("Expected the retro to start a series and to close an hour after its end, got %q, series %q, closing at %s",
+			firstROTI.GetDescription(), firstROTI.GetSeries(), firstROTI.GetClosesAt())
+	}
+
+	// the next day brings the next occurrence of the retro, in the same series
+	if created, err := syncCalendar(now.Add(24 * time.Hour)); err != nil || created != 1 {
+		t.Fatalf("Expected the next retro to get a ROTI, got %d (%v)", created, err)
+	}
+	nextRetro, found := model.GetCalendarEvent("retro-"+run, firstOccurrence.AddDate(0, 0, 1))
+	if !found {
+		t.Fatal("Expected a ROTI for the retro of tomorrow")
+	}
+	if nextROTI, _ := model.GetROTI(nextRetro.ROTI); nextROTI.GetSeries() != firstROTI.GetSeries() {
+		t.Errorf("Expected the retros to share series %s, got %s", firstROTI.GetSeries(), nextROTI.GetSeries())
+	}
+
+	// moving the kickoff moves the end of its votes
+	kickoff[3] = "DTSTART:" + icsTime(kickoffStart.Add(time.Hour))
+	kickoff[4] = "DTEND:" + icsTime(kickoffStart.Add(2*time.Hour))
+	writeFeed(t, feed, retro, kickoff)
+	if created, err := syncCalendar(now); err != nil || created != 0 {
+		t.Errorf("Expected the moved kickoff to keep its ROTI, got %d more (%v)", created, err)
+	}
+	moved, _ := model.GetCalendarEvent("kickoff-"+run, time.Time{})
+	kickoffROTI, _ := model.GetROTI(moved.ROTI)
+	if !moved.StartsAt.Equal(kickoffStart.Add(time.Hour)) || !kickoffROTI.GetClosesAt().Equal(kickoffStart.Add(3*time.Hour)) {
+		t.Errorf("Expected the kickoff to start at %s and its ROTI to close at %s, got %s and %s",
+			kickoffStart.Add(time.Hour), kickoffStart.Add(3*time.Hour), moved.StartsAt, kickoffROTI.GetClosesAt())
+	}
+
+	// votes open when the meeting ends, not a day before
+	if !kickoffROTI.GetOpensAt().Equal(kickoffStart.Add(2*time.Hour)) || !kickoffROTI.NotOpenYet() {
+		t.Errorf("Expected the kickoff ROTI to open at %s, got %s", kickoffStart.Add(2*time.Hour), kickoffROTI.GetOpensAt())
+	}
+	if err := kickoffROTI.AddVoteToROTI(4, ""); !errors.Is(err, model.ErrROTINotOpen) {
+		t.Errorf("Expected %v before the end of the meeting, got %v", model.ErrROTINotOpen, err)
+	}
+	kickoffID := strconv.Itoa(kickoffROTI.GetID().Int())
+	req := httptest.NewRequest("POST", "/vote/"+kickoffID+"?vote=4", nil)
+	req.SetPathValue("rotiid", kickoffID)
+	rr := httptest.NewRecorder()
+	postVoteHandler(rr, req)
+	if rr.Code != http.StatusFound || kickoffROTI.CountVotes() != 0 {
+		t.Errorf("Expected the early vote to be refused, got %d and %d votes", rr.Code, kickoffROTI.CountVotes())
+	}
+	req = httptest.NewRequest("GET", "/roti/"+kickoffID, nil)
+	req.SetPathValue("rotiid", kickoffID)
+	rr = httptest.NewRecorder()
+	displayROTIHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "Votes open on") {
+		t.Errorf("Expected the ROTI page to tell when votes open, got %s", rr.Body.String())
+	}
+
+	// nobody created the ROTIs of the calendar, admins manage them
+	defer func(token string) { currentConfig.AdminToken = token }(currentConfig.AdminToken)
+	currentConfig.AdminToken = "calendar-admin"
+	req = httptest.NewRequest("GET", "/roti/"+kickoffID, nil)
+	if isROTIOwner(req, kickoffROTI) {
+		t.Error("Expected visitors not to manage the ROTIs of the calendar")
+	}
+	req.Header.Set("X-Admin-Token", "calendar-admin")
+	if !isROTIOwner(req, kickoffROTI) {
+		t.Error("Expected admins to manage the ROTIs of the calendar")
+	}
+	otherROTI, _ := model.GetROTI(model.CreateROTIWithOptions(model.ROTIOptions{Description: "Other " + run, OwnerToken: model.NewOwnerToken()}, currentConfig.CleanOverTime))
+	if isROTIOwner(req, otherROTI) {
+		t.Error("Expected admins not to own the ROTIs created by others")
+	}
+}
+
+func TestReadCalendarFeed(t *testing.T) {
+	feed := filepath.Join(t.TempDir(), "meetings.ics")
+	writeFeed(t, feed, []string{"UID:standup", "SUMMARY:Standup", "DTSTART:20240304T090000Z", "DURATION:PT15M"})
+	content, err := os.ReadFile(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/meetings.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	for _, source := range []string{feed, server.URL + "/meetings.ics"} {
+		calendar, err := readCalendarFeed(source)
+		if err != nil {
+			t.Errorf("Couldn't read %s: %v", source, err)
+			continue
+		}
+		events := calendar.Occurrences(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+		if len(events) != 1 || events[0].Summary != "Standup" {
+			t.Errorf("Expected the standup from %s, got %v", source, events)
+		}
+	}
+	for _, source := range []string{filepath.Join(t.TempDir(), "missing.ics"), server.URL + "/missing.ics"} {
+		if _, err := readCalendarFeed(source); !errors.Is(err, ErrCalendarFeed) {
+			t.Errorf("Expected %v for %s, got %v", ErrCalendarFeed, source, err)
+		}
+	}
+}
+
+func TestICSHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	meetingEnd := time.Now().Add(time.Hour).Truncate(time.Second)
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "Sprint retro"}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentROTI.CloseAt(meetingEnd.Add(30 * time.Minute))
+	model.AddCalendarEvent(model.CalendarEvent{UID: "ics-" + strconv.Itoa(rotiID.Int()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		ROTI: rotiID, StartsAt: meetingEnd.Add(-time.Hour), EndsAt: meetingEnd})
+
+	req := httptest.NewRequest("GET", "/ics/"+strconv.Itoa(rotiID.Int())+".ics", nil)
+	req.SetPathValue("name", strconv.Itoa(rotiID.Int())+".ics")
+	rr := httptest.NewRecorder()
+	icsHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("Expected an iCalendar file, got %d and %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	calendar, err := ical.Parse(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := calendar.Occurrences(meetingEnd.Add(-24*time.Hour), meetingEnd.Add(24*time.Hour))
+	if len(events) != 1 {
+		t.Fatalf("Expected one event, got %v", events)
+	}
+	event := events[0]
+	voteURL := currentConfig.GetURL() + "/roti/" + strconv.Itoa(rotiID.Int())
+	qrURL := currentConfig.GetURL() + "/qr/" + strconv.Itoa(rotiID.Int()) + ".png"
+	if event.Summary != "ROTI: Sprint retro" || event.URL != voteURL || !strings.Contains(event.Description, voteURL) ||
+		!strings.Contains(event.Description, qrURL) {
+		t.Errorf("Expected the vote and QR code links in the event, got %+v", event)
+	}
+	if !event.Start.Equal(meetingEnd) || !event.End.Equal(meetingEnd.Add(30*time.Minute)) {
+		t.Errorf("Expected the votes to run from %s to %s, got %s to %s", meetingEnd, meetingEnd.Add(30*time.Minute), event.Start, event.End)
+	}
+
+	for _, name := range []string{"12345.png", "abc.ics", "1.ics"} {
+		req := httptest.NewRequest("GET", "/ics/"+name, nil)
+		req.SetPathValue("name", name)
+		rr := httptest.NewRecorder()
+		icsHandler(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected %d for %s, got %d", http.StatusNotFound, name, rr.Code)
+		}
+	}
+}
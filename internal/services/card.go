@@ -0,0 +1,345 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ErrUnknownTheme  = errors.New("unknown theme")
+	ErrUnknownPreset = errors.New("unknown size preset")
+)
+
+// cardTheme holds the colors of a results card
+type cardTheme struct {
+	Background color.RGBA
+	Text       color.RGBA
+	Muted      color.RGBA
+	Accent     color.RGBA
+	Grid       color.RGBA
+}
+
+var cardThemes = map[string]cardTheme{
+	"light": {
+		Background: color.RGBA{255, 255, 255, 255},
+		Text:       color.RGBA{0, 0, 0, 255},
+		Muted:      color.RGBA{110, 110, 110, 255},
+		Accent:     color.RGBA{200, 100, 0, 255},
+		Grid:       color.RGBA{180, 180, 180, 255},
+	},
+	"dark": {
+		Background: color.RGBA{30, 30, 36, 255},
+		Text:       color.RGBA{235, 235, 235, 255},
+		Muted:      color.RGBA{160, 160, 160, 255},
+		Accent:     color.RGBA{240, 140, 40, 255},
+		Grid:       color.RGBA{90, 90, 96, 255},
+	},
+}
+
+// cardPreset is the size of a results card. Cards without a height grow with
+// their content, the others drop what doesn't fit
+type cardPreset struct {
+	Width  int
+	Height int
+}
+
+var cardPresets = map[string]cardPreset{
+	"default": {Width: 1000},
+	// slide fills a 16:9 presentation
+	"slide": {Width: 1920, Height: 1080},
+	// social is the size of link previews on social networks and chats
+	"social": {Width: 1200, Height: 630},
+}
+
+// cardOptions are chosen with the theme, size and feedback query parameters
+type cardOptions struct {
+	Theme    string
+	Size     string
+	Feedback bool
+}
+
+func defaultCardOptions() cardOptions {
+	return cardOptions{Theme: "light", Size: "default"}
+}
+
+// parseCardOptions reads the options of a card from the query parameters,
+// missing ones keeping their default value
+func parseCardOptions(r *http.Request) (options cardOptions, err error) {
+	options = defaultCardOptions()
+	query := r.URL.Query()
+	if theme := query.Get("theme"); theme != "" {
+		if _, ok := cardThemes[theme]; !ok {
+			return options, fmt.Errorf("%w %s", ErrUnknownTheme, theme)
+		}
+		options.Theme = theme
+	}
+	if size := query.Get("size"); size != "" {
+		if _, ok := cardPresets[size]; !ok {
+			return options, fmt.Errorf("%w %s", ErrUnknownPreset, size)
+		}
+		options.Size = size
+	}
+	if feedback := query.Get("feedback"); feedback != "" {
+		if options.Feedback, err = strconv.ParseBool(feedback); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// cardRect is a filled rectangle whose top left corner is (X, Y)
+type cardRect struct {
+	X, Y, Width, Height float64
+	Color               color.RGBA
+}
+
+// cardText is a single line of text, Y being its baseline
+type cardText struct {
+	X, Y  float64
+	Size  float64
+	Color color.RGBA
+	Text  string
+}
+
+// cardLayout is a results card laid out independently of the output format
+type cardLayout struct {
+	Width      int
+	Height     int
+	Background color.RGBA
+	Rects      []cardRect
+	Texts      []cardText
+}
+
+// cardWriter lays out a card from top to bottom, in a column going from left
+// to right. Sizes are given for a 1000px wide card and scaled to the width of
+// the preset
+type cardWriter struct {
+	layout  *cardLayout
+	theme   cardTheme
+	measure textMeasurer
+	scale   float64
+	left    float64
+	right   float64
+	// maxY is the bottom of the drawable area, 0 when the card grows with its content
+	maxY float64
+	y    float64
+}
+
+// textMeasurer measures and wraps text in the font of the cards
+type textMeasurer interface {
+	Printable(text string) string
+	Width(text string, size float64) float64
+	Wrap(text string, size, maxWidth float64) []string
+}
+
+// fits tells if height pixels are left on the card
+func (cw *cardWriter) fits(height float64) bool {
+	return cw.maxY == 0 || cw.y+height <= cw.maxY
+}
+
+func (cw *cardWriter) rect(x, y, width, height float64, col color.RGBA) {
+	cw.layout.Rects = append(cw.layout.Rects, cardRect{X: x, Y: y, Width: width, Height: height, Color: col})
+}
+
+func (cw *cardWriter) text(x, y, size float64, col color.RGBA, text string) {
+	cw.layout.Texts = append(cw.layout.Texts, cardText{X: x, Y: y, Size: size, Color: col, Text: text})
+}
+
+// paragraph writes a wrapped text, as many lines as the card can hold
+func (cw *cardWriter) paragraph(x, size float64, col color.RGBA, text string) {
+	size *= cw.scale
+	lineHeight := size * 1.3
+	for _, line := range cw.measure.Wrap(cw.measure.Printable(text), size, cw.right-x) {
+		if !cw.fits(lineHeight) {
+			return
+		}
+		cw.y += lineHeight
+		cw.text(x, cw.y-size*0.3, size, col, line)
+	}
+}
+
+// errorBar draws the 1 to 5 vote scale with the average as a dot and its 95%
+// confidence interval as whiskers
+func (cw *cardWriter) errorBar(roti existingROTI) {
+	s := cw.scale
+	x, y := cw.left, cw.y+25*s
+	// the label of the interval is on the right of the scale
+	scaleWidth := min(600*s, cw.right-x-220*s)
+	toX := func(value float64) float64 {
+		return x + (value-1)/4*scaleWidth
+	}
+
+	cw.rect(x, y-1*s, scaleWidth, 2*s, cw.theme.Grid)
+	for value := 1; value <= 5; value++ {
+		cw.rect(toX(float64(value))-1*s, y-6*s, 2*s, 12*s, cw.theme.Grid)
+	}
+
+	low, high := toX(roti.CILow), toX(roti.CIHigh)
+	cw.rect(low, y-2*s, high-low, 4*s, cw.theme.Accent)
+	cw.rect(low-1*s, y-10*s, 2*s, 20*s, cw.theme.Accent)
+	cw.rect(high-1*s, y-10*s, 2*s, 20*s, cw.theme.Accent)
+	cw.rect(toX(roti.Avg)-5*s, y-5*s, 10*s, 10*s, cw.theme.Accent)
+
+	cw.text(x+scaleWidth+20*s, y+8*s, 20*s, cw.theme.Text, fmt.Sprintf("95%% CI: %0.2f - %0.2f", roti.CILow, roti.CIHigh))
+	cw.y = y + 20*s
+}
+
+// histogram draws one bar per vote value, with its number of votes above.
+// Bars are shortened to fit in the card, and left out if there's no room
+func (cw *cardWriter) histogram(bars []distributionBar) {
+	s := cw.scale
+	maxCount := 0
+	for _, bar := range bars {
+		maxCount = max(maxCount, bar.Count)
+	}
+	// the labels take 60px above and below the bars
+	chartHeight := 120 * s
+	if cw.maxY != 0 {
+		chartHeight = min(chartHeight, cw.maxY-cw.y-60*s)
+	}
+	if maxCount == 0 || chartHeight < 50*s {
+		return
+	}
+
+	slot := min((cw.right-cw.left)/float64(len(bars)), 80*s)
+	bottom := cw.y + 30*s + chartHeight
+	for i, bar := range bars {
+		x := cw.left + float64(i)*slot
+		height := float64(bar.Count) / float64(maxCount) * chartHeight
+		cw.rect(x+slot*0.15, bottom-height, slot*0.7, height, cw.theme.Accent)
+		count := strconv.Itoa(bar.Count)
+		cw.text(x+(slot-cw.measure.Width(count, 16*s))/2, bottom-height-5*s, 16*s, cw.theme.Muted, count)
+		value := strconv.FormatFloat(bar.Value, 'f', -1, 64)
+		cw.text(x+(slot-cw.measure.Width(value, 18*s))/2, bottom+22*s, 18*s, cw.theme.Text, value)
+	}
+	cw.rect(cw.left, bottom, slot*float64(len(bars)), 1*s, cw.theme.Grid)
+	cw.y = bottom + 30*s
+}
+
+// cardFeedbacks lists the feedbacks shown on a card: the free text ones, then
+// the answers to the other prompts
+func cardFeedbacks(roti existingROTI) (feedbacks []string) {
+	feedbacks = append(feedbacks, roti.Feedbacks...)
+	for _, group := range roti.Groups {
+		if group.Prompt == defaultPrompt {
+			continue
+		}
+		for _, feedback := range group.Feedbacks {
+			feedbacks = append(feedbacks, group.Prompt+": "+feedback)
+		}
+	}
+	return
+}
+
+// feedbackSection lists the feedbacks until the card is full, ending with
+// the number of feedbacks that didn't fit
+func (cw *cardWriter) feedbackSection(feedbacks []string) {
+	s := cw.scale
+	// room for the heading, a feedback and the "more" line
+	if len(feedbacks) == 0 || !cw.fits(110*s) {
+		return
+	}
+	cw.y += 10 * s
+	cw.paragraph(cw.left, 26, cw.theme.Accent, "Feedback")
+
+	moreHeight := 0.0
+	if cw.maxY != 0 {
+		moreHeight = 20 * s * 1.3
+		cw.maxY -= moreHeight
+	}
+	shown := 0
+	for _, feedback := range feedbacks {
+		// feedbacks are never cut in the middle
+		lines := cw.measure.Wrap(cw.measure.Printable(feedback), 20*s, cw.right-cw.left-25*s)
+		if !cw.fits(float64(len(lines))*20*s*1.3 + 6*s) {
+			break
+		}
+		cw.y += 6 * s
+		cw.text(cw.left, cw.y+20*s, 20*s, cw.theme.Accent, "•")
+		cw.paragraph(cw.left+25*s, 20, cw.theme.Text, feedback)
+		shown++
+	}
+	cw.maxY += moreHeight
+	if shown < len(feedbacks) {
+		cw.paragraph(cw.left, 20, cw.theme.Muted, fmt.Sprintf("… and %d more", len(feedbacks)-shown))
+	}
+}
+
+// layoutCard lays out the results card of a ROTI: title, description, stats,
+// confidence interval, histogram and optionally the feedbacks. Cards of a
+// fixed size show the feedbacks in a second column, on the right of the stats
+func layoutCard(roti existingROTI, options cardOptions, measure textMeasurer) (*cardLayout, error) {
+	theme, ok := cardThemes[options.Theme]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownTheme, options.Theme)
+	}
+	preset, ok := cardPresets[options.Size]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownPreset, options.Size)
+	}
+
+	layout := &cardLayout{Width: preset.Width, Height: preset.Height, Background: theme.Background}
+	scale := float64(preset.Width) / 1000
+	padding := 20 * scale
+	cw := cardWriter{layout: layout, theme: theme, measure: measure, scale: scale, left: padding, right: float64(preset.Width) - padding}
+	if preset.Height != 0 {
+		cw.maxY = float64(preset.Height) - padding
+	}
+	cw.y = padding / 2
+
+	cw.paragraph(cw.left, 40, theme.Accent, fmt.Sprintf("ROTI - %d", roti.Id))
+	if roti.Description != "" {
+		cw.paragraph(cw.left, 32, theme.Text, "Meeting: "+roti.Description)
+	}
+	cw.y += 10 * scale
+
+	var feedbacks []string
+	if options.Feedback {
+		feedbacks = cardFeedbacks(roti)
+	}
+	top := cw.y
+	twoColumns := preset.Height != 0 && len(feedbacks) > 0
+	if twoColumns {
+		cw.right = float64(preset.Width)/2 - padding/2
+	}
+
+	if roti.ResultsHidden {
+		// only previews of blind ROTIs are drawn before the reveal
+		cw.paragraph(cw.left, 24, theme.Text, fmt.Sprintf("Number of votes: %d", roti.NumVotes))
+		cw.paragraph(cw.left, 24, theme.Muted, "Results will be shown once they are revealed")
+		if layout.Height == 0 {
+			layout.Height = int(cw.y + padding)
+		}
+		return layout, nil
+	}
+
+	if roti.DetailsHidden {
+		cw.paragraph(cw.left, 24, theme.Text, fmt.Sprintf("Average ROTI: %0.2f", roti.Avg))
+	} else {
+		cw.paragraph(cw.left, 24, theme.Text, fmt.Sprintf("Average ROTI: %0.2f | Min: %0.2f | Max: %0.2f", roti.Avg, roti.Min, roti.Max))
+	}
+	votesLabel := fmt.Sprintf("Number of votes: %d", roti.NumVotes)
+	if roti.LowSample {
+		votesLabel += " (low sample, interpret with care)"
+	}
+	cw.paragraph(cw.left, 24, theme.Text, votesLabel)
+
+	if roti.HasCI && cw.fits(45*scale) {
+		cw.errorBar(roti)
+	}
+	cw.histogram(roti.Distribution)
+
+	if twoColumns {
+		cw.left, cw.right = float64(preset.Width)/2+padding/2, float64(preset.Width)-padding
+		cw.y = top - 10*scale
+	}
+	cw.feedbackSection(feedbacks)
+
+	if layout.Height == 0 {
+		layout.Height = int(cw.y + padding)
+	}
+	return layout, nil
+}
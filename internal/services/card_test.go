@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func TestParseCardOptions(t *testing.T) {
+	testCases := []struct {
+		query       string
+		expected    cardOptions
+		expectedErr error
+	}{
+		{"", cardOptions{Theme: "light", Size: "default"}, nil},
+		{"?theme=dark&size=slide&feedback=true", cardOptions{Theme: "dark", Size: "slide", Feedback: true}, nil},
+		{"?size=social&feedback=0", cardOptions{Theme: "light", Size: "social"}, nil},
+		{"?theme=pink", cardOptions{}, ErrUnknownTheme},
+		{"?size=poster", cardOptions{}, ErrUnknownPreset},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			options, err := parseCardOptions(httptest.NewRequest("GET", "/"+tc.query, nil))
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Got error %v but expected %v", err, tc.expectedErr)
+			}
+			if err == nil && options != tc.expected {
+				t.Errorf("Got %+v but expected %+v", options, tc.expected)
+			}
+		})
+	}
+}
+
+func testCardROTI(description string, feedbacks int) existingROTI {
+	roti := existingROTI{Id: 12345, Description: description, NumVotes: 12, Avg: 3.6, Min: 1, Max: 5, HasCI: true, CILow: 3.1, CIHigh: 4.1,
+		Distribution: []distributionBar{{1, 1, 8}, {2, 0, 0}, {3, 3, 25}, {4, 6, 50}, {5, 2, 17}}}
+	for i := 0; i < feedbacks; i++ {
+		roti.Feedbacks = append(roti.Feedbacks, "(4.0) feedback number "+strconv.Itoa(i)+" 👍")
+	}
+	return roti
+}
+
+func layoutTexts(layout *cardLayout) string {
+	var texts []string
+	for _, text := range layout.Texts {
+		texts = append(texts, text.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestLayoutCard(t *testing.T) {
+	_, metrics, err := loadLuciole()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short, err := layoutCard(testCardROTI("weekly", 0), defaultCardOptions(), metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := layoutCard(testCardROTI(strings.Repeat("a long description ", 20), 0), defaultCardOptions(), metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if long.Height <= short.Height {
+		t.Errorf("Got height %d for a long description, expected more than %d", long.Height, short.Height)
+	}
+	for _, text := range long.Texts {
+		if width := metrics.Width(text.Text, text.Size); text.X+width > float64(long.Width) {
+			t.Errorf("%q overflows the card", text.Text)
+		}
+	}
+
+	// blind ROTIs only show their number of votes before the reveal
+	hidden := testCardROTI("blind", 3)
+	hidden.ResultsHidden = true
+	layout, err := layoutCard(hidden, cardOptions{Theme: "light", Size: "social", Feedback: true}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts := layoutTexts(layout); strings.Contains(texts, "Average") || strings.Contains(texts, "feedback") || len(layout.Rects) != 0 {
+		t.Errorf("Unexpected texts for hidden results:\n%s", texts)
+	}
+
+	// default cards grow to show every feedback
+	options := cardOptions{Theme: "dark", Size: "default", Feedback: true}
+	layout, err = layoutCard(testCardROTI("weekly", 30), options, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := layoutTexts(layout)
+	if !strings.Contains(texts, "feedback number 29") || strings.Contains(texts, "more") || strings.Contains(texts, "👍") {
+		t.Errorf("Unexpected texts:\n%s", texts)
+	}
+	if layout.Background != cardThemes["dark"].Background {
+		t.Errorf("Got background %v", layout.Background)
+	}
+
+	// cards of a fixed size keep it and tell how many feedbacks didn't fit
+	for _, size := range []string{"slide", "social"} {
+		options.Size = size
+		layout, err := layoutCard(testCardROTI("weekly", 30), options, metrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layout.Width != cardPresets[size].Width || layout.Height != cardPresets[size].Height {
+			t.Errorf("Got %dx%d for %s", layout.Width, layout.Height, size)
+		}
+		if texts := layoutTexts(layout); !strings.Contains(texts, "feedback number 0") || !strings.Contains(texts, "more") {
+			t.Errorf("Unexpected texts for %s:\n%s", size, texts)
+		}
+		for _, text := range layout.Texts {
+			if text.Y > float64(layout.Height) {
+				t.Errorf("%q is below the %s card", text.Text, size)
+			}
+		}
+	}
+}
+
+func TestDownloadPNGHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "card", Feedback: true, MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currentROTI.AddVoteToROTI(4, "nice"); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		query          string
+		expectedStatus int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"", http.StatusOK, 1000, 0},
+		{"?size=social&theme=dark&feedback=true", http.StatusOK, 1200, 630},
+		{"?theme=pink", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/downpng/"+strconv.Itoa(rotiID.Int())+tc.query, nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			rr := httptest.NewRecorder()
+			downloadPNGHandler(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			img, err := png.Decode(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bounds := img.Bounds()
+			if bounds.Dx() != tc.expectedWidth || (tc.expectedHeight != 0 && bounds.Dy() != tc.expectedHeight) {
+				t.Errorf("Got a %dx%d image", bounds.Dx(), bounds.Dy())
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// chatTopFeedbacks is the number of feedbacks in a summary, the most
+	// upvoted first
+	chatTopFeedbacks = 3
+	// chatBarWidth is the number of blocks of a full distribution bar
+	chatBarWidth = 10
+)
+
+var (
+	ErrNoChatWebhook       = errors.New("no chat webhook is configured")
+	ErrUnknownChatPlatform = errors.New("unknown chat platform")
+	ErrChatWebhook         = errors.New("the chat webhook refused the summary")
+)
+
+// chatSummary is what is posted of a ROTI, whatever the chat platform
+type chatSummary struct {
+	Title string
+	URL   string
+	// Status is the average and the number of votes, or only the latter while
+	// results are hidden
+	Status  string
+	Votes   int
+	Average string
+	Color   color.RGBA
+	// Distribution holds a text bar per vote value
+	Distribution []string
+	Feedbacks    []string
+}
+
+func newChatSummary(roti existingROTI) chatSummary {
+	low, high := currentConfig.GetBadgeThresholds()
+	_, col := badgeMessage(roti, low, high)
+	summary := chatSummary{
+		Title:  roti.Description,
+		URL:    fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), roti.Id),
+		Status: ogDescription(roti),
+		Votes:  roti.NumVotes,
+		Color:  col,
+	}
+	if summary.Title == "" {
+		summary.Title = fmt.Sprintf("ROTI %d", roti.Id)
+	}
+	if roti.ResultsHidden {
+		return summary
+	}
+	if roti.NumVotes > 0 {
+		summary.Average = fmt.Sprintf("%0.2f", roti.Avg)
+	}
+
+	for i := len(roti.Distribution) - 1; i >= 0; i-- {
+		bar := roti.Distribution[i]
+		blocks := (bar.Percent*chatBarWidth + 50) / 100
+		summary.Distribution = append(summary.Distribution, fmt.Sprintf("%-3s %s%s %d (%d%%)",
+			strconv.FormatFloat(bar.Value, 'f', -1, 64), strings.Repeat("█", blocks), strings.Repeat("░", chatBarWidth-blocks), bar.Count, bar.Percent))
+	}
+
+	feedbacks := slices.Clone(roti.Supported)
+	sortBySupport(feedbacks)
+	for _, feedback := range feedbacks[:min(len(feedbacks), chatTopFeedbacks)] {
+		text := strings.ReplaceAll(feedback.Text, "\n", " ")
+		if feedback.Upvotes > 0 {
+			text += fmt.Sprintf(" (+%d)", feedback.Upvotes)
+		}
+		summary.Feedbacks = append(summary.Feedbacks, text)
+	}
+	return summary
+}
+
+// renderSlackSummary formats the summary as Block Kit blocks
+func renderSlackSummary(summary chatSummary) any {
+	message := slackMessage{Text: slackEscape(summary.Title + ": " + summary.Status)}
+	message.Blocks = append(message.Blocks,
+		slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: summary.Title}},
+		slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*" + slackEscape(summary.Status) + "*"}})
+	if len(summary.Distribution) > 0 {
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "```\n" + strings.Join(summary.Distribution, "\n") + "\n```"}})
+	}
+	if len(summary.Feedbacks) > 0 {
+		text := "*Top feedback*"
+		for _, feedback := range summary.Feedbacks {
+			text += "\n> " + slackEscape(feedback)
+		}
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}})
+	}
+	message.Blocks = append(message.Blocks, slackBlock{Type: "context", Elements: []any{
+		slackText{Type: "mrkdwn", Text: fmt.Sprintf("<%s|See the results>", summary.URL)},
+	}})
+	return message
+}
+
+type mattermostField struct {
+	Short bool   `json:"short"`
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type mattermostAttachment struct {
+	Fallback  string            `json:"fallback"`
+	Color     string            `json:"color"`
+	Title     string            `json:"title"`
+	TitleLink string            `json:"title_link"`
+	Text      string            `json:"text"`
+	Fields    []mattermostField `json:"fields,omitempty"`
+}
+
+type mattermostMessage struct {
+	Attachments []mattermostAttachment `json:"attachments"`
+}
+
+// renderMattermostSummary formats the summary as a message attachment,
+// colored like the badge of the ROTI
+func renderMattermostSummary(summary chatSummary) any {
+	attachment := mattermostAttachment{
+		Fallback:  summary.Title + ": " + summary.Status,
+		Color:     svgColor(summary.Color),
+		Title:     summary.Title,
+		TitleLink: summary.URL,
+		Text:      summary.Status,
+	}
+	if summary.Average != "" {
+		attachment.Fields = append(attachment.Fields,
+			mattermostField{Short: true, Title: "Average", Value: summary.Average},
+			mattermostField{Short: true, Title: "Votes", Value: strconv.Itoa(summary.Votes)})
+	}
+	if len(summary.Distribution) > 0 {
+		attachment.Fields = append(attachment.Fields, mattermostField{Title: "Distribution",
+			Value: "```\n" + strings.Join(summary.Distribution, "\n") + "\n```"})
+	}
+	if len(summary.Feedbacks) > 0 {
+		attachment.Fields = append(attachment.Fields, mattermostField{Title: "Top feedback",
+			Value: "> " + strings.Join(summary.Feedbacks, "\n> ")})
+	}
+	return mattermostMessage{Attachments: []mattermostAttachment{attachment}}
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// teamsElement is a TextBlock or a FactSet of an Adaptive Card
+type teamsElement struct {
+	Type     string      `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	Size     string      `json:"size,omitempty"`
+	Weight   string      `json:"weight,omitempty"`
+	FontType string      `json:"fontType,omitempty"`
+	Wrap     bool        `json:"wrap,omitempty"`
+	Facts    []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+	Actions []teamsAction  `json:"actions"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+// renderTeamsSummary formats the summary as an Adaptive Card
+func renderTeamsSummary(summary chatSummary) any {
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []teamsElement{
+			{Type: "TextBlock", Text: summary.Title, Size: "Large", Weight: "Bolder", Wrap: true},
+			{Type: "TextBlock", Text: summary.Status, Wrap: true},
+		},
+		Actions: []teamsAction{{Type: "Action.OpenUrl", Title: "See the results", URL: summary.URL}},
+	}
+	if summary.Average != "" {
+		card.Body = append(card.Body, teamsElement{Type: "FactSet", Facts: []teamsFact{
+			{Title: "Average", Value: summary.Average},
+			{Title: "Votes", Value: strconv.Itoa(summary.Votes)},
+		}})
+	}
+	if len(summary.Distribution) > 0 {
+		// a TextBlock only keeps line breaks written as paragraphs
+		card.Body = append(card.Body, teamsElement{Type: "TextBlock", Text: strings.Join(summary.Distribution, "\n\n"), FontType: "Monospace", Wrap: true})
+	}
+	if len(summary.Feedbacks) > 0 {
+		card.Body = append(card.Body, teamsElement{Type: "TextBlock", Text: "Top feedback", Weight: "Bolder"})
+		for _, feedback := range summary.Feedbacks {
+			card.Body = append(card.Body, teamsElement{Type: "TextBlock", Text: "“" + feedback + "”", Wrap: true})
+		}
+	}
+	return teamsMessage{Type: "message", Attachments: []teamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}}}
+}
+
+// chatPlatforms format the summaries for the incoming webhooks of each platform
+var chatPlatforms = map[string]func(chatSummary) any{
+	"slack":      renderSlackSummary,
+	"mattermost": renderMattermostSummary,
+	"teams":      renderTeamsSummary,
+}
+
+// postChatSummary posts the summary of a ROTI to the configured chat webhook
+func postChatSummary(currentROTI model.ROTIEntity) error {
+	webhookURL, platform := currentConfig.GetChatWebhook()
+	if webhookURL == "" {
+		return ErrNoChatWebhook
+	}
+	render, ok := chatPlatforms[platform]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownChatPlatform, platform)
+	}
+
+	body, err := json.Marshal(render(newChatSummary(collectResults(currentROTI.GetID().Int(), currentROTI))))
+	if err != nil {
+		return err
+	}
+	// the webhook is set in the configuration, it may well be an internal service
+	resp, err := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", ErrChatWebhook, resp.Status)
+	}
+	log.Info().Msgf("summary of ROTI %d posted to %s", currentROTI.GetID().Int(), platform)
+	return nil
+}
+
+// postChatSummaryOnClose posts the summary of a ROTI that was just closed,
+// without making its owner wait
+func postChatSummaryOnClose(currentROTI model.ROTIEntity) {
+	if webhookURL, _ := currentConfig.GetChatWebhook(); webhookURL == "" {
+		return
+	}
+	go func() {
+		if err := postChatSummary(currentROTI); err != nil {
+			log.Error().Msgf("couldn't post summary of ROTI %d: %s", currentROTI.GetID().Int(), err.Error())
+		}
+	}()
+}
+
+// chatSummaryHandler posts the summary of a ROTI on demand of its owner
+func chatSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "chat summary")
+	if !ok {
+		return
+	}
+
+	if err := postChatSummary(currentROTI); errors.Is(err, ErrNoChatWebhook) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error().Msgf("couldn't post summary of ROTI %d: %s", currentROTI.GetID().Int(), err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+// chatReceiver stands in for the incoming webhook of a chat platform
+type chatReceiver struct {
+	status int
+	bodies chan []byte
+}
+
+func (receiver chatReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	receiver.bodies <- body
+	w.WriteHeader(receiver.status)
+}
+
+func (receiver chatReceiver) next(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case body := <-receiver.bodies:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("No summary posted to the chat webhook")
+	}
+	return nil
+}
+
+func TestPostChatSummary(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	receiver := chatReceiver{status: http.StatusOK, bodies: make(chan []byte, 1)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "Weekly <sync>"}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vote := range []struct {
+		value    float64
+		feedback string
+	}{{5, "Great demo"}, {4, "Too long"}, {4, ""}, {2, "Off topic"}, {3, "Fine"}} {
+		if err := currentROTI.AddVoteToROTI(vote.value, vote.feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := postChatSummary(currentROTI); !errors.Is(err, ErrNoChatWebhook) {
+		t.Errorf("Got %v but expected %v", err, ErrNoChatWebhook)
+	}
+	currentConfig.ChatWebhookURL = server.URL
+	defer func() {
+		currentConfig.ChatWebhookURL = ""
+		currentConfig.ChatPlatform = "slack"
+	}()
+
+	testCases := []struct {
+		platform string
+		expected []string
+	}{
+		{"slack", []string{`"type":"header"`, "Weekly <sync>", "Weekly &lt;sync&gt;", "Average ROTI: 3.60 from 5 votes", "5   █", "> (5.0) Great demo",
+			fmt.Sprintf("/roti/%d|See the results", rotiID.Int())}},
+		{"mattermost", []string{`"attachments"`, `"title":"Weekly <sync>"`, `"color":"#`, `"title":"Average","value":"3.60"`, "Top feedback"}},
+		{"teams", []string{`"contentType":"application/vnd.microsoft.card.adaptive"`, `"type":"AdaptiveCard"`, `"type":"FactSet"`, `"fontType":"Monospace"`,
+			`"type":"Action.OpenUrl"`, "Off topic"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.platform, func(t *testing.T) {
+			currentConfig.ChatPlatform = tc.platform
+			if err := postChatSummary(currentROTI); err != nil {
+				t.Fatal(err)
+			}
+			var message any
+			if err := json.Unmarshal(receiver.next(t), &message); err != nil {
+				t.Fatal(err)
+			}
+			// compared without the escaping of HTML characters by encoding/json
+			body, _ := json.Marshal(message)
+			body = []byte(strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(body)))
+			for _, expected := range tc.expected {
+				if !strings.Contains(string(body), expected) {
+					t.Errorf("%q not found in %s", expected, body)
+				}
+			}
+			// only the top feedbacks are posted
+			if strings.Contains(string(body), "Fine") {
+				t.Errorf("Got more than %d feedbacks in %s", chatTopFeedbacks, body)
+			}
+		})
+	}
+
+	currentConfig.ChatPlatform = "irc"
+	if err := postChatSummary(currentROTI); !errors.Is(err, ErrUnknownChatPlatform) {
+		t.Errorf("Got %v but expected %v", err, ErrUnknownChatPlatform)
+	}
+	currentConfig.ChatPlatform = "slack"
+	gone := httptest.NewServer(chatReceiver{status: http.StatusNotFound, bodies: make(chan []byte, 1)})
+	defer gone.Close()
+	currentConfig.ChatWebhookURL = gone.URL
+	if err := postChatSummary(currentROTI); !errors.Is(err, ErrChatWebhook) {
+		t.Errorf("Got %v but expected %v", err, ErrChatWebhook)
+	}
+}
+
+func TestChatSummaryHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	receiver := chatReceiver{status: http.StatusOK, bodies: make(chan []byte, 1)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	token := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "retro", Blind: true, OwnerToken: token}, 30)
+	ownerCookie := &http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token}
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currentROTI.AddVoteToROTI(1, "Secret feedback"); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(handler http.HandlerFunc, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if rr := post(chatSummaryHandler, ownerCookie); rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusNotFound)
+	}
+	currentConfig.ChatWebhookURL = server.URL
+	defer func() { currentConfig.ChatWebhookURL = "" }()
+
+	if rr := post(chatSummaryHandler, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := post(chatSummaryHandler, ownerCookie); rr.Code != http.StatusSeeOther {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+	// blind ROTIs only tell their number of votes
+	if body := string(receiver.next(t)); strings.Contains(body, "Secret feedback") || strings.Contains(body, "Average") || !strings.Contains(body, "1 vote") {
+		t.Errorf("Got %s but expected the results to stay hidden", body)
+	}
+
+	// closing the ROTI posts its summary
+	if rr := post(closeROTIHandler, ownerCookie); rr.Code != http.StatusSeeOther {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+	receiver.next(t)
+}
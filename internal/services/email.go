@@ -0,0 +1,610 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	smtpTimeout = 30 * time.Second
+	// emailFirstRetry is doubled after each failed attempt, up to
+	// emailMaxAttempts attempts (about 4 hours in total)
+	emailFirstRetry   = time.Minute
+	emailMaxAttempts  = 8
+	emailPollInterval = 30 * time.Second
+	// digestPeriod is the time between two digests sent to the same recipient
+	digestPeriod = 7 * 24 * time.Hour
+	// digestMaxCards is the number of results cards attached to a digest
+	digestMaxCards = 5
+	// confirmationPeriod is the time between two confirmation links sent to
+	// the same address, so that creating ROTIs can't flood it
+	confirmationPeriod = 24 * time.Hour
+)
+
+var (
+	ErrSMTPNoStartTLS = errors.New("the SMTP server doesn't support STARTTLS")
+)
+
+// smtpRootCAs checks the certificate of the SMTP server, the system roots
+// being used when nil
+var smtpRootCAs *x509.CertPool
+
+// emailWake tells the worker that a ROTI was closed or emails were queued, so
+// that they're sent without waiting for the next poll
+var emailWake = make(chan struct{}, 1)
+
+func wakeEmailWorker() {
+	select {
+	case emailWake <- struct{}{}:
+	default:
+	}
+}
+
+type emailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// emailMessage is an email before being encoded, with the same content as
+// text and HTML
+type emailMessage struct {
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Unsubscribe string
+	Attachments []emailAttachment
+}
+
+// buildEmail encodes the message as multipart/mixed, holding the
+// multipart/alternative text and HTML versions and then the attachments
+func buildEmail(message emailMessage, from string, now time.Time) ([]byte, error) {
+	var alternative bytes.Buffer
+	alternativeWriter := multipart.NewWriter(&alternative)
+	for _, version := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, err := alternativeWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {version.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(part)
+		if _, err := encoder.Write([]byte(version.body)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := alternativeWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mixedWriter := multipart.NewWriter(&body)
+	part, err := mixedWriter.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative;\r\n\tboundary=" + alternativeWriter.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(alternative.Bytes()); err != nil {
+		return nil, err
+	}
+	for _, attachment := range message.Attachments {
+		part, err := mixedWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// lines of base64 can't be longer than 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := mixedWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	_, domain, _ := strings.Cut(from, "@")
+	var email bytes.Buffer
+	header := []struct{ name, value string }{
+		{"From", from},
+		{"To", message.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", uuid.NewString(), domain)},
+		{"MIME-Version", "1.0"},
+		// boundaries are long, they go on their own line
+		{"Content-Type", "multipart/mixed;\r\n\tboundary=" + mixedWriter.Boundary()},
+	}
+	if message.Unsubscribe != "" {
+		// one click unsubscribing (RFC 8058) posts to the same link
+		header = append(header,
+			struct{ name, value string }{"List-Unsubscribe", "<" + message.Unsubscribe + ">"},
+			struct{ name, value string }{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+	}
+	for _, field := range header {
+		fmt.Fprintf(&email, "%s: %s\r\n", field.name, field.value)
+	}
+	email.WriteString("\r\n")
+	email.Write(body.Bytes())
+	return email.Bytes(), nil
+}
+
+// sendEmail hands an email to the SMTP server, upgrading the connection with
+// STARTTLS unless the security is "none"
+func sendEmail(email model.Email) error {
+	from, err := mail.ParseAddress(currentConfig.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("%w %s", model.ErrInvalidEmail, currentConfig.SMTPFrom)
+	}
+	conn, err := net.DialTimeout("tcp", currentConfig.GetSMTPAddr(), smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, currentConfig.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	hostname := "localhost"
+	if frontend, err := url.Parse(currentConfig.GetURL()); err == nil && frontend.Hostname() != "" {
+		hostname = frontend.Hostname()
+	}
+	if err := client.Hello(hostname); err != nil {
+		return err
+	}
+	if currentConfig.SMTPSecurity != "none" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrSMTPNoStartTLS
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: currentConfig.SMTPHost, RootCAs: smtpRootCAs}); err != nil {
+			return err
+		}
+	}
+	if currentConfig.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", currentConfig.SMTPUsername, currentConfig.SMTPPassword, currentConfig.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(email.Recipient); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(email.Message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailRetryDelay is the time to wait after the given number of failed attempts
+func emailRetryDelay(attempts int) time.Duration {
+	return emailFirstRetry << (attempts - 1)
+}
+
+func deliverDueEmails(now time.Time) {
+	for _, email := range model.ListDueEmails(now) {
+		err := sendEmail(email)
+		if err == nil {
+			model.RecordEmailAttempt(email.ID, model.DeliveryDelivered, "", time.Time{})
+			log.Info().Msgf("email %s (%s) sent to %s", email.ID, email.Subject, email.Recipient)
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		if attempts >= emailMaxAttempts {
+			model.RecordEmailAttempt(email.ID, model.DeliveryFailed, err.Error(), time.Time{})
+			log.Error().Msgf("email %s to %s failed for good: %s", email.ID, email.Recipient, err.Error())
+			continue
+		}
+		model.RecordEmailAttempt(email.ID, model.DeliveryPending, err.Error(), now.Add(emailRetryDelay(attempts)))
+		log.Warn().Msgf("email %s to %s failed, attempt %d: %s", email.ID, email.Recipient, attempts, err.Error())
+	}
+}
+
+// unsubscribeURL is the link stopping the emails to the recipient
+func unsubscribeURL(recipient model.EmailRecipient) string {
+	return currentConfig.GetURL() + "/unsubscribe/" + recipient.Token
+}
+
+// confirmURL is the link confirming that the recipient wants the results emails
+func confirmURL(recipient model.EmailRecipient) string {
+	return currentConfig.GetURL() + "/confirm/" + recipient.Token
+}
+
+// queueEmail encodes the message and adds it to the queue
+func queueEmail(message emailMessage) error {
+	encoded, err := buildEmail(message, currentConfig.SMTPFrom, time.Now())
+	if err != nil {
+		return err
+	}
+	model.QueueEmail(message.To, message.Subject, encoded)
+	return nil
+}
+
+// emailContent is the HTML version of the results of a ROTI, or of the
+// digest of a period
+type emailContent struct {
+	Period string
+	// Confirm is the confirmation link of emails asking to confirm an address
+	Confirm     string
+	Summaries   []chatSummary
+	Unsubscribe string
+	Version     string
+}
+
+// renderEmail fills the HTML template of an email, the text version being
+// written by the caller
+func renderEmail(templateFilePath string, data emailContent) (string, error) {
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		return "", fmt.Errorf("template %s not found", templateFilePath)
+	}
+	var html bytes.Buffer
+	if err := t.Execute(&html, data); err != nil {
+		return "", err
+	}
+	return html.String(), nil
+}
+
+// summaryText writes the summary of a ROTI for the text version of emails
+func summaryText(text *strings.Builder, summary chatSummary) {
+	fmt.Fprintf(text, "%s\n%s\n", summary.Title, summary.Status)
+	if len(summary.Distribution) > 0 {
+		fmt.Fprintf(text, "\n%s\n", strings.Join(summary.Distribution, "\n"))
+	}
+	if len(summary.Feedbacks) > 0 {
+		text.WriteString("\nTop feedback:\n")
+		for _, feedback := range summary.Feedbacks {
+			fmt.Fprintf(text, "- %s\n", feedback)
+		}
+	}
+	fmt.Fprintf(text, "\nSee the results: %s\n", summary.URL)
+}
+
+// resultsEmail is sent to the address given when creating a ROTI, once it's closed
+func resultsEmail(currentROTI model.ROTIEntity, recipient model.EmailRecipient) (emailMessage, error) {
+	rotiID := currentROTI.GetID().Int()
+	summary := newChatSummary(collectResults(rotiID, currentROTI))
+	card, err := getOGImage(rotiID, currentROTI)
+	if err != nil {
+		return emailMessage{}, err
+	}
+
+	var text strings.Builder
+	summaryText(&text, summary)
+	fmt.Fprintf(&text, "\nThe results card is attached.\nYou get this email because this address was given when creating the ROTI. Unsubscribe: %s\n",
+		unsubscribeURL(recipient))
+	html, err := renderEmail("templates/email.html", emailContent{Summaries: []chatSummary{summary}, Unsubscribe: unsubscribeURL(recipient), Version: Version})
+	if err != nil {
+		return emailMessage{}, err
+	}
+
+	return emailMessage{
+		To:          recipient.Email,
+		Subject:     "ROTI results: " + summary.Title,
+		Unsubscribe: unsubscribeURL(recipient),
+		Text:        text.String(),
+		HTML:        html,
+		Attachments: []emailAttachment{{Name: fmt.Sprintf("roti-%d.png", rotiID), ContentType: "image/png", Data: card.data}},
+	}, nil
+}
+
+// confirmationEmail asks the recipient to confirm that it wants the results
+// emails. It doesn't hold anything written by whoever gave the address
+func confirmationEmail(recipient model.EmailRecipient) (emailMessage, error) {
+	var text strings.Builder
+	fmt.Fprintf(&text, "This address was given to GroROTI (%s) to get the results of ROTIs by email.\n", currentConfig.GetURL())
+	fmt.Fprintf(&text, "\nConfirm to get them: %s\n", confirmURL(recipient))
+	fmt.Fprintf(&text, "\nIf it wasn't you, ignore this email: no results will be sent. Stop every email from GroROTI: %s\n", unsubscribeURL(recipient))
+	html, err := renderEmail("templates/email.html", emailContent{Confirm: confirmURL(recipient), Unsubscribe: unsubscribeURL(recipient), Version: Version})
+	if err != nil {
+		return emailMessage{}, err
+	}
+
+	return emailMessage{
+		To:          recipient.Email,
+		Subject:     "Confirm your email address for GroROTI",
+		Unsubscribe: unsubscribeURL(recipient),
+		Text:        text.String(),
+		HTML:        html,
+	}, nil
+}
+
+// requestEmailConfirmation sends the confirmation link to an address given for
+// the results of a ROTI, unless it's confirmed, unsubscribed, or got a link
+// recently
+func requestEmailConfirmation(email string, now time.Time) {
+	if currentConfig.GetSMTPAddr() == "" {
+		return
+	}
+	recipient := model.GetEmailRecipient(email)
+	if recipient.Confirmed || recipient.Unsubscribed || now.Sub(recipient.ConfirmationSentAt) < confirmationPeriod {
+		return
+	}
+	message, err := confirmationEmail(recipient)
+	if err == nil {
+		err = queueEmail(message)
+	}
+	if err != nil {
+		log.Error().Msgf("couldn't write confirmation email to %s: %s", email, err.Error())
+		return
+	}
+	model.RecordConfirmationRequest(email, now)
+	wakeEmailWorker()
+}
+
+// queueResultsEmails queues the results of the ROTIs closed since the last
+// poll, closed by their owner or by their closing time, to confirmed addresses
+func queueResultsEmails() {
+	for _, rotiID := range model.ListROTIsAwaitingResults() {
+		currentROTI, err := model.GetROTI(rotiID)
+		if err != nil || !currentROTI.IsClosed() {
+			continue
+		}
+		recipient := model.GetEmailRecipient(currentROTI.GetEmail())
+		// results wait for the address to be confirmed. Addresses given before
+		// confirmations existed are asked once
+		if !recipient.Confirmed && !recipient.Unsubscribed {
+			if recipient.ConfirmationSentAt.IsZero() {
+				requestEmailConfirmation(recipient.Email, time.Now())
+			}
+			continue
+		}
+		if !recipient.Unsubscribed {
+			message, err := resultsEmail(currentROTI, recipient)
+			if err == nil {
+				err = queueEmail(message)
+			}
+			if err != nil {
+				log.Error().Msgf("couldn't write results email of ROTI %d: %s", rotiID.Int(), err.Error())
+			}
+		}
+		currentROTI.MarkResultsEmailed()
+	}
+}
+
+// digestEmail sums up the public ROTIs of the 7 days before now, with the
+// cards of the first ones having votes
+func digestEmail(recipient model.EmailRecipient, now time.Time) (message emailMessage, count int, err error) {
+	from, to := now.AddDate(0, 0, -7), now.AddDate(0, 0, -1)
+	var summaries []chatSummary
+	for _, rotiID := range model.ListROTIsCreatedBetween(from, to) {
+		currentROTI, err := model.GetROTI(rotiID)
+		if err != nil {
+			continue
+		}
+		roti := collectResults(rotiID.Int(), currentROTI)
+		summaries = append(summaries, newChatSummary(roti))
+		if roti.NumVotes > 0 && !roti.ResultsHidden && len(message.Attachments) < digestMaxCards {
+			card, err := getOGImage(rotiID.Int(), currentROTI)
+			if err != nil {
+				return message, 0, err
+			}
+			message.Attachments = append(message.Attachments, emailAttachment{Name: fmt.Sprintf("roti-%d.png", rotiID.Int()), ContentType: "image/png", Data: card.data})
+		}
+	}
+	if len(summaries) == 0 {
+		return message, 0, nil
+	}
+
+	period := fmt.Sprintf("%s to %s", from.Format("January 2"), to.Format("January 2"))
+	var text strings.Builder
+	fmt.Fprintf(&text, "ROTIs from %s\n", period)
+	for _, summary := range summaries {
+		text.WriteString("\n")
+		summaryText(&text, summary)
+	}
+	fmt.Fprintf(&text, "\nYou get this digest because this address was configured for the weekly digest. Unsubscribe: %s\n", unsubscribeURL(recipient))
+	html, err := renderEmail("templates/email.html", emailContent{Period: period, Summaries: summaries, Unsubscribe: unsubscribeURL(recipient), Version: Version})
+	if err != nil {
+		return message, 0, err
+	}
+
+	message.To = recipient.Email
+	message.Unsubscribe = unsubscribeURL(recipient)
+	message.Subject = fmt.Sprintf("GroROTI weekly digest: %d ROTIs", len(summaries))
+	message.Text = text.String()
+	message.HTML = html
+	return message, len(summaries), nil
+}
+
+// queueDigests queues the weekly digest of the recipients whose last one, or
+// subscription, is older than a week
+func queueDigests(now time.Time) {
+	for _, address := range currentConfig.GetDigestRecipients() {
+		email, err := model.CheckEmail(address)
+		if err != nil {
+			log.Error().Msgf("digest recipient %s skipped: %s", address, err.Error())
+			continue
+		}
+		recipient := model.GetEmailRecipient(email)
+		last := recipient.DigestSentAt
+		if last.IsZero() {
+			last = recipient.CreatedAt
+		}
+		if recipient.Unsubscribed || now.Sub(last) < digestPeriod {
+			continue
+		}
+
+		message, count, err := digestEmail(recipient, now)
+		if err != nil {
+			log.Error().Msgf("couldn't write digest: %s", err.Error())
+			continue
+		}
+		// weeks without any ROTI are skipped
+		if count > 0 {
+			if err := queueEmail(message); err != nil {
+				log.Error().Msgf("couldn't write digest to %s: %s", email, err.Error())
+				continue
+			}
+		}
+		model.RecordDigest(email, now)
+	}
+}
+
+// processEmails queues the emails due and sends the queue, when an SMTP
+// server is configured
+func processEmails(now time.Time) {
+	if currentConfig.GetSMTPAddr() == "" {
+		return
+	}
+	queueResultsEmails()
+	queueDigests(now)
+	// the emails queued just now are due as well
+	if queued := time.Now(); queued.After(now) {
+		now = queued
+	}
+	deliverDueEmails(now)
+}
+
+// startEmailWorker launches the goroutine sending the emails. The queue is
+// kept in the database, so emails survive restarts
+func startEmailWorker() {
+	go func() {
+		ticker := time.NewTicker(emailPollInterval)
+		defer ticker.Stop()
+		for {
+			processEmails(time.Now())
+			select {
+			case <-ticker.C:
+			case <-emailWake:
+			}
+		}
+	}()
+}
+
+// unsubscribeHandler shows the unsubscribe button of the links in emails:
+// link checkers of mail servers follow them, so a GET doesn't unsubscribe
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	recipient, err := model.GetEmailRecipientByToken(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	renderUnsubscribe(w, recipient, recipient.Unsubscribed)
+}
+
+// postUnsubscribeHandler stops the emails, from the button or from one click
+// unsubscribing in mail clients
+func postUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	recipient, err := model.Unsubscribe(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	renderUnsubscribe(w, recipient, true)
+}
+
+// confirmHandler shows the confirmation button of the links in emails: like
+// for unsubscribing, a GET doesn't confirm
+func confirmHandler(w http.ResponseWriter, r *http.Request) {
+	recipient, err := model.GetEmailRecipientByToken(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	renderConfirm(w, recipient, recipient.Confirmed && !recipient.Unsubscribed)
+}
+
+func postConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	recipient, err := model.ConfirmEmailRecipient(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	wakeEmailWorker()
+	renderConfirm(w, recipient, true)
+}
+
+func renderConfirm(w http.ResponseWriter, recipient model.EmailRecipient, done bool) {
+	templateFilePath := "templates/confirm.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	var template struct {
+		Token   string
+		Email   string
+		Done    bool
+		Version string
+	}
+	template.Token = recipient.Token
+	template.Email = recipient.Email
+	template.Done = done
+	template.Version = Version
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
+
+func renderUnsubscribe(w http.ResponseWriter, recipient model.EmailRecipient, done bool) {
+	templateFilePath := "templates/unsubscribe.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	var template struct {
+		Token   string
+		Email   string
+		Done    bool
+		Version string
+	}
+	template.Token = recipient.Token
+	template.Email = recipient.Email
+	template.Done = done
+	template.Version = Version
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
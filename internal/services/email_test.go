@@ -0,0 +1,526 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+// smtpMessage is what the SMTP stand-in received for one email
+type smtpMessage struct {
+	From string
+	To   string
+	Data []byte
+	TLS  bool
+	Auth bool
+}
+
+// smtpStandIn is an SMTP server with STARTTLS, failing the first emails it
+// receives when asked to
+type smtpStandIn struct {
+	sync.Mutex
+	listener  net.Listener
+	tlsConfig *tls.Config
+	noTLS     bool
+	failures  int
+	messages  chan smtpMessage
+}
+
+// newSMTPStandIn listens on a loopback port, with a self-signed certificate
+// that the SMTP client is made to trust
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "SMTP stand-in"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, certificate, certificate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtpRootCAs = x509.NewCertPool()
+	smtpRootCAs.AddCert(parsed)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standIn := &smtpStandIn{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		messages:  make(chan smtpMessage, 4),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go standIn.serve(conn)
+		}
+	}()
+	return standIn
+}
+
+func (standIn *smtpStandIn) Close() {
+	standIn.listener.Close()
+	smtpRootCAs = nil
+}
+
+func (standIn *smtpStandIn) port() int {
+	return standIn.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (standIn *smtpStandIn) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	var message smtpMessage
+	_ = text.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			_ = text.PrintfLine("250-localhost")
+			if !message.TLS && !standIn.noTLS {
+				_ = text.PrintfLine("250-STARTTLS")
+			}
+			_ = text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, standIn.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, message.TLS = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			message.Auth = strings.HasPrefix(argument, "PLAIN ")
+			_ = text.PrintfLine("235 authenticated")
+		case "MAIL":
+			standIn.Lock()
+			failing := standIn.failures > 0
+			if failing {
+				standIn.failures--
+			}
+			standIn.Unlock()
+			if failing {
+				_ = text.PrintfLine("451 try again later")
+				continue
+			}
+			message.From = argument
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			message.To = argument
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			if message.Data, err = text.ReadDotBytes(); err != nil {
+				return
+			}
+			_ = text.PrintfLine("250 queued")
+			standIn.messages <- message
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// next returns the next email received for the address, skipping the ones
+// left pending in the database by previous runs
+func (standIn *smtpStandIn) next(t *testing.T, address string) smtpMessage {
+	t.Helper()
+	for {
+		select {
+		case message := <-standIn.messages:
+			if message.To == "TO:<"+address+">" {
+				return message
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No email received by the SMTP stand-in for %s", address)
+			return smtpMessage{}
+		}
+	}
+}
+
+// receivedEmail is a decoded email, with its text and HTML versions and its attachments
+type receivedEmail struct {
+	Header      mail.Header
+	Text        string
+	HTML        string
+	Attachments map[string][]byte
+}
+
+func decodeEmail(t *testing.T, data []byte) receivedEmail {
+	t.Helper()
+	message, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := receivedEmail{Header: message.Header, Attachments: make(map[string][]byte)}
+
+	var walk func(body io.Reader, contentType string)
+	walk = func(body io.Reader, contentType string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			partType := part.Header.Get("Content-Type")
+			if strings.HasPrefix(partType, "multipart/") {
+				walk(part, partType)
+				continue
+			}
+			// quoted-printable is decoded by the reader, base64 isn't
+			content, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case part.FileName() != "":
+				decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, strings.NewReader(string(content))))
+				if err != nil {
+					t.Fatal(err)
+				}
+				email.Attachments[part.FileName()] = decoded
+			case strings.HasPrefix(partType, "text/plain"):
+				email.Text = string(content)
+			case strings.HasPrefix(partType, "text/html"):
+				email.HTML = string(content)
+			default:
+				t.Errorf("Unexpected part %s in %s", partType, mediaType)
+			}
+		}
+	}
+	walk(message.Body, message.Header.Get("Content-Type"))
+	return email
+}
+
+func TestBuildEmail(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	data, err := buildEmail(emailMessage{
+		To:          "facilitator@example.com",
+		Subject:     "ROTI results: Rétro",
+		Text:        "Average ROTI: 4.00 from 3 votes\nSee the results",
+		HTML:        "<p>Average ROTI: 4.00 from 3 votes</p>",
+		Unsubscribe: "http://localhost:3000/unsubscribe/token",
+		Attachments: []emailAttachment{{Name: "roti-12345.png", ContentType: "image/png", Data: []byte(strings.Repeat("card", 100))}},
+	}, "groroti@example.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("Line longer than 78 characters: %q", line)
+		}
+	}
+
+	email := decodeEmail(t, data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+	if err != nil || subject != "ROTI results: Rétro" {
+		t.Errorf("Got subject %q (%v)", subject, err)
+	}
+	if email.Header.Get("List-Unsubscribe") != "<http://localhost:3000/unsubscribe/token>" || email.Header.Get("List-Unsubscribe-Post") != "List-Unsubscribe=One-Click" {
+		t.Errorf("Got headers %v", email.Header)
+	}
+	if date, err := email.Header.Date(); err != nil || !date.Equal(now) {
+		t.Errorf("Got date %s (%v)", date, err)
+	}
+	if !strings.HasSuffix(email.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Got Message-ID %s", email.Header.Get("Message-ID"))
+	}
+	if email.Text != "Average ROTI: 4.00 from 3 votes\r\nSee the results" || email.HTML != "<p>Average ROTI: 4.00 from 3 votes</p>" {
+		t.Errorf("Got text %q and HTML %q", email.Text, email.HTML)
+	}
+	if string(email.Attachments["roti-12345.png"]) != strings.Repeat("card", 100) {
+		t.Errorf("Got attachments %v", email.Attachments)
+	}
+}
+
+func TestResultsEmails(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	standIn := newSMTPStandIn(t)
+	defer standIn.Close()
+	// the database is kept between runs
+	facilitator := "facilitator-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "@example.com"
+
+	// nothing is sent until an SMTP server is configured
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "Weekly sync", Email: facilitator}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vote := range []float64{5, 4, 3} {
+		if err := currentROTI.AddVoteToROTI(vote, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	processEmails(time.Now())
+	if awaiting := model.ListROTIsAwaitingResults(); len(awaiting) == 0 {
+		t.Fatal("Expected the ROTI to wait for an SMTP server")
+	}
+
+	currentConfig.SMTPHost, currentConfig.SMTPPort = "127.0.0.1", standIn.port()
+	currentConfig.SMTPUsername, currentConfig.SMTPPassword = "groroti", "secret"
+	defer func() {
+		currentConfig.SMTPHost, currentConfig.SMTPPort = "", 587
+		currentConfig.SMTPUsername, currentConfig.SMTPPassword = "", ""
+	}()
+
+	// the address is asked to confirm, once a day at most, with an email
+	// holding nothing written by whoever gave it
+	requestEmailConfirmation(facilitator, time.Now())
+	requestEmailConfirmation(facilitator, time.Now())
+	processEmails(time.Now())
+	if emails := model.ListEmails(facilitator); len(emails) != 1 || emails[0].Subject != "Confirm your email address for GroROTI" {
+		t.Fatalf("Got %+v, expected a single confirmation email", emails)
+	}
+	confirmation := decodeEmail(t, standIn.next(t, facilitator).Data)
+	for _, version := range []string{confirmation.Text, confirmation.HTML} {
+		if !strings.Contains(version, "/confirm/") || !strings.Contains(version, "/unsubscribe/") || strings.Contains(version, "Weekly sync") {
+			t.Errorf("Got %s", version)
+		}
+	}
+
+	// closed ROTIs wait for the address to be confirmed
+	currentROTI.Close()
+	processEmails(time.Now())
+	if emails := model.ListEmails(facilitator); len(emails) != 1 {
+		t.Fatalf("Got %+v before the address is confirmed", emails)
+	}
+	if awaiting := model.ListROTIsAwaitingResults(); !slices.Contains(awaiting, rotiID) {
+		t.Fatal("Expected the ROTI to wait for the address to be confirmed")
+	}
+	confirmToken := model.GetEmailRecipient(facilitator).Token
+	if !strings.Contains(confirmation.Text, "/confirm/"+confirmToken) {
+		t.Fatalf("Got %s, expected the confirmation link", confirmation.Text)
+	}
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/confirm/"+confirmToken, nil)
+		req.SetPathValue("token", confirmToken)
+		rr := httptest.NewRecorder()
+		if method == "GET" {
+			confirmHandler(rr, req)
+		} else {
+			postConfirmHandler(rr, req)
+		}
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), facilitator) {
+			t.Errorf("Got %d for %s:\n%s", rr.Code, method, rr.Body.String())
+		}
+		if confirmed := model.GetEmailRecipient(facilitator).Confirmed; confirmed != (method == "POST") {
+			t.Errorf("Got confirmed %t after %s", confirmed, method)
+		}
+	}
+
+	// the SMTP server fails the first attempt, the email is sent again later
+	standIn.failures = 1
+	processEmails(time.Now())
+	emails := model.ListEmails(facilitator)
+	if len(emails) != 2 {
+		t.Fatalf("Got %d emails but expected 2", len(emails))
+	}
+	if emails[1].Status != model.DeliveryPending || !strings.Contains(emails[1].LastError, "451") {
+		t.Fatalf("Got %s after %d attempts (%s), but expected the first attempt to fail", emails[1].Status, emails[1].Attempts, emails[1].LastError)
+	}
+	deliverDueEmails(time.Now().Add(emailRetryDelay(1)))
+	received := standIn.next(t, facilitator)
+	if !received.TLS || !received.Auth || received.From != "FROM:<groroti@localhost>" {
+		t.Errorf("Got %+v, expected an authenticated email over TLS", received)
+	}
+	if emails := model.ListEmails(facilitator); emails[1].Status != model.DeliveryDelivered || emails[1].Attempts != 2 {
+		t.Errorf("Got %+v", emails[1])
+	}
+
+	email := decodeEmail(t, received.Data)
+	for _, version := range []string{email.Text, email.HTML} {
+		if !strings.Contains(version, "Weekly sync") || !strings.Contains(version, "Average ROTI: 4.00 from 3 votes") ||
+			!strings.Contains(version, "/roti/"+strconv.Itoa(rotiID.Int())) || !strings.Contains(version, "/unsubscribe/") {
+			t.Errorf("Got %s", version)
+		}
+	}
+	card, ok := email.Attachments["roti-"+strconv.Itoa(rotiID.Int())+".png"]
+	if !ok {
+		t.Fatalf("Got attachments %v, expected the results card", email.Attachments)
+	}
+	if config, err := png.DecodeConfig(strings.NewReader(string(card))); err != nil || config.Width != 1200 || config.Height != 630 {
+		t.Errorf("Got %+v (%v), expected a 1200x630 card", config, err)
+	}
+
+	// the unsubscribe link asks for a confirmation, which stops the emails
+	_, token, _ := strings.Cut(strings.Trim(email.Header.Get("List-Unsubscribe"), "<>"), "/unsubscribe/")
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/unsubscribe/"+token, nil)
+		req.SetPathValue("token", token)
+		rr := httptest.NewRecorder()
+		if method == "GET" {
+			unsubscribeHandler(rr, req)
+		} else {
+			postUnsubscribeHandler(rr, req)
+		}
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), facilitator) {
+			t.Errorf("Got %d for %s:\n%s", rr.Code, method, rr.Body.String())
+		}
+		if unsubscribed := model.GetEmailRecipient(facilitator).Unsubscribed; unsubscribed != (method == "POST") {
+			t.Errorf("Got unsubscribed %t after %s", unsubscribed, method)
+		}
+	}
+	req := httptest.NewRequest("GET", "/unsubscribe/unknown", nil)
+	req.SetPathValue("token", "unknown")
+	rr := httptest.NewRecorder()
+	unsubscribeHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusNotFound)
+	}
+
+	otherID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "retro", Email: facilitator}, 30)
+	other, err := model.GetROTI(otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	processEmails(time.Now())
+	if emails := model.ListEmails(facilitator); len(emails) != 2 {
+		t.Errorf("Got %d emails, expected none after unsubscribing", len(emails))
+	}
+	for _, awaiting := range model.ListROTIsAwaitingResults() {
+		if awaiting == otherID {
+			t.Error("Expected the ROTI of an unsubscribed address to be skipped")
+		}
+	}
+
+	// creating a ROTI for someone else's address only sends them the confirmation
+	victim := "victim-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "@example.com"
+	req = httptest.NewRequest("POST", "/newroti", strings.NewReader("rotiname=Buy+now&email="+victim))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	postROTIHandler(rr, req)
+	victimROTI, err := strconv.Atoi(strings.TrimPrefix(rr.Header().Get("Location"), "/roti/"))
+	if rr.Code != http.StatusSeeOther || err != nil {
+		t.Fatalf("Got %d and %s, expected the ROTI to be created", rr.Code, rr.Header().Get("Location"))
+	}
+	if created, err := model.GetROTI(model.ROTIID(victimROTI)); err == nil {
+		created.Close()
+	}
+	processEmails(time.Now())
+	standIn.next(t, victim)
+	if emails := model.ListEmails(victim); len(emails) != 1 || emails[0].Subject != "Confirm your email address for GroROTI" {
+		t.Errorf("Got %+v, expected only the confirmation email", emails)
+	}
+
+	// servers without STARTTLS are refused unless the security is none
+	standIn.noTLS = true
+	if err := sendEmail(model.Email{Recipient: facilitator, Message: []byte("Subject: test\r\n\r\ntest")}); !errors.Is(err, ErrSMTPNoStartTLS) {
+		t.Errorf("Got %v but expected %v", err, ErrSMTPNoStartTLS)
+	}
+}
+
+func TestDigestEmails(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	standIn := newSMTPStandIn(t)
+	defer standIn.Close()
+	currentConfig.SMTPHost, currentConfig.SMTPPort = "127.0.0.1", standIn.port()
+	team := "team-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "@example.com"
+	currentConfig.DigestRecipients = team + ", not an email"
+	defer func() {
+		currentConfig.SMTPHost, currentConfig.SMTPPort = "", 587
+		currentConfig.DigestRecipients = ""
+	}()
+
+	currentROTI, err := model.GetROTI(model.CreateROTIWithOptions(model.ROTIOptions{Description: "Weekly sync"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currentROTI.AddVoteToROTI(4, "Great demo"); err != nil {
+		t.Fatal(err)
+	}
+	model.CreateROTIWithOptions(model.ROTIOptions{Description: "Blind retro", Blind: true}, 30)
+
+	// the first digest goes a week after the recipient is configured
+	now := time.Now()
+	processEmails(now)
+	if emails := model.ListEmails(team); len(emails) != 0 {
+		t.Fatalf("Got %+v, expected no digest yet", emails)
+	}
+
+	// the digest of tomorrow covers the ROTIs of today
+	model.RecordDigest(team, now.AddDate(0, 0, -7))
+	tomorrow := now.AddDate(0, 0, 1)
+	processEmails(tomorrow)
+	email := decodeEmail(t, standIn.next(t, team).Data)
+	if subject := email.Header.Get("Subject"); !strings.HasPrefix(subject, "GroROTI weekly digest: ") {
+		t.Errorf("Got subject %s", subject)
+	}
+	for _, expected := range []string{"Weekly sync", "Average ROTI: 4.00 from 1 votes", "Blind retro", "results will be shown once they are revealed", "/unsubscribe/"} {
+		if !strings.Contains(email.Text, expected) || !strings.Contains(email.HTML, expected) {
+			t.Errorf("%q not found in\n%s\n%s", expected, email.Text, email.HTML)
+		}
+	}
+	// other tests leave ROTIs with votes as well
+	if len(email.Attachments) == 0 || len(email.Attachments) > digestMaxCards {
+		t.Errorf("Got %d attachments, expected up to %d cards", len(email.Attachments), digestMaxCards)
+	}
+
+	// the next one waits for another week
+	processEmails(tomorrow.Add(time.Hour))
+	if emails := model.ListEmails(team); len(emails) != 1 {
+		t.Errorf("Got %d digests, expected 1", len(emails))
+	}
+}
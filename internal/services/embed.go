@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// badgeHeight and badgeTextSize follow the look of shields.io badges
+	badgeHeight   = 20
+	badgeTextSize = 11
+	badgePadding  = 6
+)
+
+var (
+	badgeLabelColor = color.RGBA{85, 85, 85, 255}
+	badgeGray       = color.RGBA{159, 159, 159, 255}
+	badgeRed        = color.RGBA{224, 93, 68, 255}
+	badgeYellow     = color.RGBA{223, 179, 23, 255}
+	badgeGreen      = color.RGBA{68, 204, 17, 255}
+)
+
+// badgeMessage returns the right part of the badge of a ROTI and its color:
+// the average and the number of votes, colored by the score thresholds
+func badgeMessage(roti existingROTI, low, high float64) (string, color.RGBA) {
+	votes := votesCount(roti.NumVotes)
+	switch {
+	case roti.ResultsHidden:
+		return "hidden, " + votes, badgeGray
+	case roti.NumVotes == 0:
+		return "no votes", badgeGray
+	case roti.Avg < low:
+		return fmt.Sprintf("%0.2f, %s", roti.Avg, votes), badgeRed
+	case roti.Avg < high:
+		return fmt.Sprintf("%0.2f, %s", roti.Avg, votes), badgeYellow
+	default:
+		return fmt.Sprintf("%0.2f, %s", roti.Avg, votes), badgeGreen
+	}
+}
+
+// buildBadge draws a badge with the label on gray and the message on its
+// color. Texts are outlined so that the width of the badge fits them whatever
+// the fonts of the viewer
+func buildBadge(label, message string, messageColor color.RGBA) ([]byte, error) {
+	myFont, metrics, err := loadLuciole()
+	if err != nil {
+		return nil, err
+	}
+	labelWidth := metrics.Width(label, badgeTextSize) + 2*badgePadding
+	messageWidth := metrics.Width(message, badgeTextSize) + 2*badgePadding
+	width := labelWidth + messageWidth
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%d" role="img" aria-label="%s: %s">`+"\n",
+		svgRound(width), badgeHeight, label, message)
+	fmt.Fprintf(&svg, "<title>%s: %s</title>\n", label, message)
+	svg.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` + "\n")
+	fmt.Fprintf(&svg, `<clipPath id="r"><rect width="%s" height="%d" rx="3" fill="#fff"/></clipPath>`+"\n", svgRound(width), badgeHeight)
+	fmt.Fprintf(&svg, `<g clip-path="url(#r)"><rect width="%s" height="%d" fill="%s"/><rect x="%s" width="%s" height="%d" fill="%s"/><rect width="%s" height="%d" fill="url(#s)"/></g>`+"\n",
+		svgRound(labelWidth), badgeHeight, svgColor(badgeLabelColor), svgRound(labelWidth), svgRound(messageWidth), badgeHeight, svgColor(messageColor), svgRound(width), badgeHeight)
+
+	white := color.RGBA{255, 255, 255, 255}
+	texts := []cardText{
+		{X: badgePadding, Y: 14, Size: badgeTextSize, Color: white, Text: label},
+		{X: labelWidth + badgePadding, Y: 14, Size: badgeTextSize, Color: white, Text: message},
+	}
+	if err := writeSVGTexts(&svg, texts, myFont); err != nil {
+		return nil, err
+	}
+	svg.WriteString("</svg>\n")
+	return svg.Bytes(), nil
+}
+
+// badgeHandler serves the badge of a ROTI (/badge/{rotiid}.svg), to be
+// embedded in READMEs
+func badgeHandler(w http.ResponseWriter, r *http.Request) {
+	strID, found := strings.CutSuffix(r.PathValue("name"), ".svg")
+	rotiID, err := strconv.Atoi(strID)
+	if !found || err != nil || rotiID < 10000 || rotiID > 99999 {
+		http.Error(w, model.ErrInvalidROTIID.Error(), http.StatusNotFound)
+		return
+	}
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		http.Error(w, model.ErrNoROTIMatchingThisID.Error(), http.StatusNotFound)
+		return
+	}
+
+	currentConfig, err := GetConfig()
+	if err != nil {
+		log.Error().Err(err)
+		return
+	}
+
+	low, high := currentConfig.GetBadgeThresholds()
+	message, messageColor := badgeMessage(collectResults(rotiID, currentROTI), low, high)
+	svg, err := buildBadge("ROTI", message, messageColor)
+	if err != nil {
+		log.Error().Msgf("couldn't draw badge of ROTI %d: %s", rotiID, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// the score changes with each vote, image proxies must not keep it
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if _, err := w.Write(svg); err != nil {
+		log.Error().Msgf("couldn't write badge of ROTI %d: %s", rotiID, err.Error())
+	}
+}
+
+// embedHandler shows the live score of a ROTI in a page made for iframes,
+// the sites allowed to embed it being set in the configuration
+func embedHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		http.Error(w, model.ErrNoROTIMatchingThisID.Error(), http.StatusNotFound)
+		return
+	}
+
+	currentConfig, err := GetConfig()
+	if err != nil {
+		log.Error().Err(err)
+		return
+	}
+
+	templateFilePath := "templates/embed.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	template := collectResults(rotiID, currentROTI)
+	template.Url = currentConfig.GetURL()
+
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+currentConfig.GetEmbedFrameAncestors())
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func TestBadgeMessage(t *testing.T) {
+	testCases := []struct {
+		roti          existingROTI
+		expected      string
+		expectedColor color.RGBA
+	}{
+		{existingROTI{NumVotes: 3, ResultsHidden: true}, "hidden, 3 votes", badgeGray},
+		{existingROTI{}, "no votes", badgeGray},
+		{existingROTI{NumVotes: 1, Avg: 2}, "2.00, 1 vote", badgeRed},
+		{existingROTI{NumVotes: 4, Avg: 2.5}, "2.50, 4 votes", badgeYellow},
+		{existingROTI{NumVotes: 4, Avg: 4}, "4.00, 4 votes", badgeGreen},
+	}
+
+	for _, tc := range testCases {
+		message, messageColor := badgeMessage(tc.roti, 2.5, 4)
+		if message != tc.expected || messageColor != tc.expectedColor {
+			t.Errorf("Got %q in %v but expected %q in %v", message, messageColor, tc.expected, tc.expectedColor)
+		}
+	}
+}
+
+func TestEmbedHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "embedded", MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currentROTI.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+	strID := strconv.Itoa(rotiID.Int())
+	blindID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "blind", Blind: true}, 30)
+	blindROTI, err := model.GetROTI(blindID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blindROTI.AddVoteToROTI(1, ""); err != nil {
+		t.Fatal(err)
+	}
+	strBlindID := strconv.Itoa(blindID.Int())
+
+	testCases := []struct {
+		name           string
+		handlerfunc    http.HandlerFunc
+		pathValue      string
+		value          string
+		expectedStatus int
+		expected       string
+		unexpected     string
+	}{
+		{"Badge", badgeHandler, "name", strID + ".svg", http.StatusOK, `aria-label="ROTI: 4.00, 1 vote"`, ""},
+		{"Badge of blind ROTI", badgeHandler, "name", strBlindID + ".svg", http.StatusOK, `aria-label="ROTI: hidden, 1 vote"`, "1.00"},
+		{"Badge without extension", badgeHandler, "name", strID, http.StatusNotFound, "", ""},
+		{"Badge of unknown ROTI", badgeHandler, "name", "10001.svg", http.StatusNotFound, "", ""},
+		{"Embed", embedHandler, "rotiid", strID, http.StatusOK, "4.00", ""},
+		{"Embed of blind ROTI", embedHandler, "rotiid", strBlindID, http.StatusOK, "Results will be shown once they are revealed", "1.00"},
+		{"Embed of unknown ROTI", embedHandler, "rotiid", "10001", http.StatusNotFound, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.SetPathValue(tc.pathValue, tc.value)
+			rr := httptest.NewRecorder()
+			tc.handlerfunc(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			body := rr.Body.String()
+			if !strings.Contains(body, tc.expected) || (tc.unexpected != "" && strings.Contains(body, tc.unexpected)) {
+				t.Errorf("Unexpected body:\n%s", body)
+			}
+			if strings.HasSuffix(tc.value, ".svg") {
+				checkWellFormed(t, rr.Body.Bytes())
+			} else if csp := rr.Header().Get("Content-Security-Policy"); csp != "frame-ancestors "+currentConfig.GetEmbedFrameAncestors() {
+				t.Errorf("Got Content-Security-Policy %q", csp)
+			}
+		})
+	}
+}
@@ -6,69 +6,162 @@ import (
 	"image/color"
 	"image/draw"
 	"io/fs"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
 
+	"github.com/deezer/groroti/internal/analysis"
+	"github.com/deezer/groroti/internal/pdf"
 	"github.com/deezer/groroti/internal/staticEmbed"
 	"github.com/goki/freetype/truetype"
-	"github.com/rs/zerolog/log"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
-func addLabel(img *image.RGBA, x, y int, label string, myFont *truetype.Font, size float64, col color.Color) {
-	point := fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)}
+// luciole is the font of the exports, parsed once: for drawing images and for
+// measuring text and embedding it in PDF files
+var luciole struct {
+	once    sync.Once
+	font    *truetype.Font
+	metrics *pdf.Font
+	err     error
+}
 
-	face := truetype.NewFace(myFont, &truetype.Options{
-		Size: size,
+func loadLuciole() (*truetype.Font, *pdf.Font, error) {
+	luciole.once.Do(func() {
+		data, err := fs.ReadFile(staticEmbed.EmbeddedStatic, "static/Luciole-Regular.ttf")
+		if err != nil {
+			luciole.err = err
+			return
+		}
+		if luciole.font, luciole.err = truetype.Parse(data); luciole.err != nil {
+			return
+		}
+		luciole.metrics, luciole.err = pdf.ParseFont(data)
 	})
+	return luciole.font, luciole.metrics, luciole.err
+}
 
+func addLabel(img *image.RGBA, x, y int, label string, face font.Face, col color.Color) {
 	d := &font.Drawer{
 		Dst:  img,
 		Src:  image.NewUniform(col),
 		Face: face,
-		Dot:  point,
+		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
 	}
 	d.DrawString(label)
 }
 
-func exportAsPNG(roti existingROTI) *image.RGBA {
-	var y []int
-	if roti.Description != "" {
-		y = []int{200, 50, 90, 140, 175}
-	} else {
-		y = []int{150, 50, 0, 90, 125}
+// exportAsPNG draws the results card of a ROTI
+func exportAsPNG(roti existingROTI, options cardOptions) (*image.RGBA, error) {
+	myFont, metrics, err := loadLuciole()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := layoutCard(roti, options, metrics)
+	if err != nil {
+		return nil, err
 	}
 
-	img := image.NewRGBA(image.Rect(0, 0, 1000, y[0]))
-	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	img := image.NewRGBA(image.Rect(0, 0, layout.Width, layout.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{layout.Background}, image.Point{}, draw.Src)
 
-	// Create a sub-file system to load font
-	staticFS, err := fs.Sub(staticEmbed.EmbeddedStatic, "static")
-	if err != nil {
-		log.Error().Err(err)
+	for _, rect := range layout.Rects {
+		fillRect(img, int(math.Round(rect.X)), int(math.Round(rect.Y)),
+			int(math.Round(rect.X+rect.Width)), int(math.Round(rect.Y+rect.Height)), rect.Color)
 	}
 
-	fontBytes, err := fs.ReadFile(staticFS, "Luciole-Regular.ttf")
-	if err != nil {
-		log.Error().Err(err)
+	faces := make(map[float64]font.Face)
+	for _, text := range layout.Texts {
+		face, ok := faces[text.Size]
+		if !ok {
+			face = truetype.NewFace(myFont, &truetype.Options{Size: text.Size})
+			faces[text.Size] = face
+		}
+		addLabel(img, int(math.Round(text.X)), int(math.Round(text.Y)), text.Text, face, text.Color)
 	}
-	font, err := truetype.Parse(fontBytes)
-	if err != nil {
-		log.Error().Err(err)
+
+	return img, nil
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, col color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+// exportAsCSV returns the CSV records of the results: the summary, followed by
+// one section per kind of feedback, separated by empty records
+func exportAsCSV(roti existingROTI) (records [][]string) {
+	var min, max, ciLow, ciHigh string
+	if !roti.DetailsHidden {
+		min, max = fmt.Sprintf("%.2f", roti.Min), fmt.Sprintf("%.2f", roti.Max)
+	}
+	if roti.HasCI {
+		ciLow, ciHigh = fmt.Sprintf("%.2f", roti.CILow), fmt.Sprintf("%.2f", roti.CIHigh)
+	}
+	records = [][]string{
+		{"ROTI ID", "Description", "Average ROTI", "Min ROTI", "Max ROTI", "Number of Votes", "95% CI Low", "95% CI High", "Low Sample"},
+		{strconv.Itoa(roti.Id), roti.Description, fmt.Sprintf("%.2f", roti.Avg), min, max, strconv.Itoa(roti.NumVotes), ciLow, ciHigh, strconv.FormatBool(roti.LowSample)},
 	}
 
-	addLabel(img, 5, y[1], fmt.Sprintf("ROTI - %d", roti.Id), font, 40, color.RGBA{200, 100, 0, 255})
-	if roti.Description != "" {
-		addLabel(img, 5, y[2], fmt.Sprintf("Meeting: %s", roti.Description), font, 32, color.Black)
+	// structured feedbacks are listed after the summary, grouped by prompt
+	if len(roti.Groups) > 0 {
+		records = append(records, []string{}, []string{"Prompt", "Feedback"})
+		for _, group := range roti.Groups {
+			for _, feedback := range group.Feedbacks {
+				records = append(records, []string{group.Prompt, feedback})
+			}
+		}
 	}
-	addLabel(img, 5, y[3], fmt.Sprintf("Average ROTI: %0.2f | Min: %0.2f | Max: %0.2f", roti.Avg, roti.Min, roti.Max), font, 24, color.Black)
-	addLabel(img, 5, y[4], fmt.Sprintf("Number of votes: %d", roti.NumVotes), font, 24, color.Black)
 
-	return img
-}
+	// every feedback is listed with its moderation status, hidden ones included,
+	// in the exports of the owner
+	if len(roti.Moderation) > 0 && !roti.DetailsHidden {
+		records = append(records, []string{}, []string{"Feedback", "Status"})
+		for _, item := range roti.Moderation {
+			records = append(records, []string{item.Text, string(item.Status)})
+		}
+	}
+
+	// number of participants that "+1"ed each feedback, most supported first
+	if len(roti.Supported) > 0 {
+		supported := slices.Clone(roti.Supported)
+		sortBySupport(supported)
+		records = append(records, []string{}, []string{"Feedback", "Upvotes", "Reply"})
+		for _, feedback := range supported {
+			records = append(records, []string{feedback.Text, strconv.Itoa(feedback.Upvotes), feedback.Reply})
+		}
+	}
+
+	// follow-up answers are reported separately from general feedbacks
+	if len(roti.FollowUps) > 0 {
+		records = append(records, []string{}, []string{"Follow-up question", "Answer"})
+		for _, group := range roti.FollowUps {
+			for _, answer := range group.Feedbacks {
+				records = append(records, []string{group.Prompt, answer})
+			}
+		}
+	}
 
-func exportAsCSV(roti existingROTI) (csv_strings []string) {
-	csv_strings = []string{"ROTI ID,Description,Average ROTI,Min ROTI,Max ROTI,Number of Votes",
-		fmt.Sprintf("%d,%s,%.2f,%.2f,%.2f,%d", roti.Id, roti.Description, roti.Avg, roti.Min, roti.Max, roti.NumVotes)}
+	// action items of this ROTI, then the ones still open from previous sessions
+	if len(roti.Actions) > 0 || len(roti.CarriedOver) > 0 {
+		records = append(records, []string{}, []string{"Action", "Status", "ROTI ID"})
+		for _, action := range append(slices.Clone(roti.Actions), roti.CarriedOver...) {
+			records = append(records, []string{action.Text, string(action.Status), strconv.Itoa(action.ROTIID.Int())})
+		}
+	}
+
+	// sentiment summary and most frequent keywords of the feedbacks
+	if roti.Analysis != nil {
+		records = append(records, []string{}, []string{"Positive Feedbacks", "Neutral Feedbacks", "Negative Feedbacks", "Average Sentiment Score"},
+			[]string{strconv.Itoa(roti.Analysis.Positive), strconv.Itoa(roti.Analysis.Neutral), strconv.Itoa(roti.Analysis.Negative), fmt.Sprintf("%.2f", roti.Analysis.AverageScore)})
+		records = append(records, []string{}, []string{"Keyword", "Count"})
+		for _, terms := range [][]analysis.Term{roti.Analysis.Keywords, roti.Analysis.Bigrams} {
+			for _, term := range terms {
+				records = append(records, []string{term.Term, strconv.Itoa(term.Count)})
+			}
+		}
+	}
 
-	return csv_strings
+	return records
 }
@@ -6,15 +6,29 @@ import (
 	"image/png"
 	"io/fs"
 	"net/http"
-	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/deezer/groroti/internal/analysis"
 	"github.com/deezer/groroti/internal/middlewares"
 	"github.com/deezer/groroti/internal/model"
 	"github.com/deezer/groroti/internal/staticEmbed"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// defaultPrompt gathers free text feedbacks of ROTIs using structured feedbacks
+	defaultPrompt = "General feedback"
+	// maxAnalysisTerms is the number of keywords and bigrams shown with the results
+	maxAnalysisTerms = 30
+	// font sizes of the word cloud, in rem
+	minCloudFontSize = 0.9
+	maxCloudFontSize = 2.5
+)
+
 var (
 	ErrTemplateParseFile = errors.New("error while parsing template file")
 	ErrTemplateExecute   = errors.New("error while execution of template file")
@@ -22,17 +36,75 @@ var (
 	Version              string
 )
 
+// distributionBar is one bar of the histogram of votes
+type distributionBar struct {
+	Value   float64 `json:"value"`
+	Count   int     `json:"count"`
+	Percent int     `json:"percent"`
+}
+
+// cloudWord is a keyword of the word cloud, Size being its font size in rem
+type cloudWord struct {
+	Term  string
+	Count int
+	Size  float64
+}
+
+// supportedFeedback is a feedback that participants can "+1". Upvoted tells
+// if the current user already did
+type supportedFeedback struct {
+	ID      model.FeedbackID `json:"id"`
+	Text    string           `json:"text"`
+	Upvotes int              `json:"upvotes"`
+	Reply   string           `json:"reply,omitempty"`
+	Upvoted bool             `json:"-"`
+}
+
+// feedbackGroup gathers the feedbacks answering the same prompt
+type feedbackGroup struct {
+	Prompt    string   `json:"prompt"`
+	Feedbacks []string `json:"feedbacks"`
+}
+
 type existingROTI struct {
-	Id           int
-	Description  string
-	NumVotes     int
-	Avg          float64
-	Min          float64
-	Max          float64
-	Url          string
-	Feedbacks    []string
-	UserHasVoted bool
-	Version      string
+	Id             int
+	Description    string
+	NumVotes       int
+	Avg            float64
+	Min            float64
+	Max            float64
+	CILow          float64
+	CIHigh         float64
+	HasCI          bool
+	LowSample      bool
+	ResultsHidden  bool
+	DetailsHidden  bool
+	MinVotes       int
+	Blind          bool
+	Closed         bool
+	OpensAt        string
+	IsOwner        bool
+	PresenterToken string
+	Series         string
+	Email          string
+	Moderation     []model.FeedbackItem
+	Url            string
+	Preview        string
+	Feedbacks      []string
+	Supported      []supportedFeedback
+	SortBySupport  bool
+	Groups         []feedbackGroup
+	FollowUps      []feedbackGroup
+	Distribution   []distributionBar
+	Analysis       *analysis.Report
+	Actions        []model.ActionItem
+	CarriedOver    []model.ActionItem
+	Webhooks       []model.Webhook
+	Events         []model.WebhookEvent
+	ChatSummary    bool
+	WordCloud      []cloudWord
+	UserHasVoted   bool
+	Version        string
 }
 
 func Register() *http.ServeMux {
@@ -40,6 +112,10 @@ func Register() *http.ServeMux {
 
 	// launch the periodic process that collects the metrics
 	recordMetrics()
+	// and the ones sending the webhooks and the emails, and reading the calendar feed
+	startWebhookWorker()
+	startEmailWorker()
+	startCalendarWorker()
 
 	// Prometheus + liveness/readiness
 	router.Handle("GET /-/liveness", NewHealthHandler())
@@ -49,12 +125,54 @@ func Register() *http.ServeMux {
 	// Real application
 	router.Handle("GET /{$}", middlewares.MiddlewareChain("/", http.HandlerFunc(homeHandler)))
 	router.Handle("GET /downpng/{rotiid}", middlewares.MiddlewareChain("/downpng", http.HandlerFunc(downloadPNGHandler)))
+	router.Handle("GET /downsvg/{rotiid}", middlewares.MiddlewareChain("/downsvg", http.HandlerFunc(downloadSVGHandler)))
 	router.Handle("GET /downcsv/{rotiid}", middlewares.MiddlewareChain("/downcsv", http.HandlerFunc(downloadCSVHandler)))
+	router.Handle("GET /api/roti/{rotiid}", middlewares.MiddlewareChain("/api/roti", http.HandlerFunc(apiROTIHandler)))
 	router.Handle("GET /roti/{rotiid}", middlewares.MiddlewareChain("/roti", http.HandlerFunc(displayROTIHandler)))
 	router.Handle("GET /roti", middlewares.MiddlewareChain("/roti", http.HandlerFunc(displayROTIHandlerLegacy)))
 	router.Handle("POST /displayvote/{rotiid}", middlewares.MiddlewareChain("/displayvote", http.HandlerFunc(displayVoteHandler)))
 	router.Handle("POST /newroti", middlewares.MiddlewareChain("/newroti", http.HandlerFunc(postROTIHandler)))
 	router.Handle("POST /vote/{rotiid}", middlewares.MiddlewareChain("/vote", http.HandlerFunc(postVoteHandler)))
+	router.Handle("POST /reveal/{rotiid}", middlewares.MiddlewareChain("/reveal", http.HandlerFunc(revealROTIHandler)))
+	router.Handle("POST /close/{rotiid}", middlewares.MiddlewareChain("/close", http.HandlerFunc(closeROTIHandler)))
+	router.Handle("POST /moderate/{rotiid}/{feedbackid}", middlewares.MiddlewareChain("/moderate", http.HandlerFunc(moderateFeedbackHandler)))
+	router.Handle("POST /upvote/{rotiid}/{feedbackid}", middlewares.MiddlewareChain("/upvote", http.HandlerFunc(upvoteFeedbackHandler)))
+	router.Handle("POST /reply/{rotiid}/{feedbackid}", middlewares.MiddlewareChain("/reply", http.HandlerFunc(replyFeedbackHandler)))
+	router.Handle("POST /action/{rotiid}", middlewares.MiddlewareChain("/action", http.HandlerFunc(addActionHandler)))
+	router.Handle("POST /action/{rotiid}/{actionid}", middlewares.MiddlewareChain("/action", http.HandlerFunc(updateActionHandler)))
+	router.Handle("POST /next/{rotiid}", middlewares.MiddlewareChain("/next", http.HandlerFunc(nextSessionHandler)))
+	router.Handle("GET /downvotes/{rotiid}", middlewares.MiddlewareChain("/downvotes", downloadVotesHandler(formatCSV)))
+	router.Handle("GET /downjson/{rotiid}", middlewares.MiddlewareChain("/downjson", downloadVotesHandler(formatJSON)))
+	router.Handle("GET /downndjson/{rotiid}", middlewares.MiddlewareChain("/downndjson", downloadVotesHandler(formatNDJSON)))
+	router.Handle("GET /api/roti/{rotiid}/votes", middlewares.MiddlewareChain("/api/roti/votes", http.HandlerFunc(apiVotesHandler)))
+	router.Handle("GET /downxlsx/{rotiid}", middlewares.MiddlewareChain("/downxlsx", http.HandlerFunc(downloadXLSXHandler)))
+	router.Handle("GET /downxlsx", middlewares.MiddlewareChain("/downxlsx", http.HandlerFunc(downloadSelectionXLSXHandler)))
+	router.Handle("GET /downpdf/{rotiid}", middlewares.MiddlewareChain("/downpdf", http.HandlerFunc(downloadPDFHandler)))
+	router.Handle("GET /downpdf", middlewares.MiddlewareChain("/downpdf", http.HandlerFunc(downloadRangePDFHandler)))
+	router.Handle("GET /downactions/{rotiid}", middlewares.MiddlewareChain("/downactions", http.HandlerFunc(downloadActionsHandler)))
+	router.Handle("GET /r/{rotiid}", middlewares.MiddlewareChain("/r", http.HandlerFunc(shortLinkHandler)))
+	router.Handle("GET /print", middlewares.MiddlewareChain("/print", http.HandlerFunc(printPageHandler)))
+	router.Handle("GET /print/pdf", middlewares.MiddlewareChain("/print/pdf", http.HandlerFunc(printPDFHandler)))
+	router.Handle("POST /webhook/{rotiid}", middlewares.MiddlewareChain("/webhook", http.HandlerFunc(addWebhookHandler)))
+	router.Handle("POST /webhook/{rotiid}/{webhookid}", middlewares.MiddlewareChain("/webhook", http.HandlerFunc(deleteWebhookHandler)))
+	router.Handle("GET /admin/webhooks", middlewares.MiddlewareChain("/admin/webhooks", http.HandlerFunc(adminWebhooksHandler)))
+	router.Handle("POST /admin/login", middlewares.MiddlewareChain("/admin/login", http.HandlerFunc(adminLoginHandler)))
+	router.Handle("POST /admin/webhooks", middlewares.MiddlewareChain("/admin/webhooks", http.HandlerFunc(addGlobalWebhookHandler)))
+	router.Handle("POST /admin/webhooks/{webhookid}", middlewares.MiddlewareChain("/admin/webhooks", http.HandlerFunc(deleteGlobalWebhookHandler)))
+	router.Handle("POST /chatsummary/{rotiid}", middlewares.MiddlewareChain("/chatsummary", http.HandlerFunc(chatSummaryHandler)))
+	router.Handle("GET /confirm/{token}", middlewares.MiddlewareChain("/confirm", http.HandlerFunc(confirmHandler)))
+	router.Handle("POST /confirm/{token}", middlewares.MiddlewareChain("/confirm", http.HandlerFunc(postConfirmHandler)))
+	router.Handle("GET /unsubscribe/{token}", middlewares.MiddlewareChain("/unsubscribe", http.HandlerFunc(unsubscribeHandler)))
+	router.Handle("POST /unsubscribe/{token}", middlewares.MiddlewareChain("/unsubscribe", http.HandlerFunc(postUnsubscribeHandler)))
+	router.Handle("GET /login", middlewares.MiddlewareChain("/login", http.HandlerFunc(loginHandler)))
+	router.Handle("GET /auth/callback", middlewares.MiddlewareChain("/auth/callback", http.HandlerFunc(callbackHandler)))
+	router.Handle("POST /logout", middlewares.MiddlewareChain("/logout", http.HandlerFunc(logoutHandler)))
+	router.Handle("GET /mine", middlewares.MiddlewareChain("/mine", http.HandlerFunc(myROTIsHandler)))
+	router.Handle("POST /slack/command", middlewares.MiddlewareChain("/slack/command", http.HandlerFunc(slackCommandHandler)))
+	router.Handle("POST /slack/interactive", middlewares.MiddlewareChain("/slack/interactive", http.HandlerFunc(slackInteractiveHandler)))
+	router.Handle("GET /present/{rotiid}", middlewares.MiddlewareChain("/present", http.HandlerFunc(presentROTIHandler)))
+	router.Handle("GET /present/{rotiid}/live", middlewares.MiddlewareChain("/present/live", http.HandlerFunc(presentLiveHandler)))
+	router.Handle("POST /present/{rotiid}/reveal", middlewares.MiddlewareChain("/present/reveal", http.HandlerFunc(presentRevealHandler)))
 
 	// Create a sub-file system for embedded static files
 	staticFS, err := fs.Sub(staticEmbed.EmbeddedStatic, "static")
@@ -65,12 +183,142 @@ func Register() *http.ServeMux {
 	staticFileServer := http.FileServer(http.FS(staticFS))
 	router.Handle("GET /static/", http.StripPrefix("/static/", staticFileServer))
 
-	fsQr := http.FileServer(http.Dir("data/qr"))
-	router.Handle("GET /qr/", http.StripPrefix("/qr/", fsQr))
+	router.Handle("GET /qr/{name}", middlewares.MiddlewareChain("/qr", http.HandlerFunc(qrCodeHandler)))
+	router.Handle("GET /og/{name}", middlewares.MiddlewareChain("/og", http.HandlerFunc(ogImageHandler)))
+	router.Handle("GET /badge/{name}", middlewares.MiddlewareChain("/badge", http.HandlerFunc(badgeHandler)))
+	router.Handle("GET /ics/{name}", middlewares.MiddlewareChain("/ics", http.HandlerFunc(icsHandler)))
+	router.Handle("GET /embed/{rotiid}", middlewares.MiddlewareChain("/embed", http.HandlerFunc(embedHandler)))
 
 	return router
 }
 
+// collectResults gathers the results of a ROTI shared by the results page, the
+// API and the exports. For blind ROTIs that are still hidden, only the number
+// of votes is filled and ResultsHidden is set
+func collectResults(rotiID int, currentROTI model.ROTIEntity) existingROTI {
+	if !currentROTI.ResultsVisible() {
+		return existingROTI{
+			Id:            rotiID,
+			Description:   currentROTI.GetDescription(),
+			NumVotes:      currentROTI.CountVotes(),
+			ResultsHidden: true,
+			Blind:         true,
+			Closed:        currentROTI.IsClosed(),
+			Actions:       currentROTI.ListActions(),
+			CarriedOver:   currentROTI.ListCarriedOverActions(),
+		}
+	}
+
+	stats := currentROTI.GetVotesStats()
+
+	results := existingROTI{
+		Id:          rotiID,
+		Description: currentROTI.GetDescription(),
+		NumVotes:    stats.Count,
+		Avg:         currentROTI.VotesAverage(),
+		// without votes, there's no sample to warn about
+		LowSample:   stats.Count > 0 && stats.Count < currentConfig.GetLowSampleThreshold(),
+		Blind:       currentROTI.IsBlind(),
+		Closed:      currentROTI.IsClosed(),
+		MinVotes:    anonymityThreshold(currentROTI),
+		Actions:     currentROTI.ListActions(),
+		CarriedOver: currentROTI.ListCarriedOverActions(),
+	}
+
+	// under the anonymity threshold, anything that could tell who voted what is suppressed
+	results.DetailsHidden = stats.Count < results.MinVotes
+	if !results.DetailsHidden {
+		results.Min = currentROTI.GetMinVote()
+		results.Max = currentROTI.GetMaxVote()
+		results.Distribution = buildDistribution(currentROTI.VotesDistribution(), stats.Count)
+		// along with the average, the width of the interval tells the spread of the votes
+		results.CILow, results.CIHigh, results.HasCI = stats.CILow, stats.CIHigh, stats.HasCI
+	}
+
+	anonymous := results.DetailsHidden || currentROTI.HasAnonymousFeedback() || currentConfig.AnonymousFeedback
+	if anonymous {
+		results.Feedbacks = currentROTI.ListAnonymousFeedbacks()
+	} else {
+		results.Feedbacks = currentROTI.ListFeedbacks()
+	}
+	for _, feedback := range currentROTI.ListSupportedFeedbacks(anonymous) {
+		results.Supported = append(results.Supported, supportedFeedback{ID: feedback.ID, Text: feedback.Text, Upvotes: feedback.Upvotes, Reply: feedback.Reply})
+	}
+
+	if prompts := currentROTI.GetPrompts(); prompts != nil {
+		if len(results.Feedbacks) > 0 {
+			results.Groups = append(results.Groups, feedbackGroup{Prompt: defaultPrompt, Feedbacks: results.Feedbacks})
+		}
+		for i, answers := range currentROTI.ListAnswers(anonymous) {
+			results.Groups = append(results.Groups, feedbackGroup{Prompt: prompts[i], Feedbacks: answers})
+		}
+	}
+
+	questions, followUps := currentROTI.ListFollowUps(anonymous)
+	for i, question := range questions {
+		results.FollowUps = append(results.FollowUps, feedbackGroup{Prompt: question, Feedbacks: followUps[i]})
+	}
+
+	if texts := currentROTI.ListFeedbackTexts(); len(texts) > 0 {
+		report := analysis.Analyze(texts, maxAnalysisTerms)
+		results.Analysis = &report
+		results.WordCloud = buildWordCloud(report.Keywords)
+	}
+
+	return results
+}
+
+// buildWordCloud scales the font size of the keywords with their number of
+// occurrences, and sorts them alphabetically so that the cloud looks mixed
+func buildWordCloud(keywords []analysis.Term) (cloud []cloudWord) {
+	if len(keywords) == 0 {
+		return
+	}
+	maxCount := keywords[0].Count
+	for _, keyword := range keywords {
+		size := minCloudFontSize + (maxCloudFontSize-minCloudFontSize)*float64(keyword.Count)/float64(maxCount)
+		cloud = append(cloud, cloudWord{Term: keyword.Term, Count: keyword.Count, Size: size})
+	}
+	sort.Slice(cloud, func(i, j int) bool { return cloud[i].Term < cloud[j].Term })
+	return
+}
+
+// buildDistribution returns one bar per possible vote value, plus the values
+// that were valid with a previous vote step
+func buildDistribution(counts map[float64]int, total int) (bars []distributionBar) {
+	step := currentConfig.VoteStep
+	if step <= 0 {
+		step = 0.5
+	}
+
+	values := make(map[float64]bool)
+	for i := 0; 1+float64(i)*step <= 5; i++ {
+		values[1+float64(i)*step] = true
+	}
+	for value := range counts {
+		values[value] = true
+	}
+
+	for value := range values {
+		bar := distributionBar{Value: value, Count: counts[value]}
+		if total > 0 {
+			bar.Percent = bar.Count * 100 / total
+		}
+		bars = append(bars, bar)
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Value < bars[j].Value })
+
+	return
+}
+
+// anonymityThreshold returns the threshold of the ROTI if any, the global one otherwise
+func anonymityThreshold(currentROTI model.ROTIEntity) int {
+	if currentROTI.GetMinVotes() > 0 {
+		return currentROTI.GetMinVotes()
+	}
+	return currentConfig.GetAnonymityThreshold()
+}
+
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	templateFilePath := "templates/index.html"
 	t, ok := staticEmbed.Templates[templateFilePath]
@@ -80,10 +328,19 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var template struct {
-		List    []model.ShortROTIInfo
+		List           []model.ShortROTIInfo
+		DefaultPrompts string
+		Emails         bool
+		// Login tells that creating ROTIs requires logging in as User
+		Login   bool
+		User    model.User
 		Version string
 	}
 	template.List = model.ListROTIs()
+	template.DefaultPrompts = strings.Join(currentConfig.GetFeedbackPrompts(), "\n")
+	template.Emails = currentConfig.GetSMTPAddr() != ""
+	template.Login = currentConfig.LoginEnabled()
+	template.User, _ = currentUser(r)
 	template.Version = Version
 
 	err := t.Execute(w, template)
@@ -115,28 +372,36 @@ func displayROTIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// checks if QRcode exists or not. If not, generates one
-	strID := strconv.Itoa(rotiID)
-	if _, err := os.Stat("qr/qr" + strID + ".png"); errors.Is(err, os.ErrNotExist) {
-		if err := genQRCode(currentConfig.GetURL(), strID); err != nil {
-			log.Warn().Err(ErrQRCodeGeneration)
-		}
-	}
-
 	hasVoted, _ := hasVotedForROTI(r, rotiID)
 
-	template := existingROTI{
-		Id:           rotiID,
-		Description:  currentROTI.GetDescription(),
-		NumVotes:     currentROTI.CountVotes(),
-		Avg:          currentROTI.VotesAverage(),
-		Min:          currentROTI.GetMinVote(),
-		Max:          currentROTI.GetMaxVote(),
-		Url:          currentConfig.GetURL(),
-		Feedbacks:    currentROTI.ListFeedbacks(),
-		UserHasVoted: hasVoted,
-		Version:      Version,
+	template := collectResults(rotiID, currentROTI)
+	template.Url = currentConfig.GetURL()
+	template.Preview = ogDescription(template)
+	template.UserHasVoted = hasVoted
+	if currentROTI.NotOpenYet() {
+		template.OpensAt = currentROTI.GetOpensAt().Format("January 2 at 15:04 MST")
+	}
+	upvoted := listUpvoted(r, rotiID)
+	for i := range template.Supported {
+		template.Supported[i].Upvoted = slices.Contains(upvoted, template.Supported[i].ID)
+	}
+	if r.URL.Query().Get("sort") == "support" {
+		template.SortBySupport = true
+		sortBySupport(template.Supported)
+	}
+	template.IsOwner = isROTIOwner(r, currentROTI)
+	if template.IsOwner {
+		template.PresenterToken = currentROTI.GetPresenterToken()
+		template.Series = currentROTI.GetSeries()
+		template.Email = currentROTI.GetEmail()
+		template.Moderation = currentROTI.ListFeedbackItems()
+		template.Webhooks = model.ListWebhooks(currentROTI.GetID())
+		// the ROTI already exists when its webhooks are added
+		template.Events = []model.WebhookEvent{model.EventVoteAdded, model.EventVotesReached, model.EventROTIClosed}
+		webhookURL, _ := currentConfig.GetChatWebhook()
+		template.ChatSummary = webhookURL != ""
 	}
+	template.Version = Version
 
 	templateFilePath := "templates/roti.html"
 	t, ok := staticEmbed.Templates[templateFilePath]
@@ -145,8 +410,6 @@ func displayROTIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exportAsPNG(template)
-
 	err = t.Execute(w, template)
 	if err != nil {
 		log.Error().Err(ErrTemplateExecute)
@@ -179,6 +442,17 @@ func displayVoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if currentROTI.IsClosed() {
+		log.Warn().Msgf("ROTI %d is closed, can't vote anymore", rotiID)
+		http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusFound)
+		return
+	}
+	if currentROTI.NotOpenYet() {
+		log.Warn().Msgf("ROTI %d isn't open yet, can't vote", rotiID)
+		http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusFound)
+		return
+	}
+
 	templateFilePath := "templates/vote.html"
 	t, ok := staticEmbed.Templates[templateFilePath]
 	if !ok {
@@ -191,12 +465,20 @@ func displayVoteHandler(w http.ResponseWriter, r *http.Request) {
 		VoteStep    string
 		Description string
 		HasFeedback bool
+		Prompts     []string
+		LowRule     model.FollowUpRule
+		HighRule    model.FollowUpRule
+		MaxLength   int
 		Version     string
 	}
 	template.RotiID = strconv.Itoa(rotiID)
 	template.VoteStep = fmt.Sprintf("%f", currentConfig.VoteStep)
 	template.Description = currentROTI.GetDescription()
 	template.HasFeedback = currentROTI.HasFeedback()
+	template.Prompts = currentROTI.GetPrompts()
+	template.LowRule = currentROTI.GetLowRule()
+	template.HighRule = currentROTI.GetHighRule()
+	template.MaxLength = currentConfig.MaxFeedbackLength
 	template.Version = Version
 
 	err = t.Execute(w, template)
@@ -222,17 +504,25 @@ func downloadPNGHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	template := existingROTI{
-		Id:          rotiID,
-		Description: currentROTI.GetDescription(),
-		NumVotes:    currentROTI.CountVotes(),
-		Avg:         currentROTI.VotesAverage(),
-		Min:         currentROTI.GetMinVote(),
-		Max:         currentROTI.GetMaxVote(),
-		Feedbacks:   currentROTI.ListFeedbacks(),
+	template := collectResults(rotiID, currentROTI)
+	if template.ResultsHidden {
+		log.Warn().Msgf("PNG export of ROTI %d refused: %s", rotiID, ErrResultsHidden)
+		http.Error(w, ErrResultsHidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	options, err := parseCardOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	img := exportAsPNG(template)
+	img, err := exportAsPNG(template, options)
+	if err != nil {
+		log.Error().Msgf("couldn't draw PNG of ROTI %d: %s", rotiID, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d.png", rotiID))
 	w.Header().Set("Content-Type", "image/png")
@@ -259,32 +549,34 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	template := existingROTI{
-		Id:          rotiID,
-		Description: currentROTI.GetDescription(),
-		NumVotes:    currentROTI.CountVotes(),
-		Avg:         currentROTI.VotesAverage(),
-		Min:         currentROTI.GetMinVote(),
-		Max:         currentROTI.GetMaxVote(),
+	template := collectResults(rotiID, currentROTI)
+	// feedbacks held for review or hidden are only exported for the owner
+	if isROTIOwner(r, currentROTI) {
+		template.Moderation = currentROTI.ListFeedbackItems()
+	}
+	if template.ResultsHidden {
+		log.Warn().Msgf("CSV export of ROTI %d refused: %s", rotiID, ErrResultsHidden)
+		http.Error(w, ErrResultsHidden.Error(), http.StatusForbidden)
+		return
 	}
-
-	csvContent := exportAsCSV(template)
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d.csv", rotiID))
 	w.Header().Set("Content-Type", "text/csv")
 
-	for _, line := range csvContent {
-		_, err := fmt.Fprintln(w, line)
-		if err != nil {
-			logErrorAndGoBackHome(err, w, r)
-			return
-		}
+	if err := writeCSV(w, exportAsCSV(template)); err != nil {
+		log.Error().Msgf("couldn't write CSV of ROTI %d: %s", rotiID, err.Error())
 	}
 }
 
 func postROTIHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireLogin(w, r, "/")
+	if !ok {
+		return
+	}
 	var rotiname string
-	var hide, feedback bool
+	var hide, feedback, blind, anonymous, review bool
+	var minVotes int
+	var prompts []string
 
 	// get ROTI name from form if present. "" if not
 	if err := r.ParseForm(); err != nil {
@@ -300,7 +592,75 @@ func postROTIHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Form.Get("feedback") == "on" {
 		feedback = true
 	}
-	rotiID := model.CreateROTI(rotiname, hide, feedback, currentConfig.CleanOverTime)
+	blind = false
+	if r.Form.Get("blind") == "on" {
+		blind = true
+	}
+
+	anonymous = false
+	if r.Form.Get("anonymous") == "on" {
+		anonymous = true
+	}
+	review = false
+	if r.Form.Get("review") == "on" {
+		review = true
+	}
+	if r.Form.Get("minvotes") != "" {
+		var err error
+		minVotes, err = strconv.Atoi(r.Form.Get("minvotes"))
+		if err != nil || minVotes < 0 {
+			logErrorAndGoBackHome(ErrParsingToInt, w, r)
+			return
+		}
+	}
+
+	lowRule, err := parseFollowUpRule(r.Form.Get("lowthreshold"), r.Form.Get("lowquestion"))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+	highRule, err := parseFollowUpRule(r.Form.Get("highthreshold"), r.Form.Get("highquestion"))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if feedback && r.Form.Get("feedbackmode") == "structured" {
+		prompts = strings.Split(r.Form.Get("prompts"), "\n")
+	}
+
+	var email string
+	if r.Form.Get("email") != "" {
+		if email, err = model.CheckEmail(r.Form.Get("email")); err != nil {
+			logErrorAndGoBackHome(err, w, r)
+			return
+		}
+	}
+
+	ownerToken := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{
+		Description:       rotiname,
+		Hide:              hide,
+		Feedback:          feedback,
+		Blind:             blind,
+		OwnerToken:        ownerToken,
+		MinVotes:          minVotes,
+		AnonymousFeedback: anonymous,
+		Prompts:           prompts,
+		LowRule:           lowRule,
+		HighRule:          highRule,
+		HoldForReview:     review,
+		Email:             email,
+		Creator:           user.Subject,
+	}, currentConfig.CleanOverTime)
+
+	setOwnerCookie(w, rotiID.Int(), ownerToken)
+	if email != "" {
+		requestEmailConfirmation(email, time.Now())
+	}
+	if newROTI, err := model.GetROTI(rotiID); err == nil {
+		emitWebhookEvent(newROTI, model.EventROTICreated)
+	}
 
 	http.Redirect(w, r, "/roti/"+strconv.Itoa(int(rotiID)), http.StatusSeeOther)
 }
@@ -319,6 +679,10 @@ func postVoteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	feedback := r.FormValue("feedback")
+	var answers []string
+	for i := range currentROTI.GetPrompts() {
+		answers = append(answers, r.FormValue(fmt.Sprintf("answer%d", i)))
+	}
 	// check vote validity
 	vote, err := model.CheckVote(r.FormValue("vote"))
 	if err != nil {
@@ -333,10 +697,15 @@ func postVoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := currentROTI.AddVoteToROTI(vote, feedback); err != nil {
+	ballot := model.Ballot{Value: vote, Feedback: feedback, Answers: answers, FollowUp: r.FormValue("followup")}
+	if err := castVote(currentROTI, ballot); errors.Is(err, model.ErrROTIClosed) || errors.Is(err, model.ErrROTINotOpen) || errors.Is(err, model.ErrInvalidVoteID) {
 		log.Warn().Msgf(err.Error())
 		http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusFound)
 		return
+	} else if err != nil {
+		log.Error().Msgf(err.Error())
+		http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusNotAcceptable)
+		return
 	}
 
 	// Put a cookie to mark that the user has voted for this ROTI
@@ -344,3 +713,77 @@ func postVoteHandler(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusFound)
 }
+
+// castVote moderates and saves a ballot, then tells the webhooks. Every vote
+// goes through it, whether it comes from the page of the ROTI or from a chat
+func castVote(currentROTI model.ROTIEntity, ballot model.Ballot) error {
+	if err := moderateBallot(currentROTI, &ballot); err != nil {
+		return err
+	}
+	if _, err := currentROTI.CastBallot(ballot); err != nil {
+		return err
+	}
+	emitWebhookEvent(currentROTI, model.EventVoteAdded)
+	emitWebhookEvent(currentROTI, model.EventVotesReached)
+	return nil
+}
+
+// parseFollowUpRule builds a follow-up rule from the creation form. A rule
+// without a question is disabled and its threshold is ignored
+func parseFollowUpRule(threshold, question string) (rule model.FollowUpRule, err error) {
+	rule.Question = strings.TrimSpace(question)
+	if rule.Question == "" {
+		return model.FollowUpRule{}, nil
+	}
+	rule.Threshold, err = model.CheckVote(threshold)
+	return
+}
+
+func revealROTIHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if !isROTIOwner(r, currentROTI) {
+		log.Warn().Msgf("reveal of ROTI %d refused: %s", rotiID, ErrNotROTIOwner)
+		http.Error(w, ErrNotROTIOwner.Error(), http.StatusForbidden)
+		return
+	}
+
+	currentROTI.Reveal()
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusSeeOther)
+}
+
+func closeROTIHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if !isROTIOwner(r, currentROTI) {
+		log.Warn().Msgf("closing of ROTI %d refused: %s", rotiID, ErrNotROTIOwner)
+		http.Error(w, ErrNotROTIOwner.Error(), http.StatusForbidden)
+		return
+	}
+
+	currentROTI.Close()
+	notifyClosedROTI(currentROTI)
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusSeeOther)
+}
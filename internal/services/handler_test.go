@@ -1,9 +1,12 @@
 package services
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -175,10 +178,13 @@ func TestPostROTIHandler(t *testing.T) {
 		expectedStatusCode int
 		expectedHidden     bool
 		expectedFeedback   bool
+		expectedEmail      string
 	}{
-		{"/newroti", nil, 406, false, false}, // Without form
-		{"/newroti", map[string][]string{"rotiname": {"test"}, "hide": {"on"}, "feedback": {"on"}}, 303, true, true},      // With form
-		{"/newroti", map[string][]string{"rotiname": {"test2"}, "hide": {"off"}, "feedback": {"off"}}, 303, false, false}, // With form, no options
+		{"/newroti", nil, 406, false, false, ""}, // Without form
+		{"/newroti", map[string][]string{"rotiname": {"test"}, "hide": {"on"}, "feedback": {"on"}}, 303, true, true, ""},      // With form
+		{"/newroti", map[string][]string{"rotiname": {"test2"}, "hide": {"off"}, "feedback": {"off"}}, 303, false, false, ""}, // With form, no options
+		{"/newroti", map[string][]string{"rotiname": {"test3"}, "email": {"Facilitator@Example.com"}}, 303, false, false, "facilitator@example.com"}, // With the email receiving the results
+		{"/newroti", map[string][]string{"rotiname": {"test4"}, "email": {"not an email"}}, 406, false, false, ""},                                   // With an invalid email
 	}
 
 	for _, tc := range testCases {
@@ -223,6 +229,10 @@ func TestPostROTIHandler(t *testing.T) {
 				if currentROTI.HasFeedback() != tc.expectedFeedback {
 					t.Errorf("ROTI %d has wrong feedback option: got %t want %t", rotiID, currentROTI.HasFeedback(), tc.expectedFeedback)
 				}
+
+				if currentROTI.GetEmail() != tc.expectedEmail {
+					t.Errorf("ROTI %d has wrong email: got %q want %q", rotiID, currentROTI.GetEmail(), tc.expectedEmail)
+				}
 			}
 		})
 	}
@@ -262,3 +272,594 @@ func TestPostVoteHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIROTIHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	router := http.DefaultServeMux
+	router.HandleFunc("/api/roti/{rotiid}", apiROTIHandler)
+
+	existingROTI, nonExistingROTI := generateTestsROTIs()
+	currentROTI, err := model.GetROTI(model.ROTIID(existingROTI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vote := range []float64{3, 4, 4} {
+		if err := currentROTI.AddVoteToROTI(vote, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		query              string
+		expectedStatusCode int
+	}{
+		{"/api/roti/aaaaa", 400},                            // Invalid roti
+		{fmt.Sprintf("/api/roti/%d", nonExistingROTI), 404}, // With a roti that doesn't exist
+		{fmt.Sprintf("/api/roti/%d", existingROTI), 200},    // With a roti that exists
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			code, err := testRouter(tc.query, "GET", router)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tc.expectedStatusCode {
+				t.Errorf("Handler returned wrong status code: got %d want %d", code, tc.expectedStatusCode)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/roti/%d", existingROTI), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var results apiResults
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if results.NumVotes != 3 || results.CI == nil {
+		t.Fatalf("Got %d votes and CI %v, expected 3 votes and a confidence interval", results.NumVotes, results.CI)
+	}
+	if results.CI.Low != 2.23 || results.CI.High != 5 {
+		t.Errorf("Got CI [%v, %v] but expected [2.23, 5]", results.CI.Low, results.CI.High)
+	}
+
+	// under the anonymity threshold, the interval would tell the spread of the votes
+	smallROTI := model.CreateROTIWithOptions(model.ROTIOptions{Description: "small", MinVotes: 5}, 30)
+	currentROTI, err = model.GetROTI(smallROTI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vote := range []float64{1, 5} {
+		if err := currentROTI.AddVoteToROTI(vote, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/roti/%d", smallROTI), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != 200 || strings.Contains(rr.Body.String(), "confidence_interval") {
+		t.Errorf("Expected no confidence interval under the anonymity threshold, got %d and %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBlindROTIHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	token := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "blind", Blind: true, OwnerToken: token}, 30)
+	ownerCookie := &http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token}
+	wrongCookie := &http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: "wrong"}
+
+	testCases := []struct {
+		name               string
+		method             string
+		handlerfunc        func(http.ResponseWriter, *http.Request)
+		cookie             *http.Cookie
+		expectedStatusCode int
+	}{
+		{"API before reveal", "GET", apiROTIHandler, nil, 403},
+		{"CSV before reveal", "GET", downloadCSVHandler, nil, 403},
+		{"Reveal without cookie", "POST", revealROTIHandler, nil, 403},
+		{"Reveal with wrong cookie", "POST", revealROTIHandler, wrongCookie, 403},
+		{"Reveal with owner cookie", "POST", revealROTIHandler, ownerCookie, 303},
+		{"CSV after reveal", "GET", downloadCSVHandler, nil, 200},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/", nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(tc.handlerfunc).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestCollectResultsAnonymityThreshold(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "small meeting", Feedback: true, MinVotes: 3}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vote := range []float64{1, 5} {
+		if err := currentROTI.AddVoteToROTI(vote, "feedback"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := collectResults(rotiID.Int(), currentROTI)
+	if !results.DetailsHidden || results.Min != 0 || results.Max != 0 {
+		t.Errorf("Expected min/max to be suppressed under the threshold, got %v / %v", results.Min, results.Max)
+	}
+	if results.HasCI || results.CILow != 0 || results.CIHigh != 0 {
+		t.Errorf("Expected the confidence interval to be suppressed under the threshold, got %v - %v", results.CILow, results.CIHigh)
+	}
+	for _, feedback := range results.Feedbacks {
+		if strings.HasPrefix(feedback, "(") {
+			t.Errorf("Feedback %q still carries its vote value", feedback)
+		}
+	}
+
+	if err := currentROTI.AddVoteToROTI(3, "feedback"); err != nil {
+		t.Fatal(err)
+	}
+	results = collectResults(rotiID.Int(), currentROTI)
+	if results.DetailsHidden || results.Min != 1 || results.Max != 5 {
+		t.Errorf("Expected min/max to be shown once the threshold is reached, got %v / %v", results.Min, results.Max)
+	}
+}
+
+func TestCollectResultsLowSample(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "empty"}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := collectResults(rotiID.Int(), currentROTI); results.LowSample {
+		t.Error("Expected a ROTI without votes not to be flagged as a low sample")
+	}
+
+	if err := currentROTI.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+	if results := collectResults(rotiID.Int(), currentROTI); !results.LowSample {
+		t.Error("Expected a ROTI with a single vote to be flagged as a low sample")
+	}
+}
+
+func TestPresenterHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	ownerToken := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "present", OwnerToken: ownerToken}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := currentROTI.GetPresenterToken()
+
+	testCases := []struct {
+		name               string
+		method             string
+		query              string
+		handlerfunc        func(http.ResponseWriter, *http.Request)
+		header             string
+		expectedStatusCode int
+		expectedRevealed   bool
+	}{
+		{"View without token", "GET", "/", presentROTIHandler, "", 403, false},
+		{"View with wrong token", "GET", "/?token=wrong", presentROTIHandler, "", 403, false},
+		{"View with token", "GET", "/?token=" + token, presentROTIHandler, "", 200, false},
+		{"View with owner token", "GET", "/?token=" + ownerToken, presentROTIHandler, "", 403, false},
+		{"Reveal without token", "POST", "/", presentRevealHandler, "", 403, false},
+		{"Reveal with wrong token", "POST", "/", presentRevealHandler, "wrong", 403, false},
+		{"Reveal with owner token", "POST", "/", presentRevealHandler, ownerToken, 403, false},
+		{"Reveal with token", "POST", "/", presentRevealHandler, token, 204, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.query, nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			if tc.header != "" {
+				req.Header.Set("X-Presenter-Token", tc.header)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(tc.handlerfunc).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatusCode)
+			}
+
+			// the live feed only carries results once revealed
+			req = httptest.NewRequest("GET", "/", nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			rr = httptest.NewRecorder()
+			presentLiveHandler(rr, req)
+
+			var live liveResults
+			if err := json.NewDecoder(rr.Body).Decode(&live); err != nil {
+				t.Fatal(err)
+			}
+			if live.Revealed != tc.expectedRevealed || (live.Results != nil) != tc.expectedRevealed {
+				t.Errorf("Got revealed %t with results %v, expected revealed %t", live.Revealed, live.Results, tc.expectedRevealed)
+			}
+		})
+	}
+}
+
+func TestStructuredFeedback(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "retro", Feedback: true, MinVotes: 1, Prompts: []string{"Keep", "Stop"}}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// votes from before the ROTI used prompts end up under the default prompt
+	if err := currentROTI.AddVoteToROTI(3, "old style"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/?vote=4&answer0=pairing&answer1=long+meetings", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr := httptest.NewRecorder()
+	postVoteHandler(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusFound)
+	}
+
+	results := collectResults(rotiID.Int(), currentROTI)
+	expected := []feedbackGroup{
+		{Prompt: defaultPrompt, Feedbacks: []string{"(3.0) old style"}},
+		{Prompt: "Keep", Feedbacks: []string{"(4.0) pairing"}},
+		{Prompt: "Stop", Feedbacks: []string{"(4.0) long meetings"}},
+	}
+	if !reflect.DeepEqual(results.Groups, expected) {
+		t.Errorf("Got groups %v but expected %v", results.Groups, expected)
+	}
+}
+
+func TestPostVoteFollowUp(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{
+		Description: "follow-ups",
+		LowRule:     model.FollowUpRule{Threshold: 2, Question: "What would have made this a 4?"},
+	}, 30)
+
+	testCases := []struct {
+		query              string
+		expectedStatusCode int
+	}{
+		{"/?vote=3&followup=sneaky", 406},  // No rule applies to this vote
+		{"/?vote=1&followup=shorter", 302}, // Low rule applies
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.query, nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			rr := httptest.NewRecorder()
+			postVoteHandler(rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestModerateFeedbackHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	token := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "moderation", Feedback: true, MinVotes: 1, HoldForReview: true, OwnerToken: token}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// feedbacks of this ROTI are held until reviewed
+	req := httptest.NewRequest("POST", "/?vote=2&feedback=boring", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr := httptest.NewRecorder()
+	postVoteHandler(rr, req)
+	if feedbacks := currentROTI.ListFeedbacks(); len(feedbacks) != 0 {
+		t.Fatalf("Got feedbacks %v but they should be held for review", feedbacks)
+	}
+
+	items := currentROTI.ListFeedbackItems()
+	if len(items) != 1 {
+		t.Fatalf("Got %d feedback items but expected 1", len(items))
+	}
+
+	testCases := []struct {
+		name               string
+		status             string
+		cookie             string
+		expectedStatusCode int
+		expectedFeedbacks  int
+	}{
+		{"Publish without being owner", "visible", "", 403, 0},
+		{"Publish with an invalid status", "deleted", token, 406, 0},
+		{"Publish as owner", "visible", token, 303, 1},
+		{"Hide as owner", "hidden", token, 303, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/?status="+tc.status, nil)
+			req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+			req.SetPathValue("feedbackid", items[0].ID.String())
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: tc.cookie})
+			}
+			rr := httptest.NewRecorder()
+			moderateFeedbackHandler(rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatusCode)
+			}
+			if feedbacks := currentROTI.ListFeedbacks(); len(feedbacks) != tc.expectedFeedbacks {
+				t.Errorf("Got %d published feedbacks but expected %d", len(feedbacks), tc.expectedFeedbacks)
+			}
+		})
+	}
+
+	// the forms of the owner carry the ID of the feedback, not the one of its vote
+	req = httptest.NewRequest("GET", "/roti/"+strconv.Itoa(rotiID.Int()), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	req.AddCookie(&http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token})
+	rr = httptest.NewRecorder()
+	displayROTIHandler(rr, req)
+	for _, action := range []string{"/reply/", "/moderate/"} {
+		if !strings.Contains(rr.Body.String(), action+strconv.Itoa(rotiID.Int())+"/"+items[0].ID.String()) {
+			t.Errorf("Expected the %s form of feedback %s", action, items[0].ID)
+		}
+	}
+	for _, vote := range currentROTI.ListRawVotes(false) {
+		if strings.Contains(rr.Body.String(), vote.ID.String()) {
+			t.Errorf("Vote ID %s appears on the page of the owner", vote.ID)
+		}
+	}
+
+	// hidden feedbacks are still part of the CSV export of the owner
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	req.AddCookie(&http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token})
+	rr = httptest.NewRecorder()
+	downloadCSVHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "boring,hidden") {
+		t.Errorf("Hidden feedback missing from the CSV export: %s", rr.Body.String())
+	}
+
+	// but not of everyone else
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr = httptest.NewRecorder()
+	downloadCSVHandler(rr, req)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "Feedback,Status") || strings.Contains(rr.Body.String(), "boring") {
+		t.Errorf("Moderated feedbacks in the CSV export of a non-owner: %s", rr.Body.String())
+	}
+}
+
+func TestFeedbackAnalysis(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "analysis", Feedback: true, MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, feedback := range []string{"Great demo", "The demo was boring", "Super démo, très utile"} {
+		if err := currentROTI.AddVoteToROTI(4, feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := collectResults(rotiID.Int(), currentROTI)
+	if results.Analysis == nil {
+		t.Fatal("Got no analysis of the feedbacks")
+	}
+	if results.Analysis.Positive != 2 || results.Analysis.Negative != 1 {
+		t.Errorf("Got %d positive and %d negative feedbacks but expected 2 and 1", results.Analysis.Positive, results.Analysis.Negative)
+	}
+	if len(results.WordCloud) == 0 || results.WordCloud[0].Term != "boring" {
+		t.Errorf("Got word cloud %v, expected it sorted alphabetically", results.WordCloud)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/roti/"+strconv.Itoa(rotiID.Int()), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	displayROTIHandler(rr, req)
+	if strings.Contains(rr.Body.String(), "ZgotmplZ") {
+		t.Errorf("Word cloud font sizes were escaped")
+	}
+	if !strings.Contains(rr.Body.String(), "2 positive") {
+		t.Errorf("Sentiment summary not found in the results page")
+	}
+}
+
+func TestUpvoteFeedbackHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "upvotes", Feedback: true, MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voteID, err := currentROTI.CastBallot(model.Ballot{Value: 2, Feedback: "too long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := currentROTI.CastBallot(model.Ballot{Value: 4, Feedback: "nice"}); err != nil {
+		t.Fatal(err)
+	}
+	var feedbackID model.FeedbackID
+	for _, feedback := range currentROTI.ListSupportedFeedbacks(false) {
+		if strings.HasSuffix(feedback.Text, "too long") {
+			feedbackID = feedback.ID
+		}
+	}
+
+	upvote := func(cookies []*http.Cookie, feedbackID model.FeedbackID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/upvote", nil)
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		req.SetPathValue("feedbackid", string(feedbackID))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		upvoteFeedbackHandler(rr, req)
+		return rr
+	}
+
+	rr := upvote(nil, feedbackID)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+	// the cookie protects from a second upvote of the same user
+	upvote(rr.Result().Cookies(), feedbackID)
+	// vote IDs, published in the raw exports, don't upvote feedbacks
+	for _, unknown := range []model.FeedbackID{"unknown", model.FeedbackID(voteID)} {
+		if rr := upvote(nil, unknown); rr.Code != http.StatusNotFound {
+			t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusNotFound)
+		}
+	}
+
+	results := collectResults(rotiID.Int(), currentROTI)
+	sortBySupport(results.Supported)
+	if len(results.Supported) != 2 || results.Supported[0].ID != feedbackID || results.Supported[0].Upvotes != 1 {
+		t.Errorf("Got %v but expected the upvoted feedback first with 1 upvote", results.Supported)
+	}
+
+	// the IDs of the results page can't be joined to the raw export of the votes
+	req := httptest.NewRequest("GET", "/roti/"+strconv.Itoa(rotiID.Int()), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr = httptest.NewRecorder()
+	displayROTIHandler(rr, req)
+	page := rr.Body.String()
+	if !strings.Contains(page, "/upvote/"+strconv.Itoa(rotiID.Int())+"/"+feedbackID.String()) {
+		t.Errorf("Expected the page to upvote feedback %s", feedbackID)
+	}
+	req = httptest.NewRequest("GET", "/downvotes/"+strconv.Itoa(rotiID.Int()), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr = httptest.NewRecorder()
+	downloadVotesHandler(formatCSV)(rr, req)
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Got records %v (%v)", records, err)
+	}
+	for _, record := range records[1:] {
+		if strings.Contains(page, record[0]) {
+			t.Errorf("Vote ID %s of the raw export appears on the results page", record[0])
+		}
+	}
+}
+
+func TestActionItemsHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	token := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "weekly", Feedback: true, OwnerToken: token}, 30)
+	ownerCookie := &http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token}
+
+	post := func(handler http.HandlerFunc, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if rr := post(addActionHandler, "/?text=shorter+demos", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := post(addActionHandler, "/?text=shorter+demos", ownerCookie); rr.Code != http.StatusSeeOther {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// the next session is owned by the same browser and shows the open action
+	rr := post(nextSessionHandler, "/", ownerCookie)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+	nextID, err := strconv.Atoi(strings.TrimPrefix(rr.Header().Get("Location"), "/roti/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != fmt.Sprintf("owner_roti_%d", nextID) {
+		t.Errorf("Got cookies %v, expected the owner cookie of the next session", cookies)
+	}
+
+	nextROTI, err := model.GetROTI(model.ROTIID(nextID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := collectResults(nextID, nextROTI)
+	if len(results.CarriedOver) != 1 || results.CarriedOver[0].Text != "shorter demos" {
+		t.Errorf("Got carried over actions %v", results.CarriedOver)
+	}
+
+	req := httptest.NewRequest("GET", "/?format=md", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(nextID))
+	rr = httptest.NewRecorder()
+	downloadActionsHandler(rr, req)
+	expected := fmt.Sprintf("# Action items of ROTI %d - weekly\n\nNo action item.\n\n## Open actions from previous sessions\n\n- [ ] shorter demos (ROTI %d)\n", nextID, rotiID.Int())
+	if rr.Body.String() != expected {
+		t.Errorf("Got Markdown export %q but expected %q", rr.Body.String(), expected)
+	}
+
+	req = httptest.NewRequest("GET", "/?format=json", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr = httptest.NewRecorder()
+	downloadActionsHandler(rr, req)
+	var export actionsExport
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Actions) != 1 || export.Actions[0].Status != model.ActionOpen {
+		t.Errorf("Got JSON export %v", export)
+	}
+}
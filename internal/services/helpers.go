@@ -4,16 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 
 	"github.com/deezer/groroti/internal/model"
 	"github.com/rs/zerolog/log"
-	qrcode "github.com/skip2/go-qrcode"
 )
 
 var (
 	ErrQRCodeGeneration = errors.New("error during QRcode generation")
+	ErrResultsHidden    = errors.New("results of this ROTI are hidden until they are revealed")
+	ErrNotROTIOwner     = errors.New("only the creator of this ROTI can do this")
 )
 
 // getIDFromURL() takes the id in the URL and checks if it's a valid int comprised
@@ -61,24 +61,45 @@ func hasVotedForROTI(r *http.Request, rotiID int) (bool, error) {
 	return false, err
 }
 
-func genQRCode(url string, strid string) (err error) {
-	// check directory tree for data/qr
-	qrDir := "data/qr"
-	if _, err := os.Stat(qrDir); errors.Is(err, os.ErrNotExist) {
-		err := os.Mkdir(qrDir, os.ModePerm)
-		if err != nil {
-			log.Error().Err(err)
-		}
+// setOwnerCookie lets the browser that created a ROTI manage it afterwards
+func setOwnerCookie(w http.ResponseWriter, rotiID int, token string) {
+	cookie := http.Cookie{
+		Name:     "owner_roti_" + strconv.Itoa(rotiID),
+		Value:    token,
+		Path:     "/",
+		MaxAge:   currentConfig.CleanOverTime * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	}
+	http.SetCookie(w, &cookie)
+}
 
-	// generate qrcode image
-	fullUrl := url + "/roti/" + strid
-
-	return qrcode.WriteFile(fullUrl, qrcode.Medium, currentConfig.GetQrCodeSize(),
-		fmt.Sprintf("%s/qr%s.png", qrDir, strid))
+// isROTIOwner tells whether the browser created the ROTI, or the user logged
+// in did from any browser. Nobody creates the ROTIs of the calendar feed, the
+// admins manage them
+func isROTIOwner(r *http.Request, currentROTI model.ROTIEntity) bool {
+	if user, ok := currentUser(r); ok && currentROTI.GetCreator() != "" && currentROTI.GetCreator() == user.Subject {
+		return true
+	}
+	if _, fromCalendar := currentROTI.GetCalendarEvent(); fromCalendar && adminEnabled() && isAdmin(r) {
+		return true
+	}
+	cookie, err := r.Cookie("owner_roti_" + strconv.Itoa(currentROTI.GetID().Int()))
+	if err != nil {
+		return false
+	}
+	return currentROTI.IsOwnedBy(cookie.Value)
 }
 
 func logErrorAndGoBackHome(err error, w http.ResponseWriter, r *http.Request) {
 	log.Error().Msgf(err.Error())
 	http.Redirect(w, r, "/", http.StatusNotAcceptable)
 }
+
+// votesCount writes a number of votes, "1 vote" or "N votes"
+func votesCount(votes int) string {
+	if votes == 1 {
+		return "1 vote"
+	}
+	return fmt.Sprintf("%d votes", votes)
+}
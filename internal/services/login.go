@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/oidc"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrLoginFailed  = errors.New("login failed")
+	ErrAccessDenied = errors.New("this account isn't allowed to use GroROTI")
+)
+
+const (
+	sessionCookieName = "groroti_session"
+	sessionDuration   = 7 * 24 * time.Hour
+	// loginMaxAge is how long users have to log in on the provider
+	loginMaxAge = 10 * time.Minute
+	oidcTimeout = 30 * time.Second
+)
+
+var oidcClient = &http.Client{Timeout: oidcTimeout}
+
+// the provider is discovered on the first login, and again if the issuer changes
+var (
+	oidcProvider      *oidc.Provider
+	oidcProviderMutex sync.Mutex
+)
+
+func getOIDCProvider() (*oidc.Provider, error) {
+	oidcProviderMutex.Lock()
+	defer oidcProviderMutex.Unlock()
+	if oidcProvider != nil && strings.TrimSuffix(oidcProvider.Issuer, "/") == strings.TrimSuffix(currentConfig.OIDCIssuer, "/") {
+		return oidcProvider, nil
+	}
+	provider, err := oidc.Discover(oidcClient, currentConfig.OIDCIssuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return provider, nil
+}
+
+func oidcConfig() oidc.Config {
+	return oidc.Config{
+		ClientID:     currentConfig.OIDCClientID,
+		ClientSecret: currentConfig.OIDCClientSecret,
+		RedirectURL:  currentConfig.GetURL() + "/auth/callback",
+		Scopes:       currentConfig.GetOIDCScopes(),
+	}
+}
+
+// currentUser returns the user logged in on the request, if any
+func currentUser(r *http.Request) (user model.User, ok bool) {
+	if !currentConfig.LoginEnabled() {
+		return user, false
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return user, false
+	}
+	user, err = model.GetSession(cookie.Value)
+	return user, err == nil
+}
+
+// requireLogin returns the user logged in, and sends the others to the login
+// page, to come back to next. Everyone passes when logins are disabled
+func requireLogin(w http.ResponseWriter, r *http.Request, next string) (user model.User, ok bool) {
+	if !currentConfig.LoginEnabled() {
+		return user, true
+	}
+	if user, ok = currentUser(r); ok {
+		return user, true
+	}
+	http.Redirect(w, r, "/login?next="+url.QueryEscape(next), http.StatusSeeOther)
+	return user, false
+}
+
+// localPath keeps the page to go back to after logging in on GroROTI
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// authorizeUser applies the email domain and group restrictions to the
+// claims of a user. Each configured restriction must be met
+func authorizeUser(claims oidc.Claims) (model.User, error) {
+	user := model.User{Subject: claims.Subject, Email: claims.Email, Name: claims.Name}
+	domains, allowedGroups, adminGroups := currentConfig.GetOIDCRestrictions()
+	groups := claims.Strings(currentConfig.OIDCGroupsClaim)
+
+	if len(domains) > 0 {
+		_, domain, found := strings.Cut(claims.Email, "@")
+		if !found || !claims.EmailVerified || !slices.Contains(domains, domain) {
+			return user, fmt.Errorf("%w: email %q", ErrAccessDenied, claims.Email)
+		}
+	}
+	if len(allowedGroups) > 0 && !slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(allowedGroups, group) }) {
+		return user, fmt.Errorf("%w: groups %v", ErrAccessDenied, groups)
+	}
+	user.Admin = slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(adminGroups, group) })
+	return user, nil
+}
+
+// loginHandler sends the user to the provider, with a PKCE challenge
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig.LoginEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	provider, err := getOIDCProvider()
+	if err != nil {
+		log.Error().Msgf(err.Error())
+		http.Error(w, ErrLoginFailed.Error(), http.StatusBadGateway)
+		return
+	}
+
+	login := model.LoginState{State: oidc.RandomString(), Verifier: oidc.RandomString(), Nonce: oidc.RandomString(),
+		Next: localPath(r.URL.Query().Get("next"))}
+	model.SaveLoginState(login)
+	http.Redirect(w, r, provider.AuthCodeURL(oidcConfig(), login.State, login.Nonce, login.Verifier), http.StatusFound)
+}
+
+// callbackHandler logs the user coming back from the provider in
+func callbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig.LoginEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		log.Warn().Msgf("%s: %s %s", ErrLoginFailed, query.Get("error"), query.Get("error_description"))
+		http.Error(w, fmt.Sprintf("%s: %s", ErrLoginFailed, query.Get("error")), http.StatusForbidden)
+		return
+	}
+	login, err := model.TakeLoginState(query.Get("state"), loginMaxAge)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	provider, err := getOIDCProvider()
+	if err != nil {
+		log.Error().Msgf(err.Error())
+		http.Error(w, ErrLoginFailed.Error(), http.StatusBadGateway)
+		return
+	}
+
+	config := oidcConfig()
+	idToken, err := provider.Exchange(config, query.Get("code"), login.Verifier)
+	if err != nil {
+		log.Error().Msgf(err.Error())
+		http.Error(w, ErrLoginFailed.Error(), http.StatusBadGateway)
+		return
+	}
+	claims, err := provider.Verify(config, idToken, login.Nonce, time.Now())
+	if err != nil {
+		log.Error().Msgf(err.Error())
+		http.Error(w, ErrLoginFailed.Error(), http.StatusForbidden)
+		return
+	}
+	user, err := authorizeUser(claims)
+	if err != nil {
+		log.Warn().Msgf(err.Error())
+		http.Error(w, ErrAccessDenied.Error(), http.StatusForbidden)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    model.CreateSession(user, sessionDuration),
+		Path:     "/",
+		MaxAge:   int(sessionDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(currentConfig.GetURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, login.Next, http.StatusSeeOther)
+}
+
+// logoutHandler ends the session of the user
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		model.DeleteSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// myROTIsHandler lists the ROTIs created by the user logged in
+func myROTIsHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig.LoginEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := requireLogin(w, r, "/mine")
+	if !ok {
+		return
+	}
+
+	templateFilePath := "templates/mine.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	type myROTI struct {
+		ID          int
+		Description string
+		CreatedAt   string
+		Votes       string
+		Hidden      bool
+		Closed      bool
+	}
+	var template struct {
+		User    model.User
+		ROTIs   []myROTI
+		Version string
+	}
+	template.User = user
+	for _, rotiID := range model.ListCreatorROTIs(user.Subject) {
+		currentROTI, err := model.GetROTI(rotiID)
+		if err != nil {
+			continue
+		}
+		template.ROTIs = append(template.ROTIs, myROTI{
+			ID:          rotiID.Int(),
+			Description: currentROTI.GetDescription(),
+			CreatedAt:   currentROTI.GetCreatedAt().Format("2006-01-02"),
+			Votes:       votesCount(currentROTI.CountVotes()),
+			Hidden:      currentROTI.IsHidden(),
+			Closed:      currentROTI.IsClosed(),
+		})
+	}
+	template.Version = Version
+
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/oidc/oidctest"
+)
+
+// enableLogin points the configuration to a stand-in provider, until the
+// returned function restores it
+func enableLogin(t *testing.T) (*oidctest.Provider, func()) {
+	t.Helper()
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	provider := oidctest.NewProvider("groroti", "secret")
+	previous := currentConfig
+	currentConfig.OIDCIssuer = provider.Issuer()
+	currentConfig.OIDCClientID = "groroti"
+	currentConfig.OIDCClientSecret = "secret"
+	return provider, func() {
+		provider.Close()
+		currentConfig = previous
+		oidcProviderMutex.Lock()
+		oidcProvider = nil
+		oidcProviderMutex.Unlock()
+	}
+}
+
+// logIn goes through the login of the user described by the claims, and
+// returns the answer of the callback
+func logIn(t *testing.T, provider *oidctest.Provider, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	provider.SetClaims(claims)
+
+	rr := httptest.NewRecorder()
+	loginHandler(rr, httptest.NewRequest("GET", "/login?next=/mine", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected the login to redirect to the provider, got %d", rr.Code)
+	}
+	authURL, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query := authURL.Query(); query.Get("code_challenge_method") != "S256" || query.Get("redirect_uri") != currentConfig.GetURL()+"/auth/callback" ||
+		query.Get("scope") != "openid email profile" {
+		t.Errorf("Unexpected authorization request %s", authURL)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	callbackHandler(rr, httptest.NewRequest("GET", "/auth/callback?"+callback.RawQuery, nil))
+	return rr
+}
+
+func sessionCookie(t *testing.T, rr *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == sessionCookieName && cookie.Value != "" {
+			return cookie
+		}
+	}
+	t.Fatalf("Expected a session cookie, got %d and %v", rr.Code, rr.Header())
+	return nil
+}
+
+func TestLoginToCreateROTIs(t *testing.T) {
+	provider, restore := enableLogin(t)
+	defer restore()
+	// the database is kept between runs, users are unique to this one
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	// creating a ROTI needs an account
+	req := httptest.NewRequest("POST", "/newroti", strings.NewReader("rotiname=Retro"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	postROTIHandler(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login?next=%2F" {
+		t.Fatalf("Expected to be sent to the login page, got %d and %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = logIn(t, provider, map[string]any{"sub": "jane-" + run, "email": "jane@example.com", "email_verified": true, "name": "Jane"})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/mine" {
+		t.Fatalf("Expected to go back to /mine, got %d and %s", rr.Code, rr.Header().Get("Location"))
+	}
+	jane := sessionCookie(t, rr)
+	if !jane.HttpOnly || jane.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected an HttpOnly and SameSite cookie, got %+v", jane)
+	}
+
+	req = httptest.NewRequest("POST", "/newroti", strings.NewReader("rotiname=Retro+"+run))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(jane)
+	rr = httptest.NewRecorder()
+	postROTIHandler(rr, req)
+	rotiID, err := strconv.Atoi(strings.TrimPrefix(rr.Header().Get("Location"), "/roti/"))
+	if rr.Code != http.StatusSeeOther || err != nil {
+		t.Fatalf("Expected the ROTI to be created, got %d and %s", rr.Code, rr.Header().Get("Location"))
+	}
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currentROTI.GetCreator() != "jane-"+run {
+		t.Errorf("Expected the ROTI to be created by jane-%s, got %q", run, currentROTI.GetCreator())
+	}
+
+	// Jane owns it from any browser, John doesn't
+	req = httptest.NewRequest("GET", "/roti/"+strconv.Itoa(rotiID), nil)
+	req.AddCookie(jane)
+	if !isROTIOwner(req, currentROTI) {
+		t.Error("Expected Jane to own her ROTI without its owner cookie")
+	}
+	john := sessionCookie(t, logIn(t, provider, map[string]any{"sub": "john-" + run, "email": "john@example.com", "email_verified": true}))
+	req = httptest.NewRequest("GET", "/roti/"+strconv.Itoa(rotiID), nil)
+	req.AddCookie(john)
+	if isROTIOwner(req, currentROTI) {
+		t.Error("Expected John not to own Jane's ROTI")
+	}
+
+	// voting doesn't need an account
+	req = httptest.NewRequest("POST", fmt.Sprintf("/vote/%d?vote=4", rotiID), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID))
+	rr = httptest.NewRecorder()
+	postVoteHandler(rr, req)
+	if rr.Code != http.StatusFound || currentROTI.CountVotes() != 1 {
+		t.Errorf("Expected an anonymous vote, got %d and %d votes", rr.Code, currentROTI.CountVotes())
+	}
+
+	// My ROTIs
+	req = httptest.NewRequest("GET", "/mine", nil)
+	req.AddCookie(jane)
+	rr = httptest.NewRecorder()
+	myROTIsHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Retro "+run) || !strings.Contains(rr.Body.String(), "1 vote") {
+		t.Errorf("Expected Jane's ROTI in her list, got %d and %s", rr.Code, rr.Body.String())
+	}
+	req = httptest.NewRequest("GET", "/mine", nil)
+	req.AddCookie(john)
+	rr = httptest.NewRecorder()
+	myROTIsHandler(rr, req)
+	if strings.Contains(rr.Body.String(), "Retro "+run) {
+		t.Error("Expected Jane's ROTI not to be in John's list")
+	}
+
+	// logging out ends the session
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(jane)
+	rr = httptest.NewRecorder()
+	logoutHandler(rr, req)
+	req = httptest.NewRequest("GET", "/mine", nil)
+	req.AddCookie(jane)
+	rr = httptest.NewRecorder()
+	myROTIsHandler(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login?next=%2Fmine" {
+		t.Errorf("Expected to be logged out, got %d and %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestLoginRestrictions(t *testing.T) {
+	provider, restore := enableLogin(t)
+	defer restore()
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	currentConfig.OIDCAllowedDomains = "example.com, @deezer.com"
+	currentConfig.OIDCAllowedGroups = "team,admins"
+	currentConfig.OIDCAdminGroups = "admins"
+	currentConfig.AdminToken = ""
+
+	testCases := []struct {
+		name   string
+		claims map[string]any
+		status int
+		admin  bool
+	}{
+		{"member", map[string]any{"email": "jane@example.com", "email_verified": true, "groups": []string{"team"}}, http.StatusSeeOther, false},
+		{"admin", map[string]any{"email": "jo@deezer.com", "email_verified": true, "groups": []string{"admins"}}, http.StatusSeeOther, true},
+		{"other domain", map[string]any{"email": "jane@evil.com", "email_verified": true, "groups": []string{"team"}}, http.StatusForbidden, false},
+		{"unverified email", map[string]any{"email": "jane@example.com", "email_verified": false, "groups": []string{"team"}}, http.StatusForbidden, false},
+		{"missing email_verified", map[string]any{"email": "jane@example.com", "groups": []string{"team"}}, http.StatusForbidden, false},
+		{"no email", map[string]any{"groups": []string{"team"}}, http.StatusForbidden, false},
+		{"other group", map[string]any{"email": "jane@example.com", "email_verified": true, "groups": []string{"sales"}}, http.StatusForbidden, false},
+		{"no groups", map[string]any{"email": "jane@example.com", "email_verified": true}, http.StatusForbidden, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.claims["sub"] = tc.name + "-" + run
+			rr := logIn(t, provider, tc.claims)
+			if rr.Code != tc.status {
+				t.Fatalf("Expected %d, got %d", tc.status, rr.Code)
+			}
+			if rr.Code != http.StatusSeeOther {
+				return
+			}
+
+			req := httptest.NewRequest("GET", "/admin/webhooks", nil)
+			req.AddCookie(sessionCookie(t, rr))
+			rr = httptest.NewRecorder()
+			if admin := checkAdmin(rr, req); admin != tc.admin {
+				t.Errorf("Expected admin access to be %t, got %t (%d)", tc.admin, admin, rr.Code)
+			}
+			if !tc.admin && rr.Code != http.StatusForbidden {
+				t.Errorf("Expected %d for members, got %d", http.StatusForbidden, rr.Code)
+			}
+		})
+	}
+}
+
+func TestLoginCallbackErrors(t *testing.T) {
+	provider, restore := enableLogin(t)
+	defer restore()
+	provider.SetClaims(map[string]any{"sub": "jane", "email": "jane@example.com", "email_verified": true})
+
+	testCases := map[string]int{
+		"/auth/callback?error=access_denied&state=x": http.StatusForbidden,
+		"/auth/callback?code=code&state=unknown":     http.StatusBadRequest,
+	}
+	for query, status := range testCases {
+		rr := httptest.NewRecorder()
+		callbackHandler(rr, httptest.NewRequest("GET", query, nil))
+		if rr.Code != status {
+			t.Errorf("Expected %d for %s, got %d", status, query, rr.Code)
+		}
+	}
+
+	// a state is only good for one login, and codes for the PKCE challenge of their login
+	model.SaveLoginState(model.LoginState{State: "forged", Verifier: "wrong verifier", Nonce: "nonce", Next: "/"})
+	rr := httptest.NewRecorder()
+	callbackHandler(rr, httptest.NewRequest("GET", "/auth/callback?code=stolen&state=forged", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected %d for a code that doesn't match the login, got %d", http.StatusBadGateway, rr.Code)
+	}
+
+	// next pages stay on GroROTI
+	for next, expected := range map[string]string{"/mine": "/mine", "//evil.com": "/", "https://evil.com": "/", "/\\evil.com": "/", "": "/"} {
+		if path := localPath(next); path != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, next, path)
+		}
+	}
+
+	// without provider, there's no login
+	currentConfig.OIDCIssuer = ""
+	for _, handler := range []http.HandlerFunc{loginHandler, callbackHandler, myROTIsHandler} {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/login", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected %d when logins are disabled, got %d", http.StatusNotFound, rr.Code)
+		}
+	}
+}
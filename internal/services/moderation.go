@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/moderation"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	feedbackModerator     *moderation.Moderator
+	feedbackModeratorOnce sync.Once
+)
+
+// getModerator builds the moderator from the configuration on first use
+func getModerator() *moderation.Moderator {
+	feedbackModeratorOnce.Do(func() {
+		feedbackModerator = &moderation.Moderator{MaxLength: currentConfig.MaxFeedbackLength}
+		if currentConfig.WordListsDir != "" {
+			filter, err := moderation.LoadWordLists(currentConfig.WordListsDir)
+			if err != nil {
+				log.Error().Msgf("couldn't load moderation word lists from %s: %s", currentConfig.WordListsDir, err.Error())
+				return
+			}
+			feedbackModerator.Filters = append(feedbackModerator.Filters, filter)
+		}
+	})
+	return feedbackModerator
+}
+
+// moderateBallot rejects texts that are too long and holds the ballot for
+// review when needed
+func moderateBallot(currentROTI model.ROTIEntity, ballot *model.Ballot) error {
+	moderator := getModerator()
+
+	texts := append([]string{ballot.Feedback, ballot.FollowUp}, ballot.Answers...)
+	for _, text := range texts {
+		if err := moderator.CheckLength(text); err != nil {
+			return err
+		}
+	}
+
+	if currentROTI.NeedsReview() || currentConfig.HoldForReview {
+		ballot.Status = model.FeedbackHeld
+		return nil
+	}
+	for _, text := range texts {
+		if flagged, reason := moderator.Flag(text); flagged {
+			log.Info().Msgf("feedback for ROTI %d held for review: %s", currentROTI.GetID().Int(), reason)
+			ballot.Status = model.FeedbackHeld
+			return nil
+		}
+	}
+	return nil
+}
+
+func moderateFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if !isROTIOwner(r, currentROTI) {
+		log.Warn().Msgf("moderation of ROTI %d refused: %s", rotiID, ErrNotROTIOwner)
+		http.Error(w, ErrNotROTIOwner.Error(), http.StatusForbidden)
+		return
+	}
+
+	status, err := model.CheckFeedbackStatus(r.FormValue("status"))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	err = currentROTI.SetFeedbackStatus(model.FeedbackID(r.PathValue("feedbackid")), status)
+	if errors.Is(err, model.ErrNoVoteMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusSeeOther)
+}
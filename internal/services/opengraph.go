@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+// maxOGImages is the number of preview images kept in memory
+const maxOGImages = 256
+
+// ogImage is the preview image of a ROTI, drawn for a number of votes and
+// visibility of the results
+type ogImage struct {
+	votes   int
+	visible bool
+	data    []byte
+	etag    string
+}
+
+// ogImages keeps the preview images until the next vote on their ROTI
+var ogImages = struct {
+	sync.Mutex
+	images map[int]ogImage
+}{images: make(map[int]ogImage)}
+
+// ogDescription sums up the results of a ROTI for the link previews of chats
+func ogDescription(roti existingROTI) string {
+	switch {
+	case roti.ResultsHidden:
+		return fmt.Sprintf("Blind ROTI, %d votes so far: results will be shown once they are revealed", roti.NumVotes)
+	case roti.NumVotes == 0:
+		return "No vote yet, be the first to rate this meeting"
+	default:
+		return fmt.Sprintf("Average ROTI: %0.2f from %d votes", roti.Avg, roti.NumVotes)
+	}
+}
+
+// renderOGImage draws the social card of a ROTI, without its feedbacks
+func renderOGImage(roti existingROTI) ([]byte, error) {
+	img, err := exportAsPNG(roti, cardOptions{Theme: "light", Size: "social"})
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// getOGImage returns the cached preview image of the ROTI, drawing it again
+// when votes were added or results revealed since
+func getOGImage(rotiID int, currentROTI model.ROTIEntity) (ogImage, error) {
+	votes, visible := currentROTI.CountVotes(), currentROTI.ResultsVisible()
+
+	ogImages.Lock()
+	cached, ok := ogImages.images[rotiID]
+	ogImages.Unlock()
+	if ok && cached.votes == votes && cached.visible == visible {
+		return cached, nil
+	}
+
+	data, err := renderOGImage(collectResults(rotiID, currentROTI))
+	if err != nil {
+		return ogImage{}, err
+	}
+	sum := sha256.Sum256(data)
+	image := ogImage{votes: votes, visible: visible, data: data, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+
+	ogImages.Lock()
+	defer ogImages.Unlock()
+	if _, ok := ogImages.images[rotiID]; !ok && len(ogImages.images) >= maxOGImages {
+		// previews are mostly asked for right after a link is shared, any of the others can go
+		for id := range ogImages.images {
+			delete(ogImages.images, id)
+			break
+		}
+	}
+	ogImages.images[rotiID] = image
+	return image, nil
+}
+
+// ogImageHandler serves the 1200x630 preview image of a ROTI (/og/{rotiid}.png)
+// used by the OpenGraph tags of its page
+func ogImageHandler(w http.ResponseWriter, r *http.Request) {
+	strID, found := strings.CutSuffix(r.PathValue("name"), ".png")
+	rotiID, err := strconv.Atoi(strID)
+	if !found || err != nil || rotiID < 10000 || rotiID > 99999 {
+		http.Error(w, model.ErrInvalidROTIID.Error(), http.StatusNotFound)
+		return
+	}
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		http.Error(w, model.ErrNoROTIMatchingThisID.Error(), http.StatusNotFound)
+		return
+	}
+
+	image, err := getOGImage(rotiID, currentROTI)
+	if err != nil {
+		log.Error().Msgf("couldn't draw preview of ROTI %d: %s", rotiID, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// the image changes with each vote, so it's checked again each time
+	w.Header().Set("ETag", image.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if matchesETag(r, image.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if _, err := w.Write(image.data); err != nil {
+		log.Error().Msgf("couldn't write preview of ROTI %d: %s", rotiID, err.Error())
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func TestOGDescription(t *testing.T) {
+	testCases := []struct {
+		roti     existingROTI
+		expected string
+	}{
+		{existingROTI{NumVotes: 3, ResultsHidden: true}, "Blind ROTI, 3 votes so far: results will be shown once they are revealed"},
+		{existingROTI{}, "No vote yet, be the first to rate this meeting"},
+		{existingROTI{NumVotes: 12, Avg: 3.6}, "Average ROTI: 3.60 from 12 votes"},
+	}
+
+	for _, tc := range testCases {
+		if description := ogDescription(tc.roti); description != tc.expected {
+			t.Errorf("Got %q but expected %q", description, tc.expected)
+		}
+	}
+}
+
+func TestOGImageHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "preview", MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strID := strconv.Itoa(rotiID.Int())
+	blindID := strconv.Itoa(model.CreateROTIWithOptions(model.ROTIOptions{Description: "blind", Blind: true}, 30).Int())
+
+	get := func(name, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/og/"+name, nil)
+		req.SetPathValue("name", name)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		ogImageHandler(rr, req)
+		return rr
+	}
+
+	rr := get(strID+".png", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	etag := rr.Header().Get("ETag")
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 1200 || bounds.Dy() != 630 {
+		t.Errorf("Got a %dx%d image", bounds.Dx(), bounds.Dy())
+	}
+
+	// the image is cached until the next vote
+	if rr := get(strID+".png", etag); rr.Code != http.StatusNotModified {
+		t.Errorf("Got status %d for an unchanged preview", rr.Code)
+	}
+	if err := currentROTI.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(strID+".png", etag); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("Got status %d and the same ETag after a vote", rr.Code)
+	}
+
+	// previews of blind ROTIs don't show their results
+	if rr := get(blindID+".png", ""); rr.Code != http.StatusOK {
+		t.Errorf("Got status %d for a blind ROTI", rr.Code)
+	}
+	for _, name := range []string{strID, strID + ".jpg", "10001.png"} {
+		if rr := get(name, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Got status %d for %s", rr.Code, name)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/roti/"+strID, nil)
+	req.SetPathValue("rotiid", strID)
+	rr = httptest.NewRecorder()
+	displayROTIHandler(rr, req)
+	for _, tag := range []string{`og:image" content="` + currentConfig.GetURL() + "/og/" + strID + `.png"`, `og:description" content="Average ROTI: 4.00 from 1 votes"`} {
+		if !strings.Contains(rr.Body.String(), tag) {
+			t.Errorf("%s not found in the page", tag)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/rs/zerolog/log"
+)
+
+// liveResults is polled by the presenter view. Results are only sent once the
+// facilitator revealed them
+type liveResults struct {
+	NumVotes int         `json:"num_votes"`
+	Revealed bool        `json:"revealed"`
+	Closed   bool        `json:"closed"`
+	Results  *apiResults `json:"results,omitempty"`
+}
+
+// isPresenter accepts the presenter token from the query string or a header,
+// and the owners of the ROTI. The presenter token doesn't allow to manage the
+// ROTI, so the owner token never ends up in a URL
+func isPresenter(r *http.Request, currentROTI model.ROTIEntity) bool {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return currentROTI.IsPresentedBy(token)
+	}
+	if token := r.Header.Get("X-Presenter-Token"); token != "" {
+		return currentROTI.IsPresentedBy(token)
+	}
+	return isROTIOwner(r, currentROTI)
+}
+
+// shortURL strips the scheme of the frontend URL to make it easier to type
+func shortURL(rotiID int) string {
+	url := currentConfig.GetURL()
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	return url + "/r/" + strconv.Itoa(rotiID)
+}
+
+func shortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(rotiID), http.StatusFound)
+}
+
+func presentROTIHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if !isPresenter(r, currentROTI) {
+		log.Warn().Msgf("presenter view of ROTI %d refused: %s", rotiID, ErrNotROTIOwner)
+		http.Error(w, ErrNotROTIOwner.Error(), http.StatusForbidden)
+		return
+	}
+
+	templateFilePath := "templates/present.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	var template struct {
+		Id          int
+		Description string
+		JoinURL     string
+		ShortURL    string
+		Token       string
+		Version     string
+	}
+	template.Id = rotiID
+	template.Description = currentROTI.GetDescription()
+	template.JoinURL = currentConfig.GetURL() + "/roti/" + strconv.Itoa(rotiID)
+	template.ShortURL = shortURL(rotiID)
+	template.Token = currentROTI.GetPresenterToken()
+	template.Version = Version
+
+	err = t.Execute(w, template)
+	if err != nil {
+		log.Error().Err(ErrTemplateExecute)
+		return
+	}
+}
+
+func presentLiveHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, model.ErrNoROTIMatchingThisID)
+		return
+	}
+
+	live := liveResults{
+		NumVotes: currentROTI.CountVotes(),
+		Revealed: currentROTI.IsRevealed(),
+		Closed:   currentROTI.IsClosed(),
+	}
+	if live.Revealed {
+		results := newAPIResults(collectResults(rotiID, currentROTI))
+		live.Results = &results
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, live)
+}
+
+func presentRevealHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, model.ErrNoROTIMatchingThisID)
+		return
+	}
+
+	if !isPresenter(r, currentROTI) {
+		log.Warn().Msgf("reveal of ROTI %d refused: %s", rotiID, ErrNotROTIOwner)
+		writeJSONError(w, http.StatusForbidden, ErrNotROTIOwner)
+		return
+	}
+
+	currentROTI.Reveal()
+
+	w.WriteHeader(http.StatusNoContent)
+}
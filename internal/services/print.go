@@ -0,0 +1,286 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/pdf"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// printCallToAction is written under the QR code when asked for
+	printCallToAction = "Scan to rate this session"
+	// handoutCardWidth and handoutCardHeight are the smallest size of the
+	// cards of a handout, as many as possible being laid out on each page
+	handoutCardWidth  = 190
+	handoutCardHeight = 260
+)
+
+var (
+	ErrUnknownLayout = errors.New("unknown print layout")
+	ErrUnknownPaper  = errors.New("unknown paper size")
+
+	printPapers = map[string]struct{ Width, Height float64 }{
+		"a4":     {pdf.A4Width, pdf.A4Height},
+		"letter": {pdf.LetterWidth, pdf.LetterHeight},
+		"a6":     {pdf.A6Width, pdf.A6Height},
+	}
+)
+
+// printOptions tell how the QR codes of the ROTIs are printed: a poster per
+// page, or handouts filling each page with cards to cut out
+type printOptions struct {
+	Layout       string
+	Paper        string
+	CallToAction bool
+}
+
+func defaultPrintOptions() printOptions {
+	return printOptions{Layout: "poster", Paper: "a4"}
+}
+
+// parsePrintOptions reads the options of a print from the query parameters,
+// missing ones keeping their default value
+func parsePrintOptions(r *http.Request) (options printOptions, err error) {
+	options = defaultPrintOptions()
+	query := r.URL.Query()
+	if layout := query.Get("layout"); layout != "" {
+		if layout != "poster" && layout != "handout" {
+			return options, fmt.Errorf("%w %s", ErrUnknownLayout, layout)
+		}
+		options.Layout = layout
+	}
+	if paper := query.Get("paper"); paper != "" {
+		if _, ok := printPapers[paper]; !ok {
+			return options, fmt.Errorf("%w %s", ErrUnknownPaper, paper)
+		}
+		options.Paper = paper
+	}
+	if cta := query.Get("cta"); cta != "" {
+		if options.CallToAction, err = strconv.ParseBool(cta); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// printROTI is what is printed of a ROTI: nothing about its results
+type printROTI struct {
+	Title    string
+	URL      string
+	ShortURL string
+}
+
+// groROTILogo is the embedded logo, decoded once
+var groROTILogo struct {
+	once sync.Once
+	img  image.Image
+	err  error
+}
+
+func loadLogo() (image.Image, error) {
+	groROTILogo.once.Do(func() {
+		data, err := fs.ReadFile(staticEmbed.EmbeddedStatic, logoPath)
+		if err != nil {
+			groROTILogo.err = err
+			return
+		}
+		groROTILogo.img, groROTILogo.err = png.Decode(bytes.NewReader(data))
+	})
+	return groROTILogo.img, groROTILogo.err
+}
+
+// printWriter draws the cards of the ROTIs on the pages of a document
+type printWriter struct {
+	document *pdf.Document
+	font     *pdf.Font
+	logo     image.Image
+	options  printOptions
+}
+
+// centered writes a line centered on x, shrinking it to fit in width
+func (pw *printWriter) centered(page *pdf.Page, x, y, size, width float64, col color.Color, text string) {
+	text = pw.font.Printable(text)
+	if textWidth := pw.font.Width(text, size); textWidth > width {
+		size *= width / textWidth
+	}
+	page.Text(x-pw.font.Width(text, size)/2, y, size, col, text)
+}
+
+// drawCard draws the card of a ROTI in the given box: the logo, the title, a
+// QR code as big as possible, the short URL and the call to action. Sizes
+// are relative to an A4 poster
+func (pw *printWriter) drawCard(page *pdf.Page, x, y, width, height float64, roti printROTI) {
+	unit := width / pdf.A4Width
+	// text can't get too small on the cards of handouts
+	textUnit := max(unit, 0.45)
+	margin := 40 * unit
+	center := x + width/2
+	top := y + margin
+
+	bounds := pw.logo.Bounds()
+	logoWidth := 180 * unit
+	logoHeight := logoWidth * float64(bounds.Dy()) / float64(bounds.Dx())
+	page.Image(center-logoWidth/2, top, logoWidth, logoHeight, pw.logo)
+	top += logoHeight + 24*unit
+
+	// long titles are cut, and even more on small cards, to leave room for the QR code
+	titleSize, maxLines := 34*textUnit, 3
+	if textUnit > unit {
+		maxLines = 2
+	}
+	lines := pw.font.Wrap(pw.font.Printable(roti.Title), titleSize, width-2*margin)
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines-1], strings.TrimSpace(lines[maxLines-1])+"…")
+	}
+	for _, line := range lines {
+		top += titleSize * 1.25
+		pw.centered(page, center, top-titleSize*0.3, titleSize, width-2*margin, color.Black, line)
+	}
+	top += 20 * unit
+
+	// the QR code takes the space left between the title and the bottom lines
+	bottom := y + height - margin
+	if pw.options.CallToAction {
+		ctaSize := 28 * textUnit
+		pw.centered(page, center, bottom, ctaSize, width-2*margin, reportAccent, printCallToAction)
+		bottom -= ctaSize * 1.6
+	}
+	urlSize := 22 * textUnit
+	pw.centered(page, center, bottom, urlSize, width-2*margin, reportGray, roti.ShortURL)
+	bottom -= urlSize * 1.8
+
+	size := min(width-2*margin, bottom-top)
+	drawQRCode(page, center-size/2, top+(bottom-top-size)/2, size, roti.URL)
+}
+
+// drawHandouts fills pages with copies of the card of a ROTI, separated by
+// lines to cut along
+func (pw *printWriter) drawHandouts(roti printROTI) {
+	columns := max(int(pw.document.Width/handoutCardWidth), 1)
+	rows := max(int(pw.document.Height/handoutCardHeight), 1)
+	width, height := pw.document.Width/float64(columns), pw.document.Height/float64(rows)
+
+	page := pw.document.AddPage()
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			pw.drawCard(page, float64(column)*width, float64(row)*height, width, height, roti)
+		}
+	}
+	for column := 1; column < columns; column++ {
+		page.Line(float64(column)*width, 0, float64(column)*width, pw.document.Height, 0.5, reportLight)
+	}
+	for row := 1; row < rows; row++ {
+		page.Line(0, float64(row)*height, pw.document.Width, float64(row)*height, 0.5, reportLight)
+	}
+}
+
+// buildPrint returns the document printing the QR codes of the ROTIs, one
+// page per ROTI
+func buildPrint(rotis []printROTI, options printOptions) (*pdf.Document, error) {
+	_, font, err := loadLuciole()
+	if err != nil {
+		return nil, err
+	}
+	logo, err := loadLogo()
+	if err != nil {
+		return nil, err
+	}
+
+	paper := printPapers[options.Paper]
+	pw := printWriter{document: pdf.New(font, paper.Width, paper.Height), font: font, logo: logo, options: options}
+	pw.document.Title = "ROTI QR codes"
+	for _, roti := range rotis {
+		if options.Layout == "handout" {
+			pw.drawHandouts(roti)
+		} else {
+			pw.drawCard(pw.document.AddPage(), 0, 0, paper.Width, paper.Height, roti)
+		}
+	}
+	return pw.document, nil
+}
+
+// printPageHandler shows the form choosing what to print, the ROTIs of the
+// ids parameter being filled in
+func printPageHandler(w http.ResponseWriter, r *http.Request) {
+	templateFilePath := "templates/print.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	var template struct {
+		IDs     string
+		Version string
+	}
+	template.IDs = strings.Join(r.URL.Query()["ids"], ",")
+	template.Version = Version
+
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
+
+// printPDFHandler prints the QR codes of the ROTIs of the ids parameter as
+// posters or handouts. Unknown ROTIs are left out
+func printPDFHandler(w http.ResponseWriter, r *http.Request) {
+	rotiIDs, err := parseROTISelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options, err := parsePrintOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rotis []printROTI
+	for _, rotiID := range rotiIDs {
+		currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+		if err != nil {
+			log.Warn().Msgf("ROTI %d left out of the print: %s", rotiID, err)
+			continue
+		}
+		roti := printROTI{
+			Title:    currentROTI.GetDescription(),
+			URL:      fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), rotiID),
+			ShortURL: shortURL(rotiID),
+		}
+		if roti.Title == "" {
+			roti.Title = fmt.Sprintf("ROTI %d", rotiID)
+		}
+		rotis = append(rotis, roti)
+	}
+	if len(rotis) == 0 {
+		http.Error(w, ErrNoROTISelected.Error(), http.StatusNotFound)
+		return
+	}
+
+	document, err := buildPrint(rotis, options)
+	if err != nil {
+		log.Error().Msgf("couldn't build print: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// opened in the browser, ready to be printed
+	w.Header().Set("Content-Disposition", "inline; filename=roti_qr_codes.pdf")
+	w.Header().Set("Content-Type", "application/pdf")
+	if err := document.Write(w); err != nil {
+		log.Error().Msgf("couldn't write print: %s", err.Error())
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func TestParsePrintOptions(t *testing.T) {
+	testCases := []struct {
+		query       string
+		expected    printOptions
+		expectedErr error
+	}{
+		{"", printOptions{Layout: "poster", Paper: "a4"}, nil},
+		{"?layout=handout&paper=letter&cta=true", printOptions{Layout: "handout", Paper: "letter", CallToAction: true}, nil},
+		{"?paper=a6", printOptions{Layout: "poster", Paper: "a6"}, nil},
+		{"?layout=banner", printOptions{}, ErrUnknownLayout},
+		{"?paper=a3", printOptions{}, ErrUnknownPaper},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			options, err := parsePrintOptions(httptest.NewRequest("GET", "/"+tc.query, nil))
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Got error %v but expected %v", err, tc.expectedErr)
+			}
+			if err == nil && options != tc.expected {
+				t.Errorf("Got %+v but expected %+v", options, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrintHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	talk := strconv.Itoa(model.CreateROTIWithOptions(model.ROTIOptions{Description: "talk"}, 30).Int())
+	// the QR code of a blind ROTI tells nothing about its results
+	blind := strconv.Itoa(model.CreateROTIWithOptions(model.ROTIOptions{Blind: true}, 30).Int())
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedPages  int
+	}{
+		{"Posters", "?ids=" + talk + "," + blind + "&cta=true", http.StatusOK, 2},
+		{"Handouts", "?ids=" + talk + "&layout=handout&paper=letter", http.StatusOK, 1},
+		{"A6 cards", "?ids=" + talk + "&ids=" + blind + "&paper=a6", http.StatusOK, 2},
+		{"Unknown paper", "?ids=" + talk + "&paper=a3", http.StatusBadRequest, 0},
+		{"No ROTI", "", http.StatusBadRequest, 0},
+		{"Unknown ROTI", "?ids=10001", http.StatusNotFound, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			printPDFHandler(rr, httptest.NewRequest("GET", "/print/pdf"+tc.query, nil))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+			}
+			if pages := pageCount(rr.Body.Bytes()); tc.expectedStatus == http.StatusOK && pages != tc.expectedPages {
+				t.Errorf("Got %d pages, expected %d", pages, tc.expectedPages)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	printPageHandler(rr, httptest.NewRequest("GET", "/print?ids="+talk, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="`+talk+`"`) {
+		t.Errorf("The print page doesn't select ROTI %s:\n%s", talk, rr.Body.String())
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/qr"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// qrCacheCapacity is the number of QR codes kept in memory
+	qrCacheCapacity = 512
+	// logoPath is the GroROTI logo in the embedded static files
+	logoPath = "static/groroti-logo.png"
+)
+
+// qrCodes generates the QR codes of the ROTIs, created once with the logo
+var qrCodes struct {
+	once    sync.Once
+	service *qr.Service
+	err     error
+}
+
+func getQRService() (*qr.Service, error) {
+	qrCodes.once.Do(func() {
+		logo, err := fs.ReadFile(staticEmbed.EmbeddedStatic, logoPath)
+		if err != nil {
+			qrCodes.err = err
+			return
+		}
+		qrCodes.service, qrCodes.err = qr.NewService(qrCacheCapacity, logo)
+	})
+	return qrCodes.service, qrCodes.err
+}
+
+// parseQROptions reads the look of a QR code from the query string: size,
+// level (L, M, Q or H), fg and bg colors, quiet zone and logo. theme picks the
+// colors of a card theme, that fg and bg can still override
+func parseQROptions(r *http.Request, defaultSize int) (qr.Options, error) {
+	options := qr.DefaultOptions(defaultSize)
+	query := r.URL.Query()
+
+	if name := query.Get("theme"); name != "" {
+		theme, ok := cardThemes[name]
+		if !ok {
+			return qr.Options{}, ErrUnknownTheme
+		}
+		options.Foreground, options.Background = theme.Text, theme.Background
+	}
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return qr.Options{}, qr.ErrInvalidSize
+		}
+		options.Size = size
+	}
+	if value := query.Get("level"); value != "" {
+		level, err := qr.ParseLevel(value)
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Level = level
+	}
+	if value := query.Get("fg"); value != "" {
+		col, err := qr.ParseColor(value)
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Foreground = col
+	}
+	if value := query.Get("bg"); value != "" {
+		col, err := qr.ParseColor(value)
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Background = col
+	}
+	if value := query.Get("quiet"); value != "" {
+		quiet, err := strconv.Atoi(value)
+		if err != nil {
+			return qr.Options{}, qr.ErrInvalidQuietZone
+		}
+		options.QuietZone = quiet
+	}
+	options.Logo, _ = strconv.ParseBool(query.Get("logo"))
+
+	return options, options.Validate()
+}
+
+// matchesETag tells if the If-None-Match header of the request lists the etag
+func matchesETag(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// qrCodeHandler serves the QR code of a ROTI as PNG (/qr/{rotiid}.png, and
+// /qr/qr{rotiid}.png for older links) or SVG (/qr/{rotiid}.svg)
+func qrCodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	format := qr.PNG
+	strID, found := strings.CutSuffix(name, ".png")
+	if !found {
+		if strID, found = strings.CutSuffix(name, ".svg"); found {
+			format = qr.SVG
+		}
+	}
+	strID = strings.TrimPrefix(strID, "qr")
+
+	rotiID, err := strconv.Atoi(strID)
+	if !found || err != nil || rotiID < 10000 || rotiID > 99999 {
+		http.Error(w, model.ErrInvalidROTIID.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := model.GetROTI(model.ROTIID(rotiID)); err != nil {
+		http.Error(w, model.ErrNoROTIMatchingThisID.Error(), http.StatusNotFound)
+		return
+	}
+
+	currentConfig, err := GetConfig()
+	if err != nil {
+		log.Error().Err(err)
+		return
+	}
+
+	options, err := parseQROptions(r, currentConfig.GetQrCodeSize())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	service, err := getQRService()
+	if err != nil {
+		log.Error().Msgf("%s: %s", ErrQRCodeGeneration, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	code, err := service.Get(fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), rotiID), options, format)
+	if err != nil {
+		log.Error().Msgf("%s: %s", ErrQRCodeGeneration, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// the URL doesn't change with the frontend URL, so browsers check the ETag each time
+	w.Header().Set("ETag", code.ETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if matchesETag(r, code.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", code.ContentType)
+	if _, err := w.Write(code.Data); err != nil {
+		log.Error().Msgf("couldn't write QR code of ROTI %d: %s", rotiID, err.Error())
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/qr"
+)
+
+func TestParseQROptions(t *testing.T) {
+	dark := qr.DefaultOptions(384)
+	dark.Foreground, dark.Background = cardThemes["dark"].Text, cardThemes["dark"].Background
+	custom := qr.Options{Size: 200, Level: qr.LevelHigh, Foreground: color.RGBA{0x11, 0x22, 0x33, 255},
+		Background: cardThemes["dark"].Background, QuietZone: 0, Logo: true}
+
+	testCases := []struct {
+		query       string
+		expected    qr.Options
+		expectedErr error
+	}{
+		{"", qr.DefaultOptions(384), nil},
+		{"?theme=dark", dark, nil},
+		{"?theme=dark&size=200&level=h&fg=112233&quiet=0&logo=true", custom, nil},
+		{"?theme=pink", qr.Options{}, ErrUnknownTheme},
+		{"?size=big", qr.Options{}, qr.ErrInvalidSize},
+		{"?size=10000", qr.Options{}, qr.ErrInvalidSize},
+		{"?level=Z", qr.Options{}, qr.ErrInvalidLevel},
+		{"?bg=white", qr.Options{}, qr.ErrInvalidColor},
+		{"?quiet=40", qr.Options{}, qr.ErrInvalidQuietZone},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			options, err := parseQROptions(httptest.NewRequest("GET", "/"+tc.query, nil), 384)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Got error %v but expected %v", err, tc.expectedErr)
+			}
+			if err == nil && options != tc.expected {
+				t.Errorf("Got %+v but expected %+v", options, tc.expected)
+			}
+		})
+	}
+}
+
+func TestQRCodeHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	strID := strconv.Itoa(model.CreateROTIWithOptions(model.ROTIOptions{Description: "qr"}, 30).Int())
+
+	testCases := []struct {
+		name           string
+		value          string
+		query          string
+		expectedStatus int
+		expectedType   string
+	}{
+		{"PNG", strID + ".png", "?size=128", http.StatusOK, "image/png"},
+		{"Former PNG name", "qr" + strID + ".png", "", http.StatusOK, "image/png"},
+		{"SVG with logo", strID + ".svg", "?logo=true", http.StatusOK, "image/svg+xml"},
+		{"Invalid level", strID + ".png", "?level=X", http.StatusBadRequest, ""},
+		{"Unknown format", strID + ".gif", "", http.StatusNotFound, ""},
+		{"Unknown ROTI", "12.png", "", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tc.query, nil)
+			req.SetPathValue("name", tc.value)
+			rr := httptest.NewRecorder()
+			qrCodeHandler(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tc.expectedType {
+				t.Errorf("Got content type %s", contentType)
+			}
+			etag := rr.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("No ETag")
+			}
+
+			// the browser already has this image
+			req = httptest.NewRequest("GET", "/"+tc.query, nil)
+			req.SetPathValue("name", tc.value)
+			req.Header.Set("If-None-Match", `"other", `+etag)
+			rr = httptest.NewRecorder()
+			qrCodeHandler(rr, req)
+			if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+				t.Errorf("Got status %d and %d bytes for a cached image", rr.Code, rr.Body.Len())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/?size=128", nil)
+	req.SetPathValue("name", strID+".png")
+	rr := httptest.NewRecorder()
+	qrCodeHandler(rr, req)
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 128 {
+		t.Errorf("Got a %dx%d image", bounds.Dx(), bounds.Dy())
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown export format")
+	ErrVotesHidden   = errors.New("votes of this ROTI are hidden until there are enough of them to keep them anonymous")
+)
+
+// contentTypes maps the export formats to their MIME type
+var contentTypes = map[string]string{
+	formatCSV:    "text/csv",
+	formatJSON:   "application/json",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// rawVote is the exported representation of a vote
+type rawVote struct {
+	ID        model.VoteID `json:"id"`
+	Value     float64      `json:"value"`
+	Feedback  string       `json:"feedback"`
+	Timestamp *time.Time   `json:"timestamp"`
+}
+
+// negotiateFormat picks the export format from the format query parameter,
+// then from the Accept header, falling back on defaultFormat
+func negotiateFormat(r *http.Request, defaultFormat string) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := contentTypes[format]; !ok {
+			return "", fmt.Errorf("%w %s", ErrUnknownFormat, format)
+		}
+		return format, nil
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return formatCSV, nil
+		case "application/json":
+			return formatJSON, nil
+		case "application/x-ndjson", "application/ndjson":
+			return formatNDJSON, nil
+		}
+	}
+	return defaultFormat, nil
+}
+
+// neutralizeFormula prevents spreadsheets from evaluating a cell as a formula
+// (CSV injection) by prefixing it with a quote
+func neutralizeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// writeCSV writes properly quoted records, neutralizing formulas
+func writeCSV(w io.Writer, records [][]string) error {
+	writer := csv.NewWriter(w)
+	for _, record := range records {
+		cells := make([]string, len(record))
+		for i, cell := range record {
+			cells[i] = neutralizeFormula(cell)
+		}
+		if err := writer.Write(cells); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func newRawVotes(votes []model.RawVote) []rawVote {
+	raw := make([]rawVote, len(votes))
+	for i, vote := range votes {
+		raw[i] = rawVote{ID: vote.ID, Value: vote.Value, Feedback: vote.Feedback}
+		if !vote.CreatedAt.IsZero() {
+			createdAt := vote.CreatedAt.UTC()
+			raw[i].Timestamp = &createdAt
+		}
+	}
+	return raw
+}
+
+// writeRawVotes writes the votes in the given format
+func writeRawVotes(w http.ResponseWriter, votes []rawVote, format string) error {
+	w.Header().Set("Content-Type", contentTypes[format])
+
+	switch format {
+	case formatCSV:
+		records := [][]string{{"Vote ID", "Value", "Feedback", "Timestamp"}}
+		for _, vote := range votes {
+			var timestamp string
+			if vote.Timestamp != nil {
+				timestamp = vote.Timestamp.Format(time.RFC3339)
+			}
+			records = append(records, []string{vote.ID.String(), strconv.FormatFloat(vote.Value, 'f', -1, 64), vote.Feedback, timestamp})
+		}
+		return writeCSV(w, records)
+	case formatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, vote := range votes {
+			if err := encoder.Encode(vote); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return json.NewEncoder(w).Encode(votes)
+	}
+}
+
+// getRawVotes returns the votes of the ROTI if they can be shown. Vote values
+// are hidden with the results and under the anonymity threshold, feedbacks
+// are dropped when they must stay anonymous
+func getRawVotes(currentROTI model.ROTIEntity) ([]rawVote, int, error) {
+	if !currentROTI.ResultsVisible() {
+		return nil, http.StatusForbidden, ErrResultsHidden
+	}
+	if currentROTI.CountVotes() < anonymityThreshold(currentROTI) {
+		return nil, http.StatusForbidden, ErrVotesHidden
+	}
+	withFeedback := !currentROTI.HasAnonymousFeedback() && !currentConfig.AnonymousFeedback
+	return newRawVotes(currentROTI.ListRawVotes(withFeedback)), http.StatusOK, nil
+}
+
+// downloadVotesHandler downloads every vote of a ROTI, in defaultFormat unless
+// another one is asked by query parameter or Accept header
+func downloadVotesHandler(defaultFormat string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rotiID, err := getIDFromURL(r, false)
+		if err != nil {
+			logErrorAndGoBackHome(err, w, r)
+			return
+		}
+
+		currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+		if err != nil {
+			logErrorAndGoBackHome(err, w, r)
+			return
+		}
+
+		format, err := negotiateFormat(r, defaultFormat)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+
+		votes, status, err := getRawVotes(currentROTI)
+		if err != nil {
+			log.Warn().Msgf("raw export of ROTI %d refused: %s", rotiID, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d_votes.%s", rotiID, format))
+		if err := writeRawVotes(w, votes, format); err != nil {
+			log.Error().Msgf("couldn't write votes of ROTI %d: %s", rotiID, err.Error())
+		}
+	}
+}
+
+func apiVotesHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, model.ErrNoROTIMatchingThisID)
+		return
+	}
+
+	format, err := negotiateFormat(r, formatJSON)
+	if err != nil {
+		writeJSONError(w, http.StatusNotAcceptable, err)
+		return
+	}
+
+	votes, status, err := getRawVotes(currentROTI)
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	if err := writeRawVotes(w, votes, format); err != nil {
+		log.Error().Msgf("couldn't write votes of ROTI %d: %s", rotiID, err.Error())
+	}
+}
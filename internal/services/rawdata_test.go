@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		accept         string
+		expectedFormat string
+		expectedErr    bool
+	}{
+		{"Default format", "", "", formatCSV, false},
+		{"Any format", "", "*/*", formatCSV, false},
+		{"Query parameter", "?format=ndjson", "application/json", formatNDJSON, false},
+		{"Unknown query parameter", "?format=xml", "", "", true},
+		{"Accept header", "", "text/html, application/json;q=0.9", formatJSON, false},
+		{"NDJSON accept header", "", "application/x-ndjson", formatNDJSON, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tc.query, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			format, err := negotiateFormat(req, formatCSV)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Got error %v", err)
+			}
+			if format != tc.expectedFormat {
+				t.Errorf("Got format %q but expected %q", format, tc.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var sb strings.Builder
+	records := [][]string{{"Description", "Feedback"}, {`Sprint "42", review`, "=HYPERLINK(\"http://evil\")"}, {}, {"-2+3", "@SUM(A1)"}}
+	if err := writeCSV(&sb, records); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Description,Feedback\n\"Sprint \"\"42\"\", review\",\"'=HYPERLINK(\"\"http://evil\"\")\"\n\n'-2+3,'@SUM(A1)\n"
+	if sb.String() != expected {
+		t.Errorf("Got CSV %q but expected %q", sb.String(), expected)
+	}
+}
+
+func TestDownloadVotesHandler(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "raw, data", Feedback: true, MinVotes: 2}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	download := func(format string, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+query, nil)
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		rr := httptest.NewRecorder()
+		downloadVotesHandler(format)(rr, req)
+		return rr
+	}
+
+	if err := currentROTI.AddVoteToROTI(4, "=1+1"); err != nil {
+		t.Fatal(err)
+	}
+	// under the anonymity threshold, votes can't be exported
+	if rr := download(formatCSV, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if err := currentROTI.AddVoteToROTI(2, "too long, really"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := download(formatCSV, "")
+	if rr.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("Got content type %s", rr.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][1] != "4" || records[1][2] != "'=1+1" || records[2][2] != "too long, really" || records[1][3] == "" {
+		t.Errorf("Got records %v", records)
+	}
+
+	rr = download(formatJSON, "")
+	var votes []rawVote
+	if err := json.Unmarshal(rr.Body.Bytes(), &votes); err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 2 || votes[0].Feedback != "=1+1" || votes[0].Timestamp == nil {
+		t.Errorf("Got JSON votes %+v", votes)
+	}
+
+	rr = download(formatJSON, "?format=ndjson")
+	lines := 0
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var vote rawVote
+		if err := json.Unmarshal(scanner.Bytes(), &vote); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Got %d NDJSON lines but expected 2", lines)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/csv")
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	rr = httptest.NewRecorder()
+	apiVotesHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "Vote ID,Value,Feedback,Timestamp\n") {
+		t.Errorf("Got API answer %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRawVotesOfAnonymousFeedbacks(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "anonymous", Feedback: true, AnonymousFeedback: true, MinVotes: 2}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, feedback := range map[float64]string{1: "boring demo", 3: "too long", 5: "great retro"} {
+		if err := currentROTI.AddVoteToROTI(value, feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(handler http.HandlerFunc, target string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Got %d for %s", rr.Code, target)
+		}
+		return rr.Body.String()
+	}
+
+	// what anyone sees of the feedbacks
+	public := get(displayROTIHandler, "/roti") + get(apiROTIHandler, "/api/roti")
+	var results apiResults
+	if err := json.Unmarshal([]byte(get(apiROTIHandler, "/api/roti")), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Support) != 3 {
+		t.Fatalf("Got %d supported feedbacks but expected 3", len(results.Support))
+	}
+
+	// what anyone exports of the votes
+	exports := []string{get(downloadVotesHandler(formatCSV), "/downvotes"), get(downloadVotesHandler(formatJSON), "/downjson"),
+		get(downloadVotesHandler(formatNDJSON), "/downndjson"), get(apiVotesHandler, "/api/votes")}
+	votes, _, err := getRawVotes(currentROTI)
+	if err != nil || len(votes) != 3 {
+		t.Fatalf("Got votes %v (%v)", votes, err)
+	}
+
+	// nothing tying a vote to its feedback appears on both sides
+	for _, vote := range votes {
+		if vote.Feedback != "" {
+			t.Errorf("Got feedback %q in the raw votes", vote.Feedback)
+		}
+		if strings.Contains(public, vote.ID.String()) {
+			t.Errorf("Vote ID %s of the exports appears in the results", vote.ID)
+		}
+		if vote.Timestamp == nil || strings.Contains(public, vote.Timestamp.Format(time.RFC3339)) {
+			t.Errorf("Timestamp %v of the exports appears in the results", vote.Timestamp)
+		}
+	}
+	for _, feedback := range results.Support {
+		for _, export := range exports {
+			if strings.Contains(export, feedback.ID.String()) {
+				t.Errorf("Feedback ID %s of the results appears in the exports", feedback.ID)
+			}
+		}
+	}
+}
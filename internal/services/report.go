@@ -0,0 +1,435 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/pdf"
+	"github.com/rs/zerolog/log"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// reportMargin surrounds the content of the pages, in points
+	reportMargin = 50
+	// reportFooter is kept free at the bottom of the pages for their number
+	reportFooter = 20
+	// reportQRSize is the width and height of the QR code of a ROTI
+	reportQRSize = 90
+	// reportChartHeight is the height of the bars of the histogram
+	reportChartHeight = 110
+	// maxReportROTIs limits the number of ROTIs printed in a report of a date
+	// range or a series. Later ones are left out, which the cover page tells
+	maxReportROTIs = 100
+	// dateLayout is the format of the dates of the report and of its query parameters
+	dateLayout = "2006-01-02"
+)
+
+var (
+	ErrInvalidDateRange = errors.New("invalid date range, expected from and to as YYYY-MM-DD")
+
+	reportAccent = color.RGBA{200, 100, 0, 255}
+	reportGray   = color.RGBA{110, 110, 110, 255}
+	reportLight  = color.RGBA{220, 220, 220, 255}
+)
+
+// reportROTI is a ROTI as printed in a report
+type reportROTI struct {
+	results   existingROTI
+	createdAt time.Time
+}
+
+// reportWriter lays out the report from top to bottom, starting a new page
+// when the current one is full
+type reportWriter struct {
+	document *pdf.Document
+	font     *pdf.Font
+	page     *pdf.Page
+	y        float64
+}
+
+func (rw *reportWriter) newPage() {
+	rw.page = rw.document.AddPage()
+	rw.y = reportMargin
+}
+
+// reserve starts a new page unless height points are left on the current one
+func (rw *reportWriter) reserve(height float64) {
+	if rw.page == nil || rw.y+height > rw.document.Height-reportMargin-reportFooter {
+		rw.newPage()
+	}
+}
+
+// paragraph writes a wrapped text from x to the right margin
+func (rw *reportWriter) paragraph(x, size float64, col color.Color, text string) {
+	lineHeight := size * 1.4
+	for _, line := range rw.font.Wrap(rw.font.Printable(text), size, rw.document.Width-reportMargin-x) {
+		rw.reserve(lineHeight)
+		rw.y += lineHeight
+		rw.page.Text(x, rw.y-size*0.3, size, col, line)
+	}
+}
+
+// bullet writes a wrapped list item, with a hanging indent
+func (rw *reportWriter) bullet(x, size float64, col color.Color, text string) {
+	rw.reserve(size * 1.4)
+	rw.page.Text(x, rw.y+size*1.1, size, reportAccent, "•")
+	rw.paragraph(x+12, size, col, text)
+}
+
+func (rw *reportWriter) heading(text string) {
+	rw.reserve(60)
+	rw.y += 12
+	rw.paragraph(reportMargin, 15, reportAccent, text)
+	rw.page.Line(reportMargin, rw.y+3, rw.document.Width-reportMargin, rw.y+3, 0.5, reportLight)
+	rw.y += 8
+}
+
+func (rw *reportWriter) space(height float64) {
+	rw.y += height
+}
+
+// drawQRCode draws the QR code leading to the ROTI as vector rectangles, one
+// per run of dark modules, so that it stays sharp when printed
+func drawQRCode(page *pdf.Page, x, y, size float64, url string) {
+	code, err := qrcode.New(url, qrcode.Medium)
+	if err != nil {
+		log.Warn().Msgf("%s: %s", ErrQRCodeGeneration, err)
+		return
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+	module := size / float64(len(bitmap))
+	for row, modules := range bitmap {
+		for start := 0; start < len(modules); start++ {
+			if !modules[start] {
+				continue
+			}
+			end := start
+			for end < len(modules) && modules[end] {
+				end++
+			}
+			page.Rect(x+float64(start)*module, y+float64(row)*module, float64(end-start)*module, module, color.Black)
+			start = end
+		}
+	}
+}
+
+// drawHistogram draws one bar per vote value, with its number of votes above
+func (rw *reportWriter) drawHistogram(bars []distributionBar) {
+	maxCount := 0
+	for _, bar := range bars {
+		maxCount = max(maxCount, bar.Count)
+	}
+	if maxCount == 0 {
+		return
+	}
+
+	rw.reserve(reportChartHeight + 40)
+	width := rw.document.Width - 2*reportMargin
+	slot := min(width/float64(len(bars)), 60)
+	top := rw.y + 16
+	bottom := top + reportChartHeight
+	for i, bar := range bars {
+		x := reportMargin + float64(i)*slot
+		height := float64(bar.Count) / float64(maxCount) * reportChartHeight
+		rw.page.Rect(x+slot*0.15, bottom-height, slot*0.7, height, reportAccent)
+		count := strconv.Itoa(bar.Count)
+		rw.page.Text(x+(slot-rw.font.Width(count, 9))/2, bottom-height-4, 9, reportGray, count)
+		value := strconv.FormatFloat(bar.Value, 'f', -1, 64)
+		rw.page.Text(x+(slot-rw.font.Width(value, 10))/2, bottom+14, 10, color.Black, value)
+	}
+	rw.page.Line(reportMargin, bottom, reportMargin+slot*float64(len(bars)), bottom, 0.5, reportGray)
+	rw.y = bottom + 24
+}
+
+// writeROTI starts a new page with the header, the stats, the histogram and
+// the feedbacks of a ROTI
+func (rw *reportWriter) writeROTI(roti reportROTI, url string) {
+	results := roti.results
+	rw.newPage()
+
+	rotiURL := fmt.Sprintf("%s/roti/%d", url, results.Id)
+	qrX := rw.document.Width - reportMargin - reportQRSize
+	drawQRCode(rw.page, qrX, reportMargin, reportQRSize, rotiURL)
+
+	// the header stays left of the QR code
+	headerWidth := qrX - reportMargin - 20
+	rw.page.Text(reportMargin, rw.y+24, 24, reportAccent, fmt.Sprintf("ROTI %d", results.Id))
+	rw.y += 34
+	if results.Description != "" {
+		for _, line := range rw.font.Wrap(rw.font.Printable("Meeting: "+results.Description), 14, headerWidth) {
+			rw.y += 20
+			rw.page.Text(reportMargin, rw.y-4, 14, color.Black, line)
+		}
+	}
+	if !roti.createdAt.IsZero() {
+		rw.y += 16
+		rw.page.Text(reportMargin, rw.y-3, 11, reportGray, "Created on "+roti.createdAt.Format(dateLayout))
+	}
+	rw.y += 16
+	rw.page.Text(reportMargin, rw.y-3, 9, reportGray, rotiURL)
+	rw.y = max(rw.y, reportMargin+reportQRSize) + 10
+
+	rw.heading("Results")
+	votes := fmt.Sprintf("Number of votes: %d", results.NumVotes)
+	if results.LowSample {
+		votes += " (low sample, interpret with care)"
+	}
+	rw.paragraph(reportMargin, 12, color.Black, votes)
+	if results.NumVotes > 0 {
+		if results.DetailsHidden {
+			rw.paragraph(reportMargin, 12, color.Black, fmt.Sprintf("Average ROTI: %0.2f", results.Avg))
+			rw.paragraph(reportMargin, 10, reportGray, fmt.Sprintf("Details are hidden until %d people have voted", results.MinVotes))
+		} else {
+			rw.paragraph(reportMargin, 12, color.Black, fmt.Sprintf("Average ROTI: %0.2f | Min: %0.2f | Max: %0.2f", results.Avg, results.Min, results.Max))
+		}
+	}
+	if results.HasCI {
+		rw.paragraph(reportMargin, 12, color.Black, fmt.Sprintf("95%% confidence interval: %0.2f - %0.2f", results.CILow, results.CIHigh))
+	}
+	if len(results.Distribution) > 0 {
+		rw.drawHistogram(results.Distribution)
+	}
+
+	rw.heading("Feedback")
+	empty := true
+	supported := slices.Clone(results.Supported)
+	sortBySupport(supported)
+	for _, feedback := range supported {
+		empty = false
+		text := feedback.Text
+		if feedback.Upvotes > 0 {
+			text += fmt.Sprintf(" (+%d)", feedback.Upvotes)
+		}
+		rw.bullet(reportMargin, 11, color.Black, text)
+		if feedback.Reply != "" {
+			rw.paragraph(reportMargin+24, 10, reportGray, "Reply: "+feedback.Reply)
+		}
+		rw.space(4)
+	}
+	groups := slices.Clone(results.Groups)
+	for _, group := range results.FollowUps {
+		groups = append(groups, feedbackGroup{Prompt: "Follow-up: " + group.Prompt, Feedbacks: group.Feedbacks})
+	}
+	for _, group := range groups {
+		// free text feedbacks are already listed with their upvotes
+		if group.Prompt == defaultPrompt || len(group.Feedbacks) == 0 {
+			continue
+		}
+		empty = false
+		rw.reserve(50)
+		rw.space(6)
+		rw.paragraph(reportMargin, 12, reportAccent, group.Prompt)
+		for _, feedback := range group.Feedbacks {
+			rw.bullet(reportMargin, 11, color.Black, feedback)
+			rw.space(4)
+		}
+	}
+	if empty {
+		rw.paragraph(reportMargin, 11, reportGray, "No feedback")
+	}
+}
+
+// writeSummary writes the cover page of a report gathering several ROTIs,
+// with the notice when there's one
+func (rw *reportWriter) writeSummary(title, subtitle, notice string, rotis []reportROTI) {
+	rw.newPage()
+	rw.paragraph(reportMargin, 24, reportAccent, title)
+	if subtitle != "" {
+		rw.paragraph(reportMargin, 13, reportGray, subtitle)
+	}
+	if notice != "" {
+		rw.space(6)
+		rw.paragraph(reportMargin, 12, reportAccent, notice)
+	}
+
+	votes, sum := 0, 0.0
+	for _, roti := range rotis {
+		votes += roti.results.NumVotes
+		sum += roti.results.Avg * float64(roti.results.NumVotes)
+	}
+	rw.space(10)
+	rw.paragraph(reportMargin, 12, color.Black, fmt.Sprintf("ROTIs: %d | Votes: %d", len(rotis), votes))
+	if votes > 0 {
+		rw.paragraph(reportMargin, 12, color.Black, fmt.Sprintf("Average ROTI of all votes: %0.2f", sum/float64(votes)))
+	}
+
+	rw.heading("Summary")
+	columns := []float64{reportMargin, reportMargin + 55, reportMargin + 130, rw.document.Width - reportMargin - 100, rw.document.Width - reportMargin - 45}
+	row := func(col color.Color, cells ...string) {
+		rw.reserve(18)
+		rw.y += 18
+		for i, cell := range cells {
+			rw.page.Text(columns[i], rw.y-5, 10, col, cell)
+		}
+	}
+	row(reportGray, "ROTI", "Date", "Meeting", "Votes", "Average")
+	for _, roti := range rotis {
+		description := ""
+		if lines := rw.font.Wrap(rw.font.Printable(roti.results.Description), 10, columns[3]-columns[2]-15); len(lines) > 0 {
+			description = lines[0]
+			if len(lines) > 1 {
+				description += "…"
+			}
+		}
+		date, average := "", ""
+		if !roti.createdAt.IsZero() {
+			date = roti.createdAt.Format(dateLayout)
+		}
+		if roti.results.NumVotes > 0 {
+			average = fmt.Sprintf("%0.2f", roti.results.Avg)
+		}
+		row(color.Black, strconv.Itoa(roti.results.Id), date, description, strconv.Itoa(roti.results.NumVotes), average)
+		rw.page.Line(reportMargin, rw.y, rw.document.Width-reportMargin, rw.y, 0.3, reportLight)
+	}
+}
+
+// buildReport returns the PDF report of the given ROTIs, preceded by a cover
+// page with a summary table and the notice when summary is true
+func buildReport(title, subtitle, notice string, rotis []reportROTI, summary bool, url string) (*pdf.Document, error) {
+	_, font, err := loadLuciole()
+	if err != nil {
+		return nil, err
+	}
+
+	rw := reportWriter{document: pdf.New(font, pdf.A4Width, pdf.A4Height), font: font}
+	rw.document.Title = title
+	if summary {
+		rw.writeSummary(title, subtitle, notice, rotis)
+	}
+	for _, roti := range rotis {
+		rw.writeROTI(roti, url)
+	}
+
+	// pages are numbered once they are all laid out
+	for i, page := range rw.document.Pages {
+		number := fmt.Sprintf("Page %d / %d", i+1, len(rw.document.Pages))
+		page.Text(rw.document.Width-reportMargin-font.Width(number, 9), rw.document.Height-reportMargin+10, 9, reportGray, number)
+		page.Text(reportMargin, rw.document.Height-reportMargin+10, 9, reportGray, title)
+	}
+	return rw.document, nil
+}
+
+// getReportROTI returns what can be printed of a ROTI, or an error when its
+// results are hidden
+func getReportROTI(rotiID int) (reportROTI, error) {
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		return reportROTI{}, model.ErrNoROTIMatchingThisID
+	}
+
+	roti := reportROTI{results: collectResults(rotiID, currentROTI), createdAt: currentROTI.GetCreatedAt()}
+	if roti.results.ResultsHidden {
+		return reportROTI{}, ErrResultsHidden
+	}
+	return roti, nil
+}
+
+func writeReport(w http.ResponseWriter, title, subtitle, notice string, rotis []reportROTI, summary bool, filename string) {
+	document, err := buildReport(title, subtitle, notice, rotis, summary, currentConfig.GetURL())
+	if err != nil {
+		log.Error().Msgf("couldn't build report %s: %s", filename, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Type", "application/pdf")
+
+	if err := document.Write(w); err != nil {
+		log.Error().Msgf("couldn't write report %s: %s", filename, err.Error())
+	}
+}
+
+func downloadPDFHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	roti, err := getReportROTI(rotiID)
+	if errors.Is(err, ErrResultsHidden) {
+		log.Warn().Msgf("PDF export of ROTI %d refused: %s", rotiID, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	writeReport(w, fmt.Sprintf("ROTI %d", rotiID), "", "", []reportROTI{roti}, false, fmt.Sprintf("roti_%d.pdf", rotiID))
+}
+
+// parseDateRange reads the from and to query parameters, both days being included
+func parseDateRange(r *http.Request) (from, to time.Time, err error) {
+	from, err = time.Parse(dateLayout, r.URL.Query().Get("from"))
+	if err != nil {
+		return from, to, ErrInvalidDateRange
+	}
+	to, err = time.Parse(dateLayout, r.URL.Query().Get("to"))
+	if err != nil || to.Before(from) {
+		return from, to, ErrInvalidDateRange
+	}
+	return
+}
+
+// limitReportROTIs keeps the first maxReportROTIs ROTIs, and returns the notice
+// of the cover page telling how many were left out
+func limitReportROTIs(rotiIDs []model.ROTIID) ([]model.ROTIID, string) {
+	if len(rotiIDs) <= maxReportROTIs {
+		return rotiIDs, ""
+	}
+	return rotiIDs[:maxReportROTIs], fmt.Sprintf("This report is limited to the first %d ROTIs, %d later ones are left out",
+		maxReportROTIs, len(rotiIDs)-maxReportROTIs)
+}
+
+// downloadRangePDFHandler prints the sessions of a series (series parameter)
+// or the public ROTIs created in a date range (from and to parameters) in a
+// single report, starting with a summary. ROTIs whose results are hidden are
+// left out, and so are the ones after the first maxReportROTIs
+func downloadRangePDFHandler(w http.ResponseWriter, r *http.Request) {
+	var rotiIDs []model.ROTIID
+	var title, subtitle string
+
+	if series := r.URL.Query().Get("series"); series != "" {
+		rotiIDs = model.ListSeriesROTIs(series)
+		title = "ROTI series report"
+	} else {
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rotiIDs = model.ListROTIsCreatedBetween(from, to)
+		title = "ROTI report"
+		subtitle = fmt.Sprintf("From %s to %s", from.Format(dateLayout), to.Format(dateLayout))
+	}
+	rotiIDs, notice := limitReportROTIs(rotiIDs)
+
+	var rotis []reportROTI
+	for _, rotiID := range rotiIDs {
+		roti, err := getReportROTI(rotiID.Int())
+		if err != nil {
+			log.Warn().Msgf("ROTI %d left out of the PDF report: %s", rotiID, err)
+			continue
+		}
+		rotis = append(rotis, roti)
+	}
+	if len(rotis) == 0 {
+		http.Error(w, ErrNoROTISelected.Error(), http.StatusNotFound)
+		return
+	}
+	if subtitle == "" {
+		subtitle = rotis[0].results.Description
+	}
+
+	writeReport(w, title, subtitle, notice, rotis, true, "rotis.pdf")
+}
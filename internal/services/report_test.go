@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+// pageCount returns the number of pages of a PDF file, 0 if it isn't one
+func pageCount(content []byte) int {
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return 0
+	}
+	match := regexp.MustCompile(`/Type /Pages .* /Count (\d+)`).FindSubmatch(content)
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(string(match[1]))
+	return count
+}
+
+func TestDownloadPDFHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	firstID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "weekly", Feedback: true, MinVotes: 1}, 30)
+	first, err := model.GetROTI(firstID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough feedback to fill more than a page
+	for i := 0; i < 40; i++ {
+		if err := first.AddVoteToROTI(float64(i%5+1), strings.Repeat("a rather long feedback that needs wrapping ", 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	series := first.StartSeries()
+	blindID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "weekly", Blind: true, Series: series}, 30)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(blindID.Int()))
+	rr := httptest.NewRecorder()
+	downloadPDFHandler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(firstID.Int()))
+	rr = httptest.NewRecorder()
+	downloadPDFHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/pdf" {
+		t.Errorf("Got content type %s", contentType)
+	}
+	pages := pageCount(rr.Body.Bytes())
+	if pages < 2 {
+		t.Errorf("Got %d pages but expected the feedbacks to span several pages", pages)
+	}
+
+	// the blind session is left out of the series report, which gets a cover page
+	req = httptest.NewRequest("GET", "/downpdf?series="+series, nil)
+	rr = httptest.NewRecorder()
+	downloadRangePDFHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	if count := pageCount(rr.Body.Bytes()); count != pages+1 {
+		t.Errorf("Got %d pages but expected %d", count, pages+1)
+	}
+
+	testCases := []struct {
+		query    string
+		expected int
+	}{
+		{"/downpdf", http.StatusBadRequest},
+		{"/downpdf?from=2024-03-01", http.StatusBadRequest},
+		{"/downpdf?from=2024-03-01&to=2024-02-01", http.StatusBadRequest},
+		{"/downpdf?from=2000-01-01&to=2000-01-31", http.StatusNotFound},
+		{"/downpdf?series=unknown", http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			downloadRangePDFHandler(rr, httptest.NewRequest("GET", tc.query, nil))
+			if rr.Code != tc.expected {
+				t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expected)
+			}
+		})
+	}
+	// past the limit, the report prints the first ROTIs and tells how many are left out
+	long, err := model.GetROTI(model.CreateROTIWithOptions(model.ROTIOptions{Description: "daily"}, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	longSeries := long.StartSeries()
+	for i := 0; i < maxReportROTIs+1; i++ {
+		model.CreateROTIWithOptions(model.ROTIOptions{Description: "daily", Series: longSeries}, 30)
+	}
+	rotiIDs, notice := limitReportROTIs(model.ListSeriesROTIs(longSeries))
+	if len(rotiIDs) != maxReportROTIs || !strings.Contains(notice, "2 later ones are left out") {
+		t.Errorf("Got %d ROTIs and notice %q", len(rotiIDs), notice)
+	}
+	rr = httptest.NewRecorder()
+	downloadRangePDFHandler(rr, httptest.NewRequest("GET", "/downpdf?series="+longSeries, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	if count := pageCount(rr.Body.Bytes()); count <= maxReportROTIs {
+		t.Errorf("Got %d pages but expected a cover page and the first %d ROTIs", count, maxReportROTIs)
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// slackMaxClockSkew is how old a request can be, so that recorded requests
+	// can't be replayed later
+	slackMaxClockSkew = 5 * time.Minute
+	// slackMaxBodySize is more than enough for the payloads of button clicks
+	slackMaxBodySize = 1 << 16
+	// slackVoteAction prefixes the action IDs of the vote buttons
+	slackVoteAction = "roti_vote_"
+	slackUsage      = "Create a ROTI with `/roti create <description>`: everyone in the channel can then vote from 1 to 5 with the buttons, anonymously."
+)
+
+var (
+	ErrSlackSignature = errors.New("invalid Slack request signature")
+	ErrSlackTimestamp = errors.New("Slack request timestamp is too far from now")
+)
+
+// slackText is a text object of Block Kit
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackButton struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+}
+
+// slackBlock is a section, actions or context block of Block Kit
+type slackBlock struct {
+	Type     string     `json:"type"`
+	BlockID  string     `json:"block_id,omitempty"`
+	Text     *slackText `json:"text,omitempty"`
+	Elements []any      `json:"elements,omitempty"`
+}
+
+// slackMessage answers a command, or replaces a message through its response URL
+type slackMessage struct {
+	ResponseType    string       `json:"response_type,omitempty"`
+	ReplaceOriginal bool         `json:"replace_original,omitempty"`
+	Text            string       `json:"text"`
+	Blocks          []slackBlock `json:"blocks,omitempty"`
+}
+
+func ephemeralSlackMessage(text string) slackMessage {
+	return slackMessage{ResponseType: "ephemeral", Text: text}
+}
+
+// slackInteraction is the part of the payload of a button click that is used
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// slackEscape escapes the characters having a meaning in Slack messages
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// signSlackRequest returns the signature Slack sends along with a body
+func signSlackRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySlackRequest checks the signature and the age of a request, leaving
+// its body readable for the handler
+func verifySlackRequest(r *http.Request, secret string, now time.Time) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, slackMaxBodySize))
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSlackTimestamp
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > slackMaxClockSkew || skew < -slackMaxClockSkew {
+		return ErrSlackTimestamp
+	}
+	if !hmac.Equal([]byte(r.Header.Get("X-Slack-Signature")), []byte(signSlackRequest(secret, timestamp, body))) {
+		return ErrSlackSignature
+	}
+	return nil
+}
+
+// checkSlackRequest answers requests that don't come from Slack, and all of
+// them when no signing secret is configured
+func checkSlackRequest(w http.ResponseWriter, r *http.Request) bool {
+	secret := currentConfig.GetSlackSigningSecret()
+	if secret == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	if err := verifySlackRequest(r, secret, time.Now()); err != nil {
+		log.Warn().Msgf("Slack request to %s refused: %s", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// slackVoter identifies a Slack user on a ROTI, without telling who they
+// are nor linking their votes on different ROTIs
+func slackVoter(rotiID model.ROTIID, team, user string) string {
+	mac := hmac.New(sha256.New, []byte(currentConfig.GetSlackSigningSecret()))
+	fmt.Fprintf(mac, "%d:%s:%s", rotiID.Int(), team, user)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildSlackVoteMessage returns the message of a ROTI with its vote buttons
+// and its number of votes, or only the link to its results once closed
+func buildSlackVoteMessage(currentROTI model.ROTIEntity) slackMessage {
+	rotiID := currentROTI.GetID().Int()
+	url := fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), rotiID)
+	description := currentROTI.GetDescription()
+	if description == "" {
+		description = fmt.Sprintf("ROTI %d", rotiID)
+	}
+
+	message := slackMessage{Text: fmt.Sprintf("How much was %s worth your time?", description)}
+	message.Blocks = append(message.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn",
+		Text: fmt.Sprintf("*%s*\nHow much was this meeting worth your time? Votes are anonymous.", slackEscape(description))}})
+
+	votes := currentROTI.CountVotes()
+	status := votesCount(votes) + " so far"
+	if currentROTI.IsClosed() {
+		status = "This ROTI is closed, with " + votesCount(votes)
+	} else {
+		buttons := slackBlock{Type: "actions", BlockID: fmt.Sprintf("roti_%d", rotiID)}
+		for value := 1; value <= 5; value++ {
+			buttons.Elements = append(buttons.Elements, slackButton{
+				Type:     "button",
+				Text:     slackText{Type: "plain_text", Text: strconv.Itoa(value)},
+				ActionID: slackVoteAction + strconv.Itoa(value),
+				Value:    fmt.Sprintf("%d:%d", rotiID, value),
+			})
+		}
+		message.Blocks = append(message.Blocks, buttons)
+	}
+	message.Blocks = append(message.Blocks, slackBlock{Type: "context", Elements: []any{
+		slackText{Type: "mrkdwn", Text: fmt.Sprintf("%s · <%s|ROTI %d>", status, url, rotiID)},
+	}})
+	return message
+}
+
+// postSlackResponse sends a message to the response URL of a command or a click
+func postSlackResponse(responseURL string, message slackMessage) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		log.Error().Msgf("couldn't encode Slack message: %s", err.Error())
+		return
+	}
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Error().Msgf("couldn't post Slack message: %s", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		log.Error().Msgf("Slack answered %s to a message", resp.Status)
+	}
+}
+
+// slackCommandHandler implements the /roti slash command: "create <description>"
+// posts the voting message of a new ROTI in the channel
+func slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkSlackRequest(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subcommand, description, _ := strings.Cut(strings.TrimSpace(r.Form.Get("text")), " ")
+	description = strings.TrimSpace(description)
+	if !strings.EqualFold(subcommand, "create") || description == "" {
+		writeJSON(w, http.StatusOK, ephemeralSlackMessage(slackUsage))
+		return
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: description, OwnerToken: model.NewOwnerToken()}, currentConfig.CleanOverTime)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		log.Error().Msgf("ROTI %d created from Slack can't be found: %s", rotiID.Int(), err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	emitWebhookEvent(currentROTI, model.EventROTICreated)
+	log.Info().Msgf("ROTI %d created from Slack", rotiID.Int())
+
+	message := buildSlackVoteMessage(currentROTI)
+	message.ResponseType = "in_channel"
+	writeJSON(w, http.StatusOK, message)
+
+	// only the creator gets the link of the presenter mode, which can't be
+	// used to manage the ROTI
+	if responseURL := r.Form.Get("response_url"); responseURL != "" {
+		go postSlackResponse(responseURL, ephemeralSlackMessage(fmt.Sprintf(
+			"ROTI %d created. Show the results in the room with the presenter mode, keep this link for yourself: %s/present/%d?token=%s",
+			rotiID.Int(), currentConfig.GetURL(), rotiID.Int(), currentROTI.GetPresenterToken())))
+	}
+}
+
+// slackVote casts the vote of a Slack user, returning what to tell them
+func slackVote(interaction slackInteraction, value string) (currentROTI model.ROTIEntity, reply string, err error) {
+	strID, strVote, _ := strings.Cut(value, ":")
+	rotiID, err := strconv.Atoi(strID)
+	if err != nil {
+		return currentROTI, "", model.ErrInvalidROTIID
+	}
+	if currentROTI, err = model.GetROTI(model.ROTIID(rotiID)); err != nil {
+		return currentROTI, "", err
+	}
+	vote, err := model.CheckVote(strVote)
+	if err != nil {
+		return currentROTI, "", err
+	}
+
+	if currentROTI.IsClosed() {
+		return currentROTI, "This ROTI is closed, your vote wasn't counted.", nil
+	}
+	if currentROTI.NotOpenYet() {
+		return currentROTI, "Votes open when the meeting ends, your vote wasn't counted.", nil
+	}
+	// the voter is registered first so that double clicks can't count twice,
+	// and forgotten if the vote is refused
+	voter := slackVoter(currentROTI.GetID(), interaction.Team.ID, interaction.User.ID)
+	if !currentROTI.RegisterChatVoter(voter) {
+		return currentROTI, "You already voted for this ROTI.", nil
+	}
+	if err := castVote(currentROTI, model.Ballot{Value: vote}); err != nil {
+		currentROTI.ForgetChatVoter(voter)
+		return currentROTI, "", err
+	}
+	return currentROTI, fmt.Sprintf("Thanks! Your vote (%s) was counted anonymously.", strVote), nil
+}
+
+// slackInteractiveHandler receives the clicks on the vote buttons. The vote is
+// acknowledged at once, the message being updated with the new number of votes
+// through the response URL
+func slackInteractiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkSlackRequest(w, r) {
+		return
+	}
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &interaction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, action := range interaction.Actions {
+		if interaction.Type != "block_actions" || !strings.HasPrefix(action.ActionID, slackVoteAction) {
+			continue
+		}
+		currentROTI, reply, err := slackVote(interaction, action.Value)
+		if err != nil {
+			log.Warn().Msgf("vote from Slack refused: %s", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if interaction.ResponseURL != "" {
+			message := buildSlackVoteMessage(currentROTI)
+			message.ReplaceOriginal = true
+			go func() {
+				postSlackResponse(interaction.ResponseURL, message)
+				postSlackResponse(interaction.ResponseURL, ephemeralSlackMessage(reply))
+			}()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+const testSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signedSlackRequest replays a request the way Slack sends it, signed at the given time
+func signedSlackRequest(target string, form url.Values, secret string, at time.Time) *http.Request {
+	body := form.Encode()
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", signSlackRequest(secret, timestamp, []byte(body)))
+	return req
+}
+
+// slackResponses stands in for the response URLs of Slack
+type slackResponses chan slackMessage
+
+func (responses slackResponses) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var message slackMessage
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	responses <- message
+}
+
+func (responses slackResponses) next(t *testing.T) slackMessage {
+	t.Helper()
+	select {
+	case message := <-responses:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message posted to the response URL")
+	}
+	return slackMessage{}
+}
+
+func TestVerifySlackRequest(t *testing.T) {
+	now := time.Now()
+	form := url.Values{"text": {"create weekly"}}
+
+	testCases := []struct {
+		name        string
+		req         *http.Request
+		expectedErr error
+	}{
+		{"signed", signedSlackRequest("/slack/command", form, testSlackSecret, now), nil},
+		{"wrong secret", signedSlackRequest("/slack/command", form, "wrong", now), ErrSlackSignature},
+		{"replayed", signedSlackRequest("/slack/command", form, testSlackSecret, now.Add(-10*time.Minute)), ErrSlackTimestamp},
+	}
+	tampered := signedSlackRequest("/slack/command", form, testSlackSecret, now)
+	tampered.Body = http.NoBody
+	testCases = append(testCases, struct {
+		name        string
+		req         *http.Request
+		expectedErr error
+	}{"tampered", tampered, ErrSlackSignature})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := verifySlackRequest(tc.req, testSlackSecret, now); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Got %v but expected %v", err, tc.expectedErr)
+			}
+		})
+	}
+
+	// the body is still readable by the handler
+	req := signedSlackRequest("/slack/command", form, testSlackSecret, now)
+	if err := verifySlackRequest(req, testSlackSecret, now); err != nil {
+		t.Fatal(err)
+	}
+	if req.FormValue("text") != "create weekly" {
+		t.Errorf("Got text %q after verification", req.FormValue("text"))
+	}
+}
+
+func TestSlackHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(slackResponses, 4)
+	server := httptest.NewServer(responses)
+	defer server.Close()
+
+	// the endpoints don't exist until a signing secret is set
+	rr := httptest.NewRecorder()
+	slackCommandHandler(rr, signedSlackRequest("/slack/command", url.Values{}, testSlackSecret, time.Now()))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusNotFound)
+	}
+	currentConfig.SlackSigningSecret = testSlackSecret
+	defer func() { currentConfig.SlackSigningSecret = "" }()
+
+	rr = httptest.NewRecorder()
+	slackCommandHandler(rr, signedSlackRequest("/slack/command", url.Values{"text": {"create Weekly sync"}}, "wrong", time.Now()))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	slackCommandHandler(rr, signedSlackRequest("/slack/command", url.Values{"text": {"help"}}, testSlackSecret, time.Now()))
+	var message slackMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.ResponseType != "ephemeral" || message.Text != slackUsage {
+		t.Errorf("Got %+v but expected the usage", message)
+	}
+
+	// creating a ROTI posts its vote buttons in the channel
+	form := url.Values{"command": {"/roti"}, "text": {"create Weekly <sync>"}, "team_id": {"T0001"}, "user_id": {"U0001"},
+		"response_url": {server.URL + "/commands"}}
+	rr = httptest.NewRecorder()
+	slackCommandHandler(rr, signedSlackRequest("/slack/command", form, testSlackSecret, time.Now()))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.ResponseType != "in_channel" || len(message.Blocks) != 3 || len(message.Blocks[1].Elements) != 5 {
+		t.Fatalf("Got %+v", message)
+	}
+	if text := message.Blocks[0].Text.Text; !strings.Contains(text, "*Weekly &lt;sync&gt;*") {
+		t.Errorf("Got %q, expected the escaped description", text)
+	}
+	rotiID, err := strconv.Atoi(strings.TrimPrefix(message.Blocks[1].BlockID, "roti_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the owner token never leaves GroROTI
+	if reply := responses.next(t); reply.ResponseType != "ephemeral" ||
+		!strings.Contains(reply.Text, "/present/"+strconv.Itoa(rotiID)+"?token="+created.GetPresenterToken()) || strings.Contains(reply.Text, created.GetOwnerToken()) {
+		t.Errorf("Got %+v, expected the presenter link for the creator", reply)
+	}
+
+	payload, err := os.ReadFile("testdata/slack_block_actions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	click := func(user string, vote int) *httptest.ResponseRecorder {
+		replayed := strings.NewReplacer("{{USER}}", user, "{{ROTI}}", strconv.Itoa(rotiID), "{{VOTE}}", strconv.Itoa(vote),
+			"{{RESPONSE_URL}}", server.URL+"/actions").Replace(string(payload))
+		rr := httptest.NewRecorder()
+		slackInteractiveHandler(rr, signedSlackRequest("/slack/interactive", url.Values{"payload": {replayed}}, testSlackSecret, time.Now()))
+		return rr
+	}
+
+	// a click casts a vote and updates the message with the number of votes
+	if rr := click("U0001", 4); rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	update := responses.next(t)
+	if !update.ReplaceOriginal || !strings.Contains(update.Blocks[2].Elements[0].(map[string]any)["text"].(string), "1 vote so far") {
+		t.Errorf("Got %+v, expected the message to show 1 vote", update)
+	}
+	if reply := responses.next(t); reply.ResponseType != "ephemeral" || !strings.Contains(reply.Text, "Thanks") {
+		t.Errorf("Got %+v", reply)
+	}
+
+	// the same user can't vote twice, another one can
+	click("U0001", 1)
+	responses.next(t)
+	if reply := responses.next(t); !strings.Contains(reply.Text, "already voted") {
+		t.Errorf("Got %+v", reply)
+	}
+	click("U0002", 2)
+	responses.next(t)
+	responses.next(t)
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes := currentROTI.CountVotes(); votes != 2 || currentROTI.GetMinVote() != 2 || currentROTI.GetMaxVote() != 4 {
+		t.Errorf("Got %d votes from %f to %f", votes, currentROTI.GetMinVote(), currentROTI.GetMaxVote())
+	}
+
+	// closed ROTIs lose their buttons
+	currentROTI.Close()
+	click("U0003", 5)
+	if update := responses.next(t); len(update.Blocks) != 2 {
+		t.Errorf("Got %+v, expected no button once closed", update)
+	}
+	if reply := responses.next(t); !strings.Contains(reply.Text, "closed") {
+		t.Errorf("Got %+v", reply)
+	}
+
+	if rr := click("U0004", 9); rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
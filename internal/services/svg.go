@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/goki/freetype/truetype"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func svgColor(col color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B)
+}
+
+func svgNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// svgRound writes coordinates with at most 2 decimals
+func svgRound(value float64) string {
+	return svgNumber(math.Round(value*100) / 100)
+}
+
+// glyphPath returns the outline of a glyph as SVG path data, in font units
+// with the Y axis going up
+func glyphPath(myFont *truetype.Font, index truetype.Index) (string, error) {
+	var glyph truetype.GlyphBuf
+	if err := glyph.Load(myFont, fixed.Int26_6(myFont.FUnitsPerEm()), index, font.HintingNone); err != nil {
+		return "", err
+	}
+
+	var path strings.Builder
+	start := 0
+	for _, end := range glyph.Ends {
+		writeContour(&path, glyph.Points[start:end])
+		start = end
+	}
+	return path.String(), nil
+}
+
+// writeContour converts a TrueType contour, made of quadratic curves whose
+// consecutive off-curve points imply an on-curve point in their middle
+func writeContour(path *strings.Builder, points []truetype.Point) {
+	if len(points) == 0 {
+		return
+	}
+	onCurve := func(p truetype.Point) bool { return p.Flags&1 != 0 }
+	type point struct{ x, y int }
+	at := func(i int) truetype.Point { return points[(i+len(points))%len(points)] }
+	mid := func(a, b truetype.Point) point {
+		return point{(int(a.X) + int(b.X)) / 2, (int(a.Y) + int(b.Y)) / 2}
+	}
+
+	// the contour starts on an on-curve point, or between two off-curve ones
+	first, offset := point{int(points[0].X), int(points[0].Y)}, 0
+	if !onCurve(points[0]) {
+		if onCurve(at(-1)) {
+			first, offset = point{int(at(-1).X), int(at(-1).Y)}, -1
+		} else {
+			first = mid(at(-1), points[0])
+			offset = -1
+		}
+	}
+	fmt.Fprintf(path, "M%d %d", first.x, first.y)
+
+	for i := offset + 1; i <= offset+len(points); i++ {
+		p := at(i)
+		if onCurve(p) {
+			fmt.Fprintf(path, "L%d %d", int(p.X), int(p.Y))
+			continue
+		}
+		next := at(i + 1)
+		if onCurve(next) {
+			fmt.Fprintf(path, "Q%d %d %d %d", int(p.X), int(p.Y), int(next.X), int(next.Y))
+			i++
+		} else {
+			end := mid(p, next)
+			fmt.Fprintf(path, "Q%d %d %d %d", int(p.X), int(p.Y), end.x, end.y)
+		}
+	}
+	path.WriteString("Z")
+}
+
+// writeSVGTexts writes the texts as outlined glyphs, so that they look the same
+// everywhere without embedding the font. Each glyph is defined once and used
+// wherever it's needed
+func writeSVGTexts(svg *bytes.Buffer, texts []cardText, myFont *truetype.Font) error {
+	upem := float64(myFont.FUnitsPerEm())
+	glyphs := make(map[truetype.Index]bool)
+	var uses bytes.Buffer
+	for _, text := range texts {
+		fmt.Fprintf(&uses, `<g fill="%s" aria-label="%s" transform="translate(%s %s) scale(%s %s)">`,
+			svgColor(text.Color), html.EscapeString(text.Text), svgRound(text.X), svgRound(text.Y), svgNumber(text.Size/upem), svgNumber(-text.Size/upem))
+		x := 0
+		for _, r := range text.Text {
+			index := myFont.Index(r)
+			glyphs[index] = true
+			fmt.Fprintf(&uses, `<use href="#g%d" x="%d"/>`, index, x)
+			x += int(myFont.HMetric(fixed.Int26_6(upem), index).AdvanceWidth)
+		}
+		uses.WriteString("</g>\n")
+	}
+
+	indexes := make([]truetype.Index, 0, len(glyphs))
+	for index := range glyphs {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	svg.WriteString("<defs>\n")
+	for _, index := range indexes {
+		path, err := glyphPath(myFont, index)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(svg, `<path id="g%d" d="%s"/>`+"\n", index, path)
+	}
+	svg.WriteString("</defs>\n")
+	_, err := uses.WriteTo(svg)
+	return err
+}
+
+// exportAsSVG draws the results card of a ROTI as a vector image, laid out
+// like the PNG one
+func exportAsSVG(roti existingROTI, options cardOptions) ([]byte, error) {
+	myFont, metrics, err := loadLuciole()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := layoutCard(roti, options, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`+"\n",
+		layout.Width, layout.Height, layout.Width, layout.Height)
+	fmt.Fprintf(&svg, "<title>ROTI %d</title>\n", roti.Id)
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(layout.Background))
+	for _, rect := range layout.Rects {
+		fmt.Fprintf(&svg, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			svgRound(rect.X), svgRound(rect.Y), svgRound(rect.Width), svgRound(rect.Height), svgColor(rect.Color))
+	}
+	if err := writeSVGTexts(&svg, layout.Texts, myFont); err != nil {
+		return nil, err
+	}
+	svg.WriteString("</svg>\n")
+	return svg.Bytes(), nil
+}
+
+func downloadSVGHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	// protects from IDs that match no existing ROTI
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	template := collectResults(rotiID, currentROTI)
+	if template.ResultsHidden {
+		log.Warn().Msgf("SVG export of ROTI %d refused: %s", rotiID, ErrResultsHidden)
+		http.Error(w, ErrResultsHidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	options, err := parseCardOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	svg, err := exportAsSVG(template, options)
+	if err != nil {
+		log.Error().Msgf("couldn't draw SVG of ROTI %d: %s", rotiID, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=roti_%d.svg", rotiID))
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if _, err := w.Write(svg); err != nil {
+		log.Error().Msgf("couldn't write SVG of ROTI %d: %s", rotiID, err.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of testdata/")
+
+// checkGolden compares the content with testdata/name, or overwrites the file
+// when tests run with -update
+func checkGolden(t *testing.T, name string, content []byte) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, expected) {
+		t.Errorf("%s doesn't match the golden file, run the tests with -update if the change is expected", name)
+	}
+}
+
+// checkWellFormed fails if the content isn't valid XML
+func checkWellFormed(t *testing.T, content []byte) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("SVG is not well-formed: %s", err)
+		}
+	}
+}
+
+func TestExportAsSVG(t *testing.T) {
+	testCases := []struct {
+		golden  string
+		options cardOptions
+	}{
+		{"card_light_default.svg", cardOptions{Theme: "light", Size: "default"}},
+		{"card_dark_social.svg", cardOptions{Theme: "dark", Size: "social", Feedback: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			svg, err := exportAsSVG(testCardROTI("weekly <sync> & demo", 3), tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkWellFormed(t, svg)
+			checkGolden(t, tc.golden, svg)
+		})
+	}
+}
+
+func TestSVGHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "vector", MinVotes: 1}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currentROTI.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+	blindID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "blind", Blind: true}, 30)
+
+	testCases := []struct {
+		name           string
+		handlerfunc    http.HandlerFunc
+		pathValue      string
+		value          string
+		query          string
+		expectedStatus int
+	}{
+		{"Card", downloadSVGHandler, "rotiid", strconv.Itoa(rotiID.Int()), "?theme=dark&size=slide", http.StatusOK},
+		{"Card with unknown size", downloadSVGHandler, "rotiid", strconv.Itoa(rotiID.Int()), "?size=poster", http.StatusBadRequest},
+		{"Card of blind ROTI", downloadSVGHandler, "rotiid", strconv.Itoa(blindID.Int()), "", http.StatusForbidden},
+		{"QR code", qrCodeHandler, "name", strconv.Itoa(rotiID.Int()) + ".svg", "?theme=dark", http.StatusOK},
+		{"QR code with unknown theme", qrCodeHandler, "name", strconv.Itoa(rotiID.Int()) + ".svg", "?theme=pink", http.StatusBadRequest},
+		{"QR code of unknown ROTI", qrCodeHandler, "name", "123.svg", "", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tc.query, nil)
+			req.SetPathValue(tc.pathValue, tc.value)
+			rr := httptest.NewRecorder()
+			tc.handlerfunc(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus == http.StatusOK {
+				if contentType := rr.Header().Get("Content-Type"); contentType != "image/svg+xml" {
+					t.Errorf("Got content type %s", contentType)
+				}
+				if !strings.HasPrefix(rr.Body.String(), "<svg") {
+					t.Errorf("Not an SVG image: %s", rr.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+// upvotedCookie lists the feedbacks of a ROTI the user already upvoted
+func upvotedCookie(rotiID int) string {
+	return "upvoted_roti_" + strconv.Itoa(rotiID)
+}
+
+// listUpvoted returns the IDs of the feedbacks the user upvoted
+func listUpvoted(r *http.Request, rotiID int) (feedbackIDs []model.FeedbackID) {
+	cookie, err := r.Cookie(upvotedCookie(rotiID))
+	if err != nil {
+		return nil
+	}
+	for _, feedbackID := range strings.Split(cookie.Value, ".") {
+		if feedbackID != "" {
+			feedbackIDs = append(feedbackIDs, model.FeedbackID(feedbackID))
+		}
+	}
+	return
+}
+
+// setUpvotedCookie protects from duplicate upvotes the same way as votes
+func setUpvotedCookie(w http.ResponseWriter, rotiID int, feedbackIDs []model.FeedbackID) {
+	values := make([]string, len(feedbackIDs))
+	for i, feedbackID := range feedbackIDs {
+		values[i] = string(feedbackID)
+	}
+	cookie := http.Cookie{
+		Name:     upvotedCookie(rotiID),
+		Value:    strings.Join(values, "."),
+		Path:     "/",
+		MaxAge:   7 * 24 * 60 * 60,
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// sortBySupport puts the most upvoted feedbacks first
+func sortBySupport(feedbacks []supportedFeedback) {
+	sort.SliceStable(feedbacks, func(i, j int) bool {
+		return feedbacks[i].Upvotes > feedbacks[j].Upvotes
+	})
+}
+
+func upvoteFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	if !currentROTI.ResultsVisible() {
+		http.Error(w, ErrResultsHidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	redirection := "/roti/" + strconv.Itoa(rotiID)
+	if r.FormValue("sort") == "support" {
+		redirection += "?sort=support"
+	}
+
+	feedbackID := model.FeedbackID(r.PathValue("feedbackid"))
+	upvoted := listUpvoted(r, rotiID)
+	if slices.Contains(upvoted, feedbackID) {
+		log.Warn().Msgf("User has already upvoted feedback %s of ROTI %d", feedbackID, rotiID)
+		http.Redirect(w, r, redirection, http.StatusSeeOther)
+		return
+	}
+
+	err = currentROTI.Upvote(feedbackID)
+	if errors.Is(err, model.ErrNoVoteMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Warn().Msgf(err.Error())
+		http.Redirect(w, r, redirection, http.StatusSeeOther)
+		return
+	}
+
+	setUpvotedCookie(w, rotiID, append(upvoted, feedbackID))
+
+	http.Redirect(w, r, redirection, http.StatusSeeOther)
+}
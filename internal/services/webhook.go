@@ -0,0 +1,456 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/staticEmbed"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webhookSignatureHeader holds the HMAC-SHA256 of the body, keyed with the
+	// secret of the webhook and written as sha256=<hex>
+	webhookSignatureHeader = "X-GroROTI-Signature"
+	webhookEventHeader     = "X-GroROTI-Event"
+	webhookDeliveryHeader  = "X-GroROTI-Delivery"
+
+	webhookTimeout = 10 * time.Second
+	// webhookFirstRetry is doubled after each failed attempt, up to
+	// webhookMaxAttempts attempts (about 1 hour in total)
+	webhookFirstRetry   = 30 * time.Second
+	webhookMaxAttempts  = 8
+	webhookPollInterval = 5 * time.Second
+	// recentDeliveries is the number of deliveries shown to admins
+	recentDeliveries = 50
+	// adminCookieName holds the session given for the admin token
+	adminCookieName      = "groroti_admin"
+	adminSessionDuration = 12 * time.Hour
+)
+
+var (
+	ErrPrivateWebhookAddress = errors.New("webhooks of ROTIs can't call private addresses")
+	ErrNotAdmin              = errors.New("a valid admin token is needed")
+)
+
+// webhookROTI is the state of the ROTI when the event happened. The average is
+// left out while results are hidden, and votes are never sent one by one
+type webhookROTI struct {
+	ID            int      `json:"id"`
+	Description   string   `json:"description"`
+	URL           string   `json:"url"`
+	NumVotes      int      `json:"num_votes"`
+	Avg           *float64 `json:"average,omitempty"`
+	ResultsHidden bool     `json:"results_hidden"`
+	Closed        bool     `json:"closed"`
+}
+
+// webhookPayload is the JSON body posted to the webhooks
+type webhookPayload struct {
+	ID        string             `json:"id"`
+	Event     model.WebhookEvent `json:"event"`
+	CreatedAt time.Time          `json:"created_at"`
+	ROTI      webhookROTI        `json:"roti"`
+}
+
+func newWebhookPayload(event model.WebhookEvent, roti existingROTI, closed bool) webhookPayload {
+	payload := webhookPayload{
+		ID:        uuid.NewString(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		ROTI: webhookROTI{
+			ID:            roti.Id,
+			Description:   roti.Description,
+			URL:           fmt.Sprintf("%s/roti/%d", currentConfig.GetURL(), roti.Id),
+			NumVotes:      roti.NumVotes,
+			ResultsHidden: roti.ResultsHidden,
+			Closed:        closed,
+		},
+	}
+	if !roti.ResultsHidden && roti.NumVotes > 0 {
+		payload.ROTI.Avg = &roti.Avg
+	}
+	return payload
+}
+
+// webhookWake tells the worker that deliveries were queued, so that they're
+// sent without waiting for the next poll
+var webhookWake = make(chan struct{}, 1)
+
+// emitWebhookEvent queues the event for every webhook subscribing to it. The
+// roti.votes_reached event only goes to the webhooks waiting for this number of votes
+func emitWebhookEvent(currentROTI model.ROTIEntity, event model.WebhookEvent) {
+	hooks := model.ListSubscribedWebhooks(currentROTI.GetID(), event)
+	if len(hooks) == 0 {
+		return
+	}
+	roti := collectResults(currentROTI.GetID().Int(), currentROTI)
+	body, err := json.Marshal(newWebhookPayload(event, roti, currentROTI.IsClosed()))
+	if err != nil {
+		log.Error().Msgf("couldn't encode %s event of ROTI %d: %s", event, roti.Id, err.Error())
+		return
+	}
+
+	queued := 0
+	for _, hook := range hooks {
+		if event == model.EventVotesReached && hook.Votes != roti.NumVotes {
+			continue
+		}
+		model.QueueDelivery(hook, event, body)
+		queued++
+	}
+	if queued == 0 {
+		return
+	}
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// refusePrivateAddresses stops connections to loopback, private, link-local
+// and unspecified addresses, checked once the name of the host is resolved
+func refusePrivateAddresses(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrPrivateWebhookAddress
+	}
+	return nil
+}
+
+func newWebhookClient(dialer *net.Dialer) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		// a redirection is an answer like any other, that isn't a success
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+var (
+	webhookClient       = newWebhookClient(&net.Dialer{Timeout: webhookTimeout})
+	publicWebhookClient = newWebhookClient(&net.Dialer{Timeout: webhookTimeout, Control: refusePrivateAddresses})
+)
+
+// signWebhookPayload returns the value of the signature header of a body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendDelivery posts the payload of a delivery, returning the status of the
+// answer. Only 2xx answers are successes
+func sendDelivery(delivery model.Delivery) (int, error) {
+	client := publicWebhookClient
+	// global webhooks are set by admins, who may want to call internal services
+	if delivery.Webhook.ROTIID == model.GlobalWebhooks || currentConfig.WebhooksAllowPrivate {
+		client = webhookClient
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GroROTI-Webhook/"+Version)
+	req.Header.Set(webhookEventHeader, string(delivery.Event))
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(delivery.Webhook.Secret, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// the answer is read a bit so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookRetryDelay returns how long to wait after the given number of failed attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	return webhookFirstRetry << (attempts - 1)
+}
+
+// deliverDueWebhooks sends the deliveries whose attempt is due, and plans the
+// next attempt of the ones that fail
+func deliverDueWebhooks(now time.Time) {
+	for _, delivery := range model.ListDueDeliveries(now) {
+		httpStatus, err := sendDelivery(delivery)
+		if err == nil {
+			model.RecordAttempt(delivery.ID, model.DeliveryDelivered, httpStatus, "", time.Time{})
+			log.Info().Msgf("webhook delivery %s (%s) sent to %s", delivery.ID, delivery.Event, delivery.Webhook.URL)
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		if attempts >= webhookMaxAttempts {
+			model.RecordAttempt(delivery.ID, model.DeliveryFailed, httpStatus, err.Error(), time.Time{})
+			log.Error().Msgf("webhook delivery %s to %s failed for good: %s", delivery.ID, delivery.Webhook.URL, err.Error())
+			continue
+		}
+		model.RecordAttempt(delivery.ID, model.DeliveryPending, httpStatus, err.Error(), now.Add(webhookRetryDelay(attempts)))
+		log.Warn().Msgf("webhook delivery %s to %s failed, attempt %d: %s", delivery.ID, delivery.Webhook.URL, attempts, err.Error())
+	}
+}
+
+// notifyClosedROTI tells the webhooks, the chat and the results email that
+// the ROTI is closed. Each closing is told once, whether the owner closed the
+// ROTI or its closing date passed
+func notifyClosedROTI(currentROTI model.ROTIEntity) {
+	if !currentROTI.IsClosed() || !currentROTI.ClaimCloseNotification() {
+		return
+	}
+	emitWebhookEvent(currentROTI, model.EventROTIClosed)
+	postChatSummaryOnClose(currentROTI)
+	wakeEmailWorker()
+}
+
+// notifyClosedROTIs notifies the ROTIs whose closing date passed
+func notifyClosedROTIs() {
+	for _, rotiID := range model.ListROTIsClosing() {
+		if currentROTI, err := model.GetROTI(rotiID); err == nil {
+			notifyClosedROTI(currentROTI)
+		}
+	}
+}
+
+// startWebhookWorker launches the goroutine notifying the ROTIs whose closing
+// date passed and sending the queued deliveries. The queue is kept in the
+// database, so deliveries survive restarts
+func startWebhookWorker() {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		for {
+			notifyClosedROTIs()
+			deliverDueWebhooks(time.Now())
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+		}
+	}()
+}
+
+// parseWebhookForm reads the webhook of the creation forms
+func parseWebhookForm(r *http.Request, rotiID model.ROTIID) (hook model.Webhook, err error) {
+	if err := r.ParseForm(); err != nil {
+		return hook, err
+	}
+	hook = model.Webhook{ROTIID: rotiID, URL: r.Form.Get("url"), Secret: r.Form.Get("secret")}
+	for _, value := range r.Form["events"] {
+		event, err := model.CheckWebhookEvent(value)
+		if err != nil {
+			return hook, fmt.Errorf("%w %s", err, value)
+		}
+		hook.Events = append(hook.Events, event)
+	}
+	if votes := r.Form.Get("votes"); votes != "" && hook.Subscribes(model.EventVotesReached) {
+		if hook.Votes, err = strconv.Atoi(votes); err != nil {
+			return hook, model.ErrInvalidWebhookVotes
+		}
+	}
+	return hook, nil
+}
+
+func addWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "new webhook")
+	if !ok {
+		return
+	}
+
+	hook, err := parseWebhookForm(r, currentROTI.GetID())
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+	if _, err := model.AddWebhook(hook); err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	currentROTI, ok := getOwnedROTI(w, r, "deletion of webhook")
+	if !ok {
+		return
+	}
+
+	err := model.DeleteWebhook(currentROTI.GetID(), r.PathValue("webhookid"))
+	if errors.Is(err, model.ErrNoWebhookMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, "/roti/"+strconv.Itoa(currentROTI.GetID().Int()), http.StatusSeeOther)
+}
+
+// adminEnabled tells if admin pages exist: they need an admin token or admin
+// groups of logged in users
+func adminEnabled() bool {
+	_, _, adminGroups := currentConfig.GetOIDCRestrictions()
+	return currentConfig.GetAdminToken() != "" || (currentConfig.LoginEnabled() && len(adminGroups) > 0)
+}
+
+// isAdmin tells if the request comes from a user of the admin groups, carries
+// the admin cookie, or the admin token in the X-Admin-Token header or the body
+// of a POST. The token is never read from the URL, which ends up in logs
+func isAdmin(r *http.Request) bool {
+	if user, ok := currentUser(r); ok && user.Admin {
+		return true
+	}
+	if cookie, err := r.Cookie(adminCookieName); err == nil {
+		if user, err := model.GetSession(cookie.Value); err == nil && user.Admin {
+			return true
+		}
+	}
+	token := r.Header.Get("X-Admin-Token")
+	if token == "" && r.Method == http.MethodPost {
+		token = r.PostFormValue("token")
+	}
+	adminToken := currentConfig.GetAdminToken()
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// checkAdmin tells if the request comes from an admin, and answers it
+// otherwise. Admin pages don't exist when neither a token nor admin groups
+// are configured
+func checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !adminEnabled() {
+		http.NotFound(w, r)
+		return false
+	}
+	if !isAdmin(r) {
+		log.Warn().Msgf("admin access to %s refused", r.URL.Path)
+		http.Error(w, ErrNotAdmin.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// adminLoginHandler exchanges the admin token posted by the form of the admin
+// pages for an HttpOnly cookie
+func adminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    model.CreateSession(model.User{Name: "admin token", Admin: true}, adminSessionDuration),
+		Path:     "/",
+		MaxAge:   int(adminSessionDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(currentConfig.GetURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	adminRedirect(w, r)
+}
+
+// adminWebhooksHandler lists the global webhooks and the last deliveries of
+// every webhook. Visitors who aren't admins get the forms to become one
+func adminWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	templateFilePath := "templates/admin.html"
+	t, ok := staticEmbed.Templates[templateFilePath]
+	if !ok {
+		log.Error().Msgf("template %s not found", templateFilePath)
+		return
+	}
+
+	var template struct {
+		Admin      bool
+		TokenLogin bool
+		Login      bool
+		Events     []model.WebhookEvent
+		Webhooks   []model.Webhook
+		Deliveries []model.Delivery
+		Version    string
+	}
+	template.Admin = isAdmin(r)
+	if template.Admin {
+		template.Events = model.WebhookEvents
+		template.Webhooks = model.ListWebhooks(model.GlobalWebhooks)
+		template.Deliveries = model.ListRecentDeliveries(recentDeliveries)
+	} else {
+		log.Warn().Msgf("admin access to %s refused", r.URL.Path)
+		template.TokenLogin = currentConfig.GetAdminToken() != ""
+		_, _, adminGroups := currentConfig.GetOIDCRestrictions()
+		template.Login = currentConfig.LoginEnabled() && len(adminGroups) > 0
+		w.WriteHeader(http.StatusForbidden)
+	}
+	template.Version = Version
+
+	if err := t.Execute(w, template); err != nil {
+		log.Error().Err(ErrTemplateExecute)
+	}
+}
+
+func adminRedirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func addGlobalWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	hook, err := parseWebhookForm(r, model.GlobalWebhooks)
+	if err == nil {
+		_, err = model.AddWebhook(hook)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adminRedirect(w, r)
+}
+
+func deleteGlobalWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	err := model.DeleteWebhook(model.GlobalWebhooks, r.PathValue("webhookid"))
+	if errors.Is(err, model.ErrNoWebhookMatchingThisID) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	adminRedirect(w, r)
+}
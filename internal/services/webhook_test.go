@@ -0,0 +1,328 @@
+package services
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+// webhookReceiver records the events it receives, failing the first ones
+type webhookReceiver struct {
+	sync.Mutex
+	failures int
+	events   []webhookPayload
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (receiver *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	receiver.Lock()
+	defer receiver.Unlock()
+	if receiver.failures > 0 {
+		receiver.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	receiver.events = append(receiver.events, payload)
+	receiver.headers = append(receiver.headers, r.Header)
+	receiver.bodies = append(receiver.bodies, body)
+}
+
+func TestRefusePrivateAddresses(t *testing.T) {
+	testCases := []struct {
+		address     string
+		expectedErr error
+	}{
+		{"93.184.215.14:443", nil},
+		{"[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", nil},
+		{"127.0.0.1:80", ErrPrivateWebhookAddress},
+		{"10.1.2.3:80", ErrPrivateWebhookAddress},
+		{"192.168.1.1:80", ErrPrivateWebhookAddress},
+		{"169.254.169.254:80", ErrPrivateWebhookAddress},
+		{"[::1]:80", ErrPrivateWebhookAddress},
+		{"0.0.0.0:80", ErrPrivateWebhookAddress},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.address, func(t *testing.T) {
+			if err := refusePrivateAddresses("tcp", tc.address, syscall.RawConn(nil)); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Got %v but expected %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	receiver := &webhookReceiver{failures: 1}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "webhooks", Blind: true}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := model.AddWebhook(model.Webhook{ROTIID: rotiID, URL: server.URL, Votes: 1,
+		Events: []model.WebhookEvent{model.EventVoteAdded, model.EventVotesReached}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the receiver listens on a loopback address, refused for the webhooks of ROTIs
+	if err := currentROTI.AddVoteToROTI(4, ""); err != nil {
+		t.Fatal(err)
+	}
+	emitWebhookEvent(currentROTI, model.EventVotesReached)
+	now := time.Now()
+	deliverDueWebhooks(now)
+	deliveries := model.ListRecentDeliveries(recentDeliveries)
+	if len(deliveries) == 0 || deliveries[0].Webhook.ID != hook.ID || !strings.Contains(deliveries[0].LastError, ErrPrivateWebhookAddress.Error()) {
+		t.Fatalf("Got %+v but expected the delivery to be refused", deliveries)
+	}
+
+	currentConfig.WebhooksAllowPrivate = true
+	defer func() { currentConfig.WebhooksAllowPrivate = false }()
+
+	// the receiver fails the first attempt, retried along with the refused delivery
+	emitWebhookEvent(currentROTI, model.EventVoteAdded)
+	now = time.Now()
+	deliverDueWebhooks(now)
+	if len(receiver.events) != 0 || receiver.failures != 0 {
+		t.Fatalf("Got %d events but expected the first attempt to fail", len(receiver.events))
+	}
+	deliverDueWebhooks(now.Add(webhookRetryDelay(1)))
+	if len(receiver.events) != 2 {
+		t.Fatalf("Got %d events but expected 2", len(receiver.events))
+	}
+
+	for i, payload := range receiver.events {
+		header := receiver.headers[i]
+		if !hmac.Equal([]byte(header.Get(webhookSignatureHeader)), []byte(signWebhookPayload(hook.Secret, receiver.bodies[i]))) {
+			t.Errorf("Got signature %q for %s", header.Get(webhookSignatureHeader), receiver.bodies[i])
+		}
+		if header.Get(webhookEventHeader) != string(payload.Event) || header.Get(webhookDeliveryHeader) == "" {
+			t.Errorf("Got headers %v for %s", header, receiver.bodies[i])
+		}
+		// blind ROTIs only tell their number of votes
+		if payload.ROTI.ID != rotiID.Int() || payload.ROTI.NumVotes != 1 || !payload.ROTI.ResultsHidden || payload.ROTI.Avg != nil {
+			t.Errorf("Got %+v", payload.ROTI)
+		}
+	}
+
+	for _, delivery := range model.ListRecentDeliveries(recentDeliveries) {
+		if delivery.Webhook.ID == hook.ID && (delivery.Status != model.DeliveryDelivered || delivery.Attempts != 2) {
+			t.Errorf("Got %+v but expected every delivery to be done", delivery)
+		}
+	}
+
+	// another vote doesn't reach the threshold again
+	if err := currentROTI.AddVoteToROTI(2, ""); err != nil {
+		t.Fatal(err)
+	}
+	emitWebhookEvent(currentROTI, model.EventVotesReached)
+	deliverDueWebhooks(time.Now())
+	if len(receiver.events) != 2 {
+		t.Errorf("Got %d events but expected no new one", len(receiver.events))
+	}
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	token := model.NewOwnerToken()
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "weekly", OwnerToken: token}, 30)
+	ownerCookie := &http.Cookie{Name: fmt.Sprintf("owner_roti_%d", rotiID.Int()), Value: token}
+
+	post := func(handler http.HandlerFunc, form string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	form := "url=https%3A%2F%2Fexample.com%2Fhook&events=vote.added&events=roti.votes_reached&votes=10"
+	if rr := post(addWebhookHandler, form, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if rr := post(addWebhookHandler, "url=https%3A%2F%2Fexample.com&events=roti.deleted", ownerCookie); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusNotAcceptable)
+	}
+	if rr := post(addWebhookHandler, form, ownerCookie); rr.Code != http.StatusSeeOther {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusSeeOther)
+	}
+	hooks := model.ListWebhooks(rotiID)
+	if len(hooks) != 1 || hooks[0].Votes != 10 || len(hooks[0].Events) != 2 {
+		t.Fatalf("Got %+v", hooks)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	req.SetPathValue("webhookid", hooks[0].ID)
+	req.AddCookie(ownerCookie)
+	rr := httptest.NewRecorder()
+	deleteWebhookHandler(rr, req)
+	if rr.Code != http.StatusSeeOther || len(model.ListWebhooks(rotiID)) != 0 {
+		t.Errorf("Got status %d and webhooks %+v", rr.Code, model.ListWebhooks(rotiID))
+	}
+
+	// admin pages only exist once a token is configured
+	testCases := []struct {
+		adminToken     string
+		token          string
+		expectedStatus int
+	}{
+		{"", "", http.StatusNotFound},
+		{"secret", "wrong", http.StatusForbidden},
+		{"secret", "secret", http.StatusOK},
+	}
+	defer func() { currentConfig.AdminToken = "" }()
+	for _, tc := range testCases {
+		currentConfig.AdminToken = tc.adminToken
+		req := httptest.NewRequest("GET", "/admin/webhooks", nil)
+		req.Header.Set("X-Admin-Token", tc.token)
+		rr := httptest.NewRecorder()
+		adminWebhooksHandler(rr, req)
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, tc.expectedStatus)
+		}
+	}
+
+	// the token is never read from the URL
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/webhooks?token=secret", nil)
+	adminWebhooksHandler(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `action="/admin/login"`) {
+		t.Errorf("Got status %d, expected the token of the URL to be refused:\n%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/admin/webhooks", strings.NewReader("token=secret&url=https%3A%2F%2Fexample.com%2Fall&events=roti.created"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addGlobalWebhookHandler(rr, req)
+	global := model.ListWebhooks(model.GlobalWebhooks)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/webhooks" || len(global) != 1 {
+		t.Fatalf("Got status %d, location %s and global webhooks %+v", rr.Code, rr.Header().Get("Location"), global)
+	}
+
+	// the token of the form is exchanged for a cookie
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/admin/login", strings.NewReader("token=wrong"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	adminLoginHandler(rr, req)
+	if rr.Code != http.StatusForbidden || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("Got status %d and cookies %v for a wrong token", rr.Code, rr.Result().Cookies())
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/admin/login", strings.NewReader("token=secret"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	adminLoginHandler(rr, req)
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/webhooks" || len(cookies) != 1 ||
+		cookies[0].Name != adminCookieName || !cookies[0].HttpOnly || cookies[0].Value == "secret" {
+		t.Fatalf("Got status %d, location %s and cookies %v", rr.Code, rr.Header().Get("Location"), cookies)
+	}
+	adminCookie := cookies[0]
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/webhooks", nil)
+	req.AddCookie(adminCookie)
+	adminWebhooksHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://example.com/all") || strings.Contains(rr.Body.String(), `name="token"`) {
+		t.Errorf("The global webhook isn't listed, or the token is asked for:\n%s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/admin/webhooks/"+global[0].ID, nil)
+	req.AddCookie(adminCookie)
+	req.SetPathValue("webhookid", global[0].ID)
+	deleteGlobalWebhookHandler(rr, req)
+	if rr.Code != http.StatusSeeOther || len(model.ListWebhooks(model.GlobalWebhooks)) != 0 {
+		t.Errorf("Got status %d, expected the global webhook to be deleted", rr.Code)
+	}
+}
+
+func TestCloseNotifications(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	rotiID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "deadline", OwnerToken: "owner-deadline"}, 30)
+	currentROTI, err := model.GetROTI(rotiID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := model.AddWebhook(model.Webhook{ROTIID: rotiID, URL: "https://example.com/hook",
+		Events: []model.WebhookEvent{model.EventROTIClosed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closings := func() (count int) {
+		for _, delivery := range model.ListRecentDeliveries(recentDeliveries) {
+			if delivery.Webhook.ID == hook.ID && delivery.Event == model.EventROTIClosed {
+				count++
+			}
+		}
+		return count
+	}
+
+	// nothing is told before the closing date
+	currentROTI.CloseAt(time.Now().Add(time.Hour))
+	notifyClosedROTIs()
+	if closings() != 0 {
+		t.Fatalf("Got %d closings but expected none before the closing date", closings())
+	}
+
+	// the worker tells the closing once its date passed, and only once
+	currentROTI.CloseAt(time.Now().Add(-time.Minute))
+	notifyClosedROTIs()
+	notifyClosedROTIs()
+	if closings() != 1 {
+		t.Fatalf("Got %d closings but expected 1 once the closing date passed", closings())
+	}
+
+	// closing it again by hand doesn't tell it again
+	req := httptest.NewRequest("POST", "/close/"+strconv.Itoa(rotiID.Int()), nil)
+	req.SetPathValue("rotiid", strconv.Itoa(rotiID.Int()))
+	req.AddCookie(&http.Cookie{Name: "owner_roti_" + strconv.Itoa(rotiID.Int()), Value: "owner-deadline"})
+	rr := httptest.NewRecorder()
+	closeROTIHandler(rr, req)
+	if rr.Code != http.StatusSeeOther || closings() != 1 {
+		t.Errorf("Got %d and %d closings but expected the closing to be told once", rr.Code, closings())
+	}
+}
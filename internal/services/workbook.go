@@ -0,0 +1,220 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deezer/groroti/internal/model"
+	"github.com/deezer/groroti/internal/xlsx"
+	"github.com/rs/zerolog/log"
+)
+
+// maxWorkbookROTIs limits the number of ROTIs exported in a single workbook
+const maxWorkbookROTIs = 50
+
+var (
+	ErrNoROTISelected = errors.New("no ROTI selected")
+	ErrTooManyROTIs   = fmt.Errorf("no more than %d ROTIs can be exported at once", maxWorkbookROTIs)
+)
+
+// workbookROTI gathers what is exported of a ROTI. Votes are nil when they
+// must stay hidden
+type workbookROTI struct {
+	results existingROTI
+	votes   []rawVote
+}
+
+// buildWorkbook returns a workbook with a summary sheet (stats and histogram),
+// a votes sheet and a feedback sheet, each listing all the given ROTIs
+func buildWorkbook(rotis []workbookROTI) *xlsx.Workbook {
+	var workbook xlsx.Workbook
+
+	summary := workbook.AddSheet("Summary", 10, 40, 10, 10, 10, 10, 12, 12, 12)
+	summary.AddRow(xlsx.Bold("ROTI ID"), xlsx.Bold("Description"), xlsx.Bold("Votes"), xlsx.Bold("Average"), xlsx.Bold("Min"),
+		xlsx.Bold("Max"), xlsx.Bold("95% CI Low"), xlsx.Bold("95% CI High"), xlsx.Bold("Low Sample"))
+	for _, roti := range rotis {
+		results := roti.results
+		row := []xlsx.Cell{xlsx.Number(float64(results.Id), xlsx.StyleInteger), xlsx.Text(results.Description),
+			xlsx.Number(float64(results.NumVotes), xlsx.StyleInteger), xlsx.Number(results.Avg, xlsx.StyleDecimal), {}, {}, {}, {}, {}}
+		if !results.DetailsHidden {
+			row[4], row[5] = xlsx.Number(results.Min, xlsx.StyleDecimal), xlsx.Number(results.Max, xlsx.StyleDecimal)
+		}
+		if results.HasCI {
+			row[6], row[7] = xlsx.Number(results.CILow, xlsx.StyleDecimal), xlsx.Number(results.CIHigh, xlsx.StyleDecimal)
+		}
+		if results.LowSample {
+			row[8] = xlsx.Text("yes")
+		}
+		summary.AddRow(row...)
+	}
+
+	// the histogram has one row per vote value, and a count and a share of
+	// the votes for each ROTI
+	summary.AddRow()
+	header := []xlsx.Cell{xlsx.Bold("Histogram")}
+	values := make(map[float64]map[int]distributionBar)
+	var order []float64
+	for i, roti := range rotis {
+		header = append(header, xlsx.Bold(fmt.Sprintf("%d votes", roti.results.Id)), xlsx.Bold(fmt.Sprintf("%d %%", roti.results.Id)))
+		for _, bar := range roti.results.Distribution {
+			if _, ok := values[bar.Value]; !ok {
+				values[bar.Value] = make(map[int]distributionBar)
+				order = append(order, bar.Value)
+			}
+			values[bar.Value][i] = bar
+		}
+	}
+	summary.AddRow(header...)
+	sort.Float64s(order)
+	for _, value := range order {
+		row := []xlsx.Cell{xlsx.Number(value, xlsx.StyleDecimal)}
+		for i, roti := range rotis {
+			bar, ok := values[value][i]
+			if !ok || roti.results.NumVotes == 0 {
+				row = append(row, xlsx.Cell{}, xlsx.Cell{})
+				continue
+			}
+			row = append(row, xlsx.Number(float64(bar.Count), xlsx.StyleInteger),
+				xlsx.Number(float64(bar.Count)/float64(roti.results.NumVotes), xlsx.StylePercent))
+		}
+		summary.AddRow(row...)
+	}
+
+	votes := workbook.AddSheet("Votes", 10, 38, 8, 60, 20)
+	votes.AddRow(xlsx.Bold("ROTI ID"), xlsx.Bold("Vote ID"), xlsx.Bold("Value"), xlsx.Bold("Feedback"), xlsx.Bold("Timestamp"))
+	for _, roti := range rotis {
+		for _, vote := range roti.votes {
+			timestamp := xlsx.Cell{}
+			if vote.Timestamp != nil {
+				timestamp = xlsx.Date(*vote.Timestamp)
+			}
+			votes.AddRow(xlsx.Number(float64(roti.results.Id), xlsx.StyleInteger), xlsx.Text(vote.ID.String()),
+				xlsx.Number(vote.Value, xlsx.StyleDecimal), xlsx.Text(vote.Feedback), timestamp)
+		}
+	}
+
+	feedbacks := workbook.AddSheet("Feedback", 10, 30, 60, 10, 40)
+	feedbacks.AddRow(xlsx.Bold("ROTI ID"), xlsx.Bold("Prompt"), xlsx.Bold("Feedback"), xlsx.Bold("Upvotes"), xlsx.Bold("Reply"))
+	for _, roti := range rotis {
+		id := xlsx.Number(float64(roti.results.Id), xlsx.StyleInteger)
+		for _, feedback := range roti.results.Supported {
+			feedbacks.AddRow(id, xlsx.Text(defaultPrompt), xlsx.Text(feedback.Text), xlsx.Number(float64(feedback.Upvotes), xlsx.StyleInteger), xlsx.Text(feedback.Reply))
+		}
+		for _, group := range roti.results.Groups {
+			// free text feedbacks are already listed with their upvotes
+			if group.Prompt == defaultPrompt {
+				continue
+			}
+			for _, feedback := range group.Feedbacks {
+				feedbacks.AddRow(id, xlsx.Text(group.Prompt), xlsx.Text(feedback))
+			}
+		}
+		for _, group := range roti.results.FollowUps {
+			for _, answer := range group.Feedbacks {
+				feedbacks.AddRow(id, xlsx.Text("Follow-up: "+group.Prompt), xlsx.Text(answer))
+			}
+		}
+	}
+
+	return &workbook
+}
+
+// getWorkbookROTI returns what can be exported of a ROTI, or an error when its
+// results are hidden
+func getWorkbookROTI(rotiID int) (workbookROTI, error) {
+	currentROTI, err := model.GetROTI(model.ROTIID(rotiID))
+	if err != nil {
+		return workbookROTI{}, model.ErrNoROTIMatchingThisID
+	}
+
+	roti := workbookROTI{results: collectResults(rotiID, currentROTI)}
+	if roti.results.ResultsHidden {
+		return workbookROTI{}, ErrResultsHidden
+	}
+	roti.votes, _, _ = getRawVotes(currentROTI)
+	return roti, nil
+}
+
+// parseROTISelection reads the ROTI IDs of the ids query parameter, which can
+// be repeated or comma separated
+func parseROTISelection(r *http.Request) (rotiIDs []int, err error) {
+	seen := make(map[int]bool)
+	for _, param := range r.URL.Query()["ids"] {
+		for _, value := range strings.Split(param, ",") {
+			rotiID, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || rotiID < 10000 || rotiID > 99999 {
+				return nil, model.ErrInvalidROTIID
+			}
+			if !seen[rotiID] {
+				seen[rotiID] = true
+				rotiIDs = append(rotiIDs, rotiID)
+			}
+		}
+	}
+	if len(rotiIDs) == 0 {
+		return nil, ErrNoROTISelected
+	}
+	if len(rotiIDs) > maxWorkbookROTIs {
+		return nil, ErrTooManyROTIs
+	}
+	return
+}
+
+func writeWorkbook(w http.ResponseWriter, rotis []workbookROTI, filename string) {
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+	if err := buildWorkbook(rotis).Write(w); err != nil {
+		log.Error().Msgf("couldn't write workbook %s: %s", filename, err.Error())
+	}
+}
+
+func downloadXLSXHandler(w http.ResponseWriter, r *http.Request) {
+	rotiID, err := getIDFromURL(r, false)
+	if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	roti, err := getWorkbookROTI(rotiID)
+	if errors.Is(err, ErrResultsHidden) {
+		log.Warn().Msgf("XLSX export of ROTI %d refused: %s", rotiID, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		logErrorAndGoBackHome(err, w, r)
+		return
+	}
+
+	writeWorkbook(w, []workbookROTI{roti}, fmt.Sprintf("roti_%d.xlsx", rotiID))
+}
+
+// downloadSelectionXLSXHandler exports several ROTIs in a single workbook.
+// ROTIs whose results are hidden are left out
+func downloadSelectionXLSXHandler(w http.ResponseWriter, r *http.Request) {
+	rotiIDs, err := parseROTISelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rotis []workbookROTI
+	for _, rotiID := range rotiIDs {
+		roti, err := getWorkbookROTI(rotiID)
+		if err != nil {
+			log.Warn().Msgf("ROTI %d left out of the XLSX export: %s", rotiID, err)
+			continue
+		}
+		rotis = append(rotis, roti)
+	}
+	if len(rotis) == 0 {
+		http.Error(w, ErrNoROTISelected.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeWorkbook(w, rotis, "rotis.xlsx")
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deezer/groroti/internal/model"
+)
+
+func readSheet(t *testing.T, content []byte, name string) string {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := reader.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDownloadXLSXHandlers(t *testing.T) {
+	if err := initDatabaseAndTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	visibleID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "visible", Feedback: true, MinVotes: 1}, 30)
+	visible, err := model.GetROTI(visibleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := visible.AddVoteToROTI(4, "well done"); err != nil {
+		t.Fatal(err)
+	}
+	blindID := model.CreateROTIWithOptions(model.ROTIOptions{Description: "blind", Blind: true}, 30)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetPathValue("rotiid", strconv.Itoa(blindID.Int()))
+	rr := httptest.NewRecorder()
+	downloadXLSXHandler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusForbidden)
+	}
+
+	// hidden ROTIs are left out of selections
+	req = httptest.NewRequest("GET", fmt.Sprintf("/downxlsx?ids=%d,%d", visibleID.Int(), blindID.Int()), nil)
+	rr = httptest.NewRecorder()
+	downloadSelectionXLSXHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+
+	summary := readSheet(t, rr.Body.Bytes(), "xl/worksheets/sheet1.xml")
+	if !strings.Contains(summary, ">visible<") || strings.Contains(summary, ">blind<") {
+		t.Errorf("Summary sheet should only contain the visible ROTI:\n%s", summary)
+	}
+	if votes := readSheet(t, rr.Body.Bytes(), "xl/worksheets/sheet2.xml"); !strings.Contains(votes, ">well done<") {
+		t.Errorf("Votes sheet doesn't contain the vote:\n%s", votes)
+	}
+	if feedbacks := readSheet(t, rr.Body.Bytes(), "xl/worksheets/sheet3.xml"); !strings.Contains(feedbacks, "well done") {
+		t.Errorf("Feedback sheet doesn't contain the feedback:\n%s", feedbacks)
+	}
+
+	var tooMany []string
+	for i := 0; i <= maxWorkbookROTIs; i++ {
+		tooMany = append(tooMany, strconv.Itoa(10000+i))
+	}
+	for _, query := range []string{"", "?ids=123", "?ids=" + strings.Join(tooMany, ",")} {
+		rr := httptest.NewRecorder()
+		downloadSelectionXLSXHandler(rr, httptest.NewRequest("GET", "/downxlsx"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Handler returned wrong status code for %q: got %d want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
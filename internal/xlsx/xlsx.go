@@ -0,0 +1,278 @@
+// Package xlsx writes simple Office Open XML workbooks (.xlsx) in pure Go:
+// text, numbers and dates, a few number formats, bold headers and column widths
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSheetName = errors.New("invalid sheet name")
+	ErrUnsupportedValue = errors.New("unsupported cell value")
+	ErrDuplicatedSheet  = errors.New("duplicated sheet name")
+)
+
+// invalidSheetNameRunes can't be used in sheet names
+const invalidSheetNameRunes = "[]:*?/\\"
+
+// Style is the format of a cell, as declared in styles.xml
+type Style int
+
+const (
+	StyleDefault Style = iota
+	StyleBold
+	// StyleInteger displays numbers without decimals
+	StyleInteger
+	// StyleDecimal displays numbers with 2 decimals
+	StyleDecimal
+	// StylePercent displays ratios (0.25) as percentages (25%)
+	StylePercent
+	StyleDateTime
+)
+
+// excelEpoch is the day 0 of Excel serial dates (taking the 1900 leap year bug into account)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Cell holds a string, a number (int or float64), a time.Time or nil for an empty cell
+type Cell struct {
+	Value any
+	Style Style
+}
+
+// Text returns a string cell
+func Text(value string) Cell {
+	return Cell{Value: value}
+}
+
+// Bold returns a bold string cell, for headers
+func Bold(value string) Cell {
+	return Cell{Value: value, Style: StyleBold}
+}
+
+// Number returns a numeric cell displayed with the given style
+func Number(value float64, style Style) Cell {
+	return Cell{Value: value, Style: style}
+}
+
+// Date returns a date and time cell
+func Date(value time.Time) Cell {
+	return Cell{Value: value, Style: StyleDateTime}
+}
+
+// Sheet is a worksheet of the workbook
+type Sheet struct {
+	Name string
+	// Widths of the columns, in characters. 0 keeps the default width
+	Widths []float64
+	Rows   [][]Cell
+}
+
+// AddRow appends a row to the sheet. A row without cells is left empty
+func (sheet *Sheet) AddRow(cells ...Cell) {
+	sheet.Rows = append(sheet.Rows, cells)
+}
+
+// Workbook is a set of sheets written as a single .xlsx file
+type Workbook struct {
+	Sheets []*Sheet
+}
+
+// AddSheet appends an empty sheet to the workbook
+func (workbook *Workbook) AddSheet(name string, widths ...float64) *Sheet {
+	sheet := &Sheet{Name: name, Widths: widths}
+	workbook.Sheets = append(workbook.Sheets, sheet)
+	return sheet
+}
+
+// ColumnName returns the letters of a column from its 0-based index (0 is A, 26 is AA)
+func ColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func checkSheetNames(sheets []*Sheet) error {
+	names := make(map[string]bool)
+	for _, sheet := range sheets {
+		if sheet.Name == "" || len([]rune(sheet.Name)) > 31 || strings.ContainsAny(sheet.Name, invalidSheetNameRunes) {
+			return fmt.Errorf("%w %q", ErrInvalidSheetName, sheet.Name)
+		}
+		if names[strings.ToLower(sheet.Name)] {
+			return fmt.Errorf("%w %q", ErrDuplicatedSheet, sheet.Name)
+		}
+		names[strings.ToLower(sheet.Name)] = true
+	}
+	return nil
+}
+
+// Write writes the workbook as a .xlsx (zip) file
+func (workbook *Workbook) Write(w io.Writer) error {
+	if err := checkSheetNames(workbook.Sheets); err != nil {
+		return err
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", workbook.contentTypes()},
+		{"_rels/.rels", rootRelationships},
+		{"xl/workbook.xml", workbook.workbookXML()},
+		{"xl/_rels/workbook.xml.rels", workbook.relationships()},
+		{"xl/styles.xml", stylesXML},
+	}
+	for i, sheet := range workbook.Sheets {
+		content, err := sheet.xml()
+		if err != nil {
+			return err
+		}
+		parts = append(parts, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), content})
+	}
+
+	archive := zip.NewWriter(w)
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func escape(text string) string {
+	var buffer bytes.Buffer
+	// invalid XML characters are replaced, so writing to a buffer can't fail
+	_ = xml.EscapeText(&buffer, []byte(text))
+	return buffer.String()
+}
+
+func (workbook *Workbook) contentTypes() string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	sb.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	sb.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range workbook.Sheets {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	sb.WriteString(`</Types>`)
+	return sb.String()
+}
+
+const rootRelationships = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func (workbook *Workbook) workbookXML() string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range workbook.Sheets {
+		fmt.Fprintf(&sb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheet.Name), i+1, i+1)
+	}
+	sb.WriteString(`</sheets></workbook>`)
+	return sb.String()
+}
+
+func (workbook *Workbook) relationships() string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range workbook.Sheets {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(workbook.Sheets)+1)
+	sb.WriteString(`</Relationships>`)
+	return sb.String()
+}
+
+// stylesXML declares the styles in the order of the Style constants
+const stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="6">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="9" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+func (sheet *Sheet) xml() (string, error) {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	if len(sheet.Widths) > 0 {
+		sb.WriteString(`<cols>`)
+		for i, width := range sheet.Widths {
+			if width > 0 {
+				fmt.Fprintf(&sb, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(width, 'f', -1, 64))
+			}
+		}
+		sb.WriteString(`</cols>`)
+	}
+
+	sb.WriteString(`<sheetData>`)
+	for i, row := range sheet.Rows {
+		if len(row) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			ref := ColumnName(j) + strconv.Itoa(i+1)
+			if err := writeCell(&sb, ref, cell); err != nil {
+				return "", fmt.Errorf("%s!%s: %w", sheet.Name, ref, err)
+			}
+		}
+		sb.WriteString(`</row>`)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	return sb.String(), nil
+}
+
+func writeCell(sb *strings.Builder, ref string, cell Cell) error {
+	var number float64
+	switch value := cell.Value.(type) {
+	case nil:
+		return nil
+	case string:
+		// inline strings are never evaluated as formulas
+		fmt.Fprintf(sb, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, cell.Style, escape(value))
+		return nil
+	case int:
+		number = float64(value)
+	case float64:
+		number = value
+	case time.Time:
+		number = value.Sub(excelEpoch).Hours() / 24
+	default:
+		return fmt.Errorf("%w %T", ErrUnsupportedValue, cell.Value)
+	}
+	fmt.Fprintf(sb, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.Style, strconv.FormatFloat(number, 'f', -1, 64))
+	return nil
+}
@@ -0,0 +1,121 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumnName(t *testing.T) {
+	testCases := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for index, expected := range testCases {
+		if name := ColumnName(index); name != expected {
+			t.Errorf("Got %s for column %d but expected %s", name, index, expected)
+		}
+	}
+}
+
+func readParts(t *testing.T, content []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every part must be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %s", file.Name, err)
+			}
+		}
+		parts[file.Name] = string(data)
+	}
+	return parts
+}
+
+func TestWrite(t *testing.T) {
+	var workbook Workbook
+	summary := workbook.AddSheet("Summary", 20, 0, 12)
+	summary.AddRow(Bold("Description"), Bold("Votes"), Bold("Average"))
+	summary.AddRow(Text(`=1+1 & <b>"quoted"</b>`), Number(3, StyleInteger), Number(3.6667, StyleDecimal))
+	summary.AddRow()
+	summary.AddRow(Date(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)), Number(0.25, StylePercent), Cell{})
+	workbook.AddSheet("Votes")
+
+	var buffer bytes.Buffer
+	if err := workbook.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	parts := readParts(t, buffer.Bytes())
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("Part %s is missing", name)
+		}
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	expected := []string{
+		`<col min="1" max="1" width="20" customWidth="1"/><col min="3" max="3" width="12" customWidth="1"/>`,
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">Description</t></is></c>`,
+		`<t xml:space="preserve">=1+1 &amp; &lt;b&gt;&#34;quoted&#34;&lt;/b&gt;</t>`,
+		`<c r="B2" s="2"><v>3</v></c>`,
+		`<c r="C2" s="3"><v>3.6667</v></c>`,
+		`<row r="4"><c r="A4" s="5"><v>45352.5</v></c><c r="B4" s="4"><v>0.25</v></c></row>`,
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(sheet, fragment) {
+			t.Errorf("Sheet doesn't contain %s:\n%s", fragment, sheet)
+		}
+	}
+	if strings.Contains(sheet, `<row r="3">`) {
+		t.Errorf("Empty rows shouldn't be written")
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Votes" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("Votes sheet not declared in workbook:\n%s", parts["xl/workbook.xml"])
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		sheets      []string
+		value       any
+		expectedErr error
+	}{
+		{"Invalid sheet name", []string{"a/b"}, "", ErrInvalidSheetName},
+		{"Too long sheet name", []string{strings.Repeat("a", 32)}, "", ErrInvalidSheetName},
+		{"Duplicated sheet", []string{"Votes", "votes"}, "", ErrDuplicatedSheet},
+		{"Unsupported value", []string{"Votes"}, []int{1}, ErrUnsupportedValue},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var workbook Workbook
+			for _, name := range tc.sheets {
+				workbook.AddSheet(name).AddRow(Cell{Value: tc.value})
+			}
+			if err := workbook.Write(io.Discard); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Got %v but expected %v", err, tc.expectedErr)
+			}
+		})
+	}
+}